@@ -0,0 +1,237 @@
+// Package bench measures the throughput of the packaging stages on the
+// current machine with synthetic data: compressing the source into the
+// inner ZIP with several worker counts, hashing, encrypting and writing the
+// package with several buffer sizes.
+//
+// The source is generated by the synthetic package in a temporary folder
+// from a fixed seed, half of it compressible text and half random data, so
+// that results of different machines and versions are comparable.
+package bench
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/MANCHTOOLS/open-package/crypto"
+	"github.com/MANCHTOOLS/open-package/packager"
+	"github.com/MANCHTOOLS/open-package/synthetic"
+)
+
+// Defaults of Options
+const (
+	DefaultSize     = 64 << 20
+	DefaultFileSize = 256 << 10
+)
+
+// DefaultBufferSizes are the buffer sizes the write stage is measured with
+var DefaultBufferSizes = []int{32 << 10, 256 << 10, 1 << 20, 4 << 20}
+
+// Options configures a benchmark
+type Options struct {
+	// Size is the total size of the synthetic source in bytes (optional,
+	// defaults to DefaultSize)
+	Size int64
+	// FileSize is the size of each synthetic file in bytes (optional,
+	// defaults to DefaultFileSize)
+	FileSize int64
+	// Workers are the worker counts the zip stage is measured with
+	// (optional, defaults to powers of two up to the number of CPUs)
+	Workers []int
+	// BufferSizes are the buffer sizes the write stage is measured with
+	// (optional, defaults to DefaultBufferSizes)
+	BufferSizes []int
+	// Dir is the folder for the synthetic source and the written package,
+	// e.g. on the disk of the output folder (optional, defaults to the
+	// temporary folder)
+	Dir string
+}
+
+// Measurement is the time a stage took for a number of bytes
+type Measurement struct {
+	// Workers is the worker count of the zip stage
+	Workers int `json:"workers,omitempty"`
+	// BufferSize is the buffer size of the write stage
+	BufferSize int `json:"bufferSize,omitempty"`
+	// Bytes is the number of bytes processed
+	Bytes int64 `json:"bytes"`
+	// Duration is the time taken
+	Duration time.Duration `json:"duration"`
+}
+
+// Throughput returns the bytes processed per second
+func (m Measurement) Throughput() float64 {
+	if m.Duration <= 0 {
+		return 0
+	}
+	return float64(m.Bytes) / m.Duration.Seconds()
+}
+
+// Result is the outcome of a benchmark
+type Result struct {
+	// Tool is the tool name and version, set by the caller for reports
+	Tool string `json:"tool,omitempty"`
+	// GOOS, GOARCH, CPUs and GoVersion describe the machine and build
+	GOOS      string `json:"goos"`
+	GOARCH    string `json:"goarch"`
+	CPUs      int    `json:"cpus"`
+	GoVersion string `json:"goVersion"`
+	// Size and Files describe the synthetic source
+	Size  int64 `json:"size"`
+	Files int   `json:"files"`
+	// Zip are the measurements of the inner ZIP, one per worker count
+	Zip []Measurement `json:"zip"`
+	// Hash is the SHA256 digest of the inner ZIP
+	Hash Measurement `json:"hash"`
+	// Encrypt is the encryption of the inner ZIP
+	Encrypt Measurement `json:"encrypt"`
+	// Write are the measurements of writing the encrypted content, one
+	// per buffer size
+	Write []Measurement `json:"write"`
+	// Workers is the recommended worker count: the smallest within 10% of
+	// the fastest
+	Workers int `json:"recommendedWorkers"`
+	// BufferSize is the recommended write buffer size, chosen the same way
+	BufferSize int `json:"recommendedBufferSize"`
+}
+
+// Run generates the synthetic source and measures the stages
+func Run(opts Options) (*Result, error) {
+	if opts.Size <= 0 {
+		opts.Size = DefaultSize
+	}
+	if opts.FileSize <= 0 {
+		opts.FileSize = DefaultFileSize
+	}
+	if len(opts.Workers) == 0 {
+		opts.Workers = defaultWorkers(runtime.NumCPU())
+	}
+	if len(opts.BufferSizes) == 0 {
+		opts.BufferSizes = DefaultBufferSizes
+	}
+
+	dir, err := os.MkdirTemp(opts.Dir, "open-package-bench-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create benchmark folder: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	result := &Result{
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		GoVersion: runtime.Version(),
+	}
+	tree, err := synthetic.Generate(filepath.Join(dir, "source"), synthetic.Options{
+		Files:        int((opts.Size + opts.FileSize - 1) / opts.FileSize),
+		MinSize:      opts.FileSize,
+		MaxSize:      opts.FileSize,
+		Distribution: synthetic.DistributionFixed,
+		Depth:        2,
+		Seed:         1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate source: %w", err)
+	}
+	result.Size, result.Files = tree.Size, tree.Files
+	sourceDir := filepath.Join(dir, "source")
+
+	var innerZip []byte
+	for _, workers := range opts.Workers {
+		start := time.Now()
+		data, err := zipSource(sourceDir, workers)
+		if err != nil {
+			return nil, err
+		}
+		result.Zip = append(result.Zip, Measurement{Workers: workers, Bytes: tree.Size, Duration: time.Since(start)})
+		innerZip = data
+	}
+
+	start := time.Now()
+	sha256.Sum256(innerZip)
+	result.Hash = Measurement{Bytes: int64(len(innerZip)), Duration: time.Since(start)}
+
+	start = time.Now()
+	_, encrypted, err := crypto.Encrypt(innerZip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	result.Encrypt = Measurement{Bytes: int64(len(innerZip)), Duration: time.Since(start)}
+
+	for _, size := range opts.BufferSizes {
+		start := time.Now()
+		if err := writeFile(filepath.Join(dir, "package.bin"), encrypted, size); err != nil {
+			return nil, err
+		}
+		result.Write = append(result.Write, Measurement{BufferSize: size, Bytes: int64(len(encrypted)), Duration: time.Since(start)})
+	}
+
+	result.Workers = result.Zip[fastest(result.Zip)].Workers
+	result.BufferSize = result.Write[fastest(result.Write)].BufferSize
+	return result, nil
+}
+
+// defaultWorkers returns the powers of two up to cpus, and cpus itself
+func defaultWorkers(cpus int) []int {
+	var workers []int
+	for n := 1; n < cpus; n *= 2 {
+		workers = append(workers, n)
+	}
+	return append(workers, cpus)
+}
+
+// fastest returns the index of the first measurement within 10% of the
+// highest throughput, which favors fewer workers and smaller buffers
+func fastest(measurements []Measurement) int {
+	best := 0.0
+	for _, m := range measurements {
+		if t := m.Throughput(); t > best {
+			best = t
+		}
+	}
+	for i, m := range measurements {
+		if m.Throughput() >= 0.9*best {
+			return i
+		}
+	}
+	return 0
+}
+
+// zipSource creates the inner ZIP of dir with the packaging pipeline
+func zipSource(dir string, workers int) ([]byte, error) {
+	rc, _, err := packager.ZipSource(dir, packager.Options{Quiet: true, Workers: workers})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create inner ZIP: %w", err)
+	}
+	return data, nil
+}
+
+// writeFile writes data to path in chunks of bufferSize and syncs it to
+// disk, as the write stage of a build would
+func writeFile(path string, data []byte, bufferSize int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for len(data) > 0 {
+		n := min(bufferSize, len(data))
+		if _, err := f.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
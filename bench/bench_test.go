@@ -0,0 +1,81 @@
+package bench
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-bench-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	result, err := Run(Options{
+		Size:        1 << 20,
+		FileSize:    100 << 10,
+		Workers:     []int{1, 2},
+		BufferSizes: []int{4 << 10, 64 << 10},
+		Dir:         tempDir,
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Files != 11 {
+		t.Errorf("Expected 11 files, got %d", result.Files)
+	}
+	if len(result.Zip) != 2 || len(result.Write) != 2 {
+		t.Fatalf("Expected a measurement per worker count and buffer size, got %+v", result)
+	}
+	if result.Zip[1].Workers != 2 || result.Write[1].BufferSize != 64<<10 {
+		t.Errorf("Unexpected measurements: %+v", result)
+	}
+	if result.Workers != 1 && result.Workers != 2 {
+		t.Errorf("Expected a measured worker count to be recommended, got %d", result.Workers)
+	}
+	if result.Encrypt.Bytes == 0 || result.Encrypt.Bytes >= result.Size {
+		t.Errorf("Expected the text files to compress, got an inner ZIP of %d bytes", result.Encrypt.Bytes)
+	}
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to read temp dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected the benchmark folder to be removed, got %d entries", len(entries))
+	}
+}
+
+func TestDefaultWorkers(t *testing.T) {
+	tests := map[int][]int{
+		1: {1},
+		2: {1, 2},
+		6: {1, 2, 4, 6},
+		8: {1, 2, 4, 8},
+	}
+	for cpus, expected := range tests {
+		got := defaultWorkers(cpus)
+		if len(got) != len(expected) {
+			t.Errorf("defaultWorkers(%d) = %v, expected %v", cpus, got, expected)
+			continue
+		}
+		for i := range got {
+			if got[i] != expected[i] {
+				t.Errorf("defaultWorkers(%d) = %v, expected %v", cpus, got, expected)
+				break
+			}
+		}
+	}
+}
+
+func TestFastest(t *testing.T) {
+	measurements := []Measurement{
+		{Workers: 1, Bytes: 1000, Duration: 100},
+		{Workers: 2, Bytes: 1000, Duration: 55},
+		{Workers: 4, Bytes: 1000, Duration: 50},
+	}
+	if i := fastest(measurements); measurements[i].Workers != 2 {
+		t.Errorf("Expected 2 workers within 10%% of the fastest, got %d", measurements[i].Workers)
+	}
+}
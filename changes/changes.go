@@ -0,0 +1,257 @@
+// Package changes compares the files of a source folder with those of a
+// previous build, to document what an update changes before it is
+// packaged.
+//
+// The previous build is described by a file manifest, which lists the
+// path, size and SHA256 hash of every file. Manifests are written next to
+// packages (see ManifestSuffix) or taken from a previous .intunewin file.
+package changes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// ManifestSuffix is appended to the package path for its file manifest
+const ManifestSuffix = ".files.json"
+
+// File is a file of a manifest
+type File struct {
+	// Path is relative to the source folder, with forward slashes
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest lists the files of a build, sorted by path
+type Manifest struct {
+	Files []File `json:"files"`
+}
+
+// Kinds of changes
+const (
+	Added    = "added"
+	Removed  = "removed"
+	Modified = "modified"
+)
+
+// Change is a single file that differs between two manifests
+type Change struct {
+	Kind string
+	Path string
+	// OldSize and NewSize are zero for added and removed files respectively
+	OldSize, NewSize int64
+}
+
+// String formats the change as a diff line
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s (%d bytes)", c.Path, c.NewSize)
+	case Removed:
+		return fmt.Sprintf("- %s (%d bytes)", c.Path, c.OldSize)
+	default:
+		return fmt.Sprintf("~ %s (%d -> %d bytes)", c.Path, c.OldSize, c.NewSize)
+	}
+}
+
+// Report is the result of a comparison
+type Report struct {
+	Changes   []Change
+	Unchanged int
+}
+
+// Count returns the number of changes of a kind
+func (r *Report) Count(kind string) int {
+	n := 0
+	for _, c := range r.Changes {
+		if c.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// Compare lists the files added, removed and modified from old to new
+func Compare(old, new *Manifest) *Report {
+	oldFiles := make(map[string]File, len(old.Files))
+	for _, f := range old.Files {
+		oldFiles[f.Path] = f
+	}
+
+	r := &Report{}
+	for _, f := range new.Files {
+		prev, ok := oldFiles[f.Path]
+		delete(oldFiles, f.Path)
+		switch {
+		case !ok:
+			r.Changes = append(r.Changes, Change{Kind: Added, Path: f.Path, NewSize: f.Size})
+		case prev.SHA256 != f.SHA256 || prev.Size != f.Size:
+			r.Changes = append(r.Changes, Change{Kind: Modified, Path: f.Path, OldSize: prev.Size, NewSize: f.Size})
+		default:
+			r.Unchanged++
+		}
+	}
+	for _, f := range oldFiles {
+		r.Changes = append(r.Changes, Change{Kind: Removed, Path: f.Path, OldSize: f.Size})
+	}
+
+	sort.Slice(r.Changes, func(i, j int) bool {
+		return r.Changes[i].Path < r.Changes[j].Path
+	})
+	return r
+}
+
+// FromDir hashes the files of a source folder. Entries for which skip
+// returns true are left out, e.g. packager.IsExcluded to match packages
+// built without Options.IncludeHidden. skip may be nil.
+func FromDir(dir string, skip func(fs.DirEntry) bool) (*Manifest, error) {
+	m := &Manifest{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if skip != nil && skip(d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			return err
+		}
+		hash := sha256.New()
+		size, err := io.Copy(hash, file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, File{Path: filepath.ToSlash(relPath), Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", dir, err)
+	}
+	m.sort()
+	return m, nil
+}
+
+// FromInnerZip hashes the files of a decrypted package content. The
+// source folder name that prefixes all entries is removed.
+func FromInnerZip(innerZip []byte) (*Manifest, error) {
+	zr, err := unpacker.ReadInnerZip(innerZip)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		hash := sha256.New()
+		size, err := io.Copy(hash, rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+
+		path := f.Name
+		if i := strings.Index(path, "/"); i >= 0 {
+			path = path[i+1:]
+		}
+		m.Files = append(m.Files, File{Path: path, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))})
+	}
+	m.sort()
+	return m, nil
+}
+
+// FromPackage decrypts a .intunewin file and hashes its files
+func FromPackage(path string) (*Manifest, error) {
+	pkg, err := unpacker.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	innerZip, err := pkg.Decrypt()
+	if err != nil {
+		return nil, err
+	}
+	return FromInnerZip(innerZip)
+}
+
+// Load reads a manifest file, or the files of a .intunewin package
+func Load(path string) (*Manifest, error) {
+	if strings.EqualFold(filepath.Ext(path), ".intunewin") {
+		return FromPackage(path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Save writes the manifest as JSON
+func (m *Manifest) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Digest returns the hex SHA256 digest of the paths, sizes and hashes of
+// the files. Unlike the digest of a package it does not change when the
+// files are packaged again unchanged.
+func (m *Manifest) Digest() string {
+	h := sha256.New()
+	for _, f := range m.Files {
+		fmt.Fprintf(h, "%s\x00%d\x00%s\n", f.Path, f.Size, f.SHA256)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (m *Manifest) sort() {
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+}
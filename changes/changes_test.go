@@ -0,0 +1,131 @@
+package changes
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MANCHTOOLS/open-package/metadata"
+	"github.com/MANCHTOOLS/open-package/packager"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+func TestCompare(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-changes-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "lib"), 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	files := map[string]string{
+		"install.exe":  "exe",
+		"lib/core.dll": "core",
+		"lib/old.dll":  "old",
+		"readme.txt":   "readme",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	packagePath, err := packager.New(packager.Options{
+		SourceDir: sourceDir,
+		SetupFile: "install.exe",
+		OutputDir: tempDir,
+		Quiet:     true,
+		JobID:     "job1",
+		BuildInfo: true,
+	}).CreatePackage()
+	if err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+
+	// A manifest saved from the package loads like the package itself
+	previous, err := Load(packagePath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	manifestPath := packagePath + ManifestSuffix
+	if err := previous.Save(manifestPath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	saved, err := Load(manifestPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(saved.Files) != 4 || len(Compare(previous, saved).Changes) != 0 {
+		t.Errorf("Unexpected saved manifest: %+v", saved.Files)
+	}
+	unchanged, err := FromDir(sourceDir, packager.IsExcluded)
+	if err != nil {
+		t.Fatalf("FromDir failed: %v", err)
+	}
+	if unchanged.Digest() != previous.Digest() {
+		t.Errorf("Digest of the source differs from the digest of its package")
+	}
+
+	// Both ZIP comments carry the digest recorded in the build registry
+	pkg, err := unpacker.Open(packagePath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	innerZip, err := pkg.Decrypt()
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(innerZip), int64(len(innerZip)))
+	if err != nil {
+		t.Fatalf("Failed to read inner ZIP: %v", err)
+	}
+	for _, comment := range []string{pkg.Comment, zr.Comment} {
+		info, ok := metadata.ParseBuildInfo(comment)
+		if !ok || info.JobID != "job1" || info.SourceSHA256 != previous.Digest() {
+			t.Errorf("Unexpected build info %q, expected source digest %s", comment, previous.Digest())
+		}
+	}
+
+	// Update the source
+	if err := os.WriteFile(filepath.Join(sourceDir, "lib", "core.dll"), []byte("core v2"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	if err := os.Remove(filepath.Join(sourceDir, "lib", "old.dll")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "lib", "new.dll"), []byte("new"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "Thumbs.db"), []byte("junk"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	current, err := FromDir(sourceDir, packager.IsExcluded)
+	if err != nil {
+		t.Fatalf("FromDir failed: %v", err)
+	}
+	if current.Digest() == previous.Digest() {
+		t.Errorf("Digest did not change with the source")
+	}
+	report := Compare(saved, current)
+	var lines []string
+	for _, c := range report.Changes {
+		lines = append(lines, c.String())
+	}
+	expected := "~ lib/core.dll (4 -> 7 bytes),+ lib/new.dll (3 bytes),- lib/old.dll (3 bytes)"
+	if got := strings.Join(lines, ","); got != expected {
+		t.Errorf("Unexpected changes: %s", got)
+	}
+	if report.Unchanged != 2 {
+		t.Errorf("Expected 2 unchanged files, got %d", report.Unchanged)
+	}
+	if report.Count(Added) != 1 || report.Count(Removed) != 1 || report.Count(Modified) != 1 {
+		t.Errorf("Unexpected counts: %+v", report.Changes)
+	}
+}
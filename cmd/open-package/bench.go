@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/bench"
+)
+
+// runBench measures the throughput of the packaging stages with synthetic
+// data and recommends a worker count
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	size := fs.Int64("size", bench.DefaultSize>>20, "MB of synthetic source data")
+	fileSize := fs.Int64("file-size", bench.DefaultFileSize>>10, "KB per synthetic file")
+	workers := fs.String("workers", "", "Comma-separated worker counts to measure (default: powers of two up to the number of CPUs)")
+	dir := fs.String("dir", "", "Folder for the synthetic source and package, e.g. on the output disk (default: temporary folder)")
+	jsonOutput := fs.Bool("json", false, "Print the results as JSON, e.g. for performance reports")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s bench [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Measures zip, hash, encrypt and write throughput on this machine with synthetic data\n")
+		fmt.Fprintf(os.Stderr, "and recommends a worker count for pack.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	opts := bench.Options{Size: *size << 20, FileSize: *fileSize << 10, Dir: *dir}
+	if *workers != "" {
+		for _, s := range strings.Split(*workers, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "Error: invalid worker count %q\n", s)
+				os.Exit(1)
+			}
+			opts.Workers = append(opts.Workers, n)
+		}
+	}
+	if !*jsonOutput {
+		fmt.Printf("Generating %s of synthetic data...\n", formatSize(opts.Size))
+	}
+	result, err := bench.Run(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	result.Tool = "open-package " + version
+
+	if *jsonOutput {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("Tool:                   %s\n", result.Tool)
+	fmt.Printf("Machine:                %s/%s, %d CPUs, %s\n", result.GOOS, result.GOARCH, result.CPUs, result.GoVersion)
+	fmt.Printf("Source:                 %d files, %s\n", result.Files, formatSize(result.Size))
+	fmt.Println()
+	for _, m := range result.Zip {
+		fmt.Printf("%-24s%s\n", fmt.Sprintf("Zip, %d workers", m.Workers), formatMeasurement(m))
+	}
+	fmt.Printf("%-24s%s\n", "Hash (SHA256)", formatMeasurement(result.Hash))
+	fmt.Printf("%-24s%s\n", "Encrypt (AES-256-CBC)", formatMeasurement(result.Encrypt))
+	for _, m := range result.Write {
+		fmt.Printf("%-24s%s\n", "Write, "+formatBufferSize(m.BufferSize)+" buffer", formatMeasurement(m))
+	}
+	fmt.Printf("\nRecommended:            -workers %d, write buffer %s\n", result.Workers, formatBufferSize(result.BufferSize))
+}
+
+// formatMeasurement formats the throughput and duration of a stage
+func formatMeasurement(m bench.Measurement) string {
+	return fmt.Sprintf("%8.1f MiB/s (%s)", m.Throughput()/(1<<20), m.Duration.Round(100_000))
+}
+
+// formatBufferSize formats a buffer size in KiB or MiB
+func formatBufferSize(size int) string {
+	if size >= 1<<20 && size%(1<<20) == 0 {
+		return fmt.Sprintf("%d MiB", size>>20)
+	}
+	return fmt.Sprintf("%d KiB", size>>10)
+}
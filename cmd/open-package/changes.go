@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MANCHTOOLS/open-package/changes"
+	"github.com/MANCHTOOLS/open-package/packager"
+)
+
+// runChanges compares a source folder with a previous build
+func runChanges(args []string) {
+	fs := flag.NewFlagSet("changes", flag.ExitOnError)
+	includeHidden := fs.Bool("include-hidden", false, "Include junk files and hidden or system files, as with pack")
+	save := fs.String("save", "", "Also write the file manifest of the source folder to this file")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s changes [options] <source folder> <previous.intunewin | previous%s>\n\n", os.Args[0], changes.ManifestSuffix)
+		fmt.Fprintf(os.Stderr, "Lists the files added, removed and modified since a previous build.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	previous, err := changes.Load(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	skip := packager.IsExcluded
+	if *includeHidden {
+		skip = nil
+	}
+	current, err := changes.FromDir(fs.Arg(0), skip)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	if *save != "" {
+		if err := current.Save(*save); err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+	}
+
+	report := changes.Compare(previous, current)
+	fmt.Printf("Added:      %d\n", report.Count(changes.Added))
+	fmt.Printf("Removed:    %d\n", report.Count(changes.Removed))
+	fmt.Printf("Modified:   %d\n", report.Count(changes.Modified))
+	fmt.Printf("Unchanged:  %d\n", report.Unchanged)
+	if len(report.Changes) > 0 {
+		fmt.Println()
+	}
+	for _, c := range report.Changes {
+		fmt.Println(c)
+	}
+}
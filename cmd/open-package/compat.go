@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MANCHTOOLS/open-package/compat"
+)
+
+// runCompat compares a package of the official Win32 Content Prep Tool
+// with a package created by this tool
+func runCompat(args []string) {
+	fs := flag.NewFlagSet("compat check", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s compat check <official.intunewin> <open-package.intunewin>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Compares the structure, Detection.xml fields and decrypted content of a package\n")
+		fmt.Fprintf(os.Stderr, "created by IntuneWinAppUtil with one created by this tool from the same source.\n")
+		fmt.Fprintf(os.Stderr, "Exits with status 2 if differences are found.\n")
+	}
+
+	if len(args) == 0 || args[0] != "check" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	fs.Parse(args[1:])
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	report, err := compat.Compare(fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+
+	if report.Compatible() {
+		fmt.Println("Packages are compatible: no differences found")
+		return
+	}
+
+	fmt.Printf("Found %d difference(s):\n", len(report.Differences))
+	for _, d := range report.Differences {
+		fmt.Printf("  %s\n", d)
+	}
+	os.Exit(2)
+}
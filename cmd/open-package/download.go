@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/MANCHTOOLS/open-package/lobapp"
+	"github.com/MANCHTOOLS/open-package/packager"
+)
+
+// runWrapDownload creates a package that downloads its payload at
+// install time, for content over the Intune limits
+func runWrapDownload(args []string) {
+	fs := flag.NewFlagSet("wrap-download", flag.ExitOnError)
+	payloadURL := fs.String("url", "", "HTTPS URL of the payload (required)")
+	digest := fs.String("sha256", "", "SHA256 digest of the payload, verified before installing (required)")
+	name := fs.String("name", "", "Application name and output file name (required)")
+	fileName := fs.String("file", "", "File name of the downloaded payload (default: last segment of the URL)")
+	command := fs.String("command", "", "Install command run in the download folder (default for MSI payloads: msiexec /i <file> /qn)")
+	outputDir := fs.String("output", ".", "Output directory for the .intunewin file")
+	quiet := fs.Bool("quiet", false, "Suppress progress output")
+	keepTemp := fs.Bool("keep-temp", false, "Keep temporary files for debugging and print their locations")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s wrap-download [options] -name <app> -url <url> -sha256 <digest>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Creates a small package with a script that downloads the payload at install time,\n")
+		fmt.Fprintf(os.Stderr, "verifies its SHA256 digest, extracts ZIP payloads and runs the install command.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *payloadURL == "" || *digest == "" || *name == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	absOutputDir, err := filepath.Abs(*outputDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving output path: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(absOutputDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	jobID, err := newJobID()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+
+	temp, cleanup := trackTemp(*keepTemp)
+	defer cleanup()
+	pkg := packager.New(packager.Options{
+		OutputDir: absOutputDir,
+		Name:      *name,
+		Quiet:     *quiet,
+		JobID:     jobID,
+		Temp:      temp,
+	})
+	outputPath, err := pkg.CreateDownloadPackage(packager.Download{
+		URL:      *payloadURL,
+		SHA256:   *digest,
+		FileName: *fileName,
+		Command:  *command,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+
+	if *quiet {
+		fmt.Println(outputPath)
+		return
+	}
+	fmt.Println()
+	fmt.Printf("Successfully created: %s\n", outputPath)
+	fmt.Printf("Install command:      %s\n", lobapp.InstallCommand(packager.DownloadScriptName))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MANCHTOOLS/open-package/escrow"
+)
+
+// runEscrow creates escrow keys and recovers escrowed Detection.xml files
+func runEscrow(args []string) {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s escrow keygen <key file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s escrow recover -key <key file> [-output <file>] <package.intunewin>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "keygen creates a new escrow key for use with -escrow-key.\n")
+		fmt.Fprintf(os.Stderr, "recover decrypts the escrowed Detection.xml of a package.\n")
+	}
+
+	if len(args) == 0 {
+		usage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "keygen":
+		if len(args) != 2 {
+			usage()
+			os.Exit(1)
+		}
+		key, err := escrow.GenerateKey(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		fmt.Printf("Created escrow key %s (%s)\n", args[1], key.Fingerprint())
+	case "recover":
+		fs := flag.NewFlagSet("escrow recover", flag.ExitOnError)
+		keyFile := fs.String("key", "", "Escrow key file (required)")
+		output := fs.String("output", "", "File to write Detection.xml to (default: standard output)")
+		fs.Usage = usage
+		fs.Parse(args[1:])
+		if *keyFile == "" || fs.NArg() != 1 {
+			usage()
+			os.Exit(1)
+		}
+
+		key, err := escrow.LoadKey(*keyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		detectionXML, err := escrow.Recover(key, fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+
+		if *output == "" {
+			os.Stdout.Write(detectionXML)
+			return
+		}
+		if err := os.WriteFile(*output, detectionXML, 0600); err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+		os.Exit(1)
+	}
+}
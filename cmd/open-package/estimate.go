@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MANCHTOOLS/open-package/packager"
+)
+
+// runEstimate predicts the package sizes of a source folder without
+// building the package
+func runEstimate(args []string) {
+	fs := flag.NewFlagSet("estimate", flag.ExitOnError)
+	sampleSize := fs.Int("sample-size", packager.DefaultSampleSize>>20, "MB of source data compressed for the estimate")
+	includeHidden := fs.Bool("include-hidden", false, "Include junk files and hidden or system files, as with pack")
+	links := fs.String("links", packager.LinkFollow, "Symbolic links and junctions: follow or skip, as with pack")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s estimate [options] <source folder>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Predicts the package size and the disk space needed on devices by compressing a sample of the source.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	pkg := packager.New(packager.Options{
+		SourceDir:     fs.Arg(0),
+		IncludeHidden: *includeHidden,
+		Links:         *links,
+	})
+	est, err := pkg.Estimate(int64(*sampleSize) << 20)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+
+	sampled := "all"
+	if est.SampledSize < est.SourceSize {
+		sampled = fmt.Sprintf("%.1f%%", 100*float64(est.SampledSize)/float64(est.SourceSize))
+	}
+	fmt.Printf("Files:                  %d in %d folder(s)\n", est.Files, est.Dirs)
+	fmt.Printf("Source size:            %s\n", formatSize(est.SourceSize))
+	fmt.Printf("Sampled:                %s\n", sampled)
+	fmt.Printf("Package size:           %s\n", formatSize(est.PackageSize))
+	fmt.Printf("Unencrypted size:       %s (IME cache)\n", formatSize(est.ContentSize))
+	fmt.Printf("Disk space on device:   %s (package, decrypted content and installed files)\n", formatSize(est.DeviceSize))
+	if est.PackageSize > packager.MaxContentSize {
+		fmt.Fprintf(os.Stderr, "Warning: the package exceeds the Intune limit of %s; see advise-split for splitting the content\n", formatSize(packager.MaxContentSize))
+	}
+}
+
+// formatSize formats a byte count with a binary unit
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d bytes", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB (%d bytes)", float64(size)/float64(div), "KMGTPE"[exp], size)
+}
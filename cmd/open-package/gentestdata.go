@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/synthetic"
+)
+
+// runGenTestData creates a synthetic source tree for reproducing issues
+// without the original installers
+func runGenTestData(args []string) {
+	fs := flag.NewFlagSet("gen-testdata", flag.ExitOnError)
+	files := fs.Int("files", synthetic.DefaultFiles, "Number of files")
+	minSize := fs.Int64("min-size", synthetic.DefaultMinSize>>10, "Smallest file size in KB")
+	maxSize := fs.Int64("max-size", synthetic.DefaultMaxSize>>10, "Largest file size in KB")
+	distribution := fs.String("distribution", synthetic.DistributionLog, "File size distribution: "+strings.Join(synthetic.Distributions, ", "))
+	depth := fs.Int("depth", synthetic.DefaultDepth, "Deepest folder level of files (0 puts all files in the root folder)")
+	width := fs.Int("width", 4, "Subfolders per folder")
+	unicode := fs.Bool("unicode", false, "Use non-ASCII folder and file names (accented, decomposed, Cyrillic, Greek, CJK, emoji)")
+	content := fs.String("content", synthetic.ContentMixed, "File content: "+strings.Join(synthetic.Contents, ", "))
+	setupFile := fs.String("setup", "install.cmd", "Setup file written to the root folder (empty for none)")
+	seed := fs.Int64("seed", 1, "Seed of the generated tree; the same options and seed create the same files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s gen-testdata [options] <folder>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Creates a synthetic source tree, so that performance and correctness issues can be\n")
+		fmt.Fprintf(os.Stderr, "reproduced without sharing proprietary installers.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	dir := fs.Arg(0)
+	tree, err := synthetic.Generate(dir, synthetic.Options{
+		Files:        *files,
+		MinSize:      *minSize << 10,
+		MaxSize:      *maxSize << 10,
+		Distribution: *distribution,
+		Depth:        *depth,
+		FolderWidth:  *width,
+		Unicode:      *unicode,
+		Content:      *content,
+		SetupFile:    *setupFile,
+		Seed:         *seed,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Created %d files in %d folder(s), %s\n", tree.Files, tree.Dirs, formatSize(tree.Size))
+	if *setupFile != "" {
+		fmt.Printf("Package it with: %s -source %s -setup %s\n", os.Args[0], dir, *setupFile)
+	}
+}
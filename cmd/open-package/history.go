@@ -0,0 +1,197 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MANCHTOOLS/open-package/changes"
+	"github.com/MANCHTOOLS/open-package/registry"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// runHistory lists the builds recorded in the registry
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	registryFile := fs.String("registry", "", "Registry file (default: "+registryHint()+")")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s history [options] [app name]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Lists the builds recorded with pack -record, oldest first.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	reg := openRegistry(*registryFile)
+	builds := reg.History(fs.Arg(0))
+	if len(builds) == 0 {
+		fmt.Printf("No builds recorded in %s\n", reg.Path())
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tJOB\tNAME\tVERSION\tARCH\tSTATUS\tPACKAGE SHA256")
+	for _, b := range builds {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%.12s\n", b.Time.Local().Format(time.DateTime), b.JobID, b.Name, b.Version, b.Architecture, b.UploadStatus, b.PackageSHA256)
+	}
+	w.Flush()
+}
+
+// runShow prints a build recorded in the registry, or records its upload
+func runShow(args []string) {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	registryFile := fs.String("registry", "", "Registry file (default: "+registryHint()+")")
+	uploaded := fs.String("uploaded", "", "Record that the build was uploaded to the Intune app with this ID")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s show [options] <job ID | package path | package SHA256>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Shows a build recorded with pack -record.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	reg := openRegistry(*registryFile)
+	b, ok := reg.Find(fs.Arg(0))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: no build %s in %s\n", fs.Arg(0), reg.Path())
+		os.Exit(1)
+	}
+	if *uploaded != "" {
+		updated, err := reg.Update(b, func(b *registry.Build) {
+			b.UploadStatus = registry.StatusUploaded
+			b.AppID = *uploaded
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		b = updated
+	}
+
+	fmt.Printf("Job:             %s\n", b.JobID)
+	fmt.Printf("Time:            %s\n", b.Time.Local().Format(time.DateTime))
+	fmt.Printf("Name:            %s\n", b.Name)
+	if b.Version != "" {
+		fmt.Printf("Version:         %s\n", b.Version)
+	}
+	if b.Architecture != "" {
+		fmt.Printf("Architecture:    %s\n", b.Architecture)
+	}
+	fmt.Printf("Package:         %s\n", b.Package)
+	fmt.Printf("Package SHA256:  %s\n", b.PackageSHA256)
+	fmt.Printf("Source SHA256:   %s\n", b.SourceSHA256)
+	fmt.Printf("Upload status:   %s\n", b.UploadStatus)
+	if b.AppID != "" {
+		fmt.Printf("App ID:          %s\n", b.AppID)
+	}
+}
+
+// checkVersion reports an error if the registry holds a build of the same
+// version of the package with other files
+func checkVersion(path, packagePath, version, architecture string, manifest *changes.Manifest) error {
+	reg, err := registry.Open(path)
+	if err != nil {
+		return err
+	}
+	pkg, err := unpacker.Open(packagePath)
+	if err != nil {
+		return fmt.Errorf("reading package for registry: %w", err)
+	}
+	if b, ok := reg.Conflict(pkg.Info.Name, version, architecture, manifest.Digest()); ok {
+		return fmt.Errorf("version %s of %s was already built with other files (job %s, %s); bump the version before releasing modified content",
+			version, b.Name, b.JobID, b.Time.Local().Format(time.DateTime))
+	}
+	return nil
+}
+
+// recordBuilds adds the packages of a target to the registry. manifest is
+// the file manifest of the first package, if already created.
+func recordBuilds(path string, result *targetResult, version, architecture string, manifest *changes.Manifest) error {
+	reg, err := registry.Open(path)
+	if err != nil {
+		return err
+	}
+	for i, packagePath := range result.packages {
+		pkg, err := unpacker.Open(packagePath)
+		if err != nil {
+			return fmt.Errorf("reading package for registry: %w", err)
+		}
+		if i > 0 || manifest == nil {
+			if manifest, err = changes.FromPackage(packagePath); err != nil {
+				return fmt.Errorf("hashing package files for registry: %w", err)
+			}
+		}
+		digest, err := fileSHA256(packagePath)
+		if err != nil {
+			return err
+		}
+		abs, err := filepath.Abs(packagePath)
+		if err != nil {
+			return err
+		}
+
+		b := registry.Build{
+			Time:          time.Now().UTC(),
+			JobID:         result.jobID,
+			Name:          pkg.Info.Name,
+			Version:       version,
+			Architecture:  architecture,
+			Package:       abs,
+			PackageSHA256: digest,
+			SourceSHA256:  manifest.Digest(),
+		}
+		if err := reg.Add(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openRegistry opens the registry file of a flag, or the default registry
+func openRegistry(flagValue string) *registry.Registry {
+	path, err := registryFilePath(flagValue)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	reg, err := registry.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	return reg
+}
+
+// registryFilePath returns the registry file of a flag, or the default
+func registryFilePath(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	path, err := registry.DefaultPath()
+	if err != nil {
+		return "", fmt.Errorf("locating the registry (use -registry): %w", err)
+	}
+	return path, nil
+}
+
+// registryHint describes the default registry file for usage texts
+func registryHint() string {
+	path, err := registry.DefaultPath()
+	if err != nil {
+		return registry.FileName + " in the user config directory"
+	}
+	return path
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/MANCHTOOLS/open-package/contentindex"
+	"github.com/MANCHTOOLS/open-package/escrow"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// keysFileSuffix is the suffix of the keys file next to a package
+const keysFileSuffix = ".keys.json"
+
+// runIndex builds an index of the files inside the packages below a
+// folder, or searches one
+func runIndex(args []string) {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	dir := fs.String("dir", "", "Folder to index all packages below")
+	output := fs.String("output", contentindex.FileName, "Index file to write")
+	workers := fs.Int("workers", runtime.NumCPU(), "Number of packages decrypted in parallel")
+	escrowKeyFile := fs.String("escrow-key", "", "Escrow key file; opens packages with a damaged Detection.xml from their escrowed keys")
+	quiet := fs.Bool("quiet", false, "Do not print progress")
+	indexFile := fs.String("index", contentindex.FileName, "Index file to search")
+	name := fs.String("search", "", "Search for files by name pattern, e.g. 'log4j-core-2.*.jar' or '*/lib/*.dll'")
+	digest := fs.String("sha256", "", "Search for files by SHA256 digest or a prefix of at least 8 characters")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s index -dir <folder> [-output <index.jsonl>] [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s index [-index <index.jsonl>] -search <pattern> | -sha256 <digest>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Indexes the name, size and SHA256 digest of the files inside packages.\n")
+		fmt.Fprintf(os.Stderr, "Packages that cannot be decrypted with their Detection.xml are opened\n")
+		fmt.Fprintf(os.Stderr, "with <package>%s or, with -escrow-key, <package>%s.\n\n", keysFileSuffix, escrow.KeysSuffix)
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	searching := *name != "" || *digest != ""
+	if fs.NArg() != 0 || searching == (*dir != "") {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if searching {
+		searchIndex(*indexFile, contentindex.Query{Name: *name, SHA256: *digest})
+		return
+	}
+
+	var escrowKey *escrow.Key
+	if *escrowKeyFile != "" {
+		key, err := escrow.LoadKey(*escrowKeyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		escrowKey = key
+	}
+	packages, unreadable, err := findPackages(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+
+	temp, cleanup := trackTemp(false)
+	defer cleanup()
+	file, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	done := 0
+	summary, err := contentindex.Build(packages, file, contentindex.Options{
+		Workers: *workers,
+		Keys:    func(packagePath string) (*unpacker.Keys, error) { return packageKeys(packagePath, escrowKey) },
+		Temp:    temp,
+		Progress: func(packagePath string, files int, err error) {
+			done++
+			if *quiet {
+				return
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "  [%d/%d] %s: failed\n", done, len(packages), packagePath)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "  [%d/%d] %s: %d file(s)\n", done, len(packages), packagePath, files)
+		},
+	})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*output)
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+
+	for _, walkErr := range unreadable {
+		fmt.Printf("FAILED %s: %v\n", walkErr.Path, walkErr.Err)
+	}
+	for _, failure := range summary.Failed {
+		fmt.Printf("FAILED %s: %s\n", failure.Package, failure.Error)
+	}
+	fmt.Printf("Indexed %d file(s) in %d of %d package(s) to %s\n", summary.Files, summary.Packages, len(packages), *output)
+	if len(summary.Failed) > 0 || len(unreadable) > 0 {
+		os.Exit(1)
+	}
+}
+
+// packageKeys returns the keys of a package from its keys file or its
+// escrowed keys, or nil if there are none
+func packageKeys(packagePath string, escrowKey *escrow.Key) (*unpacker.Keys, error) {
+	if _, err := os.Stat(packagePath + keysFileSuffix); err == nil {
+		return unpacker.LoadKeys(packagePath + keysFileSuffix)
+	}
+	if escrowKey == nil {
+		return nil, nil
+	}
+	detectionXML, err := escrow.Recover(escrowKey, packagePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return unpacker.ParseKeys(detectionXML)
+}
+
+// searchIndex prints the entries of an index file matching q
+func searchIndex(path string, q contentindex.Query) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	defer file.Close()
+	matches, err := contentindex.Search(file, q)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	for _, e := range matches {
+		fmt.Printf("%s\t%s\t%d\t%s\n", e.Package, e.Path, e.Size, e.SHA256)
+	}
+	if len(matches) == 0 {
+		fmt.Fprintln(os.Stderr, "No matching files")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/aes"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/MANCHTOOLS/open-package/inventory"
+	"github.com/MANCHTOOLS/open-package/metadata"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// runInspect prints the Detection.xml fields and entries of a package
+func runInspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	contents := fs.Bool("contents", false, "Decrypt the package and classify its files by type (executables, scripts, drivers, ...)")
+	header := fs.Bool("header", false, "Only read the header of the encrypted content, without keys or Detection.xml")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s inspect [-contents | -header] <package.intunewin>\n", os.Args[0])
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *header {
+		printContentHeader(fs.Arg(0))
+		return
+	}
+
+	pkg := openPackage(fs.Arg(0))
+	info := pkg.Info
+	fmt.Printf("Name:                   %s\n", info.Name)
+	fmt.Printf("Setup file:             %s\n", info.SetupFile)
+	fmt.Printf("Tool version:           %s\n", info.ToolVersion)
+	fmt.Printf("Format:                 %s\n", pkg.Format)
+	fmt.Printf("Unencrypted size:       %d bytes\n", info.UnencryptedContentSize)
+	fmt.Printf("Encrypted size:         %d bytes\n", len(pkg.Encrypted))
+	fmt.Printf("Profile:                %s\n", info.EncryptionInfo.ProfileIdentifier)
+	fmt.Printf("File digest:            %s (%s)\n", info.EncryptionInfo.FileDigest, info.EncryptionInfo.FileDigestAlgorithm)
+	if msi := info.MsiInfo; msi != nil {
+		fmt.Printf("MSI product code:       %s\n", msi.MsiProductCode)
+		fmt.Printf("MSI product version:    %s\n", msi.MsiProductVersion)
+		fmt.Printf("MSI upgrade code:       %s\n", msi.MsiUpgradeCode)
+		fmt.Printf("MSI execution context:  %s\n", msi.MsiExecutionContext)
+		fmt.Printf("MSI publisher:          %s\n", msi.MsiPublisher)
+	}
+	if build, ok := metadata.ParseBuildInfo(pkg.Comment); ok {
+		fmt.Printf("Built by:               %s\n", build.Tool)
+		if build.JobID != "" {
+			fmt.Printf("Build job:              %s\n", build.JobID)
+		}
+		fmt.Printf("Built at:               %s\n", build.Created.Local().Format(time.DateTime))
+		fmt.Printf("Source digest:          %s\n", build.SourceSHA256)
+	}
+
+	fmt.Println("Entries:")
+	for _, entry := range pkg.Entries {
+		fmt.Printf("  %s\n", entry)
+	}
+
+	if *contents {
+		innerZip, err := pkg.Decrypt()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		inv, err := inventory.FromInnerZip(innerZip)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		printInventory(inv)
+	}
+
+	printValidation(metadata.Validate(info))
+	printStructure(pkg.CheckStructure())
+}
+
+// printContentHeader prints the header of the encrypted content of a
+// package, exiting with status 1 if it is damaged
+func printContentHeader(path string) {
+	h, err := unpacker.ReadContentHeader(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	fmt.Printf("Content entry:          %s\n", h.Entry)
+	fmt.Printf("Encrypted size:         %d bytes\n", h.Size)
+	fmt.Printf("HMAC:                   %s\n", base64.StdEncoding.EncodeToString(h.Mac))
+	fmt.Printf("IV:                     %s\n", base64.StdEncoding.EncodeToString(h.IV))
+	if h.Aligned {
+		fmt.Printf("Ciphertext:             %d bytes, %d AES blocks\n", h.CiphertextSize, h.CiphertextSize/aes.BlockSize)
+		fmt.Printf("Unencrypted size:       %d to %d bytes\n", h.MinContentSize, h.MaxContentSize)
+	} else {
+		fmt.Printf("Ciphertext:             %d bytes, not a multiple of the AES block size (cut or extended)\n", h.CiphertextSize)
+	}
+	if h.DetectionError != nil {
+		fmt.Printf("Detection.xml:          unreadable (%v)\n", h.DetectionError)
+	} else if len(h.Mismatches) == 0 {
+		fmt.Println("Detection.xml:          matches the header")
+	} else {
+		fmt.Println("Detection.xml:          does not match the header")
+		for _, mismatch := range h.Mismatches {
+			fmt.Printf("  %s\n", mismatch)
+		}
+	}
+	if !h.Aligned || len(h.Mismatches) > 0 {
+		os.Exit(1)
+	}
+}
+
+// printInventory prints the files of a package by class and extension
+func printInventory(inv *inventory.Inventory) {
+	fmt.Printf("Contents:               %d files, %s\n", inv.Files, formatSize(inv.Size))
+	for _, class := range inv.Classes {
+		exts := make([]string, 0, len(class.Extensions))
+		for _, e := range class.Extensions {
+			ext := e.Ext
+			if ext == "" {
+				ext = "(none)"
+			}
+			exts = append(exts, fmt.Sprintf("%s %d", ext, e.Files))
+		}
+		fmt.Printf("  %-12s %6d files  %-28s %s\n", class.Name, class.Files, formatSize(class.Size), strings.Join(exts, ", "))
+	}
+}
+
+// runVerify validates a package and checks its integrity
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	quick := fs.Bool("quick", false, "Only check the HMAC of the encrypted content, without decrypting it")
+	full := fs.Bool("full", false, "Decrypt the content to also check its size and digest (default)")
+	quiet := fs.Bool("quiet", false, "Suppress progress output")
+	dir := fs.String("dir", "", "Verify every .intunewin file below this folder instead of a single package")
+	workers := fs.Int("workers", runtime.NumCPU(), "Packages verified in parallel with -dir")
+	reportFile := fs.String("report", "", "JSON file to write the pass/fail report of -dir to")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s verify [-quick | -full] <package.intunewin>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s verify [-quick | -full] -dir <folder> [-workers <n>] [-report <file>]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Checks the entries of the package, validates Detection.xml and decrypts the content\n")
+		fmt.Fprintf(os.Stderr, "to check HMAC, size and digest. The content is read in chunks, so packages of any\n")
+		fmt.Fprintf(os.Stderr, "size are verified in constant memory.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (*dir == "") == (fs.NArg() == 0) || fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *quick && *full {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), "-quick and -full are mutually exclusive")
+		os.Exit(1)
+	}
+
+	opts := unpacker.VerifyOptions{Mode: unpacker.VerifyFull}
+	if *quick {
+		opts.Mode = unpacker.VerifyQuick
+	}
+	if *dir != "" {
+		report, err := verifyDir(*dir, opts.Mode, *workers, *quiet)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		printVerifyReport(report)
+		if *reportFile != "" {
+			if err := writeVerifyReport(report, *reportFile); err != nil {
+				fmt.Fprintf(os.Stderr, tr("Error writing results: %v\n"), err)
+				os.Exit(1)
+			}
+		}
+		if report.Failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if !*quiet {
+		opts.Progress = verifyProgress()
+	}
+	start := time.Now()
+	pkg, err := unpacker.VerifyFile(fs.Arg(0), opts)
+	if err != nil {
+		var validationErr *metadata.ValidationError
+		var structureErr *unpacker.StructureError
+		switch {
+		case errors.As(err, &structureErr):
+			printStructure(structureErr.Problems)
+		case errors.As(err, &validationErr):
+			printValidation(err)
+		default:
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		}
+		os.Exit(1)
+	}
+	for _, w := range pkg.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	if !*quiet {
+		fmt.Fprintf(os.Stderr, "Verified in %s\n", time.Since(start).Round(time.Millisecond))
+	}
+	if opts.Mode == unpacker.VerifyQuick {
+		fmt.Printf("%s: OK (HMAC only, content not decrypted)\n", fs.Arg(0))
+		return
+	}
+	fmt.Printf("%s: OK\n", fs.Arg(0))
+}
+
+// verifyProgress returns a VerifyOptions.Progress that prints a line to
+// stderr every 5 percent of the content. Content read before the first
+// checkpoint is not worth a line.
+func verifyProgress() func(unpacker.VerifyProgress) {
+	last := -1
+	return func(p unpacker.VerifyProgress) {
+		if last < 0 && p.Bytes >= p.Total {
+			return
+		}
+		percent := int(p.Bytes * 100 / p.Total)
+		if last >= 0 && percent/5 == last/5 {
+			return
+		}
+		last = percent
+		fmt.Fprintf(os.Stderr, "  Verified %3d%% (%d of %d MiB)\n", percent, p.Bytes>>20, p.Total>>20)
+	}
+}
+
+// openPackage opens a package and prints its warnings, exiting on errors
+func openPackage(path string) *unpacker.Package {
+	pkg, err := unpacker.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	for _, w := range pkg.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	return pkg
+}
+
+// printValidation prints the result of metadata.Validate
+func printValidation(err error) {
+	var validationErr *metadata.ValidationError
+	if !errors.As(err, &validationErr) {
+		fmt.Println("Detection.xml: valid")
+		return
+	}
+	fmt.Println("Detection.xml: invalid")
+	for _, problem := range validationErr.Problems {
+		fmt.Printf("  %s\n", problem)
+	}
+}
+
+// printStructure prints the result of unpacker.Package.CheckStructure
+func printStructure(problems []unpacker.StructureProblem) {
+	if len(problems) == 0 {
+		fmt.Println("Structure: valid")
+		return
+	}
+	fmt.Println("Structure: invalid")
+	for _, problem := range problems {
+		fmt.Printf("  %s\n", problem)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/messages"
+)
+
+// langEnv is the environment variable with the language of the CLI when
+// -lang is not given
+const langEnv = "OPEN_PACKAGE_LANG"
+
+// langAuto selects the language of the locale of the environment
+const langAuto = "auto"
+
+// catalog translates the messages of the CLI. It is nil, i.e. English,
+// until main applies -lang.
+var catalog *messages.Catalog
+
+// tr returns the translation of a message format string
+func tr(format string) string {
+	return catalog.Text(format)
+}
+
+// applyLang selects the catalog from the -lang option, which applies to
+// all commands and may appear anywhere before "--", and returns args
+// without it
+func applyLang(args []string) ([]string, error) {
+	lang := os.Getenv(langEnv)
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "lang" {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("flag needs an argument: -lang")
+			}
+			i++
+			value = args[i]
+		}
+		lang = value
+	}
+
+	if lang == langAuto {
+		lang = messages.Detect()
+	}
+	c, err := messages.New(lang)
+	if err != nil {
+		return nil, err
+	}
+	catalog = c
+	return rest, nil
+}
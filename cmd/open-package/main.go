@@ -11,12 +11,14 @@
 package main
 
 import (
-	"flag"
+	"context"
 	"fmt"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"sync"
+	"syscall"
 
-	"github.com/MANCHTOOLS/open-package/packager"
+	"github.com/MANCHTOOLS/open-package/tempfiles"
 )
 
 const (
@@ -24,118 +26,125 @@ const (
 )
 
 func main() {
-	// Command line flags
-	sourceDir := flag.String("source", "", "Source folder containing the application files (required)")
-	setupFile := flag.String("setup", "", "Name of the setup file (e.g., install.exe) within the source folder (required)")
-	outputDir := flag.String("output", ".", "Output directory for the .intunewin file")
-	showVersion := flag.Bool("version", false, "Show version information")
-	quiet := flag.Bool("quiet", false, "Suppress progress output")
-
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "IntuneWin Packager v%s\n\n", version)
-		fmt.Fprintf(os.Stderr, "Creates .intunewin packages for Microsoft Intune Win32 app deployment.\n\n")
-		fmt.Fprintf(os.Stderr, "Usage:\n")
-		fmt.Fprintf(os.Stderr, "  %s -source <folder> -setup <file> [-output <dir>]\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Options:\n")
-		flag.PrintDefaults()
-		fmt.Fprintf(os.Stderr, "\nExample:\n")
-		fmt.Fprintf(os.Stderr, "  %s -source ./myapp -setup install.exe -output ./output\n", os.Args[0])
-	}
-
-	flag.Parse()
-
-	if *showVersion {
-		fmt.Printf("IntuneWin Packager v%s\n", version)
-		os.Exit(0)
-	}
-
-	// Validate required arguments
-	if *sourceDir == "" {
-		fmt.Fprintln(os.Stderr, "Error: -source is required")
-		flag.Usage()
-		os.Exit(1)
-	}
-
-	if *setupFile == "" {
-		fmt.Fprintln(os.Stderr, "Error: -setup is required")
-		flag.Usage()
-		os.Exit(1)
-	}
-
-	// Resolve absolute paths
-	absSourceDir, err := filepath.Abs(*sourceDir)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error resolving source path: %v\n", err)
-		os.Exit(1)
-	}
-
-	absOutputDir, err := filepath.Abs(*outputDir)
+	args, err := applyLang(os.Args[1:])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error resolving output path: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Verify source directory exists
-	info, err := os.Stat(absSourceDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "Error: Source directory does not exist: %s\n", absSourceDir)
-		} else {
-			fmt.Fprintf(os.Stderr, "Error accessing source directory: %v\n", err)
-		}
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
 		os.Exit(1)
 	}
-	if !info.IsDir() {
-		fmt.Fprintf(os.Stderr, "Error: Source path is not a directory: %s\n", absSourceDir)
-		os.Exit(1)
-	}
-
-	// Verify setup file exists within source directory
-	setupPath := filepath.Join(absSourceDir, *setupFile)
-	if _, err := os.Stat(setupPath); err != nil {
-		if os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "Error: Setup file not found: %s\n", setupPath)
-		} else {
-			fmt.Fprintf(os.Stderr, "Error accessing setup file: %v\n", err)
-		}
-		os.Exit(1)
+	command := ""
+	if len(args) > 0 {
+		command = args[0]
 	}
 
-	// Create output directory if it doesn't exist
-	if err := os.MkdirAll(absOutputDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Create the packager
-	opts := packager.Options{
-		SourceDir: absSourceDir,
-		SetupFile: *setupFile,
-		OutputDir: absOutputDir,
-		Quiet:     *quiet,
+	switch command {
+	case "pack":
+		runPack(args[1:])
+	case "compat":
+		runCompat(args[1:])
+	case "unpack":
+		runUnpack(args[1:])
+	case "escrow":
+		runEscrow(args[1:])
+	case "inspect":
+		runInspect(args[1:])
+	case "verify":
+		runVerify(args[1:])
+	case "estimate":
+		runEstimate(args[1:])
+	case "advise-split":
+		runAdviseSplit(args[1:])
+	case "wrap-download":
+		runWrapDownload(args[1:])
+	case "changes":
+		runChanges(args[1:])
+	case "rotate-keys":
+		runRotateKeys(args[1:])
+	case "repair":
+		runRepair(args[1:])
+	case "index":
+		runIndex(args[1:])
+	case "prune":
+		runPrune(args[1:])
+	case "history":
+		runHistory(args[1:])
+	case "show":
+		runShow(args[1:])
+	case "bench":
+		runBench(args[1:])
+	case "gen-testdata":
+		runGenTestData(args[1:])
+	case "ps-module":
+		runPSModule(args[1:])
+	case sandboxCommand:
+		runSandboxZip(args[1:])
+	default:
+		runPack(args)
 	}
+}
 
-	pkg := packager.New(opts)
+// Exit codes of commands stopped by a signal, 128 plus the signal number
+// as with shells, so that wrappers can tell cancelled builds from failed
+// ones
+const (
+	exitInterrupted = 130
+	exitTerminated  = 143
+)
 
-	if !*quiet {
-		fmt.Printf("IntuneWin Packager v%s\n", version)
-		fmt.Printf("Source: %s\n", absSourceDir)
-		fmt.Printf("Setup file: %s\n", *setupFile)
-		fmt.Printf("Output: %s\n", absOutputDir)
-		fmt.Println()
-	}
+// interrupt holds the functions run when a command is interrupted, after
+// its temporary files are removed
+var interrupt struct {
+	sync.Mutex
+	handlers []func()
+}
 
-	// Create the package
-	outputPath, err := pkg.CreatePackage()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating package: %v\n", err)
-		os.Exit(1)
-	}
+// onInterrupt registers fn to run when the command is interrupted
+func onInterrupt(fn func()) {
+	interrupt.Lock()
+	defer interrupt.Unlock()
+	interrupt.handlers = append(interrupt.handlers, fn)
+}
 
-	if !*quiet {
-		fmt.Println()
-		fmt.Printf("Successfully created: %s\n", outputPath)
-	} else {
-		fmt.Println(outputPath)
+// trackTemp returns the manager of the temporary files of a command. On
+// SIGINT (Ctrl+C) or SIGTERM the context of the manager is cancelled,
+// which removes them, the handlers of onInterrupt run and the command
+// exits with exitInterrupted or exitTerminated; a second signal stops it
+// at once. The returned function, deferred by the command, removes them
+// when it returns or panics; commands that exit with an error return the
+// exit code from a function that defers it, as os.Exit skips deferred
+// calls. With keep, they are left in place and listed on stderr instead.
+func trackTemp(keep bool) (*tempfiles.Manager, func()) {
+	temp := tempfiles.New(keep, os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	cleaned := temp.Watch(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig, ok := <-signals
+		if !ok {
+			return
+		}
+		signal.Stop(signals)
+		cancel()
+		<-cleaned
+		interrupt.Lock()
+		for _, fn := range interrupt.handlers {
+			fn()
+		}
+		interrupt.Unlock()
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), fmt.Errorf("%v signal received", sig))
+		if sig == syscall.SIGTERM {
+			os.Exit(exitTerminated)
+		}
+		os.Exit(exitInterrupted)
+	}()
+	return temp, func() {
+		if r := recover(); r != nil {
+			temp.Cleanup()
+			panic(r)
+		}
+		signal.Stop(signals)
+		close(signals)
+		cancel()
+		<-cleaned
 	}
 }
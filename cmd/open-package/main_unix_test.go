@@ -0,0 +1,75 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestMain runs the command instead of the tests when a test starts the
+// test binary as open-package
+func TestMain(m *testing.M) {
+	if os.Getenv("OPEN_PACKAGE_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestInterruptExitCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		signal os.Signal
+		code   int
+	}{
+		{"SIGINT", os.Interrupt, exitInterrupted},
+		{"SIGTERM", syscall.SIGTERM, exitTerminated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir, err := os.MkdirTemp("", "open-package-signal-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			// The pre_pack hook keeps the build running until the signal
+			configPath := filepath.Join(tempDir, "config.json")
+			config := `{"source": "app", "setup": "install.cmd", "hooks": {"pre_pack": ["touch started && sleep 5"]}}`
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+			cmd := exec.Command(os.Args[0], "pack", "-config", configPath, "-quiet")
+			cmd.Env = append(os.Environ(), "OPEN_PACKAGE_TEST_MAIN=1")
+			if err := cmd.Start(); err != nil {
+				t.Fatalf("Failed to start command: %v", err)
+			}
+			defer cmd.Process.Kill()
+
+			deadline := time.Now().Add(10 * time.Second)
+			for {
+				if _, err := os.Stat(filepath.Join(tempDir, "started")); err == nil {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("Timed out waiting for the pre_pack hook")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if err := cmd.Process.Signal(tt.signal); err != nil {
+				t.Fatalf("Failed to send %s: %v", tt.name, err)
+			}
+			var exitErr *exec.ExitError
+			if err := cmd.Wait(); !errors.As(err, &exitErr) || exitErr.ExitCode() != tt.code {
+				t.Errorf("Expected exit code %d, got %v", tt.code, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/MANCHTOOLS/open-package/config"
+	"github.com/MANCHTOOLS/open-package/packager"
+)
+
+// manifestResult is the outcome of a single manifest row
+type manifestResult struct {
+	Line     int      `json:"line"`
+	JobID    string   `json:"jobId,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Source   string   `json:"source"`
+	Setup    string   `json:"setup"`
+	Status   string   `json:"status"`
+	Packages []string `json:"packages,omitempty"`
+	Skipped  []string `json:"skipped,omitempty"`
+	Excluded []string `json:"excluded,omitempty"`
+	// EmptyDirs are included in the package unless pruned
+	EmptyDirs       []string `json:"emptyDirs,omitempty"`
+	EmptyDirsPruned bool     `json:"emptyDirsPruned,omitempty"`
+	// HardLinks are left out as duplicates with -skip-hard-links
+	// ("duplicate => packaged")
+	HardLinks []string `json:"hardLinks,omitempty"`
+	// Duplicates is content packaged under several paths
+	Duplicates []packager.Duplicate `json:"duplicates,omitempty"`
+	// Drivers are the driver packages of the source
+	Drivers []packager.Driver `json:"drivers,omitempty"`
+	// Streams are the source files with alternate data streams
+	Streams []packager.StreamFile `json:"streams,omitempty"`
+	// SmokeTests are the exit codes of the smoke test hooks
+	SmokeTests []config.SmokeTestResult `json:"smokeTests,omitempty"`
+	// Warnings are the warnings of the build with their codes
+	Warnings []packager.Warning `json:"warnings,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// runManifest builds all packages of a manifest file, continuing after
+// failed rows. It prints a summary table, writes the results file and
+// reports whether all rows succeeded.
+func runManifest(manifestPath, resultsPath, defaultOutput string, opts buildOptions) bool {
+	rows, err := config.LoadManifest(manifestPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		return false
+	}
+
+	results := make([]manifestResult, 0, len(rows))
+	failed := 0
+	for _, row := range rows {
+		cfg := row.Config
+		result := manifestResult{Line: row.Line, Name: cfg.Name, Source: cfg.Source, Setup: cfg.Setup, Status: "ok"}
+
+		built, err := buildManifestRow(cfg, defaultOutput, opts)
+		if built != nil {
+			result.JobID = built.jobID
+			result.Packages = built.packages
+			result.Skipped = built.skipped
+			result.Excluded = built.excluded
+			result.EmptyDirs = built.emptyDirs
+			result.EmptyDirsPruned = opts.pruneEmptyDirs && len(built.emptyDirs) > 0
+			result.HardLinks = built.hardLinks
+			result.Duplicates = built.duplicates
+			result.Drivers = built.drivers
+			result.Streams = built.streams
+			result.SmokeTests = built.smokeTests
+			result.Warnings = built.warnings
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: line %d: job %s: %v\n"), row.Line, result.JobID, err)
+			result.Status = "failed"
+			result.Error = err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		return false
+	}
+	if err := os.WriteFile(resultsPath, append(data, '\n'), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error writing results: %v\n"), err)
+		return false
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "LINE\tJOB\tSTATUS\tSOURCE\tPACKAGE")
+	for _, r := range results {
+		pkg := r.Error
+		if len(r.Packages) > 0 {
+			pkg = r.Packages[0]
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", r.Line, r.JobID, r.Status, r.Source, pkg)
+	}
+	w.Flush()
+	fmt.Printf(tr("\n%d of %d package(s) created, results written to %s\n"), len(results)-failed, len(results), resultsPath)
+
+	return failed == 0
+}
+
+// buildManifestRow builds the package of a single manifest row
+func buildManifestRow(cfg *config.Config, defaultOutput string, opts buildOptions) (*targetResult, error) {
+	output := cfg.Output
+	if output == "" {
+		output = defaultOutput
+	}
+	absOutputDir, err := filepath.Abs(output)
+	if err != nil {
+		return nil, fmt.Errorf("resolving output path: %w", err)
+	}
+	if err := os.MkdirAll(absOutputDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating output directory: %w", err)
+	}
+
+	// Manifest rows have no architectures, and the result of a row
+	// describes a single build
+	targets := cfg.Targets()
+	if len(targets) != 1 {
+		return nil, fmt.Errorf("manifest rows build a single package, got %d targets", len(targets))
+	}
+	opts.name = cfg.Name
+	opts.outputDir = absOutputDir
+	return buildTarget(targets[0], opts)
+}
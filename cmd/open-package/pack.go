@@ -0,0 +1,924 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MANCHTOOLS/open-package/changes"
+	"github.com/MANCHTOOLS/open-package/config"
+	"github.com/MANCHTOOLS/open-package/escrow"
+	"github.com/MANCHTOOLS/open-package/lobapp"
+	"github.com/MANCHTOOLS/open-package/logging"
+	"github.com/MANCHTOOLS/open-package/metadata"
+	"github.com/MANCHTOOLS/open-package/packager"
+	"github.com/MANCHTOOLS/open-package/snippet"
+	"github.com/MANCHTOOLS/open-package/tempfiles"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// runPack creates .intunewin packages. It is the default command, so the
+// flags can be used without the "pack" command name.
+func runPack(args []string) {
+	fs := flag.NewFlagSet("pack", flag.ExitOnError)
+
+	// Command line flags
+	sourceDir := fs.String("source", "", "Source folder containing the application files (required)")
+	setupFile := fs.String("setup", "", "Name of the setup file (e.g., install.exe) within the source folder (required)")
+	name := fs.String("name", "", "Application name and output file name (default: source folder name)")
+	outputDir := fs.String("output", ".", "Output directory for the .intunewin file")
+	configFile := fs.String("config", "", "JSON config file describing the build")
+	manifestFile := fs.String("manifest", "", "CSV file with one package per row (columns: source, setup, name, output)")
+	resultsFile := fs.String("results", "", "JSON results file of a manifest build (default: <manifest>.results.json)")
+	archList := fs.String("arch", "", "Comma-separated architectures to build (e.g., x64,arm64), one package each")
+	showVersion := fs.Bool("version", false, "Show version information")
+	quiet := fs.Bool("quiet", false, "Suppress progress output")
+	retries := fs.Int("retries", 3, "Retries of transient errors of all stages (opening source files, writing the package)")
+	retryDelay := fs.Duration("retry-delay", packager.DefaultOpenRetryDelay, "Delay before the first retry of all stages, doubled per retry")
+	openRetries := fs.Int("open-retries", 0, "Retries for source files locked by another process (default: -retries)")
+	openRetryDelay := fs.Duration("open-retry-delay", 0, "Delay before the first retry of a locked file (default: -retry-delay)")
+	writeRetries := fs.Int("write-retries", 0, "Retries for transient errors writing the package (default: -retries)")
+	writeRetryDelay := fs.Duration("write-retry-delay", 0, "Delay before the first retry of a failed package write (default: -retry-delay)")
+	changedRetries := fs.Int("changed-retries", 2, "Times a source file that changes while being read is read again before failing")
+	includeHidden := fs.Bool("include-hidden", false, "Include junk files (Thumbs.db, desktop.ini, .DS_Store, ~$*.tmp) and hidden or system files")
+	pruneEmptyDirs := fs.Bool("prune-empty-dirs", false, "Leave directories without files out of the package")
+	links := fs.String("links", packager.LinkFollow, "Symbolic links and junctions: follow (package their targets) or skip")
+	skipHardLinks := fs.Bool("skip-hard-links", false, "Package only the first hard link to the same content and leave the others out with a warning")
+	stripZoneIdentifier := fs.Bool("strip-zone-identifier", false, "Remove the Mark of the Web (Zone.Identifier stream) from source files (Windows)")
+	uploadScript := fs.Bool("upload-script", false, "Write a PowerShell script next to each package that uploads it with the IntuneWin32App module")
+	fileManifest := fs.Bool("file-manifest", false, "Write a file manifest next to each package, for the changes command")
+	record := fs.Bool("record", false, "Record each build in the local registry (see the history and show commands)")
+	stamp := fs.Bool("stamp", false, "Stamp the ZIP comments of each package with build info (tool version, job ID, source digest)")
+	registryFile := fs.String("registry", "", "Registry file for -record (default: "+registryHint()+")")
+	workers := fs.Int("workers", 1, "Source files read and compressed in parallel (speeds up trees with many small files)")
+	skipLocked := fs.Bool("skip-locked", false, "Skip source files that stay locked instead of failing")
+	unreadable := fs.String("unreadable", packager.UnreadableFail, "Source files and folders that cannot be opened: fail or skip (with a warning, fails with -strict)")
+	jobID := fs.String("job-id", "", "Correlation ID of the build for logs, results and escrow sidecars (default: random per package)")
+	logFile := fs.String("log-file", "", "Also write progress to this log file, with size based rotation")
+	logMaxSize := fs.Int("log-max-size", 10, "Size in MB at which the log file is rotated")
+	progressPath := fs.String("progress-file", "", "Write JSON-lines progress events (stage, percent, current file) to this file or named pipe, for wrapper GUIs")
+	logMaxFiles := fs.Int("log-max-files", logging.DefaultMaxFiles, "Number of rotated log files to keep")
+	strict := fs.Bool("strict", false, "Fail on packaging warnings (path length, name collisions, unsigned setup, size limit, reused version, installer without silent switches, unsigned driver)")
+	suppress := fs.String("suppress", "", "Comma-separated warning codes to drop, also with -strict (e.g. W014,W001)")
+	strictCompat := fs.Bool("strict-compat", false, "Write Detection.xml byte-compatible with the official tool")
+	toolVersion := fs.String("tool-version", "", "ToolVersion recorded in Detection.xml (default "+metadata.ToolVersion+")")
+	profile := fs.String("profile", "", "Crypto profile recorded in Detection.xml ("+strings.Join(metadata.ProfileIdentifiers, ", ")+")")
+	msixWrapper := fs.Bool("msix-wrapper", false, "Wrap an MSIX setup file with a bootstrap install script")
+	escrowKeyFile := fs.String("escrow-key", "", "Escrow key file; writes encrypted keys and a sidecar next to each package")
+	uninstallPackage := fs.Bool("uninstall-package", false, "Also create an uninstall companion package")
+	uninstallCommand := fs.String("uninstall-command", "", "Uninstall command for the companion package (derived from MSI setups, and from Inno Setup and NSIS setups installed to %ProgramFiles%\\<name>, if omitted)")
+	var sources []packager.Source
+	fs.Func("add", "Additional folder or file merged into the package, as path[=target folder] (repeatable)", func(value string) error {
+		src, err := packager.ParseSource(value)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, src)
+		return nil
+	})
+	timestamps := fs.String("timestamps", packager.TimestampsPreserve, "Entry modification times: preserve (source files), build (build time), fixed ("+packager.DefaultTimestamp.Format("2006-01-02")+") or an RFC 3339 time")
+	attributes := fs.String("attributes", packager.AttributesPreserve, "Entry permissions and read-only, hidden and system attributes: preserve or normalize")
+	var rewrites []packager.Rewrite
+	fs.Func("rewrite", "Move a folder or file of the source to another path of the package, as from=to; an empty to moves a folder to the root (repeatable)", func(value string) error {
+		r, err := packager.ParseRewrite(value)
+		if err != nil {
+			return err
+		}
+		rewrites = append(rewrites, r)
+		return nil
+	})
+	sandboxed := fs.Bool("sandbox", false, "Walk and compress the source in a restricted process without network access (Linux, Windows)")
+	sandboxUser := fs.String("sandbox-user", "", "Account the sandboxed process runs as when started as root (Linux, default: nobody)")
+	keepTemp := fs.Bool("keep-temp", false, "Keep staging directories and partially written packages for debugging and print their locations")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "IntuneWin Packager v%s\n\n", version)
+		fmt.Fprint(os.Stderr, tr("Creates .intunewin packages for Microsoft Intune Win32 app deployment.\n\n"))
+		fmt.Fprint(os.Stderr, tr("Usage:\n"))
+		fmt.Fprintf(os.Stderr, "  %s -source <folder> -setup <file> [-output <dir>]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -config <file> [-arch <list>]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -manifest <apps.csv> [-results <file>]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s <command> [options]\n\n", os.Args[0])
+		fmt.Fprint(os.Stderr, tr("Commands:\n"))
+		fmt.Fprintf(os.Stderr, "  pack            %s\n", tr("Create .intunewin packages (default)"))
+		fmt.Fprintf(os.Stderr, "  unpack          %s\n", tr("Decrypt a package and extract its content"))
+		fmt.Fprintf(os.Stderr, "  inspect         %s\n", tr("Show the Detection.xml fields, entries and contents of a package"))
+		fmt.Fprintf(os.Stderr, "  verify          %s\n", tr("Validate a package and check its integrity"))
+		fmt.Fprintf(os.Stderr, "  escrow          %s\n", tr("Create escrow keys and recover escrowed Detection.xml files"))
+		fmt.Fprintf(os.Stderr, "  estimate        %s\n", tr("Estimate package and device sizes without packaging"))
+		fmt.Fprintf(os.Stderr, "  advise-split    %s\n", tr("Suggest how to split a source over the Intune size limit"))
+		fmt.Fprintf(os.Stderr, "  wrap-download   %s\n", tr("Create a package that downloads its payload at install time"))
+		fmt.Fprintf(os.Stderr, "  changes         %s\n", tr("List the files changed since a previous build"))
+		fmt.Fprintf(os.Stderr, "  rotate-keys     %s\n", tr("Re-encrypt a package with new keys"))
+		fmt.Fprintf(os.Stderr, "  repair          %s\n", tr("Regenerate the damaged Detection.xml of a package from its keys"))
+		fmt.Fprintf(os.Stderr, "  index           %s\n", tr("Index the files inside packages and search them"))
+		fmt.Fprintf(os.Stderr, "  prune           %s\n", tr("Remove old package versions from an output folder"))
+		fmt.Fprintf(os.Stderr, "  history         %s\n", tr("List the builds recorded with -record"))
+		fmt.Fprintf(os.Stderr, "  show            %s\n", tr("Show a recorded build or record its upload"))
+		fmt.Fprintf(os.Stderr, "  bench           %s\n", tr("Measure packaging throughput on this machine"))
+		fmt.Fprintf(os.Stderr, "  gen-testdata    %s\n", tr("Create a synthetic source tree for reproducing issues"))
+		fmt.Fprintf(os.Stderr, "  ps-module       %s\n", tr("Write the PowerShell module wrapping this CLI"))
+		fmt.Fprintf(os.Stderr, "  compat check    %s\n\n", tr("Compare a package of the official tool with one of this tool"))
+		fmt.Fprint(os.Stderr, tr("Options:\n"))
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "  -lang string\n    \t%s\n", tr("Language of the messages of all commands: en, de, fr or auto (default: $OPEN_PACKAGE_LANG or en)"))
+		fmt.Fprint(os.Stderr, tr("\nExample:\n"))
+		fmt.Fprintf(os.Stderr, "  %s -source ./myapp -setup install.exe -output ./output\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -source ./myapp -setup install.exe -arch x64,arm64\n", os.Args[0])
+	}
+
+	fs.Parse(args)
+
+	if *showVersion {
+		fmt.Printf("IntuneWin Packager v%s\n", version)
+		os.Exit(0)
+	}
+
+	// Load the config file, command line flags take precedence
+	cfg := &config.Config{}
+	if *configFile != "" {
+		loaded, err := config.Load(*configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		cfg = loaded
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "source":
+			cfg.Source = *sourceDir
+		case "setup":
+			cfg.Setup = *setupFile
+		case "name":
+			cfg.Name = *name
+		case "output":
+			cfg.Output = *outputDir
+		}
+	})
+
+	// Stages without their own retry flags use the global ones
+	stageSet := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { stageSet[f.Name] = true })
+	if !stageSet["open-retries"] {
+		*openRetries = *retries
+	}
+	if !stageSet["open-retry-delay"] {
+		*openRetryDelay = *retryDelay
+	}
+	if !stageSet["write-retries"] {
+		*writeRetries = *retries
+	}
+	if !stageSet["write-retry-delay"] {
+		*writeRetryDelay = *retryDelay
+	}
+	if cfg.Output == "" {
+		cfg.Output = *outputDir
+	}
+	cfg.Sources = append(cfg.Sources, sources...)
+	cfg.Rewrites = append(rewrites, cfg.Rewrites...)
+
+	if *toolVersion != "" {
+		if err := metadata.ValidateToolVersion(*toolVersion); err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+	}
+	if *profile != "" {
+		if err := metadata.ValidateProfileIdentifier(*profile); err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+	}
+
+	// A time sets all entries to it
+	var timestamp time.Time
+	if t, err := time.Parse(time.RFC3339, *timestamps); err == nil {
+		*timestamps, timestamp = packager.TimestampsFixed, t
+	}
+
+	suppressed, err := parseSuppress(*suppress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+
+	var escrowKey *escrow.Key
+	if *escrowKeyFile != "" {
+		key, err := escrow.LoadKey(*escrowKeyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		escrowKey = key
+	}
+
+	var sandbox packager.Sandbox
+	if *sandboxed {
+		sandbox = processSandbox{user: *sandboxUser}
+	} else if *sandboxUser != "" {
+		fmt.Fprintf(os.Stderr, tr("Error: %s requires %s\n"), "-sandbox-user", "-sandbox")
+		os.Exit(1)
+	}
+
+	var registryPath string
+	if *record || *registryFile != "" {
+		path, err := registryFilePath(*registryFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		registryPath = path
+	}
+
+	temp, cleanup := trackTemp(*keepTemp)
+	defer cleanup()
+
+	opts := buildOptions{
+		quiet:            *quiet,
+		uninstallPackage: *uninstallPackage,
+		uninstallCommand: *uninstallCommand,
+		msixWrapper:      *msixWrapper,
+		strictCompat:     *strictCompat,
+		toolVersion:      *toolVersion,
+		profile:          *profile,
+		escrowKey:        escrowKey,
+		strict:           *strict,
+		suppress:         suppressed,
+		jobID:            *jobID,
+		openRetries:      *openRetries,
+		openRetryDelay:   *openRetryDelay,
+		writeRetries:     *writeRetries,
+		writeRetryDelay:  *writeRetryDelay,
+		skipLocked:       *skipLocked,
+		unreadable:       *unreadable,
+		changedRetries:   *changedRetries,
+		includeHidden:    *includeHidden,
+		pruneEmptyDirs:   *pruneEmptyDirs,
+		links:            *links,
+		skipHardLinks:    *skipHardLinks,
+		stripZone:        *stripZoneIdentifier,
+		workers:          *workers,
+		fileManifest:     *fileManifest,
+		uploadScript:     *uploadScript,
+		registry:         registryPath,
+		stamp:            *stamp,
+		sources:          cfg.Sources,
+		rewrites:         cfg.Rewrites,
+		generated:        cfg.Generated,
+		timestamps:       *timestamps,
+		timestamp:        timestamp,
+		attributes:       *attributes,
+		sandbox:          sandbox,
+		temp:             temp,
+	}
+
+	if *logFile != "" {
+		rf, err := logging.OpenRotatingFile(*logFile, int64(*logMaxSize)<<20, *logMaxFiles)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		defer rf.Close()
+		opts.logFile = rf
+	}
+
+	if *progressPath != "" {
+		pf, err := openProgressFile(*progressPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		defer pf.Close()
+		opts.progress = pf
+		onInterrupt(pf.cancelled)
+	}
+
+	if *manifestFile != "" {
+		resultsPath := *resultsFile
+		if resultsPath == "" {
+			resultsPath = strings.TrimSuffix(*manifestFile, filepath.Ext(*manifestFile)) + ".results.json"
+		}
+		if !runManifest(*manifestFile, resultsPath, *outputDir, opts) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := applyArchList(cfg, *archList); err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+
+	// Validate required arguments
+	if cfg.Source == "" {
+		fmt.Fprintf(os.Stderr, tr("Error: %s is required\n"), "-source")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	if cfg.Setup == "" && len(cfg.Architectures) == 0 {
+		fmt.Fprintf(os.Stderr, tr("Error: %s is required\n"), "-setup")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	// Output directories using the product version are created per target
+	absOutputDir := cfg.Output
+	if !config.Deferred(cfg.Output) {
+		var err error
+		if absOutputDir, err = filepath.Abs(cfg.Output); err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error resolving output path: %v\n"), err)
+			os.Exit(1)
+		}
+
+		// Create output directory if it doesn't exist
+		if err := os.MkdirAll(absOutputDir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error creating output directory: %v\n"), err)
+			os.Exit(1)
+		}
+	}
+
+	if !*quiet {
+		fmt.Printf("IntuneWin Packager v%s\n", version)
+	}
+
+	opts.name = cfg.Name
+	opts.outputDir = absOutputDir
+	opts.hooks = cfg.Hooks
+	opts.limits = cfg.Limits
+	opts.app = cfg.App
+	opts.hookDir = cfg.Dir()
+	opts.cfg = cfg
+
+	for _, target := range cfg.Targets() {
+		result, err := buildTarget(target, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: job %s: %v\n"), result.jobID, err)
+			os.Exit(1)
+		}
+
+		for _, outputPath := range result.packages {
+			if !*quiet {
+				fmt.Println()
+				fmt.Printf(tr("Successfully created: %s\n"), outputPath)
+			} else {
+				fmt.Println(outputPath)
+			}
+		}
+	}
+
+	if cfg.Retention.Keep > 0 {
+		dir := cfg.Retention.Dir
+		if dir == "" {
+			dir = absOutputDir
+		}
+		removed, err := pruneOutput(dir, cfg.Retention.Keep, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: pruning old versions: %v\n"), err)
+			os.Exit(1)
+		}
+		for _, path := range removed {
+			fmt.Fprintf(os.Stderr, tr("Pruned: %s\n"), path)
+		}
+	}
+}
+
+// buildOptions contains the settings shared by all targets of a run
+type buildOptions struct {
+	name             string
+	outputDir        string
+	quiet            bool
+	uninstallPackage bool
+	uninstallCommand string
+	msixWrapper      bool
+	strictCompat     bool
+	toolVersion      string
+	profile          string
+	escrowKey        *escrow.Key
+	strict           bool
+	suppress         []string
+	hooks            config.Hooks
+	limits           config.Limits
+	hookDir          string
+	// cfg expands the values using the product version of the setup file
+	// once the pre_pack hooks have run; nil for manifest builds
+	cfg             *config.Config
+	logFile         io.Writer
+	progress        *progressFile
+	jobID           string
+	openRetries     int
+	openRetryDelay  time.Duration
+	writeRetries    int
+	writeRetryDelay time.Duration
+	skipLocked      bool
+	unreadable      string
+	changedRetries  int
+	includeHidden   bool
+	pruneEmptyDirs  bool
+	links           string
+	skipHardLinks   bool
+	stripZone       bool
+	workers         int
+	fileManifest    bool
+	uploadScript    bool
+	registry        string
+	stamp           bool
+	app             lobapp.Metadata
+	sources         []packager.Source
+	rewrites        []packager.Rewrite
+	generated       []packager.GeneratedFile
+	timestamps      string
+	timestamp       time.Time
+	attributes      string
+	sandbox         packager.Sandbox
+	temp            *tempfiles.Manager
+}
+
+// applyArchList restricts the build to the given comma-separated
+// architectures. Architectures not declared in the config use the
+// subfolder named after the architecture.
+func applyArchList(cfg *config.Config, list string) error {
+	if list == "" {
+		return nil
+	}
+
+	selected := make(map[string]config.Architecture)
+	for _, arch := range strings.Split(list, ",") {
+		arch = strings.TrimSpace(arch)
+		if arch == "" {
+			continue
+		}
+		selected[arch] = cfg.Architectures[arch]
+	}
+	cfg.Architectures = selected
+	return cfg.Validate()
+}
+
+// targetResult is the outcome of building a single target
+type targetResult struct {
+	// jobID is the correlation ID of the build
+	jobID string
+	// packages lists the created packages
+	packages []string
+	// skipped lists the locked and unreadable source files left out of the
+	// package
+	skipped []string
+	// excluded lists the junk and hidden source files left out
+	excluded []string
+	// emptyDirs lists the directories without files
+	emptyDirs []string
+	// hardLinks lists the hard links left out as duplicates
+	hardLinks []string
+	// duplicates lists the content packaged under several paths
+	duplicates []packager.Duplicate
+	// drivers lists the driver packages of the source
+	drivers []packager.Driver
+	// streams lists the source files with alternate data streams
+	streams []packager.StreamFile
+	// smokeTests lists the exit codes of the smoke test hooks
+	smokeTests []config.SmokeTestResult
+	// warnings lists the warnings of the package and of the checks of the
+	// CLI
+	warnings []packager.Warning
+}
+
+// warn reports a warning of the checks of the CLI as the packager does: it
+// is dropped with -suppress, fails the build with -strict, and is printed,
+// logged and added to the result otherwise
+func (r *targetResult) warn(opts buildOptions, logger *log.Logger, w packager.Warning) error {
+	for _, code := range opts.suppress {
+		if code == w.Code {
+			return nil
+		}
+	}
+	if opts.strict {
+		return fmt.Errorf("%w: %s", packager.ErrStrict, w)
+	}
+	fmt.Fprintf(os.Stderr, tr("Warning: %s\n"), w)
+	if logger != nil {
+		logger.Printf("Warning: %s", w)
+	}
+	r.warnings = append(r.warnings, w)
+	return nil
+}
+
+// parseSuppress parses the comma-separated warning codes of -suppress
+func parseSuppress(list string) ([]string, error) {
+	var codes []string
+	for _, code := range strings.Split(list, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" {
+			continue
+		}
+		if _, ok := packager.WarningCodes[code]; !ok {
+			return nil, fmt.Errorf("unknown warning code %q in -suppress", code)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// buildTarget validates the source of a single target and creates its
+// package, followed by the uninstall companion package if requested. The
+// result is returned even on errors, for its job ID.
+func buildTarget(target config.Target, opts buildOptions) (result *targetResult, err error) {
+	result = &targetResult{jobID: opts.jobID}
+	if result.jobID == "" {
+		if result.jobID, err = newJobID(); err != nil {
+			return result, err
+		}
+	}
+	jobID := result.jobID
+	defer func() {
+		if err != nil {
+			opts.progress.failed(jobID, err)
+		}
+	}()
+
+	var logger *log.Logger
+	if opts.logFile != nil {
+		logger = log.New(opts.logFile, "job="+jobID+" ", log.LstdFlags|log.LUTC|log.Lmsgprefix)
+		logger.Printf("Building %s (setup %s, architecture %q)", target.SourceDir, target.SetupFile, target.Architecture)
+		defer func() {
+			if err != nil {
+				logger.Printf("Error: %v", err)
+			}
+		}()
+	}
+
+	if target.SetupFile == "" {
+		return result, fmt.Errorf("no setup file specified for architecture %s", target.Architecture)
+	}
+
+	// Resolve absolute paths
+	absSourceDir, err := filepath.Abs(target.SourceDir)
+	if err != nil {
+		return result, fmt.Errorf("resolving source path: %w", err)
+	}
+
+	// Pre-pack hooks may create the source, e.g. by downloading installers
+	hookEnv := map[string]string{
+		"SOURCE": absSourceDir,
+		"SETUP":  target.SetupFile,
+		"OUTPUT": opts.outputDir,
+		"NAME":   opts.name,
+		"ARCH":   target.Architecture,
+	}
+	for _, key := range []string{"OUTPUT", "NAME"} {
+		if config.Deferred(hookEnv[key]) {
+			// Not known before the hooks have downloaded the setup file
+			hookEnv[key] = ""
+		}
+	}
+	if err := runHooks(opts, opts.hooks.PrePack, hookEnv); err != nil {
+		return result, err
+	}
+
+	// Expand the values using the product version of the setup file
+	if opts.cfg != nil {
+		cfg, err := opts.cfg.ForTarget(target)
+		if err != nil {
+			return result, fmt.Errorf("expanding config: %w", err)
+		}
+		if opts.outputDir, err = filepath.Abs(cfg.Output); err != nil {
+			return result, fmt.Errorf("resolving output path: %w", err)
+		}
+		if err := os.MkdirAll(opts.outputDir, 0755); err != nil {
+			return result, fmt.Errorf("creating output directory: %w", err)
+		}
+		opts.name = cfg.Name
+		opts.hooks = cfg.Hooks
+		opts.app = cfg.App
+		opts.sources = cfg.Sources
+		opts.rewrites = cfg.Rewrites
+		hookEnv["OUTPUT"] = opts.outputDir
+		hookEnv["NAME"] = opts.name
+	}
+
+	// Verify source directory exists
+	info, err := os.Stat(absSourceDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, fmt.Errorf("source directory does not exist: %s", absSourceDir)
+		}
+		return result, fmt.Errorf("accessing source directory: %w", err)
+	}
+	if !info.IsDir() {
+		return result, fmt.Errorf("source path is not a directory: %s", absSourceDir)
+	}
+
+	// Verify setup file exists within source directory
+	setupPath := filepath.Join(absSourceDir, target.SetupFile)
+	if _, err := os.Stat(setupPath); err != nil {
+		if os.IsNotExist(err) {
+			return result, fmt.Errorf("setup file not found: %s", setupPath)
+		}
+		return result, fmt.Errorf("accessing setup file: %w", err)
+	}
+
+	if packager.IsMSIX(target.SetupFile) && !opts.msixWrapper {
+		fmt.Fprintf(os.Stderr, tr("Note: %s is an MSIX package. MSIX packages can be uploaded to Intune directly\n"+
+			"as line-of-business apps. To deploy it through the Win32 channel, use -msix-wrapper\n"+
+			"to add a bootstrap install script.\n"), target.SetupFile)
+	}
+
+	installCommand := opts.app.InstallCommand
+	if installCommand == "" {
+		// The install command runs the setup file at its path in the package
+		setupFile := filepath.FromSlash(packager.RewritePath(opts.rewrites, filepath.ToSlash(target.SetupFile)))
+		installCommand = lobapp.InstallCommand(setupFile)
+	}
+
+	// Inno Setup and NSIS installers show their wizard without silent switches
+	installer, err := packager.InstallerType(absSourceDir, target.SetupFile)
+	if err != nil {
+		return result, fmt.Errorf("reading setup file: %w", err)
+	}
+	for _, problem := range packager.CheckSilentSwitches(installer, installCommand) {
+		msg := fmt.Sprintf("%s is an %s installer: %s; set the command with app.installCommand", target.SetupFile, installer, problem)
+		if err := result.warn(opts, logger, packager.Warning{Code: packager.WarnSilentSwitches, Message: msg}); err != nil {
+			return result, err
+		}
+	}
+
+	// Smoke test the silent install before spending time on the package
+	if len(opts.hooks.SmokeTest) > 0 {
+		hookEnv["INSTALL_COMMAND"] = installCommand
+		result.smokeTests, err = runSmokeTests(opts, hookEnv)
+		delete(hookEnv, "INSTALL_COMMAND")
+		if logger != nil {
+			for _, test := range result.smokeTests {
+				logger.Printf("Smoke test %q exited with %d", test.Command, test.ExitCode)
+			}
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// Derive the uninstall command before spending time on the package
+	uninstallCommand := opts.uninstallCommand
+	if opts.uninstallPackage && uninstallCommand == "" {
+		appName := opts.name
+		if appName == "" {
+			appName = filepath.Base(absSourceDir)
+		}
+		uninstallCommand, err = packager.UninstallCommand(absSourceDir, target.SetupFile, appName)
+		if err != nil {
+			return result, fmt.Errorf("%w (use -uninstall-command)", err)
+		}
+	}
+
+	// Create the packager
+	pkg := packager.New(packager.Options{
+		SourceDir:           absSourceDir,
+		SetupFile:           target.SetupFile,
+		OutputDir:           opts.outputDir,
+		Quiet:               opts.quiet,
+		Architecture:        target.Architecture,
+		MSIXWrapper:         opts.msixWrapper,
+		StrictCompat:        opts.strictCompat,
+		ToolVersion:         opts.toolVersion,
+		ProfileIdentifier:   opts.profile,
+		Name:                opts.name,
+		EscrowKey:           opts.escrowKey,
+		Strict:              opts.strict,
+		Suppress:            opts.suppress,
+		Logger:              logger,
+		JobID:               jobID,
+		OpenRetries:         opts.openRetries,
+		OpenRetryDelay:      opts.openRetryDelay,
+		WriteRetries:        opts.writeRetries,
+		WriteRetryDelay:     opts.writeRetryDelay,
+		SkipLocked:          opts.skipLocked,
+		Unreadable:          opts.unreadable,
+		ChangedFileRetries:  opts.changedRetries,
+		IncludeHidden:       opts.includeHidden,
+		PruneEmptyDirs:      opts.pruneEmptyDirs,
+		Links:               opts.links,
+		SkipHardLinks:       opts.skipHardLinks,
+		StripZoneIdentifier: opts.stripZone,
+		Workers:             opts.workers,
+		MaxFileSize:         opts.limits.MaxFileSizeMB << 20,
+		MaxSourceSize:       opts.limits.MaxTotalSizeMB << 20,
+		FailOnSizeLimit:     opts.limits.Fail,
+		BuildInfo:           opts.stamp,
+		BuildTool:           "open-package " + version,
+		Sources:             opts.sources,
+		Rewrites:            opts.rewrites,
+		Generated:           opts.generated,
+		Timestamps:          opts.timestamps,
+		Timestamp:           opts.timestamp,
+		Attributes:          opts.attributes,
+		Sandbox:             opts.sandbox,
+		Temp:                opts.temp,
+		Progress:            opts.progress.handler(jobID),
+	})
+
+	if !opts.quiet {
+		fmt.Println()
+		if target.Architecture != "" {
+			fmt.Printf(tr("Architecture: %s\n"), target.Architecture)
+		}
+		fmt.Printf(tr("Source: %s\n"), absSourceDir)
+		fmt.Printf(tr("Setup file: %s\n"), target.SetupFile)
+		fmt.Printf(tr("Output: %s\n"), opts.outputDir)
+		fmt.Printf(tr("Job: %s\n"), jobID)
+		if len(opts.app.Architectures) > 0 || opts.app.MinimumWindowsRelease != "" {
+			fmt.Printf(tr("Applicability: %s\n"), opts.app.Applicability(target.Architecture))
+		}
+		fmt.Println()
+	}
+
+	// Create the package
+	outputPath, err := pkg.CreatePackage()
+	if err != nil {
+		return result, fmt.Errorf("creating package: %w", err)
+	}
+	for _, w := range pkg.WarningDetails() {
+		fmt.Fprintf(os.Stderr, tr("Warning: %s\n"), w)
+	}
+	result.warnings = append(result.warnings, pkg.WarningDetails()...)
+	for _, path := range pkg.Skipped() {
+		fmt.Fprintf(os.Stderr, tr("Skipped file: %s\n"), path)
+	}
+	result.skipped = pkg.Skipped()
+	result.excluded = pkg.Excluded()
+	result.emptyDirs = pkg.EmptyDirs()
+	result.hardLinks = pkg.HardLinks()
+	result.duplicates = pkg.Duplicates()
+	if len(result.duplicates) > 0 {
+		copies := 0
+		for _, d := range result.duplicates {
+			copies += len(d.Paths) - 1
+		}
+		fmt.Fprintf(os.Stderr, tr("Note: %d files duplicate other packaged files, wasting %d bytes\n"), copies, packager.WastedSize(result.duplicates))
+	}
+	result.drivers = pkg.Drivers()
+	if len(result.drivers) > 0 {
+		fmt.Fprintf(os.Stderr, tr("Note: the source contains %d driver packages; Win32 apps only install drivers staged by the install command (pnputil /add-driver <inf> /install)\n"), len(result.drivers))
+	}
+	result.streams = pkg.Streams()
+	result.packages = []string{outputPath}
+
+	var manifest *changes.Manifest
+	if opts.fileManifest || opts.registry != "" {
+		manifest, err = changes.FromPackage(outputPath)
+		if err != nil {
+			return result, fmt.Errorf("creating file manifest: %w", err)
+		}
+	}
+
+	// Modified content must not be released under a version already built
+	version, _ := packager.SetupVersion(absSourceDir, target.SetupFile)
+	if opts.registry != "" && version != "" {
+		if err := checkVersion(opts.registry, outputPath, version, target.Architecture, manifest); err != nil {
+			if err := result.warn(opts, logger, packager.Warning{Code: packager.WarnReusedVersion, Message: err.Error()}); err != nil {
+				// The escrowed keys were written with the package
+				for _, path := range []string{outputPath, outputPath + escrow.KeysSuffix, outputPath + escrow.SidecarSuffix} {
+					os.Remove(path)
+				}
+				return result, err
+			}
+		}
+	}
+
+	if opts.fileManifest {
+		if err := manifest.Save(outputPath + changes.ManifestSuffix); err != nil {
+			return result, err
+		}
+	}
+
+	if opts.uploadScript || !opts.app.IsZero() {
+		if err := writeAppFiles(outputPath, target.Architecture, opts); err != nil {
+			return result, err
+		}
+	}
+
+	if opts.uninstallPackage {
+		uninstallPath, err := pkg.CreateUninstallPackage(uninstallCommand)
+		if err != nil {
+			return result, fmt.Errorf("creating uninstall package: %w", err)
+		}
+		result.packages = append(result.packages, uninstallPath)
+	}
+
+	if len(opts.hooks.PostPack) > 0 {
+		for _, outputPath := range result.packages {
+			digest, err := fileSHA256(outputPath)
+			if err != nil {
+				return result, err
+			}
+			hookEnv["PACKAGE"] = outputPath
+			hookEnv["PACKAGE_SHA256"] = digest
+			if err := runHooks(opts, opts.hooks.PostPack, hookEnv); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	if opts.registry != "" {
+		if err := recordBuilds(opts.registry, result, version, target.Architecture, manifest); err != nil {
+			return result, err
+		}
+	}
+
+	if logger != nil {
+		for _, outputPath := range result.packages {
+			logger.Printf("Created %s", outputPath)
+		}
+	}
+
+	return result, nil
+}
+
+// newJobID returns a random correlation ID for a package build
+func newJobID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("creating job ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// writeAppFiles writes the app sidecar of a package if the config has
+// app metadata, and its IntuneWin32App upload script if requested
+func writeAppFiles(packagePath, architecture string, opts buildOptions) error {
+	pkg, err := unpacker.Open(packagePath)
+	if err != nil {
+		return fmt.Errorf("reading package for app sidecar: %w", err)
+	}
+
+	if !opts.app.IsZero() {
+		app := lobapp.New(lobapp.Options{
+			PackagePath:      packagePath,
+			Info:             pkg.Info,
+			Metadata:         opts.app,
+			UninstallCommand: opts.uninstallCommand,
+			Architecture:     architecture,
+		})
+		if _, err := app.Write(packagePath); err != nil {
+			return err
+		}
+		if _, err := app.WriteLocalized(packagePath, opts.app); err != nil {
+			return err
+		}
+	}
+
+	if opts.uploadScript {
+		script := snippet.Generate(snippet.Options{
+			PackagePath:      packagePath,
+			Info:             pkg.Info,
+			Metadata:         opts.app,
+			UninstallCommand: opts.uninstallCommand,
+			Architecture:     architecture,
+		})
+		if err := os.WriteFile(snippet.Path(packagePath), script, 0644); err != nil {
+			return fmt.Errorf("failed to write upload script: %w", err)
+		}
+	}
+	return nil
+}
+
+// runSmokeTests runs the smoke test hooks with the output of runHooks
+func runSmokeTests(opts buildOptions, env map[string]string) ([]config.SmokeTestResult, error) {
+	stdout := io.Writer(os.Stdout)
+	if opts.quiet {
+		stdout = os.Stderr
+	}
+	return config.RunSmokeTests(opts.hooks.SmokeTest, opts.hookDir, env, stdout, os.Stderr)
+}
+
+// runHooks runs config hooks. Hook output goes to stderr in quiet mode,
+// so that stdout only lists the created packages.
+func runHooks(opts buildOptions, commands []string, env map[string]string) error {
+	stdout := io.Writer(os.Stdout)
+	if opts.quiet {
+		stdout = os.Stderr
+	}
+	return config.RunHooks(commands, opts.hookDir, env, stdout, os.Stderr)
+}
+
+// fileSHA256 returns the hex SHA256 digest of a file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/MANCHTOOLS/open-package/packager"
+)
+
+// Stages of the last event of builds that did not complete
+const (
+	stageFailed    = "failed"
+	stageCancelled = "cancelled"
+)
+
+// progressEvent is a line of the progress file
+type progressEvent struct {
+	JobID string `json:"jobId"`
+	packager.Progress
+	Error string `json:"error,omitempty"`
+}
+
+// progressFile writes progress events as JSON lines, for wrapper GUIs
+type progressFile struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+	// job is the job of the last event, until it is done or failed
+	job string
+}
+
+// openProgressFile opens the progress file at path. Named pipes of
+// Windows (\\.\pipe\name) must exist and are opened for writing as they
+// are; FIFOs of Unix block until the reader has opened them.
+func openProgressFile(path string) (*progressFile, error) {
+	flags := os.O_WRONLY
+	if !strings.HasPrefix(path, `\\.\pipe\`) {
+		flags |= os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &progressFile{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// write writes an event. Errors are ignored, so that a GUI that closes
+// the pipe does not fail the build.
+func (f *progressFile) write(event progressEvent) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.job = event.JobID
+	if event.Stage == packager.StageDone || event.Stage == stageFailed {
+		f.job = ""
+	}
+	f.enc.Encode(event)
+}
+
+// handler returns the Options.Progress of the builds of a job
+func (f *progressFile) handler(jobID string) func(packager.Progress) {
+	if f == nil {
+		return nil
+	}
+	return func(p packager.Progress) {
+		f.write(progressEvent{JobID: jobID, Progress: p})
+	}
+}
+
+// failed writes the last event of a failed job
+func (f *progressFile) failed(jobID string, err error) {
+	f.write(progressEvent{JobID: jobID, Progress: packager.Progress{Stage: stageFailed}, Error: err.Error()})
+}
+
+// cancelled writes the last event of the job of the last event, when the
+// command is interrupted
+func (f *progressFile) cancelled() {
+	f.mu.Lock()
+	job := f.job
+	f.mu.Unlock()
+	if job != "" {
+		f.write(progressEvent{JobID: job, Progress: packager.Progress{Stage: stageCancelled}})
+	}
+}
+
+// Close closes the progress file
+func (f *progressFile) Close() error {
+	if f == nil {
+		return nil
+	}
+	return f.file.Close()
+}
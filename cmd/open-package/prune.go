@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MANCHTOOLS/open-package/config"
+	"github.com/MANCHTOOLS/open-package/prune"
+)
+
+// runPrune removes old package versions from an output directory
+func runPrune(args []string) {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	keep := fs.Int("keep", 0, "Number of versions to keep per app (default: retention.keep of -config, or 3)")
+	configFile := fs.String("config", "", "Prune the retention directory (or output) of a build config")
+	dryRun := fs.Bool("dry-run", false, "List the files that would be removed without removing them")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s prune [options] <output folder>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s prune [options] -config <config.json>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Keeps the newest versions of each app and removes older packages with their\n")
+		fmt.Fprintf(os.Stderr, "sidecars and upload scripts.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	dir := fs.Arg(0)
+	defaultKeep := 3
+	if *configFile != "" {
+		cfg, err := config.Load(*configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		dir = cfg.Retention.Dir
+		if dir == "" {
+			dir = cfg.Output
+		}
+		if config.Deferred(dir) {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), "set retention.dir, the output of the config uses ProductVersion")
+			os.Exit(1)
+		}
+		if cfg.Retention.Keep > 0 {
+			defaultKeep = cfg.Retention.Keep
+		}
+	}
+	if dir == "" || (fs.NArg() > 0 && *configFile != "") || fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *keep == 0 {
+		*keep = defaultKeep
+	}
+
+	removed, err := pruneOutput(dir, *keep, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+	for _, path := range removed {
+		fmt.Printf("%s %s\n", verb, path)
+	}
+	fmt.Printf("%s %d files\n", verb, len(removed))
+}
+
+// pruneOutput keeps the newest versions of each app in dir and returns
+// the removed files, or the files that would be removed in a dry run
+func pruneOutput(dir string, keep int, dryRun bool) ([]string, error) {
+	apps, err := prune.Plan(dir, keep)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		return prune.Remove(dir, apps)
+	}
+	var files []string
+	for _, app := range apps {
+		for _, v := range app.Remove {
+			files = append(files, v.Files()...)
+		}
+	}
+	return files, nil
+}
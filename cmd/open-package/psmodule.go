@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MANCHTOOLS/open-package/psmodule"
+)
+
+// runPSModule writes the PowerShell module that wraps this CLI
+func runPSModule(args []string) {
+	fs := flag.NewFlagSet("ps-module", flag.ExitOnError)
+	outputDir := fs.String("output", psmodule.Name, "Module folder; name it "+psmodule.Name+" and place it in a PSModulePath folder to import it by name")
+	cliPath := fs.String("cli", "", "Path of the open-package executable the cmdlets run (default: open-package from PATH, or $"+psmodule.CLIEnv+")")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s ps-module [-output <folder>] [-cli <path>]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Writes the %s PowerShell module, with the New-OpenPackage and Publish-OpenPackage\n", psmodule.Name)
+		fmt.Fprintf(os.Stderr, "cmdlets that run this CLI and return its results as objects.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	paths, err := psmodule.Write(*outputDir, psmodule.Options{CLIPath: *cliPath, Version: version})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	for _, path := range paths {
+		fmt.Printf("Created %s\n", path)
+	}
+	fmt.Printf("Import it with: Import-Module %s\n", *outputDir)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/packager"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// runRepair writes a copy of a package with a regenerated Detection.xml
+func runRepair(args []string) {
+	fs := flag.NewFlagSet("repair", flag.ExitOnError)
+	keysFile := fs.String("keys", "", "Keys file: fileEncryptionInfo JSON or a Detection.xml, e.g. from escrow recover (required)")
+	output := fs.String("output", "", "Path of the repaired package (default: <package>_repaired.intunewin)")
+	name := fs.String("name", "", "Name of the app (default: from the damaged Detection.xml or the content folder)")
+	setupFile := fs.String("setup", "", "Setup file of the app (default: from the damaged Detection.xml)")
+	strictCompat := fs.Bool("strict-compat", false, "Write Detection.xml byte-compatible with the official tool")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s repair -keys <keys.json> [options] <package.intunewin>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Regenerates the Detection.xml of a package from its keys, the header of the\n")
+		fmt.Fprintf(os.Stderr, "encrypted content and the size and digest of the decrypted content.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *keysFile == "" || fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	inputPath := fs.Arg(0)
+
+	outputPath := *output
+	if outputPath == "" {
+		outputPath = strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + "_repaired.intunewin"
+	}
+	absInput, _ := filepath.Abs(inputPath)
+	absOutput, _ := filepath.Abs(outputPath)
+	if absInput == absOutput {
+		fmt.Fprintf(os.Stderr, "Error: the repaired package would overwrite %s\n", inputPath)
+		os.Exit(1)
+	}
+
+	keys, err := unpacker.LoadKeys(*keysFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	// The temporary files are removed before exiting
+	if code := repair(inputPath, outputPath, keys, unpacker.RepairOptions{
+		Name:         *name,
+		SetupFile:    *setupFile,
+		StrictCompat: *strictCompat,
+	}); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// repair writes the package at inputPath with a regenerated Detection.xml
+// to outputPath and returns the exit code
+func repair(inputPath, outputPath string, keys *unpacker.Keys, opts unpacker.RepairOptions) int {
+	temp, cleanup := trackTemp(false)
+	defer cleanup()
+	opts.Temp = temp
+	detectionXML, err := unpacker.Repair(inputPath, keys, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		return 1
+	}
+	if err := writeRepaired(inputPath, outputPath, detectionXML); err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		return 1
+	}
+	fmt.Printf("Repaired: %s\n", outputPath)
+	return 0
+}
+
+// writeRepaired writes the encrypted content of the package at inputPath
+// with a new Detection.xml to outputPath
+func writeRepaired(inputPath, outputPath string, detectionXML []byte) error {
+	encrypted, err := unpacker.OpenEncrypted(inputPath)
+	if err != nil {
+		return err
+	}
+	defer encrypted.Close()
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if err := packager.WriteOuter(file, detectionXML, encrypted); err != nil {
+		file.Close()
+		os.Remove(outputPath)
+		return err
+	}
+	return file.Close()
+}
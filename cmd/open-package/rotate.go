@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/escrow"
+	"github.com/MANCHTOOLS/open-package/packager"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// runRotateKeys re-encrypts a package with new keys
+func runRotateKeys(args []string) {
+	fs := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	output := fs.String("output", "", "Path of the new package (default: <package>_rotated.intunewin)")
+	strictCompat := fs.Bool("strict-compat", false, "Write Detection.xml byte-compatible with the official tool")
+	escrowKeyFile := fs.String("escrow-key", "", "Escrow key file; writes encrypted keys and a sidecar next to the new package")
+	quiet := fs.Bool("quiet", false, "Suppress progress output")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s rotate-keys [options] <package.intunewin>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Re-encrypts the unchanged content of a package with new random keys.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	inputPath := fs.Arg(0)
+
+	outputPath := *output
+	if outputPath == "" {
+		outputPath = strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + "_rotated.intunewin"
+	}
+	absInput, _ := filepath.Abs(inputPath)
+	absOutput, _ := filepath.Abs(outputPath)
+	if absInput == absOutput {
+		fmt.Fprintf(os.Stderr, "Error: the new package would overwrite %s\n", inputPath)
+		os.Exit(1)
+	}
+
+	var escrowKey *escrow.Key
+	if *escrowKeyFile != "" {
+		key, err := escrow.LoadKey(*escrowKeyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		escrowKey = key
+	}
+
+	// The temporary files are removed before exiting
+	if code := rotateKeys(inputPath, outputPath, escrowKey, *strictCompat, *quiet); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// rotateKeys re-encrypts the package at inputPath to outputPath and
+// returns the exit code
+func rotateKeys(inputPath, outputPath string, escrowKey *escrow.Key, strictCompat, quiet bool) int {
+	temp, cleanup := trackTemp(false)
+	defer cleanup()
+
+	// The content is decrypted to a temporary file and encrypted from it
+	inner, err := unpacker.OpenInner(inputPath, nil, temp)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		return 1
+	}
+	defer inner.Close()
+	for _, w := range inner.Package.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	content := inner.Content()
+
+	jobID, err := newJobID()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		return 1
+	}
+	rotator := packager.New(packager.Options{
+		Quiet:        quiet,
+		StrictCompat: strictCompat,
+		EscrowKey:    escrowKey,
+		JobID:        jobID,
+		Temp:         temp,
+	})
+	if err := rotator.RotateKeys(inner.Package.Info, content, content.Size(), outputPath); err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		return 1
+	}
+
+	if !quiet {
+		fmt.Println()
+		fmt.Printf("Successfully created: %s\n", outputPath)
+	} else {
+		fmt.Println(outputPath)
+	}
+	return 0
+}
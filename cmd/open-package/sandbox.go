@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/packager"
+)
+
+// sandboxCommand is the hidden command run by the sandboxed process
+const sandboxCommand = "sandbox-zip"
+
+// processSandbox creates inner ZIPs in a copy of this executable with fewer
+// privileges, as restrictCommand allows on the platform
+type processSandbox struct {
+	// user is the account the process runs as when started as root
+	// (optional, defaults to nobody)
+	user string
+}
+
+// ZipSource starts the sandboxed process. It receives the options on
+// stdin and writes the inner ZIP to stdout, followed by the manifest, or
+// the error, on stderr once it exits.
+func (s processSandbox) ZipSource(sourceDir string, opts packager.Options) (io.ReadCloser, *packager.Manifest, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.SourceDir = sourceDir
+	input, err := json.Marshal(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cmd := exec.Command(exe, sandboxCommand)
+	release, err := restrictCommand(cmd, s.user)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+	cmd.Stdin = bytes.NewReader(input)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("failed to start sandboxed process: %w", err)
+	}
+	manifest := &packager.Manifest{}
+	return &sandboxReader{cmd: cmd, stdout: stdout, stderr: stderr, manifest: manifest}, manifest, nil
+}
+
+// sandboxReader reads the inner ZIP from the sandboxed process and fills
+// in the manifest once the process has exited
+type sandboxReader struct {
+	cmd      *exec.Cmd
+	stdout   io.Reader
+	stderr   *bytes.Buffer
+	manifest *packager.Manifest
+	done     bool
+	err      error
+}
+
+func (r *sandboxReader) Read(b []byte) (int, error) {
+	if r.done {
+		if r.err != nil {
+			return 0, r.err
+		}
+		return 0, io.EOF
+	}
+	n, err := r.stdout.Read(b)
+	if err == io.EOF {
+		if err := r.wait(); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+// wait waits for the process and reads its results
+func (r *sandboxReader) wait() error {
+	r.done = true
+	if err := r.cmd.Wait(); err != nil {
+		msg := strings.TrimSpace(r.stderr.String())
+		if msg == "" {
+			r.err = fmt.Errorf("sandboxed process failed: %w", err)
+		} else {
+			r.err = errors.New(strings.TrimPrefix(msg, "Error: "))
+		}
+		return r.err
+	}
+	if err := json.Unmarshal(r.stderr.Bytes(), r.manifest); err != nil {
+		r.err = fmt.Errorf("invalid results of sandboxed process: %w", err)
+	}
+	return r.err
+}
+
+// Close stops the process if the inner ZIP was not read to the end
+func (r *sandboxReader) Close() error {
+	if !r.done {
+		r.done = true
+		r.cmd.Process.Kill()
+		r.cmd.Wait()
+	}
+	return nil
+}
+
+// runSandboxZip runs in the sandboxed process, see processSandbox
+func runSandboxZip(args []string) {
+	var opts packager.Options
+	if err := json.NewDecoder(os.Stdin).Decode(&opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid options: %v\n", err)
+		os.Exit(1)
+	}
+	rc, manifest, err := packager.ZipSource(opts.SourceDir, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	if _, err := io.Copy(os.Stdout, rc); err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+	if err := json.NewEncoder(os.Stderr).Encode(manifest); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// restrictCommand fails, as the sandbox is only supported on Linux and
+// Windows
+func restrictCommand(cmd *exec.Cmd, name string) (func(), error) {
+	return nil, fmt.Errorf("the sandbox is not supported on %s", runtime.GOOS)
+}
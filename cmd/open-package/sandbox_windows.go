@@ -0,0 +1,48 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modadvapi32               = syscall.NewLazyDLL("advapi32.dll")
+	procCreateRestrictedToken = modadvapi32.NewProc("CreateRestrictedToken")
+)
+
+// Flags of CreateRestrictedToken
+const (
+	disableMaxPrivilege = 0x1
+	luaToken            = 0x4
+)
+
+// restrictCommand runs the sandboxed process with a restricted copy of the
+// token of this process: without privileges and, when elevated, without
+// the rights of the Administrators group. The returned function closes
+// the token once the process has started.
+func restrictCommand(cmd *exec.Cmd, name string) (func(), error) {
+	if name != "" {
+		return nil, fmt.Errorf("running as another user is not supported on Windows")
+	}
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return nil, err
+	}
+	var token syscall.Token
+	if err := syscall.OpenProcessToken(process, syscall.TOKEN_DUPLICATE|syscall.TOKEN_ASSIGN_PRIMARY|syscall.TOKEN_QUERY, &token); err != nil {
+		return nil, fmt.Errorf("failed to open process token: %w", err)
+	}
+	defer token.Close()
+
+	var restricted syscall.Token
+	ok, _, err := procCreateRestrictedToken.Call(uintptr(token), disableMaxPrivilege|luaToken, 0, 0, 0, 0, 0, 0, uintptr(unsafe.Pointer(&restricted)))
+	if ok == 0 {
+		return nil, fmt.Errorf("failed to create restricted token: %w", err)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Token: restricted}
+	return func() { restricted.Close() }, nil
+}
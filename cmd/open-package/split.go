@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/MANCHTOOLS/open-package/packager"
+	"github.com/MANCHTOOLS/open-package/split"
+)
+
+// partConfig is the config file definition of a suggested package
+type partConfig struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Setup  string `json:"setup"`
+}
+
+// splitOutput is the JSON output of advise-split
+type splitOutput struct {
+	*split.Advice
+	Configs []partConfig `json:"configs"`
+}
+
+// runAdviseSplit suggests how to split a source folder over the Intune
+// content limit into a main package and data packages
+func runAdviseSplit(args []string) {
+	fs := flag.NewFlagSet("advise-split", flag.ExitOnError)
+	setupFile := fs.String("setup", "", "Name of the setup file within the source folder (required)")
+	name := fs.String("name", "", "Application name (default: source folder name)")
+	limit := fs.Int64("limit", packager.MaxContentSize>>20, "Largest package size in MB")
+	jsonOutput := fs.Bool("json", false, "Print the advice and config definitions as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s advise-split [options] -setup <file> <source folder>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Suggests how to split a source over the Intune content limit into a main package\n")
+		fmt.Fprintf(os.Stderr, "with the setup file and data packages deployed as its dependencies.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *setupFile == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	source := fs.Arg(0)
+	advice, err := split.Advise(source, *setupFile, *limit<<20)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+		os.Exit(1)
+	}
+
+	appName := *name
+	if appName == "" {
+		abs, err := filepath.Abs(source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		appName = filepath.Base(abs)
+	}
+	out := splitOutput{Advice: advice}
+	for i := range advice.Parts {
+		if i == 0 {
+			out.Configs = append(out.Configs, partConfig{Name: appName, Source: source, Setup: *setupFile})
+			continue
+		}
+		out.Configs = append(out.Configs, partConfig{
+			Name:   fmt.Sprintf("%s Data %d", appName, i),
+			Source: fmt.Sprintf("%s-data%d", filepath.Clean(source), i),
+			Setup:  "install.cmd",
+		})
+	}
+
+	if *jsonOutput {
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("Source size:            %s\n", formatSize(advice.SourceSize))
+	fmt.Printf("Limit:                  %s\n", formatSize(advice.Limit))
+	if len(advice.Parts) == 1 && len(advice.Oversized) == 0 {
+		fmt.Println("The source fits into a single package.")
+		return
+	}
+	for i, part := range advice.Parts {
+		kind := "main package with the setup file"
+		if !part.Main {
+			kind = "data package, source " + out.Configs[i].Source
+		}
+		fmt.Printf("\nPart %d (%s): %s\n", i+1, kind, formatSize(part.Size))
+		for _, path := range part.Paths {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+	if len(advice.Oversized) > 0 {
+		fmt.Printf("\nFiles over the limit, to be downloaded at install time (see wrap-download):\n")
+		for _, path := range advice.Oversized {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+
+	if len(out.Configs) > 1 {
+		fmt.Printf("\nMove the paths of each data part to its source folder and add an install script\n")
+		fmt.Printf("that copies the content where the main setup expects it. Deploy the data packages\n")
+		fmt.Printf("as dependencies of the main app. Config definitions:\n\n")
+		data, err := json.MarshalIndent(out.Configs, "", "    ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// runUnpack decrypts a package and extracts its content
+func runUnpack(args []string) {
+	fs := flag.NewFlagSet("unpack", flag.ExitOnError)
+	outputDir := fs.String("output", ".", "Directory to extract the package content to")
+	quiet := fs.Bool("quiet", false, "Suppress progress output")
+	keepTemp := fs.Bool("keep-temp", false, "Keep temporary files for debugging and print their locations")
+	keysFile := fs.String("keys", "", "Keys file (fileEncryptionInfo JSON or Detection.xml) to decrypt a package whose Detection.xml is damaged")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s unpack [-output <dir>] [-keys <keys.json>] <package.intunewin>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	// The temporary files are removed before exiting
+	if code := unpack(fs.Arg(0), *outputDir, *keysFile, *keepTemp, *quiet); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// unpack extracts the package at inputPath to outputDir and returns the
+// exit code
+func unpack(inputPath, outputDir, keysFile string, keepTemp, quiet bool) int {
+	// The content is verified while it is decrypted to a temporary file,
+	// and only extracted once HMAC and digest match
+	temp, cleanup := trackTemp(keepTemp)
+	defer cleanup()
+	var files []string
+	if keysFile != "" {
+		keys, err := unpacker.LoadKeys(keysFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			return 1
+		}
+		if files, err = unpacker.UnpackWithKeys(inputPath, outputDir, keys, temp); err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			return 1
+		}
+	} else {
+		pkg, extracted, err := unpacker.UnpackWith(inputPath, outputDir, temp)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, tr("Error: %v\n"), err)
+			return 1
+		}
+		for _, w := range pkg.Warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+		}
+		files = extracted
+	}
+
+	if !quiet {
+		for _, f := range files {
+			fmt.Println(f)
+		}
+		fmt.Printf("Extracted %d file(s) to %s\n", len(files), outputDir)
+	}
+	return 0
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MANCHTOOLS/open-package/metadata"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// verifyResult is the result of a package in the report of verify -dir
+type verifyResult struct {
+	Package string `json:"package"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	// Problems are the structure or Detection.xml problems of the package
+	Problems []string `json:"problems,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// verifyReport is the report of verify -dir
+type verifyReport struct {
+	Dir      string         `json:"dir"`
+	Mode     string         `json:"mode"`
+	Total    int            `json:"total"`
+	Passed   int            `json:"passed"`
+	Failed   int            `json:"failed"`
+	Packages []verifyResult `json:"packages"`
+}
+
+// walkError is a folder below the packages that could not be read
+type walkError struct {
+	Path string
+	Err  error
+}
+
+// findPackages returns the .intunewin files below dir, sorted. Folders
+// that cannot be read are returned as walk errors, so that one of them
+// does not stop the audit; only an unreadable dir is an error.
+func findPackages(dir string) (packages []string, unreadable []walkError, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			unreadable = append(unreadable, walkError{Path: path, Err: err})
+			return nil
+		}
+		if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".intunewin") {
+			packages = append(packages, path)
+		}
+		return nil
+	})
+	sort.Strings(packages)
+	return packages, unreadable, err
+}
+
+// verifyDir verifies the packages below dir with the given number of
+// workers and returns the report. Progress is printed to stderr unless
+// quiet.
+func verifyDir(dir string, mode unpacker.VerifyMode, workers int, quiet bool) (*verifyReport, error) {
+	packages, unreadable, err := findPackages(dir)
+	if err != nil {
+		return nil, err
+	}
+	return verifyPackages(dir, packages, unreadable, mode, workers, quiet), nil
+}
+
+// verifyPackages verifies the packages found below dir and reports them
+// together with the folders that could not be read
+func verifyPackages(dir string, packages []string, unreadable []walkError, mode unpacker.VerifyMode, workers int, quiet bool) *verifyReport {
+	report := &verifyReport{Dir: dir, Mode: mode.String(), Packages: make([]verifyResult, len(packages))}
+
+	var mu sync.Mutex
+	done := 0
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start := time.Now()
+				result := verifyOne(packages[i], mode)
+				report.Packages[i] = result
+				if quiet {
+					continue
+				}
+				mu.Lock()
+				done++
+				fmt.Fprintf(os.Stderr, "  [%d/%d] %s: %s (%s)\n", done, len(packages), packages[i], result.Status, time.Since(start).Round(time.Millisecond))
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range packages {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Packages in unreadable folders cannot be verified
+	for _, walkErr := range unreadable {
+		report.Packages = append(report.Packages, verifyResult{Package: walkErr.Path, Status: "failed", Error: walkErr.Err.Error()})
+	}
+	report.Total = len(report.Packages)
+	for _, result := range report.Packages {
+		if result.Status == "ok" {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+	return report
+}
+
+// verifyOne verifies a package and describes the result
+func verifyOne(path string, mode unpacker.VerifyMode) verifyResult {
+	result := verifyResult{Package: path, Status: "ok"}
+	pkg, err := unpacker.VerifyFile(path, unpacker.VerifyOptions{Mode: mode})
+	if err == nil {
+		result.Warnings = pkg.Warnings
+		return result
+	}
+	result.Status = "failed"
+	result.Error = err.Error()
+	var validationErr *metadata.ValidationError
+	var structureErr *unpacker.StructureError
+	switch {
+	case errors.As(err, &structureErr):
+		for _, problem := range structureErr.Problems {
+			result.Problems = append(result.Problems, problem.String())
+		}
+	case errors.As(err, &validationErr):
+		result.Problems = validationErr.Problems
+	}
+	return result
+}
+
+// printVerifyReport prints the failed packages and the totals of a report
+func printVerifyReport(report *verifyReport) {
+	for _, result := range report.Packages {
+		if result.Status == "ok" {
+			continue
+		}
+		fmt.Printf("FAILED %s: %s\n", result.Package, result.Error)
+		for _, problem := range result.Problems {
+			fmt.Printf("  %s\n", problem)
+		}
+	}
+	fmt.Printf("%d of %d package(s) passed %s verification, %d failed\n", report.Passed, report.Total, report.Mode, report.Failed)
+}
+
+// writeVerifyReport writes a report as JSON to path
+func writeVerifyReport(report *verifyReport, path string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/MANCHTOOLS/open-package/packager"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+func TestVerifyPackages(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-verifydir-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.exe"), []byte(strings.Repeat("setup", 1000)), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+	packagesDir := filepath.Join(tempDir, "packages")
+	if err := os.MkdirAll(filepath.Join(packagesDir, "good"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	good, err := packager.New(packager.Options{SourceDir: sourceDir, SetupFile: "install.exe", OutputDir: filepath.Join(packagesDir, "good"), Quiet: true}).CreatePackage()
+	if err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+
+	// A package with a flipped byte in its content, and one that is not
+	// a package at all
+	data, err := os.ReadFile(good)
+	if err != nil {
+		t.Fatalf("Failed to read package: %v", err)
+	}
+	data[len(data)/2] ^= 0xff
+	corrupt := filepath.Join(packagesDir, "corrupt.intunewin")
+	if err := os.WriteFile(corrupt, data, 0644); err != nil {
+		t.Fatalf("Failed to write package: %v", err)
+	}
+	truncated := filepath.Join(packagesDir, "truncated.intunewin")
+	if err := os.WriteFile(truncated, data[:100], 0644); err != nil {
+		t.Fatalf("Failed to write package: %v", err)
+	}
+
+	packages, unreadable, err := findPackages(packagesDir)
+	if err != nil {
+		t.Fatalf("findPackages failed: %v", err)
+	}
+	if len(packages) != 3 || len(unreadable) != 0 {
+		t.Fatalf("Unexpected packages %v and unreadable folders %v", packages, unreadable)
+	}
+	// Folders cannot be made unreadable for root, so the walk error is
+	// passed in
+	locked := filepath.Join(packagesDir, "locked")
+	unreadable = append(unreadable, walkError{Path: locked, Err: errors.New("permission denied")})
+
+	for _, mode := range []unpacker.VerifyMode{unpacker.VerifyQuick, unpacker.VerifyFull} {
+		report := verifyPackages(packagesDir, packages, unreadable, mode, 2, true)
+		if report.Total != 4 || report.Passed != 1 || report.Failed != 3 {
+			t.Errorf("%s: unexpected totals %d/%d/%d", mode, report.Total, report.Passed, report.Failed)
+		}
+		statuses := make(map[string]string)
+		for _, result := range report.Packages {
+			statuses[result.Package] = result.Status
+			if result.Status != "ok" && result.Error == "" {
+				t.Errorf("%s: %s failed without an error", mode, result.Package)
+			}
+		}
+		expected := map[string]string{good: "ok", corrupt: "failed", truncated: "failed", locked: "failed"}
+		for path, status := range expected {
+			if statuses[path] != status {
+				t.Errorf("%s: %s is %q, expected %q", mode, path, statuses[path], status)
+			}
+		}
+	}
+
+	if _, err := verifyDir(filepath.Join(tempDir, "missing"), unpacker.VerifyQuick, 1, true); err == nil {
+		t.Error("Expected error for a missing folder")
+	}
+}
+
+func TestFindPackagesUnreadable(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("folders cannot be made unreadable by mode on Windows or for root")
+	}
+	tempDir, err := os.MkdirTemp("", "open-package-verifydir-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	locked := filepath.Join(tempDir, "locked")
+	if err := os.MkdirAll(locked, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "app.intunewin"), []byte("package"), 0644); err != nil {
+		t.Fatalf("Failed to write package: %v", err)
+	}
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatalf("Failed to lock dir: %v", err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	packages, unreadable, err := findPackages(tempDir)
+	if err != nil {
+		t.Fatalf("findPackages failed: %v", err)
+	}
+	if len(packages) != 1 || len(unreadable) != 1 || unreadable[0].Path != locked {
+		t.Errorf("Unexpected packages %v and unreadable folders %v", packages, unreadable)
+	}
+}
@@ -0,0 +1,258 @@
+// Package compat compares a package created by Microsoft's Win32 Content
+// Prep Tool (IntuneWinAppUtil) with a package created by this tool from
+// the same source folder.
+//
+// Encryption keys, IVs and MACs are random for every package, so they are
+// not compared directly. Instead both packages are verified and decrypted
+// with their own keys, and the comparison covers:
+//   - Structure: the entries of the outer ZIP
+//   - Detection: the Detection.xml fields that do not depend on the keys
+//   - Integrity: HMAC, digest and size verification of each package
+//   - Content: the files in the decrypted inner ZIP and their SHA256 hashes
+package compat
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/crypto"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// Areas of a package covered by the comparison
+const (
+	AreaStructure = "structure"
+	AreaDetection = "detection"
+	AreaIntegrity = "integrity"
+	AreaContent   = "content"
+)
+
+// Difference is a single divergence between the two packages
+type Difference struct {
+	// Area is the part of the package that differs
+	Area string
+	// Item is the entry path or Detection.xml field that differs
+	Item string
+	// Official is the value in the package of the official tool
+	Official string
+	// Ours is the value in the package created by this tool
+	Ours string
+}
+
+// String formats the difference for display
+func (d Difference) String() string {
+	return fmt.Sprintf("[%s] %s: official=%q ours=%q", d.Area, d.Item, d.Official, d.Ours)
+}
+
+// Report is the result of a comparison
+type Report struct {
+	Differences []Difference
+}
+
+// Compatible reports whether no differences were found
+func (r *Report) Compatible() bool {
+	return len(r.Differences) == 0
+}
+
+func (r *Report) add(area, item, official, ours string) {
+	r.Differences = append(r.Differences, Difference{Area: area, Item: item, Official: official, Ours: ours})
+}
+
+// Compare opens and compares the packages at the given paths
+func Compare(officialPath, oursPath string) (*Report, error) {
+	official, err := unpacker.Open(officialPath)
+	if err != nil {
+		return nil, fmt.Errorf("official package: %w", err)
+	}
+	ours, err := unpacker.Open(oursPath)
+	if err != nil {
+		return nil, fmt.Errorf("our package: %w", err)
+	}
+	return ComparePackages(official, ours), nil
+}
+
+// ComparePackages compares two opened packages
+func ComparePackages(official, ours *unpacker.Package) *Report {
+	r := &Report{}
+
+	compareSets(r, AreaStructure, entrySet(official.Entries), entrySet(ours.Entries))
+	compareDetection(r, official, ours)
+
+	officialContent, officialErr := official.Decrypt()
+	oursContent, oursErr := ours.Decrypt()
+	if officialErr != nil || oursErr != nil {
+		r.add(AreaIntegrity, "verification", errorString(officialErr), errorString(oursErr))
+		return r
+	}
+
+	officialFiles, officialErr := innerFiles(officialContent)
+	oursFiles, oursErr := innerFiles(oursContent)
+	if officialErr != nil || oursErr != nil {
+		r.add(AreaIntegrity, "inner ZIP", errorString(officialErr), errorString(oursErr))
+		return r
+	}
+	compareSets(r, AreaContent, officialFiles, oursFiles)
+
+	return r
+}
+
+// compareDetection compares the key independent Detection.xml fields
+func compareDetection(r *Report, official, ours *unpacker.Package) {
+	o, u := official.Info, ours.Info
+	type field struct {
+		name          string
+		official, our string
+	}
+	fields := []field{
+		{"ToolVersion", o.ToolVersion, u.ToolVersion},
+		{"Name", o.Name, u.Name},
+		{"FileName", o.FileName, u.FileName},
+		{"SetupFile", o.SetupFile, u.SetupFile},
+		{"EncryptionInfo/ProfileIdentifier", o.EncryptionInfo.ProfileIdentifier, u.EncryptionInfo.ProfileIdentifier},
+		{"EncryptionInfo/FileDigestAlgorithm", o.EncryptionInfo.FileDigestAlgorithm, u.EncryptionInfo.FileDigestAlgorithm},
+		{"xmlns:xsi", o.XSI, u.XSI},
+		{"xmlns:xsd", o.XSD, u.XSD},
+	}
+
+	// MsiInfo is only written for MSI setup files
+	switch {
+	case (o.MsiInfo == nil) != (u.MsiInfo == nil):
+		r.add(AreaDetection, "MsiInfo", msiPresence(o.MsiInfo != nil), msiPresence(u.MsiInfo != nil))
+	case o.MsiInfo != nil:
+		om, um := o.MsiInfo, u.MsiInfo
+		fields = append(fields, []field{
+			{"MsiInfo/MsiProductCode", om.MsiProductCode, um.MsiProductCode},
+			{"MsiInfo/MsiProductVersion", om.MsiProductVersion, um.MsiProductVersion},
+			{"MsiInfo/MsiPackageCode", om.MsiPackageCode, um.MsiPackageCode},
+			{"MsiInfo/MsiUpgradeCode", om.MsiUpgradeCode, um.MsiUpgradeCode},
+			{"MsiInfo/MsiExecutionContext", om.MsiExecutionContext, um.MsiExecutionContext},
+			{"MsiInfo/MsiRequiresLogon", strconv.FormatBool(om.MsiRequiresLogon), strconv.FormatBool(um.MsiRequiresLogon)},
+			{"MsiInfo/MsiRequiresReboot", strconv.FormatBool(om.MsiRequiresReboot), strconv.FormatBool(um.MsiRequiresReboot)},
+			{"MsiInfo/MsiIsMachineInstall", strconv.FormatBool(om.MsiIsMachineInstall), strconv.FormatBool(um.MsiIsMachineInstall)},
+			{"MsiInfo/MsiIsUserInstall", strconv.FormatBool(om.MsiIsUserInstall), strconv.FormatBool(um.MsiIsUserInstall)},
+			{"MsiInfo/MsiIncludesServices", strconv.FormatBool(om.MsiIncludesServices), strconv.FormatBool(um.MsiIncludesServices)},
+			{"MsiInfo/MsiIncludesODBCDataSource", strconv.FormatBool(om.MsiIncludesODBCDataSource), strconv.FormatBool(um.MsiIncludesODBCDataSource)},
+			{"MsiInfo/MsiContainsSystemRegistryKeys", strconv.FormatBool(om.MsiContainsSystemRegistryKeys), strconv.FormatBool(um.MsiContainsSystemRegistryKeys)},
+			{"MsiInfo/MsiContainsSystemFolders", strconv.FormatBool(om.MsiContainsSystemFolders), strconv.FormatBool(um.MsiContainsSystemFolders)},
+			{"MsiInfo/MsiPublisher", om.MsiPublisher, um.MsiPublisher},
+		}...)
+	}
+
+	for _, f := range fields {
+		if f.official != f.our {
+			r.add(AreaDetection, f.name, f.official, f.our)
+		}
+	}
+
+	// Keys differ by design, but both packages must have them
+	keys := []struct {
+		name          string
+		official, our string
+	}{
+		{"EncryptionInfo/EncryptionKey", o.EncryptionInfo.EncryptionKey, u.EncryptionInfo.EncryptionKey},
+		{"EncryptionInfo/MacKey", o.EncryptionInfo.MacKey, u.EncryptionInfo.MacKey},
+		{"EncryptionInfo/InitializationVector", o.EncryptionInfo.InitializationVector, u.EncryptionInfo.InitializationVector},
+		{"EncryptionInfo/Mac", o.EncryptionInfo.Mac, u.EncryptionInfo.Mac},
+		{"EncryptionInfo/FileDigest", o.EncryptionInfo.FileDigest, u.EncryptionInfo.FileDigest},
+	}
+	for _, k := range keys {
+		if (k.official == "") != (k.our == "") {
+			r.add(AreaDetection, k.name, presence(k.official), presence(k.our))
+		}
+	}
+}
+
+// compareSets reports items missing on either side or with different values
+func compareSets(r *Report, area string, official, ours map[string]string) {
+	names := make(map[string]bool)
+	for name := range official {
+		names[name] = true
+	}
+	for name := range ours {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		o, inOfficial := official[name]
+		u, inOurs := ours[name]
+		switch {
+		case !inOfficial:
+			r.add(area, name, "(missing)", u)
+		case !inOurs:
+			r.add(area, name, o, "(missing)")
+		case o != u:
+			r.add(area, name, o, u)
+		}
+	}
+}
+
+// entrySet converts outer ZIP entry names to a set
+func entrySet(entries []string) map[string]string {
+	set := make(map[string]string, len(entries))
+	for _, name := range entries {
+		if !strings.HasSuffix(name, "/") {
+			set[name] = "present"
+		}
+	}
+	return set
+}
+
+// innerFiles maps the files of the inner ZIP to their SHA256 hashes.
+// Directory entries are mapped to "directory".
+func innerFiles(innerZip []byte) (map[string]string, error) {
+	zr, err := unpacker.ReadInnerZip(innerZip)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string, len(zr.File))
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			files[f.Name] = "directory"
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		files[f.Name] = "sha256:" + hex.EncodeToString(crypto.ComputeSHA256(data)) + " size:" + strconv.Itoa(len(data))
+	}
+	return files, nil
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return err.Error()
+}
+
+// msiPresence describes whether a package has MsiInfo
+func msiPresence(present bool) string {
+	if present {
+		return "present"
+	}
+	return "(missing)"
+}
+
+func presence(value string) string {
+	if value == "" {
+		return "(empty)"
+	}
+	return "present"
+}
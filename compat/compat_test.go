@@ -0,0 +1,136 @@
+package compat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MANCHTOOLS/open-package/metadata"
+	"github.com/MANCHTOOLS/open-package/packager"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// buildPackage creates a package of sourceDir in its own output directory
+func buildPackage(t *testing.T, sourceDir, setupFile, outputDir string) string {
+	t.Helper()
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output dir: %v", err)
+	}
+	outputPath, err := packager.New(packager.Options{
+		SourceDir: sourceDir,
+		SetupFile: setupFile,
+		OutputDir: outputDir,
+		Quiet:     true,
+	}).CreatePackage()
+	if err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	return outputPath
+}
+
+func TestCompare(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-compat-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.exe"), []byte("exe"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+
+	first := buildPackage(t, sourceDir, "install.exe", filepath.Join(tempDir, "a"))
+	second := buildPackage(t, sourceDir, "install.exe", filepath.Join(tempDir, "b"))
+
+	// Two packages of the same source only differ in their random keys
+	report, err := Compare(first, second)
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	if !report.Compatible() {
+		t.Errorf("Expected compatible packages, got %v", report.Differences)
+	}
+
+	// Changed content and setup file are reported
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.exe"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to modify setup file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "extra.txt"), []byte("extra"), 0644); err != nil {
+		t.Fatalf("Failed to create extra file: %v", err)
+	}
+	third := buildPackage(t, sourceDir, "extra.txt", filepath.Join(tempDir, "c"))
+
+	report, err = Compare(first, third)
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+
+	found := make(map[string]bool)
+	for _, d := range report.Differences {
+		found[d.Area+" "+d.Item] = true
+	}
+	for _, expected := range []string{
+		"detection SetupFile",
+		"content app/install.exe",
+		"content app/extra.txt",
+	} {
+		if !found[expected] {
+			t.Errorf("Expected difference %q, got %v", expected, report.Differences)
+		}
+	}
+}
+
+func TestCompareMissingPackage(t *testing.T) {
+	if _, err := Compare("missing-official.intunewin", "missing-ours.intunewin"); err == nil {
+		t.Error("Expected error for missing packages")
+	}
+}
+
+func TestCompareDetectionMsiInfo(t *testing.T) {
+	msiInfo := func(version string, reboot bool) *metadata.MsiInfo {
+		return &metadata.MsiInfo{
+			MsiProductCode:      "{11111111-2222-3333-4444-555555555555}",
+			MsiProductVersion:   version,
+			MsiUpgradeCode:      "{66666666-7777-8888-9999-000000000000}",
+			MsiExecutionContext: "System",
+			MsiRequiresReboot:   reboot,
+			MsiPublisher:        "Contoso",
+		}
+	}
+	pkg := func(msi *metadata.MsiInfo) *unpacker.Package {
+		return &unpacker.Package{Info: &metadata.ApplicationInfo{Name: "App", MsiInfo: msi}}
+	}
+
+	r := &Report{}
+	compareDetection(r, pkg(msiInfo("1.0", false)), pkg(msiInfo("1.0", false)))
+	if !r.Compatible() {
+		t.Errorf("Expected equal MsiInfo, got %v", r.Differences)
+	}
+
+	r = &Report{}
+	compareDetection(r, pkg(msiInfo("1.0", false)), pkg(msiInfo("1.1", true)))
+	found := make(map[string]Difference)
+	for _, d := range r.Differences {
+		found[d.Item] = d
+	}
+	if d := found["MsiInfo/MsiProductVersion"]; d.Official != "1.0" || d.Ours != "1.1" {
+		t.Errorf("Expected product version difference, got %v", r.Differences)
+	}
+	if d := found["MsiInfo/MsiRequiresReboot"]; d.Official != "false" || d.Ours != "true" {
+		t.Errorf("Expected requires reboot difference, got %v", r.Differences)
+	}
+	if len(r.Differences) != 2 {
+		t.Errorf("Expected 2 differences, got %v", r.Differences)
+	}
+
+	// Only one package has MsiInfo
+	r = &Report{}
+	compareDetection(r, pkg(msiInfo("1.0", false)), pkg(nil))
+	if len(r.Differences) != 1 || r.Differences[0].Item != "MsiInfo" || r.Differences[0].Ours != "(missing)" {
+		t.Errorf("Expected MsiInfo presence difference, got %v", r.Differences)
+	}
+}
@@ -0,0 +1,246 @@
+// Package config loads package build definitions from a JSON file.
+//
+// A config file describes the source folder, setup file and output
+// directory of an application, so that the same build can be repeated
+// without retyping command line flags:
+//
+//	{
+//	    "name": "My App",
+//	    "source": "./myapp",
+//	    "setup": "install.exe",
+//	    "output": "./output",
+//	    "architectures": {
+//	        "x64":   { "setup": "install-x64.exe" },
+//	        "arm64": { "source": "arm", "setup": "install-arm64.exe" }
+//	    },
+//	    "hooks": {
+//	        "pre_pack":  ["./download-installer.sh"],
+//	        "post_pack": ["./sign-and-upload.sh \"$PACKAGE\""]
+//	    },
+//	    "retention": { "keep": 3 },
+//	    "limits": { "maxFileSizeMB": 2048, "maxTotalSizeMB": 8192 },
+//	    "sources": [
+//	        { "path": "../shared/scripts", "target": "scripts" },
+//	        { "path": "../shared/license.txt" }
+//	    ],
+//	    "rewrites": [{ "from": "payload/**", "to": "" }],
+//	    "generated": [
+//	        { "path": "version.txt", "template": "{{ .ProductVersion }} {{ .JobID }}" }
+//	    ],
+//	    "app": {
+//	        "publisher": "Contoso",
+//	        "description": "Line of business app",
+//	        "informationUrl": "https://contoso.com/myapp",
+//	        "owner": "Client Engineering",
+//	        "notes": "Packaged by the release pipeline"
+//	    }
+//	}
+//
+// Relative paths are resolved against the directory containing the config file.
+//
+// Values are Go templates, so that one config serves every release:
+//
+//	"name": "My App {{ .ProductVersion }}",
+//	"output": "./output/{{ env \"BUILD_VERSION\" }}-{{ .GitSHA }}"
+//
+// See templateData for the built-in variables.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MANCHTOOLS/open-package/lobapp"
+	"github.com/MANCHTOOLS/open-package/packager"
+)
+
+// Config is the build definition of a single application
+type Config struct {
+	// Name overrides the application name derived from the source folder
+	Name string `json:"name,omitempty"`
+	// Source is the directory containing the application files
+	Source string `json:"source"`
+	// Setup is the name of the setup file (relative to the source folder)
+	Setup string `json:"setup"`
+	// Output is the directory where the .intunewin files will be created
+	Output string `json:"output"`
+	// Architectures declares one package per architecture (optional)
+	Architectures map[string]Architecture `json:"architectures,omitempty"`
+	// Hooks are shell commands run before and after packaging (optional)
+	Hooks Hooks `json:"hooks,omitempty"`
+	// App is the descriptive metadata of the Intune app (optional). It is
+	// written to an app sidecar next to each package.
+	App lobapp.Metadata `json:"app,omitempty"`
+	// Retention removes old package versions after each build (optional)
+	Retention Retention `json:"retention,omitempty"`
+	// Limits guards against stray large files in the source (optional)
+	Limits Limits `json:"limits,omitempty"`
+	// Sources are additional folders and files merged into every package,
+	// e.g. shared scripts (optional)
+	Sources []packager.Source `json:"sources,omitempty"`
+	// Rewrites move folders and files of the source to other paths of
+	// every package (optional)
+	Rewrites []packager.Rewrite `json:"rewrites,omitempty"`
+	// Generated are files rendered at build time and added to every
+	// package (optional). Their templates are rendered by the packager
+	// with packager.GeneratedData, not with the config templates.
+	Generated []packager.GeneratedFile `json:"generated,omitempty"`
+
+	// dir is the directory containing the config file
+	dir string
+}
+
+// Architecture describes the architecture specific parts of a build
+type Architecture struct {
+	// Source is the subfolder of Config.Source holding the files for this
+	// architecture. Defaults to the architecture name (e.g. x64/).
+	Source string `json:"source,omitempty"`
+	// Setup overrides Config.Setup for this architecture
+	Setup string `json:"setup,omitempty"`
+}
+
+// Retention is the number of package versions to keep per app
+type Retention struct {
+	// Keep is the number of versions kept; 0 keeps all
+	Keep int `json:"keep,omitempty"`
+	// Dir is the directory to prune. Defaults to Config.Output; set it to
+	// the parent of versioned output directories.
+	Dir string `json:"dir,omitempty"`
+}
+
+// Limits are size thresholds for the source of a package, which catch
+// stray files such as VM images or crash dumps in the source folder
+type Limits struct {
+	// MaxFileSizeMB is the largest source file in MB; 0 disables the check
+	MaxFileSizeMB int64 `json:"maxFileSizeMB,omitempty"`
+	// MaxTotalSizeMB is the largest total source size in MB; 0 disables
+	// the check
+	MaxTotalSizeMB int64 `json:"maxTotalSizeMB,omitempty"`
+	// Fail fails the build when a limit is exceeded instead of warning
+	Fail bool `json:"fail,omitempty"`
+}
+
+// Target is a single package to build
+type Target struct {
+	// Architecture is empty for architecture independent packages
+	Architecture string
+	SourceDir    string
+	SetupFile    string
+}
+
+// Load reads and validates a config file
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	cfg.dir = filepath.Dir(path)
+	if err := cfg.expandTemplates(&templateData{baseDir: cfg.dir, now: time.Now()}); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// Dir returns the directory of the config file, which is the working
+// directory of hooks. It is empty for configs not loaded from a file.
+func (c *Config) Dir() string {
+	return c.dir
+}
+
+// Validate checks the config for unsupported values
+func (c *Config) Validate() error {
+	for arch := range c.Architectures {
+		if !packager.IsValidArchitecture(arch) {
+			return fmt.Errorf("unsupported architecture %q (supported: %s)", arch, strings.Join(packager.Architectures, ", "))
+		}
+	}
+	if c.Retention.Keep < 0 {
+		return fmt.Errorf("retention.keep must not be negative")
+	}
+	if c.Retention.Keep > 0 && c.Retention.Dir == "" && Deferred(c.Output) {
+		return fmt.Errorf("retention.dir is required when output uses ProductVersion")
+	}
+	if c.Limits.MaxFileSizeMB < 0 || c.Limits.MaxTotalSizeMB < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	if err := c.App.Validate(); err != nil {
+		return fmt.Errorf("app: %w", err)
+	}
+	for i, src := range c.Sources {
+		if err := src.Validate(); err != nil {
+			return fmt.Errorf("sources[%d]: %w", i, err)
+		}
+	}
+	for i, r := range c.Rewrites {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("rewrites[%d]: %w", i, err)
+		}
+	}
+	for i, g := range c.Generated {
+		if err := g.Validate(); err != nil {
+			return fmt.Errorf("generated[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Targets returns the packages described by the config, one per declared
+// architecture in a stable order, or a single target if no architectures
+// are declared
+func (c *Config) Targets() []Target {
+	if len(c.Architectures) == 0 {
+		return []Target{{SourceDir: c.Source, SetupFile: c.Setup}}
+	}
+
+	archs := make([]string, 0, len(c.Architectures))
+	for arch := range c.Architectures {
+		archs = append(archs, arch)
+	}
+	sort.Strings(archs)
+
+	targets := make([]Target, 0, len(archs))
+	for _, arch := range archs {
+		a := c.Architectures[arch]
+		subDir := a.Source
+		if subDir == "" {
+			subDir = arch
+		}
+		setup := a.Setup
+		if setup == "" {
+			setup = c.Setup
+		}
+		targets = append(targets, Target{
+			Architecture: arch,
+			SourceDir:    filepath.Join(c.Source, subDir),
+			SetupFile:    setup,
+		})
+	}
+	return targets
+}
+
+// resolvePath makes a relative path relative to baseDir
+func resolvePath(baseDir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
@@ -0,0 +1,360 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "open-package.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-config-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := writeConfig(t, tempDir, `{
+		"source": "myapp",
+		"setup": "install.exe",
+		"output": "/abs/output",
+		"retention": {"keep": 3, "dir": "releases"},
+		"limits": {"maxFileSizeMB": 100, "fail": true},
+		"sources": [{"path": "../shared", "target": "scripts"}, {"path": "/abs/license.txt"}],
+		"rewrites": [{"from": "payload/**"}],
+		"generated": [{"path": "version.txt", "template": "{{ .JobID }}"}, {"path": "install.cmd", "file": "install.tmpl", "crlf": true}],
+		"architectures": {
+			"x64": {},
+			"arm64": {"source": "arm", "setup": "install-arm64.exe"}
+		}
+	}`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	expectedSource := filepath.Join(filepath.Dir(path), "myapp")
+	if cfg.Source != expectedSource {
+		t.Errorf("Source mismatch: expected %s, got %s", expectedSource, cfg.Source)
+	}
+	if cfg.Output != "/abs/output" {
+		t.Errorf("Output mismatch: expected /abs/output, got %s", cfg.Output)
+	}
+	if cfg.Retention.Keep != 3 || cfg.Retention.Dir != filepath.Join(filepath.Dir(path), "releases") {
+		t.Errorf("Unexpected retention: %+v", cfg.Retention)
+	}
+	if cfg.Limits.MaxFileSizeMB != 100 || cfg.Limits.MaxTotalSizeMB != 0 || !cfg.Limits.Fail {
+		t.Errorf("Unexpected limits: %+v", cfg.Limits)
+	}
+	if len(cfg.Sources) != 2 || cfg.Sources[0].Path != filepath.Join(filepath.Dir(path), "../shared") || cfg.Sources[0].Target != "scripts" || cfg.Sources[1].Path != "/abs/license.txt" {
+		t.Errorf("Unexpected sources: %+v", cfg.Sources)
+	}
+	if len(cfg.Rewrites) != 1 || cfg.Rewrites[0].From != "payload/**" || cfg.Rewrites[0].To != "" {
+		t.Errorf("Unexpected rewrites: %+v", cfg.Rewrites)
+	}
+	if len(cfg.Generated) != 2 || cfg.Generated[0].Template != "{{ .JobID }}" || cfg.Generated[1].File != filepath.Join(filepath.Dir(path), "install.tmpl") {
+		t.Errorf("Unexpected generated files: %+v", cfg.Generated)
+	}
+
+	targets := cfg.Targets()
+	if len(targets) != 2 {
+		t.Fatalf("Expected 2 targets, got %d", len(targets))
+	}
+
+	// Targets are sorted by architecture
+	if targets[0].Architecture != "arm64" || targets[1].Architecture != "x64" {
+		t.Errorf("Unexpected target order: %s, %s", targets[0].Architecture, targets[1].Architecture)
+	}
+	if targets[0].SourceDir != filepath.Join(expectedSource, "arm") {
+		t.Errorf("arm64 SourceDir mismatch: %s", targets[0].SourceDir)
+	}
+	if targets[0].SetupFile != "install-arm64.exe" {
+		t.Errorf("arm64 SetupFile mismatch: %s", targets[0].SetupFile)
+	}
+	if targets[1].SourceDir != filepath.Join(expectedSource, "x64") {
+		t.Errorf("x64 SourceDir mismatch: %s", targets[1].SourceDir)
+	}
+	if targets[1].SetupFile != "install.exe" {
+		t.Errorf("x64 SetupFile mismatch: %s", targets[1].SetupFile)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-config-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tests := map[string]string{
+		"unknown field":        `{"source": "app", "setpu": "install.exe"}`,
+		"invalid architecture": `{"source": "app", "architectures": {"ia64": {}}}`,
+		"malformed json":       `{"source": `,
+		"negative retention":   `{"source": "app", "retention": {"keep": -1}}`,
+		"negative limit":       `{"source": "app", "limits": {"maxTotalSizeMB": -1}}`,
+		"source outside":       `{"source": "app", "sources": [{"path": "shared", "target": "../up"}]}`,
+		"rewrite outside":      `{"source": "app", "rewrites": [{"from": "payload", "to": "../up"}]}`,
+		"generated no path":    `{"source": "app", "generated": [{"template": "x"}]}`,
+		"invalid app url":      `{"source": "app", "app": {"informationUrl": "contoso.com"}}`,
+		"invalid detection":    `{"source": "app", "app": {"detection": [{"@odata.type": "#microsoft.graph.win32LobAppRegistryRule", "ruleType": "detection", "keyPath": "SOFTWARE\\Contoso", "operationType": "exists"}]}}`,
+	}
+
+	for name, content := range tests {
+		if _, err := Load(writeConfig(t, tempDir, content)); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func TestTargetsWithoutArchitectures(t *testing.T) {
+	cfg := &Config{Source: "/src/app", Setup: "setup.msi"}
+	targets := cfg.Targets()
+	if len(targets) != 1 {
+		t.Fatalf("Expected 1 target, got %d", len(targets))
+	}
+	if targets[0].Architecture != "" || targets[0].SourceDir != "/src/app" || targets[0].SetupFile != "setup.msi" {
+		t.Errorf("Unexpected target: %+v", targets[0])
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-config-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("OPEN_PACKAGE_TEST_VERSION", "2.1.0")
+	defer os.Unsetenv("OPEN_PACKAGE_TEST_VERSION")
+
+	path := writeConfig(t, tempDir, `{
+		"name": "My App {{ env \"OPEN_PACKAGE_TEST_VERSION\" }}",
+		"source": "app-{{ env \"OPEN_PACKAGE_TEST_VERSION\" }}",
+		"setup": "install.exe",
+		"output": "out/{{ .Date }}"
+	}`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Name != "My App 2.1.0" {
+		t.Errorf("Name mismatch: %s", cfg.Name)
+	}
+	if cfg.Source != filepath.Join(tempDir, "app-2.1.0") {
+		t.Errorf("Source mismatch: %s", cfg.Source)
+	}
+	if cfg.Output != filepath.Join(tempDir, "out", time.Now().Format("2006-01-02")) {
+		t.Errorf("Output mismatch: %s", cfg.Output)
+	}
+
+	errorTests := map[string]string{
+		"unknown variable":             `{"source": "app", "setup": "install.exe", "name": "{{ .Version }}"}`,
+		"malformed template":           `{"source": "app", "setup": "install.exe", "name": "{{ .Date "}`,
+		"product version in src":       `{"source": "{{ .ProductVersion }}", "setup": "install.msi"}`,
+		"product version in pre_pack":  `{"source": "app", "setup": "install.msi", "hooks": {"pre_pack": ["echo {{ .ProductVersion }}"]}}`,
+		"product version in retention": `{"source": "app", "setup": "install.msi", "retention": {"dir": "{{ .ProductVersion }}"}}`,
+		"versioned output without dir": `{"source": "app", "setup": "install.msi", "output": "out/{{ .ProductVersion }}", "retention": {"keep": 3}}`,
+	}
+	for name, content := range errorTests {
+		if _, err := Load(writeConfig(t, tempDir, content)); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func TestForTarget(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-config-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	t.Setenv("OPEN_PACKAGE_TEST_VERSION", "2.1.0")
+	path := writeConfig(t, tempDir, `{
+		"name": "My App {{ .ProductVersion }}",
+		"source": "app",
+		"setup": "install.exe",
+		"output": "out/{{ env \"OPEN_PACKAGE_TEST_VERSION\" }}/{{ .ProductVersion }}",
+		"sources": [{ "path": "shared/{{ .ProductVersion }}" }]
+	}`)
+
+	// The setup file is downloaded by a pre_pack hook, after loading
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Name != "My App {{ .ProductVersion }}" || !Deferred(cfg.Output) || !Deferred(cfg.Sources[0].Path) {
+		t.Errorf("Expected the product version to be deferred: %+v", cfg)
+	}
+	if _, err := cfg.ForTarget(cfg.Targets()[0]); err == nil {
+		t.Error("Expected error for a missing setup file")
+	}
+
+	// Scripts have no product version
+	if err := os.MkdirAll(filepath.Join(tempDir, "app"), 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "app", "install.cmd"), []byte("@echo off"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+	cfg.Setup = "install.cmd"
+	if _, err := cfg.ForTarget(cfg.Targets()[0]); err == nil || !strings.Contains(err.Error(), "only available for MSI") {
+		t.Errorf("Expected error for a script setup file, got %v", err)
+	}
+	if cfg.Name != "My App {{ .ProductVersion }}" {
+		t.Errorf("ForTarget modified the loaded config: %s", cfg.Name)
+	}
+}
+
+func TestLoadApp(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-config-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	t.Setenv("OPEN_PACKAGE_TEST_OWNER", "Client Engineering")
+	path := writeConfig(t, tempDir, `{
+		"source": "app",
+		"setup": "install.exe",
+		"app": {
+			"publisher": "Contoso",
+			"description": "Built on {{ .Date }}",
+			"informationUrl": "https://contoso.com/app",
+			"owner": "{{ env \"OPEN_PACKAGE_TEST_OWNER\" }}",
+			"localized": {
+				"de-DE": {"displayName": "Meine App", "description": "Erstellt am {{ .Date }}"}
+			}
+		}
+	}`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.App.Publisher != "Contoso" || cfg.App.Owner != "Client Engineering" || cfg.App.InformationURL != "https://contoso.com/app" {
+		t.Errorf("Unexpected app metadata: %+v", cfg.App)
+	}
+	if cfg.App.Description != "Built on "+time.Now().Format("2006-01-02") {
+		t.Errorf("Description template not expanded: %s", cfg.App.Description)
+	}
+	if de := cfg.App.Localized["de-DE"]; de.DisplayName != "Meine App" || de.Description != "Erstellt am "+time.Now().Format("2006-01-02") {
+		t.Errorf("Unexpected localized metadata: %+v", de)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-config-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := writeConfig(t, tempDir, `{
+		"source": "app",
+		"setup": "install.exe",
+		"hooks": {
+			"pre_pack": ["echo \"$SOURCE\" > pre.txt"],
+			"post_pack": ["echo \"$PACKAGE_SHA256\" > post.txt", "exit 3"]
+		}
+	}`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Dir() != tempDir {
+		t.Errorf("Dir mismatch: %s", cfg.Dir())
+	}
+
+	env := map[string]string{"SOURCE": "/src/app", "PACKAGE_SHA256": "abc123"}
+	if err := RunHooks(cfg.Hooks.PrePack, cfg.Dir(), env, io.Discard, io.Discard); err != nil {
+		t.Fatalf("RunHooks failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(tempDir, "pre.txt"))
+	if err != nil || strings.TrimSpace(string(data)) != "/src/app" {
+		t.Errorf("Unexpected pre_pack output: %q, %v", data, err)
+	}
+
+	// A failing hook stops packaging
+	if err := RunHooks(cfg.Hooks.PostPack, cfg.Dir(), env, io.Discard, io.Discard); err == nil {
+		t.Error("Expected error for failing hook")
+	}
+	data, err = os.ReadFile(filepath.Join(tempDir, "post.txt"))
+	if err != nil || strings.TrimSpace(string(data)) != "abc123" {
+		t.Errorf("Unexpected post_pack output: %q, %v", data, err)
+	}
+}
+
+func TestRunSmokeTests(t *testing.T) {
+	env := map[string]string{"INSTALL_COMMAND": "setup.exe /S"}
+	results, err := RunSmokeTests([]string{`test "$INSTALL_COMMAND" = "setup.exe /S"`, "exit 0", "exit 3", "exit 0"}, "", env, io.Discard, io.Discard)
+	if err == nil {
+		t.Fatal("Expected error for failing smoke test")
+	}
+	if len(results) != 3 || results[0].ExitCode != 0 || results[1].ExitCode != 0 || results[2].ExitCode != 3 {
+		t.Errorf("Unexpected results: %+v", results)
+	}
+}
+
+func TestLoadManifest(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-config-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "apps.csv")
+	content := "\ufeffSource,Setup,Name,Output\n" +
+		"# migrated from ConfigMgr\n" +
+		"apps/7zip,7z.msi,7-Zip,out\n" +
+		"/abs/app, \"setup, v2.exe\",,\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	rows, err := LoadManifest(path)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+
+	first := rows[0].Config
+	if rows[0].Line != 3 || first.Name != "7-Zip" || first.Setup != "7z.msi" {
+		t.Errorf("Unexpected first row: line %d, %+v", rows[0].Line, first)
+	}
+	if first.Source != filepath.Join(tempDir, "apps/7zip") || first.Output != filepath.Join(tempDir, "out") {
+		t.Errorf("Paths not resolved: %s, %s", first.Source, first.Output)
+	}
+	second := rows[1].Config
+	if second.Source != "/abs/app" || second.Setup != "setup, v2.exe" || second.Output != "" {
+		t.Errorf("Unexpected second row: %+v", second)
+	}
+
+	errorTests := map[string]string{
+		"unknown column": "source,setup,version\napp,setup.exe,1\n",
+		"missing setup":  "source,name\napp,App\n",
+		"empty setup":    "source,setup\napp,\n",
+	}
+	for name, content := range errorTests {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write manifest: %v", err)
+		}
+		if _, err := LoadManifest(path); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+)
+
+// Hooks are shell commands run around packaging. Commands run in the
+// directory of the config file with environment variables describing
+// the job:
+//
+//	SOURCE, SETUP, OUTPUT, NAME, ARCH   all hooks
+//	INSTALL_COMMAND                     smoke_test hooks only
+//	PACKAGE, PACKAGE_SHA256             post_pack hooks only
+type Hooks struct {
+	// PrePack runs before each package is built, e.g. to download
+	// installers or stamp versions
+	PrePack []string `json:"pre_pack,omitempty"`
+	// SmokeTest runs after the source is validated and before it is
+	// packaged. The commands hand the source and install command to a
+	// runner that installs the app in a disposable Windows Sandbox or VM
+	// (e.g. over WinRM) and exit with the exit code of the installer.
+	SmokeTest []string `json:"smoke_test,omitempty"`
+	// PostPack runs after each package is built, e.g. to trigger signing
+	// or uploads
+	PostPack []string `json:"post_pack,omitempty"`
+}
+
+// SuccessExitCodes are the installer exit codes Intune treats as success
+// by default: 0, 1707, and 3010 and 1641, which request a restart
+var SuccessExitCodes = []int{0, 1707, 3010, 1641}
+
+// SmokeTestResult is the outcome of a smoke test command
+type SmokeTestResult struct {
+	Command  string `json:"command"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// RunHooks runs commands in order with the given environment variables
+// added to the process environment. It stops at the first failing command.
+func RunHooks(commands []string, dir string, env map[string]string, stdout, stderr io.Writer) error {
+	environ := hookEnviron(env)
+	for _, command := range commands {
+		if err := hookCommand(command, dir, environ, stdout, stderr).Run(); err != nil {
+			return fmt.Errorf("hook %q failed: %w", command, err)
+		}
+	}
+	return nil
+}
+
+// RunSmokeTests runs smoke test commands like RunHooks and records their
+// exit codes. Commands fail with exit codes other than SuccessExitCodes.
+// The results include the failing command.
+func RunSmokeTests(commands []string, dir string, env map[string]string, stdout, stderr io.Writer) ([]SmokeTestResult, error) {
+	environ := hookEnviron(env)
+	var results []SmokeTestResult
+	for _, command := range commands {
+		err := hookCommand(command, dir, environ, stdout, stderr).Run()
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			return results, fmt.Errorf("smoke test %q failed: %w", command, err)
+		}
+		result := SmokeTestResult{Command: command}
+		if exitErr != nil {
+			result.ExitCode = exitErr.ExitCode()
+		}
+		results = append(results, result)
+		if !isSuccessExitCode(result.ExitCode) {
+			return results, fmt.Errorf("smoke test %q failed with exit code %d", command, result.ExitCode)
+		}
+	}
+	return results, nil
+}
+
+func isSuccessExitCode(code int) bool {
+	for _, c := range SuccessExitCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// hookEnviron returns the process environment with env added
+func hookEnviron(env map[string]string) []string {
+	environ := os.Environ()
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		environ = append(environ, key+"="+env[key])
+	}
+	return environ
+}
+
+// hookCommand prepares a hook command
+func hookCommand(command, dir string, environ []string, stdout, stderr io.Writer) *exec.Cmd {
+	cmd := shellCommand(command)
+	cmd.Dir = dir
+	cmd.Env = environ
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd
+}
+
+// shellCommand runs command with the shell of the platform
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// manifestColumns are the columns of a manifest file
+var manifestColumns = []string{"source", "setup", "name", "output"}
+
+// ManifestRow is a single package of a manifest file
+type ManifestRow struct {
+	// Line is the line number of the row in the manifest file
+	Line int
+	// Config is the build definition of the row
+	Config *Config
+}
+
+// LoadManifest reads a CSV manifest with one package per row. The header
+// row names the columns: source and setup are required, name and output
+// are optional. Relative paths are resolved against the directory of the
+// manifest file.
+func LoadManifest(path string) ([]ManifestRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest header %s: %w", path, err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		// Spreadsheet applications start CSV files with a byte order mark
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !contains(manifestColumns, name) {
+			return nil, fmt.Errorf("unknown manifest column %q (supported: %s)", name, strings.Join(manifestColumns, ", "))
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"source", "setup"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("manifest %s has no %s column", path, name)
+		}
+	}
+
+	baseDir := filepath.Dir(path)
+	var rows []ManifestRow
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+		}
+		line, _ := r.FieldPos(0)
+
+		value := func(column string) string {
+			if i, ok := columns[column]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		cfg := &Config{
+			Name:   value("name"),
+			Source: resolvePath(baseDir, value("source")),
+			Setup:  value("setup"),
+			Output: resolvePath(baseDir, value("output")),
+		}
+		if cfg.Source == "" || cfg.Setup == "" {
+			return nil, fmt.Errorf("manifest %s line %d: source and setup are required", path, line)
+		}
+		rows = append(rows, ManifestRow{Line: line, Config: cfg})
+	}
+
+	return rows, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
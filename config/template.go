@@ -0,0 +1,255 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/MANCHTOOLS/open-package/packager"
+)
+
+// templateData provides the built-in variables of config templates:
+//
+//	{{ .Date }}            the current date (2006-01-02)
+//	{{ .GitSHA }}          the short commit of the config directory, if any
+//	{{ .ProductVersion }}  the ProductVersion of an MSI setup file
+//
+// The env function reads environment variables: {{ env "BUILD_VERSION" }}
+//
+// The setup file may only exist once the pre_pack hooks have run, so
+// values using the product version are left as they are by Load and
+// expanded per target by ForTarget.
+type templateData struct {
+	baseDir string
+	now     time.Time
+	// target is the package being built, or nil while loading the config
+	target *Target
+}
+
+// errDeferred is returned by ProductVersion while loading the config
+var errDeferred = errors.New("ProductVersion is not available in source, setup, retention.dir and pre_pack hooks")
+
+// Date returns the current date
+func (d *templateData) Date() string {
+	return d.now.Format("2006-01-02")
+}
+
+// GitSHA returns the short commit hash of the repository containing the
+// config file, or an empty string outside of a git repository
+func (d *templateData) GitSHA() string {
+	cmd := exec.Command("git", "rev-parse", "--short", "HEAD")
+	cmd.Dir = d.baseDir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// ProductVersion returns the product version of the MSI or EXE setup
+// file of the target
+func (d *templateData) ProductVersion() (string, error) {
+	if d.target == nil {
+		return "", errDeferred
+	}
+	version, err := packager.SetupVersion(d.target.SourceDir, d.target.SetupFile)
+	if err != nil {
+		return "", err
+	}
+	if version == "" {
+		return "", fmt.Errorf("ProductVersion is only available for MSI setup files and executables with a version resource")
+	}
+	return version, nil
+}
+
+// templateFuncs are the functions available in config templates
+var templateFuncs = template.FuncMap{
+	"env": os.Getenv,
+}
+
+// execute executes value as a template. Values without actions are
+// returned unchanged.
+func (d *templateData) execute(field, value string) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+	tmpl, err := template.New(field).Funcs(templateFuncs).Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", field, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, d); err != nil {
+		return "", fmt.Errorf("%s: %w", field, err)
+	}
+	return buf.String(), nil
+}
+
+// expand executes value as a template. Values using the product version
+// are returned unchanged while loading the config.
+func (d *templateData) expand(field, value string) (string, error) {
+	expanded, err := d.execute(field, value)
+	if errors.Is(err, errDeferred) {
+		return value, nil
+	}
+	return expanded, err
+}
+
+// expandPath expands a path and resolves it against the config directory
+// once it no longer uses the product version
+func (d *templateData) expandPath(field, value string) (string, error) {
+	if d.target != nil && !Deferred(value) {
+		// Resolved by Load, or set by a command line flag
+		return value, nil
+	}
+	path, err := d.execute(field, value)
+	if errors.Is(err, errDeferred) {
+		return value, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return resolvePath(d.baseDir, path), nil
+}
+
+// Deferred reports whether a loaded config value uses the product version
+// of the setup file, and is only expanded by ForTarget
+func Deferred(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+// ForTarget returns a copy of the config with the values using the product
+// version expanded for the setup file of target. It is called once the
+// pre_pack hooks have run, as they may download the setup file.
+func (c *Config) ForTarget(target Target) (*Config, error) {
+	cfg := *c
+	cfg.Architectures = maps.Clone(c.Architectures)
+	cfg.Sources = slices.Clone(c.Sources)
+	cfg.Rewrites = slices.Clone(c.Rewrites)
+	cfg.Hooks.PrePack = slices.Clone(c.Hooks.PrePack)
+	cfg.Hooks.SmokeTest = slices.Clone(c.Hooks.SmokeTest)
+	cfg.Hooks.PostPack = slices.Clone(c.Hooks.PostPack)
+	cfg.App.Localized = maps.Clone(c.App.Localized)
+
+	d := &templateData{baseDir: c.dir, now: time.Now(), target: &target}
+	if err := cfg.expandTemplates(d); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// expandTemplates expands the templates of all config values and resolves
+// the relative paths. Source, setup, retention.dir and the pre_pack hooks
+// are needed before the setup file exists, so they cannot use the product
+// version.
+func (c *Config) expandTemplates(d *templateData) error {
+	var err error
+	if c.Source, err = d.execute("source", c.Source); err != nil {
+		return err
+	}
+	if d.target == nil {
+		c.Source = resolvePath(d.baseDir, c.Source)
+	}
+	if c.Setup, err = d.execute("setup", c.Setup); err != nil {
+		return err
+	}
+
+	for arch, a := range c.Architectures {
+		if a.Source, err = d.execute("architectures."+arch+".source", a.Source); err != nil {
+			return err
+		}
+		if a.Setup, err = d.execute("architectures."+arch+".setup", a.Setup); err != nil {
+			return err
+		}
+		c.Architectures[arch] = a
+	}
+
+	if c.Output, err = d.expandPath("output", c.Output); err != nil {
+		return err
+	}
+	if c.Retention.Dir, err = d.execute("retention.dir", c.Retention.Dir); err != nil {
+		return err
+	}
+	if d.target == nil {
+		c.Retention.Dir = resolvePath(d.baseDir, c.Retention.Dir)
+	}
+	if c.Name, err = d.expand("name", c.Name); err != nil {
+		return err
+	}
+	for i, src := range c.Sources {
+		if src.Path, err = d.expandPath(fmt.Sprintf("sources[%d].path", i), src.Path); err != nil {
+			return err
+		}
+		if src.Target, err = d.expand(fmt.Sprintf("sources[%d].target", i), src.Target); err != nil {
+			return err
+		}
+		c.Sources[i] = src
+	}
+	for i, r := range c.Rewrites {
+		if r.From, err = d.expand(fmt.Sprintf("rewrites[%d].from", i), r.From); err != nil {
+			return err
+		}
+		if r.To, err = d.expand(fmt.Sprintf("rewrites[%d].to", i), r.To); err != nil {
+			return err
+		}
+		c.Rewrites[i] = r
+	}
+	// Generated file templates are rendered at build time; only the
+	// template files are resolved
+	if d.target == nil {
+		for i := range c.Generated {
+			c.Generated[i].File = resolvePath(d.baseDir, c.Generated[i].File)
+		}
+	}
+
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{
+		{"app.publisher", &c.App.Publisher},
+		{"app.description", &c.App.Description},
+		{"app.informationUrl", &c.App.InformationURL},
+		{"app.owner", &c.App.Owner},
+		{"app.notes", &c.App.Notes},
+		{"app.minimumWindowsRelease", &c.App.MinimumWindowsRelease},
+	} {
+		if *field.value, err = d.expand(field.name, *field.value); err != nil {
+			return err
+		}
+	}
+	for locale, l := range c.App.Localized {
+		if l.DisplayName, err = d.expand("app.localized."+locale+".displayName", l.DisplayName); err != nil {
+			return err
+		}
+		if l.Description, err = d.expand("app.localized."+locale+".description", l.Description); err != nil {
+			return err
+		}
+		c.App.Localized[locale] = l
+	}
+
+	for i, command := range c.Hooks.PrePack {
+		if c.Hooks.PrePack[i], err = d.execute(fmt.Sprintf("hooks.pre_pack[%d]", i), command); err != nil {
+			return err
+		}
+	}
+	for i, command := range c.Hooks.SmokeTest {
+		if c.Hooks.SmokeTest[i], err = d.expand(fmt.Sprintf("hooks.smoke_test[%d]", i), command); err != nil {
+			return err
+		}
+	}
+	for i, command := range c.Hooks.PostPack {
+		if c.Hooks.PostPack[i], err = d.expand(fmt.Sprintf("hooks.post_pack[%d]", i), command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// Package contentindex indexes the files inside archived .intunewin
+// packages, so that questions like "which packages ship
+// log4j-core-2.x.jar?" are answered without decrypting every package again.
+//
+// The index is a JSON Lines file with one packaged file per line: the
+// package, the app name from Detection.xml, the path in the inner ZIP, the
+// size and the SHA256 digest. It can be searched with Search, or with
+// grep and jq.
+package contentindex
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/MANCHTOOLS/open-package/format"
+	"github.com/MANCHTOOLS/open-package/tempfiles"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// FileName is the name of the default index file
+const FileName = "index.jsonl"
+
+// Entry is a packaged file in the index
+type Entry struct {
+	// Package is the path of the .intunewin file
+	Package string `json:"package"`
+	// Name is the app name from Detection.xml, empty for packages
+	// decrypted with keys
+	Name string `json:"name,omitempty"`
+	// Path is the path of the file in the inner ZIP, with forward slashes
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Options configures Build
+type Options struct {
+	// Workers is the number of packages decrypted in parallel (default 1)
+	Workers int
+	// Keys, if set, returns the keys of a package that cannot be
+	// decrypted with its Detection.xml, or nil if there are none
+	Keys func(packagePath string) (*unpacker.Keys, error)
+	// Temp tracks the temporary files of the decrypted packages
+	Temp *tempfiles.Manager
+	// Progress, if set, is called after each package with the number of
+	// indexed files or the error. Calls are not concurrent.
+	Progress func(packagePath string, files int, err error)
+}
+
+// Failure is a package that could not be indexed
+type Failure struct {
+	Package string `json:"package"`
+	Error   string `json:"error"`
+}
+
+// Summary is the result of Build
+type Summary struct {
+	Packages int
+	Files    int
+	Failed   []Failure
+}
+
+// Build indexes the files of packages and writes them to w as JSON lines,
+// in the order of packages. Packages that cannot be decrypted are listed
+// in the summary instead of failing the build; the error is for writing w.
+func Build(packages []string, w io.Writer, opts Options) (*Summary, error) {
+	type result struct {
+		entries []Entry
+		err     error
+		done    chan struct{}
+	}
+	results := make([]*result, len(packages))
+	for i := range results {
+		results[i] = &result{done: make(chan struct{})}
+	}
+
+	var mu sync.Mutex
+	jobs := make(chan int)
+	for range max(opts.Workers, 1) {
+		go func() {
+			for i := range jobs {
+				r := results[i]
+				r.entries, r.err = indexPackage(packages[i], opts)
+				if opts.Progress != nil {
+					mu.Lock()
+					opts.Progress(packages[i], len(r.entries), r.err)
+					mu.Unlock()
+				}
+				close(r.done)
+			}
+		}()
+	}
+	go func() {
+		for i := range packages {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	// Entries are written in order as packages complete
+	summary := &Summary{}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	var writeErr error
+	for i, r := range results {
+		<-r.done
+		if r.err != nil {
+			summary.Failed = append(summary.Failed, Failure{Package: packages[i], Error: r.err.Error()})
+			continue
+		}
+		summary.Packages++
+		summary.Files += len(r.entries)
+		for _, e := range r.entries {
+			if writeErr == nil {
+				writeErr = enc.Encode(e)
+			}
+		}
+	}
+	if writeErr == nil {
+		writeErr = bw.Flush()
+	}
+	if writeErr != nil {
+		return nil, fmt.Errorf("failed to write index: %w", writeErr)
+	}
+	return summary, nil
+}
+
+// indexPackage decrypts a package and hashes its files
+func indexPackage(packagePath string, opts Options) ([]Entry, error) {
+	inner, err := unpacker.OpenInner(packagePath, nil, opts.Temp)
+	if err != nil && opts.Keys != nil {
+		keys, keysErr := opts.Keys(packagePath)
+		if keysErr != nil {
+			return nil, fmt.Errorf("%w (keys: %v)", err, keysErr)
+		}
+		if keys != nil {
+			inner, err = unpacker.OpenInner(packagePath, keys, opts.Temp)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer inner.Close()
+
+	var name string
+	if inner.Package != nil {
+		name = inner.Package.Info.Name
+	}
+	var entries []Entry
+	for _, f := range inner.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+		}
+		h := sha256.New()
+		size, err := io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+		}
+		entries = append(entries, Entry{
+			Package: packagePath,
+			Name:    name,
+			Path:    format.Normalize(f.Name),
+			Size:    size,
+			SHA256:  hex.EncodeToString(h.Sum(nil)),
+		})
+	}
+	return entries, nil
+}
+
+// Query selects entries of the index. Empty fields match all entries.
+type Query struct {
+	// Name is a path.Match pattern, matched case-insensitively against the
+	// file name or, if it contains a slash, against the whole path
+	Name string
+	// SHA256 is a hex digest or a prefix of at least 8 characters of it
+	SHA256 string
+}
+
+// Search reads an index from r and returns the entries matching q
+func Search(r io.Reader, q Query) ([]Entry, error) {
+	pattern := strings.ToLower(q.Name)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", q.Name, err)
+	}
+	digest := strings.ToLower(q.SHA256)
+	if digest != "" && len(digest) < 8 {
+		return nil, fmt.Errorf("digest prefix %q is shorter than 8 characters", q.SHA256)
+	}
+
+	var matches []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("failed to parse index line %d: %w", line, err)
+		}
+		if digest != "" && !strings.HasPrefix(e.SHA256, digest) {
+			continue
+		}
+		if pattern != "" {
+			subject := path.Base(e.Path)
+			if strings.Contains(pattern, "/") {
+				subject = e.Path
+			}
+			if ok, _ := path.Match(pattern, strings.ToLower(subject)); !ok {
+				continue
+			}
+		}
+		matches = append(matches, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+	return matches, nil
+}
@@ -0,0 +1,166 @@
+package contentindex
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MANCHTOOLS/open-package/packager"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// createPackage builds a package of an app with the given files
+func createPackage(t *testing.T, tempDir, app string, files map[string]string) string {
+	t.Helper()
+	sourceDir := filepath.Join(tempDir, app)
+	for name, content := range files {
+		path := filepath.Join(sourceDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create source dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	outputPath, err := packager.New(packager.Options{
+		SourceDir: sourceDir,
+		SetupFile: "install.cmd",
+		OutputDir: tempDir,
+		Quiet:     true,
+	}).CreatePackage()
+	if err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	return outputPath
+}
+
+func TestBuildAndSearch(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "contentindex-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	logger := createPackage(t, tempDir, "logger", map[string]string{
+		"install.cmd":                 "@echo off",
+		"lib/log4j-core-2.14.1.jar":   "vulnerable",
+		"lib/log4j-api-2.14.1.jar":    "api",
+		"config/log4j2-template.json": "{}",
+	})
+	other := createPackage(t, tempDir, "other", map[string]string{
+		"install.cmd": "@echo off",
+		"app.exe":     "binary",
+	})
+	missing := filepath.Join(tempDir, "missing.intunewin")
+
+	var buf bytes.Buffer
+	var progress []string
+	summary, err := Build([]string{logger, other, missing}, &buf, Options{
+		Workers: 2,
+		Progress: func(packagePath string, files int, err error) {
+			progress = append(progress, packagePath)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if summary.Packages != 2 || summary.Files != 6 || len(summary.Failed) != 1 || summary.Failed[0].Package != missing {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+	if len(progress) != 3 {
+		t.Errorf("Expected progress for 3 packages, got %v", progress)
+	}
+
+	index := buf.String()
+	matches, err := Search(strings.NewReader(index), Query{Name: "LOG4J-core-2.*.jar"})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Package != logger || matches[0].Name != "logger" || matches[0].Path != "logger/lib/log4j-core-2.14.1.jar" {
+		t.Fatalf("Unexpected matches: %+v", matches)
+	}
+	digest := sha256.Sum256([]byte("vulnerable"))
+	if matches[0].SHA256 != hex.EncodeToString(digest[:]) || matches[0].Size != 10 {
+		t.Errorf("Unexpected digest or size: %+v", matches[0])
+	}
+
+	// Digest prefixes and patterns with a folder
+	if matches, _ := Search(strings.NewReader(index), Query{SHA256: hex.EncodeToString(digest[:])[:8]}); len(matches) != 1 {
+		t.Errorf("Expected a match by digest prefix, got %+v", matches)
+	}
+	if matches, _ := Search(strings.NewReader(index), Query{Name: "*/install.cmd"}); len(matches) != 2 {
+		t.Errorf("Expected both setup files, got %+v", matches)
+	}
+	if _, err := Search(strings.NewReader(index), Query{SHA256: "abc"}); err == nil {
+		t.Error("Expected error for a short digest prefix")
+	}
+}
+
+func TestBuildWithKeys(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "contentindex-keys-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	packagePath := createPackage(t, tempDir, "app", map[string]string{"install.cmd": "@echo off"})
+	pkg, err := unpacker.Open(packagePath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	keys := &unpacker.Keys{EncryptionInfo: pkg.Info.EncryptionInfo}
+
+	// Without its Detection.xml, the package is indexed with its keys
+	if err := os.WriteFile(packagePath, rewriteWithout(t, packagePath, "Detection.xml"), 0644); err != nil {
+		t.Fatalf("Failed to write package: %v", err)
+	}
+	var buf bytes.Buffer
+	summary, err := Build([]string{packagePath}, &buf, Options{
+		Keys: func(string) (*unpacker.Keys, error) { return keys, nil },
+	})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if summary.Files != 1 || len(summary.Failed) != 0 || !strings.Contains(buf.String(), `"path":"app/install.cmd"`) {
+		t.Errorf("Unexpected index %q, %+v", buf.String(), summary)
+	}
+}
+
+// rewriteWithout returns the package at path without the entries named name
+func rewriteWithout(t *testing.T, path, name string) []byte {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("Failed to open package: %v", err)
+	}
+	defer zr.Close()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/"+name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		w, err := zw.Create(f.Name)
+		if err == nil {
+			_, err = io.Copy(w, rc)
+		}
+		rc.Close()
+		if err != nil {
+			t.Fatalf("Failed to copy %s: %v", f.Name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to write package: %v", err)
+	}
+	return buf.Bytes()
+}
@@ -18,6 +18,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 )
@@ -95,6 +96,23 @@ func pkcs7Pad(data []byte, blockSize int) []byte {
 	return append(data, padBytes...)
 }
 
+// pkcs7Unpad removes PKCS#7 padding from the data
+func pkcs7Unpad(data []byte, blockSize int) ([]byte, error) {
+	if len(data) == 0 || len(data)%blockSize != 0 {
+		return nil, fmt.Errorf("invalid padded data length %d", len(data))
+	}
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > blockSize {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	for _, b := range data[len(data)-padding:] {
+		if int(b) != padding {
+			return nil, fmt.Errorf("invalid padding")
+		}
+	}
+	return data[:len(data)-padding], nil
+}
+
 // EncryptAES256CBC encrypts data using AES-256-CBC with PKCS#7 padding
 func EncryptAES256CBC(key, iv, plaintext []byte) ([]byte, error) {
 	if len(key) != AES256KeySize {
@@ -122,10 +140,34 @@ func EncryptAES256CBC(key, iv, plaintext []byte) ([]byte, error) {
 	return ciphertext, nil
 }
 
+// DecryptAES256CBC decrypts data encrypted with EncryptAES256CBC
+func DecryptAES256CBC(key, iv, ciphertext []byte) ([]byte, error) {
+	if len(key) != AES256KeySize {
+		return nil, fmt.Errorf("invalid key size: expected %d, got %d", AES256KeySize, len(key))
+	}
+	if len(iv) != IVSize {
+		return nil, fmt.Errorf("invalid IV size: expected %d, got %d", IVSize, len(iv))
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid ciphertext length %d", len(ciphertext))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	mode := cipher.NewCBCDecrypter(block, iv)
+	mode.CryptBlocks(plaintext, ciphertext)
+
+	return pkcs7Unpad(plaintext, aes.BlockSize)
+}
+
 // Encrypt performs authenticated encryption on the provided data
 // Returns the encrypted data with HMAC and IV prepended, along with encryption info
 func Encrypt(plaintext []byte) (*EncryptionInfo, []byte, error) {
-	// Generate random keys and IV
+	// Generate random keys
 	encryptionKey, err := GenerateKey(AES256KeySize)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to generate encryption key: %w", err)
@@ -136,18 +178,41 @@ func Encrypt(plaintext []byte) (*EncryptionInfo, []byte, error) {
 		return nil, nil, fmt.Errorf("failed to generate MAC key: %w", err)
 	}
 
-	iv, err := GenerateIV()
+	// Compute SHA256 of original content
+	fileDigest := ComputeSHA256(plaintext)
+
+	output, err := EncryptWithKeys(encryptionKey, macKey, plaintext)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate IV: %w", err)
+		return nil, nil, err
 	}
+	iv := output[HMACSize : HMACSize+IVSize]
+	mac := output[:HMACSize]
 
-	// Compute SHA256 of original content
-	fileDigest := ComputeSHA256(plaintext)
+	info := &EncryptionInfo{
+		EncryptionKey:   encryptionKey,
+		MacKey:          macKey,
+		IV:              iv,
+		MAC:             mac,
+		FileDigest:      fileDigest,
+		UnencryptedSize: int64(len(plaintext)),
+	}
+
+	return info, output, nil
+}
+
+// EncryptWithKeys performs authenticated encryption with the given keys and
+// a random IV. The output has the format produced by Encrypt:
+// [HMAC][IV][Ciphertext].
+func EncryptWithKeys(encryptionKey, macKey, plaintext []byte) ([]byte, error) {
+	iv, err := GenerateIV()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate IV: %w", err)
+	}
 
 	// Encrypt the content
 	ciphertext, err := EncryptAES256CBC(encryptionKey, iv, plaintext)
 	if err != nil {
-		return nil, nil, fmt.Errorf("encryption failed: %w", err)
+		return nil, fmt.Errorf("encryption failed: %w", err)
 	}
 
 	// Create the data that will be HMAC'd (IV + ciphertext)
@@ -160,17 +225,7 @@ func Encrypt(plaintext []byte) (*EncryptionInfo, []byte, error) {
 	output = append(output, mac...)
 	output = append(output, iv...)
 	output = append(output, ciphertext...)
-
-	info := &EncryptionInfo{
-		EncryptionKey:   encryptionKey,
-		MacKey:          macKey,
-		IV:              iv,
-		MAC:             mac,
-		FileDigest:      fileDigest,
-		UnencryptedSize: int64(len(plaintext)),
-	}
-
-	return info, output, nil
+	return output, nil
 }
 
 // EncryptReader performs authenticated encryption on data from a reader
@@ -184,6 +239,30 @@ func EncryptReader(r io.Reader) (*EncryptionInfo, []byte, error) {
 	return Encrypt(plaintext)
 }
 
+// ErrMACMismatch is returned when the HMAC of encrypted data does not match
+var ErrMACMismatch = errors.New("HMAC verification failed")
+
+// Decrypt verifies and decrypts data produced by Encrypt
+// ([HMAC][IV][Ciphertext]) using the given encryption and MAC keys
+func Decrypt(encryptionKey, macKey, data []byte) ([]byte, error) {
+	if len(data) < HMACSize+IVSize+aes.BlockSize {
+		return nil, fmt.Errorf("encrypted data too short: %d bytes", len(data))
+	}
+
+	mac := data[:HMACSize]
+	expectedMAC := ComputeHMACSHA256(macKey, data[HMACSize:])
+	if !hmac.Equal(mac, expectedMAC) {
+		return nil, ErrMACMismatch
+	}
+
+	iv := data[HMACSize : HMACSize+IVSize]
+	plaintext, err := DecryptAES256CBC(encryptionKey, iv, data[HMACSize+IVSize:])
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed: %w", err)
+	}
+	return plaintext, nil
+}
+
 // ToBase64 converts the encryption info to base64-encoded strings
 func (e *EncryptionInfo) ToBase64() EncryptionInfoBase64 {
 	return EncryptionInfoBase64{
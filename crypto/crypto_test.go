@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"io"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -228,3 +231,159 @@ func TestEncryptionInfoToBase64(t *testing.T) {
 		t.Errorf("UnencryptedSize mismatch: expected 12345, got %d", b64.UnencryptedSize)
 	}
 }
+
+func TestDecrypt(t *testing.T) {
+	plaintext := []byte("Round trip content for decryption")
+
+	info, encrypted, err := Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	decrypted, err := Decrypt(info.EncryptionKey, info.MacKey, encrypted)
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Error("Decrypted content does not match original")
+	}
+
+	// Tampered ciphertext must fail HMAC verification
+	tampered := append([]byte(nil), encrypted...)
+	tampered[len(tampered)-1] ^= 0xFF
+	if _, err := Decrypt(info.EncryptionKey, info.MacKey, tampered); err != ErrMACMismatch {
+		t.Errorf("Expected ErrMACMismatch, got %v", err)
+	}
+
+	// Truncated data is rejected
+	if _, err := Decrypt(info.EncryptionKey, info.MacKey, encrypted[:HMACSize+IVSize]); err == nil {
+		t.Error("Expected error for truncated data")
+	}
+}
+
+func TestEncryptStream(t *testing.T) {
+	file, err := os.CreateTemp("", "crypto-stream-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	// Sizes around the block size and the read chunk size
+	for _, size := range []int{0, 1, 15, 16, 17, streamChunkSize - 1, streamChunkSize, streamChunkSize + 17, 3*streamChunkSize + 5} {
+		plaintext := bytes.Repeat([]byte{byte(size)}, size)
+		if err := file.Truncate(0); err != nil {
+			t.Fatalf("Failed to truncate temp file: %v", err)
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			t.Fatalf("Failed to seek temp file: %v", err)
+		}
+		info, err := EncryptStream(bytes.NewReader(plaintext), file)
+		if err != nil {
+			t.Fatalf("EncryptStream failed for %d bytes: %v", size, err)
+		}
+		encrypted, err := os.ReadFile(file.Name())
+		if err != nil {
+			t.Fatalf("Failed to read temp file: %v", err)
+		}
+
+		// The output has the format of Encrypt
+		decrypted, err := Decrypt(info.EncryptionKey, info.MacKey, encrypted)
+		if err != nil {
+			t.Errorf("Decrypt failed for %d bytes: %v", size, err)
+			continue
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("Decrypted content differs for %d bytes", size)
+		}
+		if info.UnencryptedSize != int64(size) || !bytes.Equal(info.FileDigest, ComputeSHA256(plaintext)) {
+			t.Errorf("Unexpected size or digest for %d bytes: %d", size, info.UnencryptedSize)
+		}
+		if !bytes.Equal(info.MAC, encrypted[:HMACSize]) || !bytes.Equal(info.IV, encrypted[HMACSize:HMACSize+IVSize]) {
+			t.Errorf("MAC or IV do not match the output for %d bytes", size)
+		}
+	}
+}
+
+func TestDecryptStream(t *testing.T) {
+	// Sizes around the block size and the read chunk size
+	for _, size := range []int{0, 1, 15, 16, 17, streamChunkSize - 1, streamChunkSize, streamChunkSize + 17, 3*streamChunkSize + 5} {
+		plaintext := bytes.Repeat([]byte{byte(size)}, size)
+		info, encrypted, err := Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt failed: %v", err)
+		}
+		var out bytes.Buffer
+		n, err := DecryptStream(info.EncryptionKey, info.MacKey, bytes.NewReader(encrypted), &out)
+		if err != nil {
+			t.Errorf("DecryptStream failed for %d bytes: %v", size, err)
+			continue
+		}
+		if n != int64(size) || !bytes.Equal(out.Bytes(), plaintext) {
+			t.Errorf("DecryptStream returned %d bytes for %d bytes of content", n, size)
+		}
+
+		tampered := append([]byte{}, encrypted...)
+		tampered[len(tampered)-1] ^= 0xFF
+		if _, err := DecryptStream(info.EncryptionKey, info.MacKey, bytes.NewReader(tampered), io.Discard); err != ErrMACMismatch {
+			t.Errorf("Expected ErrMACMismatch for %d bytes, got %v", size, err)
+		}
+		if _, err := DecryptStream(info.EncryptionKey, info.MacKey, bytes.NewReader(encrypted[:len(encrypted)-7]), io.Discard); err != ErrMACMismatch {
+			t.Errorf("Expected ErrMACMismatch for truncated data of %d bytes, got %v", size, err)
+		}
+	}
+
+	info, encrypted, err := Encrypt([]byte("data"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if _, err := DecryptStream(info.EncryptionKey, info.MacKey, bytes.NewReader(encrypted[:20]), io.Discard); err == nil || !strings.Contains(err.Error(), "too short") {
+		t.Errorf("Expected error for short data, got %v", err)
+	}
+}
+
+func TestVerifyStream(t *testing.T) {
+	info, encrypted, err := Encrypt(bytes.Repeat([]byte("data"), 1000))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	n, err := VerifyStream(info.MacKey, bytes.NewReader(encrypted))
+	if err != nil {
+		t.Fatalf("VerifyStream failed: %v", err)
+	}
+	if n != int64(len(encrypted)) {
+		t.Errorf("VerifyStream read %d bytes, expected %d", n, len(encrypted))
+	}
+
+	tampered := append([]byte{}, encrypted...)
+	tampered[HMACSize+IVSize+100] ^= 0xFF
+	if _, err := VerifyStream(info.MacKey, bytes.NewReader(tampered)); err != ErrMACMismatch {
+		t.Errorf("Expected ErrMACMismatch for tampered data, got %v", err)
+	}
+	if _, err := VerifyStream(info.EncryptionKey, bytes.NewReader(encrypted)); err != ErrMACMismatch {
+		t.Errorf("Expected ErrMACMismatch for the wrong key, got %v", err)
+	}
+	if _, err := VerifyStream(info.MacKey, bytes.NewReader(encrypted[:20])); err == nil || !strings.Contains(err.Error(), "too short") {
+		t.Errorf("Expected error for short data, got %v", err)
+	}
+}
+
+func TestPKCS7Unpad(t *testing.T) {
+	for _, n := range []int{0, 1, 15, 16, 17} {
+		data := bytes.Repeat([]byte{0xAB}, n)
+		unpadded, err := pkcs7Unpad(pkcs7Pad(append([]byte(nil), data...), aes.BlockSize), aes.BlockSize)
+		if err != nil {
+			t.Errorf("pkcs7Unpad(%d bytes) failed: %v", n, err)
+			continue
+		}
+		if !bytes.Equal(unpadded, data) {
+			t.Errorf("pkcs7Unpad(%d bytes): content mismatch", n)
+		}
+	}
+
+	invalid := make([]byte, 16)
+	invalid[15] = 17
+	if _, err := pkcs7Unpad(invalid, aes.BlockSize); err == nil {
+		t.Error("Expected error for invalid padding")
+	}
+}
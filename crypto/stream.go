@@ -0,0 +1,193 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// streamChunkSize is the amount of data read at a time by EncryptStream
+// and DecryptStream, a multiple of the AES block size
+const streamChunkSize = 1 << 20
+
+// EncryptStream performs authenticated encryption like Encrypt on data
+// read from r, with new random keys, and writes [HMAC][IV][Ciphertext] to
+// w, so that neither the plaintext nor the ciphertext are held in memory.
+// The HMAC is only known once all data is encrypted; it is written over a
+// placeholder at the start of the output, and w is left at its end.
+func EncryptStream(r io.Reader, w io.WriteSeeker) (*EncryptionInfo, error) {
+	encryptionKey, err := GenerateKey(AES256KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+	macKey, err := GenerateKey(AES256KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate MAC key: %w", err)
+	}
+	iv, err := GenerateIV()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate IV: %w", err)
+	}
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append(make([]byte, HMACSize), iv...)); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	out := io.MultiWriter(w, mac)
+	digest := sha256.New()
+	mode := cipher.NewCBCEncrypter(block, iv)
+
+	// Full chunks are encrypted as they are read; the padding is added to
+	// the rest, which is a full block for data of a multiple of the size
+	var size int64
+	buf := make([]byte, streamChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		digest.Write(buf[:n])
+		size += int64(n)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, err
+		}
+		chunk := buf[:n]
+		if err != nil {
+			chunk = pkcs7Pad(chunk, aes.BlockSize)
+		}
+		mode.CryptBlocks(chunk, chunk)
+		if _, err := out.Write(chunk); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	sum := mac.Sum(nil)
+	if _, err := w.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(sum); err != nil {
+		return nil, err
+	}
+	if _, err := w.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+	return &EncryptionInfo{
+		EncryptionKey:   encryptionKey,
+		MacKey:          macKey,
+		IV:              iv,
+		MAC:             sum,
+		FileDigest:      digest.Sum(nil),
+		UnencryptedSize: size,
+	}, nil
+}
+
+// DecryptStream decrypts data produced by Encrypt ([HMAC][IV][Ciphertext])
+// from r to w, computing the HMAC while reading, so that neither the
+// ciphertext nor the plaintext are held in memory. It returns the number
+// of plaintext bytes written.
+//
+// The HMAC can only be compared once all data is read: w receives
+// unverified plaintext, which the caller must discard when an error is
+// returned. ErrMACMismatch takes precedence over padding errors, which
+// corrupted data causes as well.
+func DecryptStream(encryptionKey, macKey []byte, r io.Reader, w io.Writer) (int64, error) {
+	if len(encryptionKey) != AES256KeySize {
+		return 0, fmt.Errorf("invalid key size: expected %d, got %d", AES256KeySize, len(encryptionKey))
+	}
+	header := make([]byte, HMACSize+IVSize)
+	if n, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, fmt.Errorf("encrypted data too short: %d bytes", n)
+		}
+		return 0, err
+	}
+	expectedMAC, iv := header[:HMACSize], header[HMACSize:]
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	mode := cipher.NewCBCDecrypter(block, iv)
+
+	// The last block is held back until the end of the data, as it
+	// carries the padding
+	var written int64
+	buf := make([]byte, 0, streamChunkSize+aes.BlockSize)
+	for {
+		n, err := io.ReadFull(r, buf[len(buf):cap(buf)])
+		mac.Write(buf[len(buf) : len(buf)+n])
+		buf = buf[:len(buf)+n]
+		eof := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !eof {
+			return written, err
+		}
+		if eof {
+			break
+		}
+
+		ready := len(buf) - aes.BlockSize
+		ready -= ready % aes.BlockSize
+		mode.CryptBlocks(buf[:ready], buf[:ready])
+		if _, err := w.Write(buf[:ready]); err != nil {
+			return written, err
+		}
+		written += int64(ready)
+		buf = buf[:copy(buf, buf[ready:])]
+	}
+
+	if !hmac.Equal(mac.Sum(nil), expectedMAC) {
+		return written, ErrMACMismatch
+	}
+	if len(buf) == 0 || len(buf)%aes.BlockSize != 0 {
+		return written, fmt.Errorf("decryption failed: ciphertext is not a multiple of the block size")
+	}
+	mode.CryptBlocks(buf, buf)
+	plaintext, err := pkcs7Unpad(buf, aes.BlockSize)
+	if err != nil {
+		return written, fmt.Errorf("decryption failed: %w", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return written, err
+	}
+	return written + int64(len(plaintext)), nil
+}
+
+// VerifyStream checks the HMAC of data produced by Encrypt
+// ([HMAC][IV][Ciphertext]) read from r, without decrypting it, and returns
+// the number of bytes read. It takes a single pass over the data and no
+// encryption key, so it is the quick check of content at rest.
+func VerifyStream(macKey []byte, r io.Reader) (int64, error) {
+	header := make([]byte, HMACSize+IVSize)
+	if n, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return int64(n), fmt.Errorf("encrypted data too short: %d bytes", n)
+		}
+		return int64(n), err
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(header[HMACSize:])
+	n, err := io.Copy(mac, r)
+	n += int64(len(header))
+	if err != nil {
+		return n, err
+	}
+	if !hmac.Equal(mac.Sum(nil), header[:HMACSize]) {
+		return n, ErrMACMismatch
+	}
+	return n, nil
+}
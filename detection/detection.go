@@ -0,0 +1,325 @@
+// Package detection describes the rules Intune uses to detect whether a
+// Win32 app is installed.
+//
+// Rules use the JSON format of the win32LobAppRule resources of Microsoft
+// Graph, so that they can be copied from existing apps into a build config
+// and sent to Graph as is:
+//
+//	{
+//	    "@odata.type": "#microsoft.graph.win32LobAppProductCodeRule",
+//	    "ruleType": "detection",
+//	    "productCode": "{11111111-2222-3333-4444-555555555555}",
+//	    "productVersionOperator": "greaterThanOrEqual",
+//	    "productVersion": "1.2.0"
+//	}
+//
+// Go code creates rules with the builders instead:
+//
+//	rules := []detection.Rule{
+//	    detection.File(`C:\Program Files\Contoso\app.exe`, detection.Version(detection.OperatorGreaterThanOrEqual, "1.2.0")),
+//	    detection.Registry("HKLM", `SOFTWARE\Contoso\App`, "Version", detection.Exists()),
+//	}
+//
+// Validate checks rules from either source before they are used.
+package detection
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+// Graph types of the supported rules
+const (
+	ProductCodeType = "#microsoft.graph.win32LobAppProductCodeRule"
+	FileSystemType  = "#microsoft.graph.win32LobAppFileSystemRule"
+	RegistryType    = "#microsoft.graph.win32LobAppRegistryRule"
+	ScriptType      = "#microsoft.graph.win32LobAppPowerShellScriptRule"
+)
+
+// RuleTypeDetection marks a rule as a detection rule (as opposed to a
+// requirement rule)
+const RuleTypeDetection = "detection"
+
+// Operators compare the detected value with the value of a rule
+const (
+	OperatorNotConfigured      = "notConfigured"
+	OperatorEqual              = "equal"
+	OperatorNotEqual           = "notEqual"
+	OperatorGreaterThan        = "greaterThan"
+	OperatorGreaterThanOrEqual = "greaterThanOrEqual"
+	OperatorLessThan           = "lessThan"
+	OperatorLessThanOrEqual    = "lessThanOrEqual"
+)
+
+// Operators lists the supported operators
+var Operators = []string{
+	OperatorNotConfigured, OperatorEqual, OperatorNotEqual, OperatorGreaterThan,
+	OperatorGreaterThanOrEqual, OperatorLessThan, OperatorLessThanOrEqual,
+}
+
+// Operation types of file and registry rules. Exists and DoesNotExist
+// take no operator; the others compare with Rule.ComparisonValue.
+const (
+	OperationExists       = "exists"
+	OperationDoesNotExist = "doesNotExist"
+	OperationVersion      = "version"
+	OperationString       = "string"
+	OperationInteger      = "integer"
+	OperationSizeInMB     = "sizeInMB"
+	OperationModifiedDate = "modifiedDate"
+	OperationCreatedDate  = "createdDate"
+)
+
+// fileOperations and registryOperations are the operation types Graph
+// accepts for file and registry rules
+var (
+	fileOperations     = []string{OperationExists, OperationDoesNotExist, OperationVersion, OperationSizeInMB, OperationModifiedDate, OperationCreatedDate}
+	registryOperations = []string{OperationExists, OperationDoesNotExist, OperationVersion, OperationString, OperationInteger}
+)
+
+// Hives maps the registry hive abbreviations to the names Graph expects
+var Hives = map[string]string{
+	"HKLM": "HKEY_LOCAL_MACHINE",
+	"HKCU": "HKEY_CURRENT_USER",
+	"HKCR": "HKEY_CLASSES_ROOT",
+	"HKU":  "HKEY_USERS",
+	"HKCC": "HKEY_CURRENT_CONFIG",
+}
+
+// productCodePattern matches MSI product codes
+var productCodePattern = regexp.MustCompile(`^\{[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}\}$`)
+
+// Rule is a win32LobAppRule. Only the fields of its type are set.
+type Rule struct {
+	ODataType string `json:"@odata.type"`
+	RuleType  string `json:"ruleType"`
+
+	// Product code rules
+	ProductCode            string `json:"productCode,omitempty"`
+	ProductVersionOperator string `json:"productVersionOperator,omitempty"`
+	ProductVersion         string `json:"productVersion,omitempty"`
+
+	// File system rules
+	Path             string `json:"path,omitempty"`
+	FileOrFolderName string `json:"fileOrFolderName,omitempty"`
+
+	// Registry rules
+	KeyPath   string `json:"keyPath,omitempty"`
+	ValueName string `json:"valueName,omitempty"`
+
+	// File system and registry rules
+	Check32BitOn64System bool   `json:"check32BitOn64System,omitempty"`
+	OperationType        string `json:"operationType,omitempty"`
+	Operator             string `json:"operator,omitempty"`
+	ComparisonValue      string `json:"comparisonValue,omitempty"`
+
+	// Script rules. ScriptContent is base64 encoded.
+	ScriptContent         string `json:"scriptContent,omitempty"`
+	EnforceSignatureCheck bool   `json:"enforceSignatureCheck,omitempty"`
+	RunAs32Bit            bool   `json:"runAs32Bit,omitempty"`
+}
+
+// Check is the check of a file or registry rule
+type Check struct {
+	OperationType   string
+	Operator        string
+	ComparisonValue string
+}
+
+// Exists checks that the file, folder or registry value exists
+func Exists() Check {
+	return Check{OperationType: OperationExists, Operator: OperatorNotConfigured}
+}
+
+// DoesNotExist checks that the file, folder or registry value is absent
+func DoesNotExist() Check {
+	return Check{OperationType: OperationDoesNotExist, Operator: OperatorNotConfigured}
+}
+
+// Version compares the file or registry version with a version
+func Version(operator, version string) Check {
+	return Check{OperationType: OperationVersion, Operator: operator, ComparisonValue: version}
+}
+
+// String compares a registry value with a string
+func String(operator, value string) Check {
+	return Check{OperationType: OperationString, Operator: operator, ComparisonValue: value}
+}
+
+// Integer compares a registry value with an integer
+func Integer(operator string, value int64) Check {
+	return Check{OperationType: OperationInteger, Operator: operator, ComparisonValue: fmt.Sprint(value)}
+}
+
+// ProductCode creates a rule detecting an MSI product by its product code.
+// If version is set, the installed version must be the same or newer.
+func ProductCode(productCode, version string) Rule {
+	rule := Rule{
+		ODataType:              ProductCodeType,
+		RuleType:               RuleTypeDetection,
+		ProductCode:            productCode,
+		ProductVersionOperator: OperatorNotConfigured,
+	}
+	if version != "" {
+		rule.ProductVersionOperator = OperatorGreaterThanOrEqual
+		rule.ProductVersion = version
+	}
+	return rule
+}
+
+// File creates a rule detecting a file or folder by its full path, e.g.
+// C:\Program Files\Contoso\app.exe. Without a check it must exist.
+func File(path string, check ...Check) Rule {
+	path = strings.ReplaceAll(path, "/", `\`)
+	dir, name := "", path
+	if i := strings.LastIndex(path, `\`); i >= 0 {
+		dir, name = path[:i], path[i+1:]
+	}
+	rule := Rule{
+		ODataType:        FileSystemType,
+		RuleType:         RuleTypeDetection,
+		Path:             dir,
+		FileOrFolderName: name,
+	}
+	rule.setCheck(check)
+	return rule
+}
+
+// Registry creates a rule detecting a registry value. The hive may be
+// abbreviated (HKLM); an empty value name checks the key itself. Without
+// a check the value must exist.
+func Registry(hive, key, value string, check ...Check) Rule {
+	if long, ok := Hives[strings.ToUpper(hive)]; ok {
+		hive = long
+	}
+	rule := Rule{
+		ODataType: RegistryType,
+		RuleType:  RuleTypeDetection,
+		KeyPath:   hive + `\` + strings.Trim(key, `\`),
+		ValueName: value,
+	}
+	rule.setCheck(check)
+	return rule
+}
+
+// Script creates a rule running a PowerShell script. The app is detected
+// if the script exits with 0 and writes to stdout.
+func Script(script []byte) Rule {
+	return Rule{
+		ODataType:     ScriptType,
+		RuleType:      RuleTypeDetection,
+		ScriptContent: base64.StdEncoding.EncodeToString(script),
+		OperationType: "notConfigured",
+		Operator:      OperatorNotConfigured,
+	}
+}
+
+func (r *Rule) setCheck(check []Check) {
+	c := Exists()
+	if len(check) > 0 {
+		c = check[0]
+	}
+	r.OperationType = c.OperationType
+	r.Operator = c.Operator
+	r.ComparisonValue = c.ComparisonValue
+}
+
+// FromMsiInfo creates the product code rule of an MSI package. It returns
+// false if the package has no MSI metadata.
+func FromMsiInfo(msi *metadata.MsiInfo) (Rule, bool) {
+	if msi == nil || msi.MsiProductCode == "" {
+		return Rule{}, false
+	}
+	return ProductCode(msi.MsiProductCode, msi.MsiProductVersion), true
+}
+
+// Validate checks a rule for missing or unsupported values
+func (r Rule) Validate() error {
+	if r.RuleType != RuleTypeDetection {
+		return fmt.Errorf("unsupported ruleType %q, expected %s", r.RuleType, RuleTypeDetection)
+	}
+
+	switch r.ODataType {
+	case ProductCodeType:
+		if !productCodePattern.MatchString(r.ProductCode) {
+			return fmt.Errorf("invalid productCode %q, expected a GUID in braces", r.ProductCode)
+		}
+		return validateComparison(r.ProductVersionOperator, r.ProductVersion, "productVersion")
+	case FileSystemType:
+		if r.Path == "" || r.FileOrFolderName == "" {
+			return fmt.Errorf("file rules require path and fileOrFolderName")
+		}
+		if strings.ContainsAny(r.FileOrFolderName, `\/`) {
+			return fmt.Errorf("fileOrFolderName %q must not contain a path", r.FileOrFolderName)
+		}
+		return r.validateCheck(fileOperations)
+	case RegistryType:
+		hive, _, _ := strings.Cut(r.KeyPath, `\`)
+		if !isHive(hive) {
+			return fmt.Errorf("keyPath %q must start with a registry hive such as HKEY_LOCAL_MACHINE", r.KeyPath)
+		}
+		return r.validateCheck(registryOperations)
+	case ScriptType:
+		script, err := base64.StdEncoding.DecodeString(r.ScriptContent)
+		if err != nil {
+			return fmt.Errorf("scriptContent is not base64: %w", err)
+		}
+		if len(strings.TrimSpace(string(script))) == 0 {
+			return fmt.Errorf("scriptContent is empty")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported rule @odata.type %q", r.ODataType)
+	}
+}
+
+// validateCheck checks the operation type, operator and comparison value
+// of file and registry rules
+func (r Rule) validateCheck(operations []string) error {
+	if !contains(operations, r.OperationType) {
+		return fmt.Errorf("unsupported operationType %q (supported: %s)", r.OperationType, strings.Join(operations, ", "))
+	}
+	if r.OperationType == OperationExists || r.OperationType == OperationDoesNotExist {
+		return nil
+	}
+	if r.Operator == OperatorNotConfigured || r.Operator == "" {
+		return fmt.Errorf("operationType %s requires an operator", r.OperationType)
+	}
+	return validateComparison(r.Operator, r.ComparisonValue, "comparisonValue")
+}
+
+// validateComparison checks an operator and the value it compares with
+func validateComparison(operator, value, field string) error {
+	if operator == "" || operator == OperatorNotConfigured {
+		return nil
+	}
+	if !contains(Operators, operator) {
+		return fmt.Errorf("unsupported operator %q (supported: %s)", operator, strings.Join(Operators, ", "))
+	}
+	if value == "" {
+		return fmt.Errorf("operator %s requires a %s", operator, field)
+	}
+	return nil
+}
+
+func isHive(hive string) bool {
+	for _, long := range Hives {
+		if strings.EqualFold(hive, long) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package detection
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+func TestFromMsiInfo(t *testing.T) {
+	if _, ok := FromMsiInfo(nil); ok {
+		t.Error("Expected no rule without MSI metadata")
+	}
+
+	rule, ok := FromMsiInfo(&metadata.MsiInfo{
+		MsiProductCode:    "{11111111-2222-3333-4444-555555555555}",
+		MsiProductVersion: "1.2.0",
+	})
+	if !ok {
+		t.Fatal("Expected a rule for MSI metadata")
+	}
+	data, err := json.Marshal(rule)
+	if err != nil {
+		t.Fatalf("Failed to marshal rule: %v", err)
+	}
+	want := `{"@odata.type":"#microsoft.graph.win32LobAppProductCodeRule","ruleType":"detection",` +
+		`"productCode":"{11111111-2222-3333-4444-555555555555}","productVersionOperator":"greaterThanOrEqual","productVersion":"1.2.0"}`
+	if string(data) != want {
+		t.Errorf("Unexpected rule:\n got %s\nwant %s", data, want)
+	}
+
+	// Without a version any installed version is detected
+	rule = ProductCode("{PRODUCT}", "")
+	if rule.ProductVersionOperator != OperatorNotConfigured || rule.ProductVersion != "" {
+		t.Errorf("Unexpected version comparison: %+v", rule)
+	}
+}
+
+func TestBuilders(t *testing.T) {
+	rule := File(`C:\Program Files\Contoso\app.exe`, Version(OperatorGreaterThanOrEqual, "1.2.0"))
+	if rule.Path != `C:\Program Files\Contoso` || rule.FileOrFolderName != "app.exe" || rule.OperationType != OperationVersion || rule.ComparisonValue != "1.2.0" {
+		t.Errorf("Unexpected file rule: %+v", rule)
+	}
+
+	rule = Registry("hklm", `\SOFTWARE\Contoso\App\`, "Installed", Integer(OperatorEqual, 1))
+	if rule.KeyPath != `HKEY_LOCAL_MACHINE\SOFTWARE\Contoso\App` || rule.ValueName != "Installed" || rule.ComparisonValue != "1" {
+		t.Errorf("Unexpected registry rule: %+v", rule)
+	}
+	if rule := Registry("HKCU", `SOFTWARE\Contoso`, ""); rule.OperationType != OperationExists {
+		t.Errorf("Expected an existence check by default, got %+v", rule)
+	}
+
+	rule = Script([]byte("Write-Output 'installed'"))
+	if rule.ScriptContent != "V3JpdGUtT3V0cHV0ICdpbnN0YWxsZWQn" {
+		t.Errorf("Unexpected script content: %s", rule.ScriptContent)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, rule := range []Rule{
+		ProductCode("{11111111-2222-3333-4444-555555555555}", "1.0"),
+		File(`C:\Program Files\Contoso\app.exe`),
+		File(`%ProgramFiles%\Contoso`, Check{OperationType: OperationSizeInMB, Operator: OperatorGreaterThan, ComparisonValue: "10"}),
+		Registry("HKLM", `SOFTWARE\Contoso`, "Version", Version(OperatorEqual, "2.0")),
+		Script([]byte("exit 0")),
+	} {
+		if err := rule.Validate(); err != nil {
+			t.Errorf("Validate(%+v) failed: %v", rule, err)
+		}
+	}
+
+	invalid := map[string]Rule{
+		"rule type":        {ODataType: ProductCodeType, RuleType: "requirement", ProductCode: "{11111111-2222-3333-4444-555555555555}"},
+		"odata type":       {ODataType: "#microsoft.graph.win32LobAppRule", RuleType: RuleTypeDetection},
+		"product code":     ProductCode("11111111-2222-3333-4444-555555555555", ""),
+		"file name":        File("app.exe"),
+		"file operation":   File(`C:\app.exe`, String(OperatorEqual, "x")),
+		"missing operator": File(`C:\app.exe`, Version("", "1.0")),
+		"unknown operator": File(`C:\app.exe`, Version(">=", "1.0")),
+		"missing value":    Registry("HKLM", `SOFTWARE\Contoso`, "Version", Version(OperatorEqual, "")),
+		"hive":             Registry("HKEY_NOWHERE", `SOFTWARE\Contoso`, ""),
+		"empty script":     Script([]byte("  ")),
+		"script encoding":  {ODataType: ScriptType, RuleType: RuleTypeDetection, ScriptContent: "not base64!"},
+	}
+	for name, rule := range invalid {
+		if err := rule.Validate(); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
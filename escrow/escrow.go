@@ -0,0 +1,225 @@
+// Package escrow keeps archived .intunewin packages decryptable.
+//
+// The keys of a package are only stored in its Detection.xml, which is
+// consumed by Intune on upload. For every built package, escrow writes:
+//   - <package>.keys.enc: the Detection.xml encrypted with a team owned
+//     escrow key, in the same [HMAC][IV][Ciphertext] format as the
+//     package content
+//   - <package>.escrow.json: an unencrypted sidecar describing the package
+//     (digests and sizes) and the fingerprint of the escrow key needed to
+//     recover the Detection.xml
+//
+// The escrow key file holds 64 random bytes, base64 encoded: a 32 byte
+// AES-256 encryption key followed by a 32 byte HMAC-SHA256 key.
+package escrow
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MANCHTOOLS/open-package/crypto"
+)
+
+const (
+	// KeysSuffix is appended to the package path for the encrypted keys file
+	KeysSuffix = ".keys.enc"
+	// SidecarSuffix is appended to the package path for the sidecar file
+	SidecarSuffix = ".escrow.json"
+	// keySize is the size of an escrow key (encryption key + MAC key)
+	keySize = 2 * crypto.AES256KeySize
+)
+
+// Key is an escrow key
+type Key struct {
+	encryptionKey []byte
+	macKey        []byte
+}
+
+// Fingerprint identifies the key without revealing it
+func (k *Key) Fingerprint() string {
+	return "sha256:" + hex.EncodeToString(crypto.ComputeSHA256(append(append([]byte{}, k.encryptionKey...), k.macKey...)))
+}
+
+// GenerateKey creates a new escrow key and writes it to path. Existing
+// files are not overwritten. The file is synced to disk, as the key cannot
+// be recreated once packages are escrowed with it, and removed when it
+// cannot be written completely.
+func GenerateKey(path string) (*Key, error) {
+	raw, err := crypto.GenerateKey(keySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate escrow key: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create escrow key file: %w", err)
+	}
+	_, err = f.WriteString(base64.StdEncoding.EncodeToString(raw) + "\n")
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write escrow key file: %w", err)
+	}
+
+	return &Key{encryptionKey: raw[:crypto.AES256KeySize], macKey: raw[crypto.AES256KeySize:]}, nil
+}
+
+// LoadKey reads an escrow key file
+func LoadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read escrow key: %w", err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid escrow key %s: %w", path, err)
+	}
+	if len(raw) != keySize {
+		return nil, fmt.Errorf("invalid escrow key %s: expected %d bytes, got %d", path, keySize, len(raw))
+	}
+	return &Key{encryptionKey: raw[:crypto.AES256KeySize], macKey: raw[crypto.AES256KeySize:]}, nil
+}
+
+// Sidecar is the unencrypted description of an escrowed package
+type Sidecar struct {
+	// Package is the file name of the .intunewin package
+	Package string `json:"package"`
+	// PackageSHA256 is the hex SHA256 digest of the .intunewin file
+	PackageSHA256 string `json:"packageSha256"`
+	// PackageSize is the size of the .intunewin file in bytes
+	PackageSize int64 `json:"packageSize"`
+	// UnencryptedContentSize is the size of the inner ZIP in bytes
+	UnencryptedContentSize int64 `json:"unencryptedContentSize"`
+	// FileDigest is the base64 digest of the inner ZIP from Detection.xml
+	FileDigest string `json:"fileDigest"`
+	// FileDigestAlgorithm is the algorithm of FileDigest
+	FileDigestAlgorithm string `json:"fileDigestAlgorithm"`
+	// ProfileIdentifier is the crypto profile of the package content
+	ProfileIdentifier string `json:"profileIdentifier"`
+	// KeysFile is the file name of the encrypted Detection.xml
+	KeysFile string `json:"keysFile"`
+	// KeysSHA256 is the hex SHA256 digest of the encrypted keys file
+	KeysSHA256 string `json:"keysSha256"`
+	// KeyFingerprint identifies the escrow key needed to open KeysFile
+	KeyFingerprint string `json:"keyFingerprint"`
+	// JobID is the correlation ID of the build that created the package
+	JobID string `json:"jobId,omitempty"`
+	// Created is the time the escrow was written
+	Created time.Time `json:"created"`
+	// Recovery describes how to decrypt the package
+	Recovery string `json:"recovery"`
+}
+
+// recoveryNote is written to every sidecar
+const recoveryNote = "KeysFile is the package Detection.xml encrypted with the escrow key " +
+	"identified by KeyFingerprint: [32 byte HMAC-SHA256 over IV+ciphertext][16 byte IV][AES-256-CBC ciphertext, PKCS7 padded]. " +
+	"The escrow key file holds 64 base64 encoded bytes: the AES key followed by the HMAC key. " +
+	"Run 'open-package escrow recover -key <key file> <package>' to restore Detection.xml, " +
+	"whose EncryptionInfo decrypts IntuneWinPackage/Contents/IntunePackage.intunewin in the same format."
+
+// Details are the package values recorded in the sidecar
+type Details struct {
+	UnencryptedContentSize int64
+	FileDigest             string
+	FileDigestAlgorithm    string
+	ProfileIdentifier      string
+	JobID                  string
+}
+
+// hashFile returns the hex SHA256 digest and the size of the file at path
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// Write escrows the Detection.xml of the package at packagePath and writes
+// the sidecar next to it. It returns the paths of both files.
+func Write(key *Key, packagePath string, detectionXML []byte, details Details) (string, string, error) {
+	packageSHA256, packageSize, err := hashFile(packagePath)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read package: %w", err)
+	}
+
+	encrypted, err := crypto.EncryptWithKeys(key.encryptionKey, key.macKey, detectionXML)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt keys: %w", err)
+	}
+	keysPath := packagePath + KeysSuffix
+	if err := os.WriteFile(keysPath, encrypted, 0600); err != nil {
+		return "", "", fmt.Errorf("failed to write keys file: %w", err)
+	}
+
+	sidecar := Sidecar{
+		Package:                filepath.Base(packagePath),
+		PackageSHA256:          packageSHA256,
+		PackageSize:            packageSize,
+		UnencryptedContentSize: details.UnencryptedContentSize,
+		FileDigest:             details.FileDigest,
+		FileDigestAlgorithm:    details.FileDigestAlgorithm,
+		ProfileIdentifier:      details.ProfileIdentifier,
+		KeysFile:               filepath.Base(keysPath),
+		KeysSHA256:             hex.EncodeToString(crypto.ComputeSHA256(encrypted)),
+		KeyFingerprint:         key.Fingerprint(),
+		JobID:                  details.JobID,
+		Created:                time.Now().UTC(),
+		Recovery:               recoveryNote,
+	}
+	data, err := json.MarshalIndent(sidecar, "", "  ")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode sidecar: %w", err)
+	}
+	sidecarPath := packagePath + SidecarSuffix
+	if err := os.WriteFile(sidecarPath, append(data, '\n'), 0644); err != nil {
+		return "", "", fmt.Errorf("failed to write sidecar: %w", err)
+	}
+
+	return keysPath, sidecarPath, nil
+}
+
+// Recover decrypts the escrowed Detection.xml of the package at
+// packagePath. The key fingerprint is checked against the sidecar when
+// one exists.
+func Recover(key *Key, packagePath string) ([]byte, error) {
+	if data, err := os.ReadFile(packagePath + SidecarSuffix); err == nil {
+		var sidecar Sidecar
+		if err := json.NewDecoder(bytes.NewReader(data)).Decode(&sidecar); err != nil {
+			return nil, fmt.Errorf("failed to parse sidecar: %w", err)
+		}
+		if sidecar.KeyFingerprint != key.Fingerprint() {
+			return nil, fmt.Errorf("escrow key does not match the sidecar (expected %s, got %s)", sidecar.KeyFingerprint, key.Fingerprint())
+		}
+	}
+
+	encrypted, err := os.ReadFile(packagePath + KeysSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys file: %w", err)
+	}
+	detectionXML, err := crypto.Decrypt(key.encryptionKey, key.macKey, encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keys file: %w", err)
+	}
+	return detectionXML, nil
+}
@@ -0,0 +1,92 @@
+package escrow
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteRecover(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-escrow-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	keyPath := filepath.Join(tempDir, "escrow.key")
+	key, err := GenerateKey(keyPath)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	if _, err := GenerateKey(keyPath); err == nil {
+		t.Error("Expected error when overwriting an existing key")
+	}
+	loaded, err := LoadKey(keyPath)
+	if err != nil {
+		t.Fatalf("LoadKey failed: %v", err)
+	}
+	if loaded.Fingerprint() != key.Fingerprint() {
+		t.Errorf("Fingerprint mismatch: %s != %s", loaded.Fingerprint(), key.Fingerprint())
+	}
+
+	packagePath := filepath.Join(tempDir, "app.intunewin")
+	if err := os.WriteFile(packagePath, []byte("package"), 0644); err != nil {
+		t.Fatalf("Failed to write package: %v", err)
+	}
+	detectionXML := []byte("<ApplicationInfo />")
+
+	keysPath, sidecarPath, err := Write(key, packagePath, detectionXML, Details{
+		UnencryptedContentSize: 42,
+		FileDigest:             "ZGlnZXN0",
+		FileDigestAlgorithm:    "SHA256",
+		ProfileIdentifier:      "ProfileVersion1",
+		JobID:                  "job-42",
+	})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if keysPath != packagePath+KeysSuffix || sidecarPath != packagePath+SidecarSuffix {
+		t.Errorf("Unexpected paths: %s, %s", keysPath, sidecarPath)
+	}
+
+	data, err := os.ReadFile(sidecarPath)
+	if err != nil {
+		t.Fatalf("Failed to read sidecar: %v", err)
+	}
+	var sidecar Sidecar
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		t.Fatalf("Failed to parse sidecar: %v", err)
+	}
+	if sidecar.Package != "app.intunewin" || sidecar.PackageSize != 7 || sidecar.UnencryptedContentSize != 42 {
+		t.Errorf("Unexpected sidecar: %+v", sidecar)
+	}
+	if sidecar.JobID != "job-42" {
+		t.Errorf("JobID mismatch: %s", sidecar.JobID)
+	}
+	if sidecar.KeyFingerprint != key.Fingerprint() || sidecar.KeysFile != "app.intunewin"+KeysSuffix {
+		t.Errorf("Unexpected sidecar key fields: %+v", sidecar)
+	}
+
+	recovered, err := Recover(loaded, packagePath)
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if !bytes.Equal(recovered, detectionXML) {
+		t.Errorf("Recovered Detection.xml mismatch: %q", recovered)
+	}
+
+	// A different key is rejected
+	other, err := GenerateKey(filepath.Join(tempDir, "other.key"))
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	if _, err := Recover(other, packagePath); err == nil {
+		t.Error("Expected error for a different key")
+	}
+	os.Remove(sidecarPath)
+	if _, err := Recover(other, packagePath); err == nil {
+		t.Error("Expected HMAC error for a different key without sidecar")
+	}
+}
@@ -0,0 +1,86 @@
+// Package format describes the layout of the .intunewin container.
+//
+// A Spec names the entries of the outer ZIP: where Detection.xml is
+// stored, the folder of the encrypted content and its default name. Specs
+// are versioned, so that layout changes can be supported side by side:
+// packages are written with Current and read with the spec Detect finds
+// for their entries.
+package format
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+// Spec is a version of the outer ZIP layout
+type Spec struct {
+	// Version is the layout version, counting from 1
+	Version int
+	// MetadataPath is the entry of Detection.xml
+	MetadataPath string
+	// ContentsDir is the folder of the encrypted content, with a trailing
+	// slash
+	ContentsDir string
+	// ContentName is the default name of the encrypted content, used when
+	// Detection.xml names none
+	ContentName string
+	// Dirs are the directory entries tools may write, with trailing slashes
+	Dirs []string
+}
+
+// V1 is the layout of the Microsoft Win32 Content Prep Tool
+var V1 = &Spec{
+	Version:      1,
+	MetadataPath: metadata.DetectionXMLPath,
+	ContentsDir:  metadata.ContentsDir,
+	ContentName:  metadata.EncryptedFileName,
+	Dirs:         []string{"IntuneWinPackage/", "IntuneWinPackage/Metadata/", metadata.ContentsDir},
+}
+
+// Specs lists the supported layouts, newest first
+var Specs = []*Spec{V1}
+
+// Current is the layout packages are written with
+var Current = V1
+
+// String returns the name of the layout, e.g. "intunewin v1"
+func (s *Spec) String() string {
+	return "intunewin v" + strconv.Itoa(s.Version)
+}
+
+// ContentPath returns the entry of the encrypted content named fileName,
+// or of the default content name if fileName is empty
+func (s *Spec) ContentPath(fileName string) string {
+	if fileName == "" {
+		fileName = s.ContentName
+	}
+	return s.ContentsDir + fileName
+}
+
+// IsMetadataPath reports whether an entry name is the Detection.xml entry
+// of the layout. Names written by other tools with backslashes or in other
+// casing match as well.
+func (s *Spec) IsMetadataPath(name string) bool {
+	return strings.EqualFold(Normalize(name), s.MetadataPath)
+}
+
+// Detect returns the newest layout whose Detection.xml entry is among the
+// entries of an outer ZIP, or nil if there is none
+func Detect(entries []string) *Spec {
+	for _, spec := range Specs {
+		for _, entry := range entries {
+			if spec.IsMetadataPath(entry) {
+				return spec
+			}
+		}
+	}
+	return nil
+}
+
+// Normalize returns an entry name with forward slashes, for comparing
+// names written by tools that use backslashes
+func Normalize(name string) string {
+	return strings.ReplaceAll(name, `\`, "/")
+}
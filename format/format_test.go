@@ -0,0 +1,38 @@
+package format
+
+import (
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		entries  []string
+		expected *Spec
+	}{
+		{[]string{"IntuneWinPackage/Contents/IntunePackage.intunewin", "IntuneWinPackage/Metadata/Detection.xml"}, V1},
+		{[]string{`IntuneWinPackage\Metadata\Detection.xml`}, V1},
+		{[]string{"intunewinpackage/metadata/detection.xml"}, V1},
+		{[]string{"Metadata/Detection.xml"}, nil},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.entries); got != tt.expected {
+			t.Errorf("Detect(%v) = %v, expected %v", tt.entries, got, tt.expected)
+		}
+	}
+}
+
+func TestSpec(t *testing.T) {
+	if Current.String() != "intunewin v1" {
+		t.Errorf("Unexpected name %q", Current.String())
+	}
+	if got := V1.ContentPath(""); got != "IntuneWinPackage/Contents/IntunePackage.intunewin" {
+		t.Errorf("Unexpected default content path %q", got)
+	}
+	if got := V1.ContentPath("Other.intunewin"); got != "IntuneWinPackage/Contents/Other.intunewin" {
+		t.Errorf("Unexpected content path %q", got)
+	}
+	if Specs[0] != Current {
+		t.Error("Expected the current layout to be the newest")
+	}
+}
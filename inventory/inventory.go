@@ -0,0 +1,176 @@
+// Package inventory classifies the files of a package by type.
+//
+// Files are classified by extension into executables, scripts, drivers,
+// archives, disk images, media, documents and data, with file counts and
+// sizes per class and extension, so that reviewers see at a glance whether
+// a package contains unexpected content such as a stray disk image.
+package inventory
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// Content classes, in the order of Inventory.Classes
+const (
+	ClassExecutable = "executable"
+	ClassScript     = "script"
+	ClassDriver     = "driver"
+	ClassArchive    = "archive"
+	ClassDiskImage  = "disk image"
+	ClassMedia      = "media"
+	ClassDocument   = "document"
+	ClassData       = "data"
+)
+
+// Classes lists all content classes
+var Classes = []string{ClassExecutable, ClassScript, ClassDriver, ClassArchive, ClassDiskImage, ClassMedia, ClassDocument, ClassData}
+
+// classes maps file extensions to their content class. Other extensions
+// are data.
+var classes = map[string]string{
+	".exe": ClassExecutable, ".msi": ClassExecutable, ".msp": ClassExecutable, ".msu": ClassExecutable,
+	".msix": ClassExecutable, ".msixbundle": ClassExecutable, ".appx": ClassExecutable, ".appxbundle": ClassExecutable,
+	".dll": ClassExecutable, ".ocx": ClassExecutable, ".com": ClassExecutable, ".scr": ClassExecutable, ".cpl": ClassExecutable,
+
+	".ps1": ClassScript, ".psm1": ClassScript, ".psd1": ClassScript, ".cmd": ClassScript, ".bat": ClassScript,
+	".vbs": ClassScript, ".vbe": ClassScript, ".js": ClassScript, ".jse": ClassScript, ".wsf": ClassScript,
+	".hta": ClassScript, ".reg": ClassScript, ".sh": ClassScript, ".py": ClassScript,
+
+	".inf": ClassDriver, ".cat": ClassDriver, ".sys": ClassDriver,
+
+	".zip": ClassArchive, ".cab": ClassArchive, ".7z": ClassArchive, ".rar": ClassArchive, ".tar": ClassArchive,
+	".gz": ClassArchive, ".tgz": ClassArchive, ".xz": ClassArchive, ".bz2": ClassArchive, ".jar": ClassArchive,
+
+	".iso": ClassDiskImage, ".img": ClassDiskImage, ".vhd": ClassDiskImage, ".vhdx": ClassDiskImage,
+	".vmdk": ClassDiskImage, ".wim": ClassDiskImage, ".esd": ClassDiskImage, ".dmp": ClassDiskImage,
+
+	".png": ClassMedia, ".jpg": ClassMedia, ".jpeg": ClassMedia, ".gif": ClassMedia, ".bmp": ClassMedia,
+	".ico": ClassMedia, ".svg": ClassMedia, ".tif": ClassMedia, ".tiff": ClassMedia, ".webp": ClassMedia,
+	".mp3": ClassMedia, ".wav": ClassMedia, ".wma": ClassMedia, ".mp4": ClassMedia, ".avi": ClassMedia,
+	".mov": ClassMedia, ".wmv": ClassMedia, ".mkv": ClassMedia, ".ttf": ClassMedia, ".otf": ClassMedia,
+
+	".pdf": ClassDocument, ".txt": ClassDocument, ".rtf": ClassDocument, ".md": ClassDocument,
+	".htm": ClassDocument, ".html": ClassDocument, ".chm": ClassDocument, ".doc": ClassDocument,
+	".docx": ClassDocument, ".xls": ClassDocument, ".xlsx": ClassDocument, ".ppt": ClassDocument,
+	".pptx": ClassDocument,
+}
+
+// Classify returns the content class of a file name
+func Classify(name string) string {
+	if class, ok := classes[strings.ToLower(path.Ext(name))]; ok {
+		return class
+	}
+	return ClassData
+}
+
+// Extension is the share of a file extension in a class. Files without
+// extension have an empty Ext.
+type Extension struct {
+	Ext   string `json:"ext"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// Class is the share of a content class in a package
+type Class struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+	// Extensions are the extensions of the class, largest first
+	Extensions []Extension `json:"extensions"`
+}
+
+// Inventory is the content of a package by class
+type Inventory struct {
+	Files int   `json:"files"`
+	Size  int64 `json:"size"`
+	// Classes are the classes present in the package, in the order of
+	// the Classes variable
+	Classes []Class `json:"classes"`
+}
+
+// Add counts a file
+func (inv *Inventory) Add(name string, size int64) {
+	inv.Files++
+	inv.Size += size
+
+	className := Classify(name)
+	i := 0
+	for i < len(inv.Classes) && inv.Classes[i].Name != className {
+		i++
+	}
+	if i == len(inv.Classes) {
+		inv.Classes = append(inv.Classes, Class{Name: className})
+		sort.SliceStable(inv.Classes, func(a, b int) bool {
+			return classIndex(inv.Classes[a].Name) < classIndex(inv.Classes[b].Name)
+		})
+		for inv.Classes[i].Name != className {
+			i--
+		}
+	}
+	class := &inv.Classes[i]
+	class.Files++
+	class.Size += size
+
+	ext := strings.ToLower(path.Ext(name))
+	for j := range class.Extensions {
+		if class.Extensions[j].Ext == ext {
+			class.Extensions[j].Files++
+			class.Extensions[j].Size += size
+			sortExtensions(class.Extensions)
+			return
+		}
+	}
+	class.Extensions = append(class.Extensions, Extension{Ext: ext, Files: 1, Size: size})
+	sortExtensions(class.Extensions)
+}
+
+// Class returns the share of a class, which is zero if the package has
+// no files of the class
+func (inv *Inventory) Class(name string) Class {
+	for _, c := range inv.Classes {
+		if c.Name == name {
+			return c
+		}
+	}
+	return Class{Name: name}
+}
+
+// FromInnerZip classifies the files of a decrypted package content by
+// their uncompressed size
+func FromInnerZip(innerZip []byte) (*Inventory, error) {
+	zr, err := unpacker.ReadInnerZip(innerZip)
+	if err != nil {
+		return nil, err
+	}
+	inv := &Inventory{}
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		inv.Add(f.Name, int64(f.UncompressedSize64))
+	}
+	return inv, nil
+}
+
+func classIndex(name string) int {
+	for i, c := range Classes {
+		if c == name {
+			return i
+		}
+	}
+	return len(Classes)
+}
+
+func sortExtensions(exts []Extension) {
+	sort.SliceStable(exts, func(i, j int) bool {
+		if exts[i].Size != exts[j].Size {
+			return exts[i].Size > exts[j].Size
+		}
+		return exts[i].Ext < exts[j].Ext
+	})
+}
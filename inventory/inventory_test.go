@@ -0,0 +1,76 @@
+package inventory
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+func TestFromInnerZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string]int{
+		"app/setup.exe":          300,
+		"app/lib/core.dll":       200,
+		"app/install.PS1":        10,
+		"app/drivers/x.inf":      5,
+		"app/drivers/x.sys":      50,
+		"app/backup/disk.vhdx":   5000,
+		"app/readme.txt":         20,
+		"app/config/settings":    7,
+		"app/config/defaults.db": 40,
+	}
+	if _, err := zw.Create("app/drivers/"); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	for name, size := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		w.Write(make([]byte, size))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close ZIP: %v", err)
+	}
+
+	inv, err := FromInnerZip(buf.Bytes())
+	if err != nil {
+		t.Fatalf("FromInnerZip failed: %v", err)
+	}
+	if inv.Files != 9 || inv.Size != 5632 {
+		t.Errorf("Unexpected totals: %d files, %d bytes", inv.Files, inv.Size)
+	}
+
+	var names []string
+	for _, c := range inv.Classes {
+		names = append(names, c.Name)
+	}
+	expected := []string{ClassExecutable, ClassScript, ClassDriver, ClassDiskImage, ClassDocument, ClassData}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected classes %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("Expected classes %v, got %v", expected, names)
+		}
+	}
+
+	exe := inv.Class(ClassExecutable)
+	if exe.Files != 2 || exe.Size != 500 || exe.Extensions[0].Ext != ".exe" || exe.Extensions[1].Ext != ".dll" {
+		t.Errorf("Unexpected executables: %+v", exe)
+	}
+	if script := inv.Class(ClassScript); len(script.Extensions) != 1 || script.Extensions[0].Ext != ".ps1" {
+		t.Errorf("Expected extensions to be case-insensitive: %+v", script)
+	}
+	if data := inv.Class(ClassData); data.Files != 2 || data.Extensions[1].Ext != "" {
+		t.Errorf("Unexpected data: %+v", data)
+	}
+	if media := inv.Class(ClassMedia); media.Files != 0 {
+		t.Errorf("Expected no media, got %+v", media)
+	}
+
+	if _, err := FromInnerZip([]byte("not a zip")); err == nil {
+		t.Error("Expected error for invalid content")
+	}
+}
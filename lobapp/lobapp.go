@@ -0,0 +1,356 @@
+// Package lobapp describes the Intune Win32 app (the win32LobApp resource
+// of Microsoft Graph) that a package is uploaded as.
+//
+// The app is written as a sidecar next to the package,
+// <package>.intunewin.app.json, in the JSON format Graph expects when the
+// app is created, so that upload tooling can send it as is. It combines
+// the Detection.xml of the package with the descriptive metadata of the
+// build config. Graph apps are not localized, so a sidecar per locale,
+// <package>.intunewin.app.<locale>.json, carries the localized display
+// name and description.
+package lobapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/detection"
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+// SidecarSuffix is appended to the package path for the app sidecar
+const SidecarSuffix = ".app.json"
+
+// ODataType is the Graph type of Win32 apps
+const ODataType = "#microsoft.graph.win32LobApp"
+
+// Metadata is the descriptive information of an app, shown in the Intune
+// portal and the Company Portal
+type Metadata struct {
+	Publisher      string `json:"publisher,omitempty"`
+	Description    string `json:"description,omitempty"`
+	InformationURL string `json:"informationUrl,omitempty"`
+	Owner          string `json:"owner,omitempty"`
+	Notes          string `json:"notes,omitempty"`
+	// InstallCommand replaces the install command derived from the setup
+	// file. EXE installers usually need the silent switches of the vendor.
+	InstallCommand string `json:"installCommand,omitempty"`
+	// Architectures lists the architectures the app applies to (x86, x64,
+	// arm64). Defaults to the architecture of the package, if any.
+	Architectures []string `json:"architectures,omitempty"`
+	// MinimumWindowsRelease is the oldest Windows release the app applies
+	// to, e.g. W10_1809 or W11_22H2 (see WindowsReleases)
+	MinimumWindowsRelease string `json:"minimumWindowsRelease,omitempty"`
+	// Detection replaces the detection rules derived from the package
+	// (the product code rule of MSI setups)
+	Detection []detection.Rule `json:"detection,omitempty"`
+	// Localized overrides the display name and description per locale
+	// (e.g. "de-DE"), for tenants that create an app per language
+	Localized map[string]Localization `json:"localized,omitempty"`
+}
+
+// Localization is the display name and description of an app in one
+// language. Empty values fall back to the default.
+type Localization struct {
+	DisplayName string `json:"displayName,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Architectures lists the supported values of Metadata.Architectures
+var Architectures = []string{"x86", "x64", "arm64"}
+
+// WindowsReleases lists the supported values of
+// Metadata.MinimumWindowsRelease, named as in the IntuneWin32App module
+var WindowsReleases = []string{
+	"W10_1607", "W10_1703", "W10_1709", "W10_1803", "W10_1809", "W10_1903",
+	"W10_1909", "W10_2004", "W10_20H2", "W10_21H1", "W10_21H2", "W10_22H2",
+	"W11_21H2", "W11_22H2", "W11_23H2", "W11_24H2",
+}
+
+// localePattern matches BCP 47 language tags such as "de" or "pt-BR"
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// IsZero reports whether no metadata is set
+func (m Metadata) IsZero() bool {
+	return m.Publisher == "" && m.Description == "" && m.InformationURL == "" &&
+		m.Owner == "" && m.Notes == "" && m.InstallCommand == "" && len(m.Architectures) == 0 &&
+		m.MinimumWindowsRelease == "" && len(m.Detection) == 0 && len(m.Localized) == 0
+}
+
+// Locales returns the locales of Localized in a stable order
+func (m Metadata) Locales() []string {
+	locales := make([]string, 0, len(m.Localized))
+	for locale := range m.Localized {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Validate checks the metadata for invalid values
+func (m Metadata) Validate() error {
+	if m.InformationURL != "" {
+		u, err := url.Parse(m.InformationURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("informationUrl %q is not an http(s) URL", m.InformationURL)
+		}
+	}
+	for _, arch := range m.Architectures {
+		if !contains(Architectures, arch) {
+			return fmt.Errorf("unsupported architecture %q (supported: %s)", arch, strings.Join(Architectures, ", "))
+		}
+	}
+	if m.MinimumWindowsRelease != "" && !contains(WindowsReleases, m.MinimumWindowsRelease) {
+		return fmt.Errorf("unsupported minimumWindowsRelease %q (supported: %s)", m.MinimumWindowsRelease, strings.Join(WindowsReleases, ", "))
+	}
+	for i, rule := range m.Detection {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("detection[%d]: %w", i, err)
+		}
+	}
+	for locale, l := range m.Localized {
+		if !localePattern.MatchString(locale) {
+			return fmt.Errorf("invalid locale %q, expected a language tag such as de-DE", locale)
+		}
+		if l == (Localization{}) {
+			return fmt.Errorf("locale %s sets neither displayName nor description", locale)
+		}
+	}
+	return nil
+}
+
+// App is the win32LobApp resource of a package
+type App struct {
+	ODataType            string             `json:"@odata.type"`
+	DisplayName          string             `json:"displayName"`
+	Description          string             `json:"description"`
+	Publisher            string             `json:"publisher"`
+	InformationURL       string             `json:"informationUrl,omitempty"`
+	Owner                string             `json:"owner,omitempty"`
+	Notes                string             `json:"notes,omitempty"`
+	FileName             string             `json:"fileName"`
+	SetupFilePath        string             `json:"setupFilePath"`
+	InstallCommandLine   string             `json:"installCommandLine"`
+	UninstallCommandLine string             `json:"uninstallCommandLine"`
+	InstallExperience    *InstallExperience `json:"installExperience"`
+	// ApplicableArchitectures is a comma-separated list, e.g. "x64,arm64"
+	ApplicableArchitectures        string `json:"applicableArchitectures,omitempty"`
+	MinimumSupportedWindowsRelease string `json:"minimumSupportedWindowsRelease,omitempty"`
+	// Rules are the detection rules of the app. Graph requires at least
+	// one, so upload tooling must add a rule when none could be derived.
+	Rules []detection.Rule `json:"rules,omitempty"`
+}
+
+// InstallExperience is the account and restart behavior of installs
+type InstallExperience struct {
+	// RunAsAccount is "system" or "user"
+	RunAsAccount string `json:"runAsAccount"`
+	// DeviceRestartBehavior is "basedOnReturnCode", "allow", "suppress"
+	// or "force"
+	DeviceRestartBehavior string `json:"deviceRestartBehavior"`
+}
+
+// Options describes the app of a package
+type Options struct {
+	// PackagePath is the path of the .intunewin file
+	PackagePath string
+	// Info is the Detection.xml of the package
+	Info *metadata.ApplicationInfo
+	// Metadata is the descriptive information from the build config
+	Metadata Metadata
+	// InstallCommand overrides the command derived from the setup file
+	InstallCommand string
+	// UninstallCommand overrides the command derived from MSI setups
+	UninstallCommand string
+	// Architecture is the architecture of the package (optional), used
+	// when the metadata declares no architectures
+	Architecture string
+}
+
+// New creates the app of a package. Graph requires a description and a
+// publisher, so the display name and the MSI publisher are used when the
+// metadata does not set them. The uninstall command is empty for setups
+// other than MSI unless Options.UninstallCommand is set. MSI setups are
+// detected by product code and version unless the metadata declares
+// detection rules.
+func New(opts Options) *App {
+	info := opts.Info
+	meta := opts.Metadata
+
+	app := &App{
+		ODataType:            ODataType,
+		DisplayName:          info.Name,
+		Description:          meta.Description,
+		Publisher:            meta.Publisher,
+		InformationURL:       meta.InformationURL,
+		Owner:                meta.Owner,
+		Notes:                meta.Notes,
+		FileName:             filepath.Base(opts.PackagePath),
+		SetupFilePath:        info.SetupFile,
+		InstallCommandLine:   opts.InstallCommand,
+		UninstallCommandLine: opts.UninstallCommand,
+		InstallExperience: &InstallExperience{
+			RunAsAccount:          "system",
+			DeviceRestartBehavior: "suppress",
+		},
+	}
+	architectures := meta.Architectures
+	if len(architectures) == 0 && opts.Architecture != "" {
+		architectures = []string{opts.Architecture}
+	}
+	app.ApplicableArchitectures = strings.Join(architectures, ",")
+	app.MinimumSupportedWindowsRelease = graphWindowsRelease(meta.MinimumWindowsRelease)
+	app.Rules = meta.Detection
+	if rule, ok := detection.FromMsiInfo(info.MsiInfo); ok && len(app.Rules) == 0 {
+		app.Rules = []detection.Rule{rule}
+	}
+	if app.InstallCommandLine == "" {
+		app.InstallCommandLine = meta.InstallCommand
+	}
+	if app.InstallCommandLine == "" {
+		app.InstallCommandLine = InstallCommand(info.SetupFile)
+	}
+	if app.Description == "" {
+		app.Description = info.Name
+	}
+	if msi := info.MsiInfo; msi != nil {
+		if app.Publisher == "" {
+			app.Publisher = msi.MsiPublisher
+		}
+		if app.UninstallCommandLine == "" && msi.MsiProductCode != "" {
+			app.UninstallCommandLine = fmt.Sprintf("msiexec /x %s /qn /norestart", msi.MsiProductCode)
+		}
+		if msi.MsiExecutionContext == "User" {
+			app.InstallExperience.RunAsAccount = "user"
+		}
+	}
+	return app
+}
+
+// Localize returns a copy of the app with the display name and description
+// of a locale of the metadata
+func (a *App) Localize(meta Metadata, locale string) (*App, error) {
+	l, ok := meta.Localized[locale]
+	if !ok {
+		return nil, fmt.Errorf("no localized metadata for %s", locale)
+	}
+	localized := *a
+	if l.DisplayName != "" {
+		localized.DisplayName = l.DisplayName
+	}
+	if l.Description != "" {
+		localized.Description = l.Description
+	}
+	return &localized, nil
+}
+
+// LocalizedPath returns the sidecar path of a localized app
+func LocalizedPath(packagePath, locale string) string {
+	return packagePath + strings.TrimSuffix(SidecarSuffix, ".json") + "." + locale + ".json"
+}
+
+// graphWindowsRelease converts a WindowsReleases value to the Graph
+// notation: "1809" for Windows 10, "Windows11_22H2" for Windows 11
+func graphWindowsRelease(release string) string {
+	if v, ok := strings.CutPrefix(release, "W10_"); ok {
+		return v
+	}
+	if v, ok := strings.CutPrefix(release, "W11_"); ok {
+		return "Windows11_" + v
+	}
+	return release
+}
+
+// Applicability describes the architectures and minimum Windows release
+// of the app for build output, e.g. "x64, Windows 10 1809 or later"
+func (m Metadata) Applicability(architecture string) string {
+	architectures := m.Architectures
+	if len(architectures) == 0 && architecture != "" {
+		architectures = []string{architecture}
+	}
+	parts := []string{"all architectures"}
+	if len(architectures) > 0 {
+		parts[0] = strings.Join(architectures, ", ")
+	}
+	if m.MinimumWindowsRelease != "" {
+		release := strings.NewReplacer("W10_", "Windows 10 ", "W11_", "Windows 11 ").Replace(m.MinimumWindowsRelease)
+		parts = append(parts, release+" or later")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// InstallCommand derives the install command of a setup file. Commands
+// for EXE installers usually need the silent switches of the vendor added.
+func InstallCommand(setupFile string) string {
+	path := strings.ReplaceAll(filepath.ToSlash(setupFile), "/", `\`)
+	switch strings.ToLower(filepath.Ext(setupFile)) {
+	case ".msi":
+		return fmt.Sprintf(`msiexec /i "%s" /qn /norestart`, path)
+	case ".ps1":
+		return fmt.Sprintf(`powershell.exe -ExecutionPolicy Bypass -File "%s"`, path)
+	default:
+		return `"` + path + `"`
+	}
+}
+
+// Write writes the app sidecar next to a package and returns its path
+func (a *App) Write(packagePath string) (string, error) {
+	return a.writeFile(packagePath + SidecarSuffix)
+}
+
+// WriteLocalized writes the localized app sidecars of all locales of the
+// metadata, <package>.intunewin.app.<locale>.json, and returns their paths
+func (a *App) WriteLocalized(packagePath string, meta Metadata) ([]string, error) {
+	var paths []string
+	for _, locale := range meta.Locales() {
+		localized, err := a.Localize(meta, locale)
+		if err != nil {
+			return nil, err
+		}
+		path, err := localized.writeFile(LocalizedPath(packagePath, locale))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func (a *App) writeFile(path string) (string, error) {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("failed to write app sidecar: %w", err)
+	}
+	return path, nil
+}
+
+// Load reads an app sidecar
+func Load(path string) (*App, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read app sidecar: %w", err)
+	}
+	var app App
+	if err := json.Unmarshal(data, &app); err != nil {
+		return nil, fmt.Errorf("failed to parse app sidecar %s: %w", path, err)
+	}
+	return &app, nil
+}
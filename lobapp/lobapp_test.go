@@ -0,0 +1,194 @@
+package lobapp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MANCHTOOLS/open-package/detection"
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+func TestNew(t *testing.T) {
+	info := &metadata.ApplicationInfo{
+		Name:      "My App",
+		SetupFile: "setup.msi",
+		MsiInfo: &metadata.MsiInfo{
+			MsiProductCode:      "{11111111-2222-3333-4444-555555555555}",
+			MsiExecutionContext: "System",
+			MsiPublisher:        "Contoso Ltd",
+		},
+	}
+
+	// Defaults are derived from Detection.xml
+	app := New(Options{PackagePath: "/out/My App.intunewin", Info: info})
+	if app.ODataType != ODataType || app.DisplayName != "My App" || app.Description != "My App" || app.Publisher != "Contoso Ltd" {
+		t.Errorf("Unexpected app: %+v", app)
+	}
+	if app.FileName != "My App.intunewin" || app.SetupFilePath != "setup.msi" {
+		t.Errorf("Unexpected file names: %s, %s", app.FileName, app.SetupFilePath)
+	}
+	if app.InstallCommandLine != `msiexec /i "setup.msi" /qn /norestart` {
+		t.Errorf("Unexpected install command: %s", app.InstallCommandLine)
+	}
+	if app.UninstallCommandLine != "msiexec /x {11111111-2222-3333-4444-555555555555} /qn /norestart" {
+		t.Errorf("Unexpected uninstall command: %s", app.UninstallCommandLine)
+	}
+	if app.InstallExperience.RunAsAccount != "system" {
+		t.Errorf("Unexpected install experience: %+v", app.InstallExperience)
+	}
+	if len(app.Rules) != 1 || app.Rules[0].ProductCode != "{11111111-2222-3333-4444-555555555555}" {
+		t.Errorf("Unexpected detection rules: %+v", app.Rules)
+	}
+
+	// Config metadata takes precedence
+	app = New(Options{PackagePath: "/out/My App.intunewin", Info: info, Metadata: Metadata{
+		Publisher:   "Contoso",
+		Description: "Line of business app",
+		Owner:       "Client Engineering",
+	}})
+	if app.Publisher != "Contoso" || app.Description != "Line of business app" || app.Owner != "Client Engineering" {
+		t.Errorf("Metadata not applied: %+v", app)
+	}
+
+	// Declared detection rules replace the product code rule
+	rule := detection.ProductCode("{66666666-7777-8888-9999-000000000000}", "")
+	if app := New(Options{Info: info, Metadata: Metadata{Detection: []detection.Rule{rule}}}); len(app.Rules) != 1 || app.Rules[0] != rule {
+		t.Errorf("Detection rules not applied: %+v", app.Rules)
+	}
+
+	// The install command of the metadata replaces the derived one, the
+	// command of the options replaces both
+	meta := Metadata{InstallCommand: `"setup.exe" /VERYSILENT`}
+	if app := New(Options{Info: info, Metadata: meta}); app.InstallCommandLine != meta.InstallCommand {
+		t.Errorf("Install command not applied: %s", app.InstallCommandLine)
+	}
+	if app := New(Options{Info: info, Metadata: meta, InstallCommand: "install.cmd"}); app.InstallCommandLine != "install.cmd" {
+		t.Errorf("Install command option not applied: %s", app.InstallCommandLine)
+	}
+
+	tempDir, err := os.MkdirTemp("", "open-package-lobapp-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path, err := app.Write(filepath.Join(tempDir, "My App.intunewin"))
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Owner != "Client Engineering" || loaded.InstallExperience == nil || loaded.InstallExperience.DeviceRestartBehavior != "suppress" {
+		t.Errorf("Unexpected loaded app: %+v", loaded)
+	}
+}
+
+func TestMetadataValidate(t *testing.T) {
+	for url, valid := range map[string]bool{
+		"":                        true,
+		"https://contoso.com/app": true,
+		"http://contoso.com":      true,
+		"contoso.com":             false,
+		"ftp://contoso.com":       false,
+	} {
+		err := Metadata{InformationURL: url}.Validate()
+		if (err == nil) != valid {
+			t.Errorf("Validate(%q) = %v, want valid %v", url, err, valid)
+		}
+	}
+}
+
+func TestLocalized(t *testing.T) {
+	meta := Metadata{
+		Description: "Line of business app",
+		Localized: map[string]Localization{
+			"de-DE": {DisplayName: "Meine App", Description: "Fachanwendung"},
+			"fr":    {DisplayName: "Mon app"},
+		},
+	}
+	if err := meta.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	for name, localized := range map[string]map[string]Localization{
+		"invalid locale": {"German": {DisplayName: "Meine App"}},
+		"empty locale":   {"de-DE": {}},
+	} {
+		if err := (Metadata{Localized: localized}).Validate(); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+
+	tempDir, err := os.MkdirTemp("", "open-package-lobapp-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	packagePath := filepath.Join(tempDir, "app.intunewin")
+	app := New(Options{PackagePath: packagePath, Info: &metadata.ApplicationInfo{Name: "My App", SetupFile: "install.exe"}, Metadata: meta})
+	paths, err := app.WriteLocalized(packagePath, meta)
+	if err != nil {
+		t.Fatalf("WriteLocalized failed: %v", err)
+	}
+	if len(paths) != 2 || paths[0] != packagePath+".app.de-DE.json" {
+		t.Fatalf("Unexpected sidecars: %v", paths)
+	}
+
+	de, err := Load(paths[0])
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if de.DisplayName != "Meine App" || de.Description != "Fachanwendung" {
+		t.Errorf("Unexpected de-DE app: %+v", de)
+	}
+	fr, err := Load(paths[1])
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if fr.DisplayName != "Mon app" || fr.Description != "Line of business app" {
+		t.Errorf("Unexpected fr app: %+v", fr)
+	}
+	if app.DisplayName != "My App" {
+		t.Errorf("Localize modified the default app: %+v", app)
+	}
+}
+
+func TestApplicability(t *testing.T) {
+	info := &metadata.ApplicationInfo{Name: "My App", SetupFile: "install.exe"}
+
+	// The package architecture applies unless architectures are declared
+	app := New(Options{Info: info, Architecture: "arm64"})
+	if app.ApplicableArchitectures != "arm64" || app.MinimumSupportedWindowsRelease != "" {
+		t.Errorf("Unexpected applicability: %q, %q", app.ApplicableArchitectures, app.MinimumSupportedWindowsRelease)
+	}
+
+	meta := Metadata{Architectures: []string{"x64", "arm64"}, MinimumWindowsRelease: "W11_22H2"}
+	if err := meta.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	app = New(Options{Info: info, Metadata: meta, Architecture: "x64"})
+	if app.ApplicableArchitectures != "x64,arm64" || app.MinimumSupportedWindowsRelease != "Windows11_22H2" {
+		t.Errorf("Unexpected applicability: %q, %q", app.ApplicableArchitectures, app.MinimumSupportedWindowsRelease)
+	}
+	if got := meta.Applicability("x64"); got != "x64, arm64, Windows 11 22H2 or later" {
+		t.Errorf("Unexpected applicability summary: %s", got)
+	}
+	if got := (Metadata{MinimumWindowsRelease: "W10_1809"}).Applicability(""); got != "all architectures, Windows 10 1809 or later" {
+		t.Errorf("Unexpected applicability summary: %s", got)
+	}
+	if app := New(Options{Info: info, Metadata: Metadata{MinimumWindowsRelease: "W10_21H2"}}); app.MinimumSupportedWindowsRelease != "21H2" {
+		t.Errorf("Unexpected Windows 10 release: %s", app.MinimumSupportedWindowsRelease)
+	}
+
+	for name, meta := range map[string]Metadata{
+		"invalid architecture": {Architectures: []string{"ia64"}},
+		"invalid release":      {MinimumWindowsRelease: "1809"},
+	} {
+		if err := meta.Validate(); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Package logging writes log files with size based rotation, so that long
+// running builds do not fill disks.
+//
+// When the log file would exceed the maximum size, it is renamed to
+// <path>.1, existing backups are shifted (<path>.1 to <path>.2 and so on)
+// and backups beyond the retention count are deleted.
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Default rotation settings
+const (
+	DefaultMaxSize  = 10 << 20
+	DefaultMaxFiles = 5
+)
+
+// RotatingFile is a log file that rotates when it reaches a maximum size.
+// It is safe for concurrent use.
+type RotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	// limit is the size at which the file is rotated next, beyond maxSize
+	// after a failed rotation
+	limit int64
+}
+
+// OpenRotatingFile opens or creates the log file at path. maxSize is the
+// size in bytes at which the file is rotated and maxFiles the number of
+// rotated files kept; zero values select the defaults.
+func OpenRotatingFile(path string, maxSize int64, maxFiles int) (*RotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxFiles <= 0 {
+		maxFiles = DefaultMaxFiles
+	}
+
+	r := &RotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles, limit: maxSize}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the log file for appending
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	r.file = f
+	r.size = stat.Size()
+	return nil
+}
+
+// Write appends p to the log file, rotating it first if p does not fit.
+// When the rotation fails, p is still appended to the log file and the
+// error of the rotation is returned; it is only retried once another
+// maximum size is written.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	var rotateErr error
+	if r.size > 0 && r.size+int64(len(p)) > r.limit {
+		rotateErr = r.rotate()
+		if r.file == nil {
+			return 0, rotateErr
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// rotate shifts the backups and starts a new log file. When the backups
+// cannot be renamed, the log file is opened again to keep appending to it.
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	r.file = nil
+
+	os.Remove(r.backupPath(r.maxFiles))
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(r.backupPath(i), r.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return r.reopen(err)
+		}
+	}
+	if err := os.Rename(r.path, r.backupPath(1)); err != nil {
+		return r.reopen(err)
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.limit = r.maxSize
+	return nil
+}
+
+// reopen opens the log file again after its rotation failed with err
+func (r *RotatingFile) reopen(err error) error {
+	err = fmt.Errorf("failed to rotate log file: %w", err)
+	if openErr := r.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	r.limit = r.size + r.maxSize
+	return err
+}
+
+// backupPath returns the path of the n-th rotated file
+func (r *RotatingFile) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", r.path, n)
+}
+
+// Close closes the log file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
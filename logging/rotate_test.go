@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-logging-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "build.log")
+	r, err := OpenRotatingFile(path, 20, 2)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile failed: %v", err)
+	}
+
+	lines := []string{"line one 12345\n", "line two 12345\n", "line three 123\n", "line four 1234\n"}
+	for _, line := range lines {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Each line fills a file: the current file and two backups are kept
+	expected := map[string]string{
+		path:        lines[3],
+		path + ".1": lines[2],
+		path + ".2": lines[1],
+	}
+	for file, content := range expected {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Errorf("Failed to read %s: %v", file, err)
+			continue
+		}
+		if string(data) != content {
+			t.Errorf("%s: expected %q, got %q", filepath.Base(file), content, data)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("Backup beyond retention was kept")
+	}
+
+	// Reopening appends to the existing file
+	r, err = OpenRotatingFile(path, 100, 2)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile failed: %v", err)
+	}
+	r.Write([]byte("appended\n"))
+	r.Close()
+	data, _ := os.ReadFile(path)
+	if !strings.HasSuffix(string(data), lines[3]+"appended\n") {
+		t.Errorf("Expected appended content, got %q", data)
+	}
+	if _, err := r.Write([]byte("x")); err == nil {
+		t.Error("Expected error writing to a closed file")
+	}
+}
+
+func TestRotatingFileRenameFailure(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-logging-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A non-empty directory in place of the backup cannot be replaced
+	path := filepath.Join(tempDir, "build.log")
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocked"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	r, err := OpenRotatingFile(path, 20, 1)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile failed: %v", err)
+	}
+	defer r.Close()
+
+	lines := []string{"line one 12345\n", "line two 12345\n", "3\n"}
+	if _, err := r.Write([]byte(lines[0])); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if n, err := r.Write([]byte(lines[1])); err == nil || n != len(lines[1]) {
+		t.Errorf("Expected the rotation error and the line written, got %d, %v", n, err)
+	}
+	// The error is returned once, and the log file is still written until
+	// another maximum size is reached
+	if _, err := r.Write([]byte(lines[2])); err != nil {
+		t.Errorf("Expected no error after the failed rotation, got %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if string(data) != strings.Join(lines, "") {
+		t.Errorf("Expected all lines in the log file, got %q", data)
+	}
+}
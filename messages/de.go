@@ -0,0 +1,59 @@
+package messages
+
+// german holds the German translations
+var german = map[string]string{
+	// Usage
+	"Creates .intunewin packages for Microsoft Intune Win32 app deployment.\n\n": "Erstellt .intunewin-Pakete für die Verteilung von Win32-Apps mit Microsoft Intune.\n\n",
+	"Usage:\n":     "Verwendung:\n",
+	"Commands:\n":  "Befehle:\n",
+	"Options:\n":   "Optionen:\n",
+	"\nExample:\n": "\nBeispiel:\n",
+
+	"Create .intunewin packages (default)":                                                             "Erstellt .intunewin-Pakete (Standard)",
+	"Decrypt a package and extract its content":                                                        "Entschlüsselt ein Paket und entpackt seinen Inhalt",
+	"Show the Detection.xml fields, entries and contents of a package":                                 "Zeigt die Detection.xml-Felder, Einträge und Inhalte eines Pakets",
+	"Validate a package and check its integrity":                                                       "Validiert ein Paket und prüft seine Integrität",
+	"Create escrow keys and recover escrowed Detection.xml files":                                      "Erstellt Escrow-Schlüssel und stellt hinterlegte Detection.xml-Dateien wieder her",
+	"Estimate package and device sizes without packaging":                                              "Schätzt Paket- und Gerätegrößen, ohne zu paketieren",
+	"Suggest how to split a source over the Intune size limit":                                         "Schlägt vor, wie eine Quelle über dem Intune-Größenlimit aufgeteilt wird",
+	"Create a package that downloads its payload at install time":                                      "Erstellt ein Paket, das seine Nutzdaten bei der Installation herunterlädt",
+	"List the files changed since a previous build":                                                    "Listet die seit einem früheren Build geänderten Dateien",
+	"Re-encrypt a package with new keys":                                                               "Verschlüsselt ein Paket mit neuen Schlüsseln",
+	"Regenerate the damaged Detection.xml of a package from its keys":                                  "Erzeugt die beschädigte Detection.xml eines Pakets aus seinen Schlüsseln neu",
+	"Index the files inside packages and search them":                                                  "Indiziert die Dateien in Paketen und durchsucht sie",
+	"Remove old package versions from an output folder":                                                "Entfernt alte Paketversionen aus einem Ausgabeordner",
+	"List the builds recorded with -record":                                                            "Listet die mit -record aufgezeichneten Builds",
+	"Show a recorded build or record its upload":                                                       "Zeigt einen aufgezeichneten Build oder zeichnet seinen Upload auf",
+	"Measure packaging throughput on this machine":                                                     "Misst den Paketierungsdurchsatz dieses Rechners",
+	"Create a synthetic source tree for reproducing issues":                                            "Erstellt einen synthetischen Quellbaum, um Probleme nachzustellen",
+	"Write the PowerShell module wrapping this CLI":                                                    "Schreibt das PowerShell-Modul für diese CLI",
+	"Compare a package of the official tool with one of this tool":                                     "Vergleicht ein Paket des offiziellen Tools mit einem dieses Tools",
+	"Language of the messages of all commands: en, de, fr or auto (default: $OPEN_PACKAGE_LANG or en)": "Sprache der Meldungen aller Befehle: en, de, fr oder auto (Standard: $OPEN_PACKAGE_LANG oder en)",
+
+	// Errors
+	"Error: %v\n":                           "Fehler: %v\n",
+	"Error: %s is required\n":               "Fehler: %s ist erforderlich\n",
+	"Error: %s requires %s\n":               "Fehler: %s erfordert %s\n",
+	"Error resolving output path: %v\n":     "Fehler beim Auflösen des Ausgabepfads: %v\n",
+	"Error creating output directory: %v\n": "Fehler beim Erstellen des Ausgabeordners: %v\n",
+	"Error: job %s: %v\n":                   "Fehler: Job %s: %v\n",
+	"Error: line %d: job %s: %v\n":          "Fehler: Zeile %d: Job %s: %v\n",
+	"Error: pruning old versions: %v\n":     "Fehler beim Entfernen alter Versionen: %v\n",
+	"Error writing results: %v\n":           "Fehler beim Schreiben der Ergebnisse: %v\n",
+
+	// Builds
+	"Architecture: %s\n":         "Architektur: %s\n",
+	"Source: %s\n":               "Quelle: %s\n",
+	"Setup file: %s\n":           "Setup-Datei: %s\n",
+	"Output: %s\n":               "Ausgabe: %s\n",
+	"Job: %s\n":                  "Job: %s\n",
+	"Applicability: %s\n":        "Anwendbarkeit: %s\n",
+	"Successfully created: %s\n": "Erfolgreich erstellt: %s\n",
+	"Pruned: %s\n":               "Entfernt: %s\n",
+	"Warning: %s\n":              "Warnung: %s\n",
+	"Skipped file: %s\n":         "Übersprungene Datei: %s\n",
+	"Note: %s is an MSIX package. MSIX packages can be uploaded to Intune directly\nas line-of-business apps. To deploy it through the Win32 channel, use -msix-wrapper\nto add a bootstrap install script.\n": "Hinweis: %s ist ein MSIX-Paket. MSIX-Pakete können direkt als Branchen-Apps\nin Intune hochgeladen werden. Um es über den Win32-Kanal zu verteilen, fügen Sie\nmit -msix-wrapper ein Installationsskript hinzu.\n",
+	"Note: %d files duplicate other packaged files, wasting %d bytes\n":                                                                                  "Hinweis: %d Dateien duplizieren andere paketierte Dateien und verschwenden %d Bytes\n",
+	"Note: the source contains %d driver packages; Win32 apps only install drivers staged by the install command (pnputil /add-driver <inf> /install)\n": "Hinweis: Die Quelle enthält %d Treiberpakete; Win32-Apps installieren nur Treiber, die der Installationsbefehl bereitstellt (pnputil /add-driver <inf> /install)\n",
+	"\n%d of %d package(s) created, results written to %s\n":                                                                                             "\n%d von %d Paket(en) erstellt, Ergebnisse in %s geschrieben\n",
+}
@@ -0,0 +1,59 @@
+package messages
+
+// french holds the French translations
+var french = map[string]string{
+	// Usage
+	"Creates .intunewin packages for Microsoft Intune Win32 app deployment.\n\n": "Crée des paquets .intunewin pour le déploiement d'applications Win32 avec Microsoft Intune.\n\n",
+	"Usage:\n":     "Utilisation :\n",
+	"Commands:\n":  "Commandes :\n",
+	"Options:\n":   "Options :\n",
+	"\nExample:\n": "\nExemple :\n",
+
+	"Create .intunewin packages (default)":                                                             "Crée des paquets .intunewin (par défaut)",
+	"Decrypt a package and extract its content":                                                        "Déchiffre un paquet et extrait son contenu",
+	"Show the Detection.xml fields, entries and contents of a package":                                 "Affiche les champs Detection.xml, les entrées et le contenu d'un paquet",
+	"Validate a package and check its integrity":                                                       "Valide un paquet et vérifie son intégrité",
+	"Create escrow keys and recover escrowed Detection.xml files":                                      "Crée des clés de séquestre et récupère les fichiers Detection.xml séquestrés",
+	"Estimate package and device sizes without packaging":                                              "Estime les tailles du paquet et sur l'appareil sans empaqueter",
+	"Suggest how to split a source over the Intune size limit":                                         "Propose un découpage d'une source dépassant la limite de taille d'Intune",
+	"Create a package that downloads its payload at install time":                                      "Crée un paquet qui télécharge son contenu à l'installation",
+	"List the files changed since a previous build":                                                    "Liste les fichiers modifiés depuis une génération précédente",
+	"Re-encrypt a package with new keys":                                                               "Chiffre à nouveau un paquet avec de nouvelles clés",
+	"Regenerate the damaged Detection.xml of a package from its keys":                                  "Régénère le fichier Detection.xml endommagé d'un paquet à partir de ses clés",
+	"Index the files inside packages and search them":                                                  "Indexe les fichiers contenus dans les paquets et les recherche",
+	"Remove old package versions from an output folder":                                                "Supprime les anciennes versions de paquets d'un dossier de sortie",
+	"List the builds recorded with -record":                                                            "Liste les générations enregistrées avec -record",
+	"Show a recorded build or record its upload":                                                       "Affiche une génération enregistrée ou enregistre son envoi",
+	"Measure packaging throughput on this machine":                                                     "Mesure le débit d'empaquetage de cette machine",
+	"Create a synthetic source tree for reproducing issues":                                            "Crée une arborescence source synthétique pour reproduire des problèmes",
+	"Write the PowerShell module wrapping this CLI":                                                    "Écrit le module PowerShell qui encapsule cette CLI",
+	"Compare a package of the official tool with one of this tool":                                     "Compare un paquet de l'outil officiel avec un paquet de cet outil",
+	"Language of the messages of all commands: en, de, fr or auto (default: $OPEN_PACKAGE_LANG or en)": "Langue des messages de toutes les commandes : en, de, fr ou auto (par défaut : $OPEN_PACKAGE_LANG ou en)",
+
+	// Errors
+	"Error: %v\n":                           "Erreur : %v\n",
+	"Error: %s is required\n":               "Erreur : %s est obligatoire\n",
+	"Error: %s requires %s\n":               "Erreur : %s nécessite %s\n",
+	"Error resolving output path: %v\n":     "Erreur lors de la résolution du chemin de sortie : %v\n",
+	"Error creating output directory: %v\n": "Erreur lors de la création du dossier de sortie : %v\n",
+	"Error: job %s: %v\n":                   "Erreur : tâche %s : %v\n",
+	"Error: line %d: job %s: %v\n":          "Erreur : ligne %d : tâche %s : %v\n",
+	"Error: pruning old versions: %v\n":     "Erreur lors de la suppression des anciennes versions : %v\n",
+	"Error writing results: %v\n":           "Erreur lors de l'écriture des résultats : %v\n",
+
+	// Builds
+	"Architecture: %s\n":         "Architecture : %s\n",
+	"Source: %s\n":               "Source : %s\n",
+	"Setup file: %s\n":           "Fichier d'installation : %s\n",
+	"Output: %s\n":               "Sortie : %s\n",
+	"Job: %s\n":                  "Tâche : %s\n",
+	"Applicability: %s\n":        "Applicabilité : %s\n",
+	"Successfully created: %s\n": "Créé avec succès : %s\n",
+	"Pruned: %s\n":               "Supprimé : %s\n",
+	"Warning: %s\n":              "Avertissement : %s\n",
+	"Skipped file: %s\n":         "Fichier ignoré : %s\n",
+	"Note: %s is an MSIX package. MSIX packages can be uploaded to Intune directly\nas line-of-business apps. To deploy it through the Win32 channel, use -msix-wrapper\nto add a bootstrap install script.\n": "Remarque : %s est un paquet MSIX. Les paquets MSIX peuvent être envoyés directement\nà Intune comme applications métier. Pour le déployer par le canal Win32, utilisez\n-msix-wrapper pour ajouter un script d'installation.\n",
+	"Note: %d files duplicate other packaged files, wasting %d bytes\n":                                                                                  "Remarque : %d fichiers dupliquent d'autres fichiers empaquetés et gaspillent %d octets\n",
+	"Note: the source contains %d driver packages; Win32 apps only install drivers staged by the install command (pnputil /add-driver <inf> /install)\n": "Remarque : la source contient %d paquets de pilotes ; les applications Win32 n'installent que les pilotes ajoutés par la commande d'installation (pnputil /add-driver <inf> /install)\n",
+	"\n%d of %d package(s) created, results written to %s\n":                                                                                             "\n%d paquet(s) sur %d créé(s), résultats écrits dans %s\n",
+}
@@ -0,0 +1,103 @@
+// Package messages translates the user-facing messages of the CLI.
+//
+// Messages are identified by their English format string, as with
+// gettext, so that call sites stay readable and messages without a
+// translation fall back to English. Translations must keep the verbs of
+// the format string in the same order. Error details from the library
+// packages and option descriptions are not translated.
+package messages
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Supported languages
+const (
+	English = "en"
+	German  = "de"
+	French  = "fr"
+)
+
+// Languages lists all supported languages
+var Languages = []string{English, German, French}
+
+// catalogs holds the translations by language
+var catalogs = map[string]map[string]string{
+	German: german,
+	French: french,
+}
+
+// Catalog translates messages into a language. A nil Catalog returns
+// messages in English.
+type Catalog struct {
+	lang         string
+	translations map[string]string
+}
+
+// New returns the catalog of lang, a language of Languages or a locale
+// such as "de-DE" or "fr_FR.UTF-8". An empty lang, "C" and "POSIX" select
+// English.
+func New(lang string) (*Catalog, error) {
+	base := normalize(lang)
+	if base == English {
+		return &Catalog{lang: English}, nil
+	}
+	translations, ok := catalogs[base]
+	if !ok {
+		return nil, fmt.Errorf("unsupported language %q (supported: %s)", lang, strings.Join(Languages, ", "))
+	}
+	return &Catalog{lang: base, translations: translations}, nil
+}
+
+// Detect returns the language of the locale of the environment, from
+// LC_ALL, LC_MESSAGES or LANG, or English if it is not supported
+func Detect() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			if base := normalize(value); base == English || catalogs[base] != nil {
+				return base
+			}
+			return English
+		}
+	}
+	return English
+}
+
+// normalize returns the language of a locale in lower case
+func normalize(lang string) string {
+	if i := strings.IndexAny(lang, "-_.@"); i >= 0 {
+		lang = lang[:i]
+	}
+	lang = strings.ToLower(lang)
+	if lang == "" || lang == "c" || lang == "posix" {
+		return English
+	}
+	return lang
+}
+
+// Lang returns the language of the catalog
+func (c *Catalog) Lang() string {
+	if c == nil {
+		return English
+	}
+	return c.lang
+}
+
+// Text returns the translation of the English format string, or format
+// itself if it has none
+func (c *Catalog) Text(format string) string {
+	if c == nil {
+		return format
+	}
+	if translated, ok := c.translations[format]; ok {
+		return translated
+	}
+	return format
+}
+
+// Sprintf formats the translation of format with args
+func (c *Catalog) Sprintf(format string, args ...interface{}) string {
+	return fmt.Sprintf(c.Text(format), args...)
+}
@@ -0,0 +1,95 @@
+package messages
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// verbPattern matches the verbs of a format string
+var verbPattern = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestTranslations(t *testing.T) {
+	for lang, translations := range catalogs {
+		for format, translated := range translations {
+			want := strings.Join(verbPattern.FindAllString(format, -1), " ")
+			if got := strings.Join(verbPattern.FindAllString(translated, -1), " "); got != want {
+				t.Errorf("%s translation of %q has verbs %q, expected %q", lang, format, got, want)
+			}
+			if strings.HasSuffix(format, "\n") != strings.HasSuffix(translated, "\n") {
+				t.Errorf("%s translation of %q does not keep the trailing newline", lang, format)
+			}
+		}
+		for other, otherTranslations := range catalogs {
+			for format := range otherTranslations {
+				if _, ok := translations[format]; !ok {
+					t.Errorf("%s has no translation of %q, which %s translates", lang, format, other)
+				}
+			}
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	for lang, expected := range map[string]string{
+		"":            English,
+		"C":           English,
+		"en_US.UTF-8": English,
+		"de":          German,
+		"de-AT":       German,
+		"FR_ca":       French,
+		"fr_FR@euro":  French,
+	} {
+		c, err := New(lang)
+		if err != nil {
+			t.Errorf("New(%q) failed: %v", lang, err)
+			continue
+		}
+		if c.Lang() != expected {
+			t.Errorf("New(%q) returned %s, expected %s", lang, c.Lang(), expected)
+		}
+	}
+	if _, err := New("xx"); err == nil || !strings.Contains(err.Error(), "en, de, fr") {
+		t.Errorf("Expected an error listing the supported languages, got %v", err)
+	}
+
+	c, _ := New(German)
+	if got := c.Sprintf("Error: %v\n", "x"); got != "Fehler: x\n" {
+		t.Errorf("Unexpected translation %q", got)
+	}
+	if got := c.Text("untranslated"); got != "untranslated" {
+		t.Errorf("Expected untranslated messages in English, got %q", got)
+	}
+	var none *Catalog
+	if got := none.Sprintf("Error: %v\n", "x"); got != "Error: x\n" || none.Lang() != English {
+		t.Errorf("Expected a nil catalog to return English, got %q", got)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, value)
+		} else {
+			defer os.Unsetenv(name)
+		}
+		os.Unsetenv(name)
+	}
+
+	if lang := Detect(); lang != English {
+		t.Errorf("Expected English without locale, got %s", lang)
+	}
+	os.Setenv("LANG", "fr_FR.UTF-8")
+	if lang := Detect(); lang != French {
+		t.Errorf("Expected French from LANG, got %s", lang)
+	}
+	os.Setenv("LC_MESSAGES", "de_DE.UTF-8")
+	if lang := Detect(); lang != German {
+		t.Errorf("Expected LC_MESSAGES to take precedence, got %s", lang)
+	}
+	os.Setenv("LC_ALL", "ja_JP.UTF-8")
+	if lang := Detect(); lang != English {
+		t.Errorf("Expected English for an unsupported locale, got %s", lang)
+	}
+}
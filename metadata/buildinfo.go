@@ -0,0 +1,68 @@
+package metadata
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// buildInfoHeader is the first line of build info ZIP comments
+const buildInfoHeader = "open-package build info"
+
+// BuildInfo identifies the build of a package. It is stamped into the ZIP
+// comments of the inner and outer archive, which survive copies and
+// round-trips, so that packages found on shares can be traced to their build.
+type BuildInfo struct {
+	// Tool is the name and version of the tool that built the package
+	Tool string
+	// JobID is the correlation ID of the build
+	JobID string
+	// SourceSHA256 is the digest of the packaged files, as recorded in the
+	// build registry (see changes.Manifest.Digest)
+	SourceSHA256 string
+	// Created is the time the package was built
+	Created time.Time
+}
+
+// Comment returns the ZIP comment of the build info
+func (b *BuildInfo) Comment() string {
+	var sb strings.Builder
+	sb.WriteString(buildInfoHeader + "\n")
+	fmt.Fprintf(&sb, "tool: %s\n", b.Tool)
+	if b.JobID != "" {
+		fmt.Fprintf(&sb, "job: %s\n", b.JobID)
+	}
+	fmt.Fprintf(&sb, "source-sha256: %s\n", b.SourceSHA256)
+	fmt.Fprintf(&sb, "created: %s\n", b.Created.UTC().Format(time.RFC3339))
+	return sb.String()
+}
+
+// ParseBuildInfo parses a ZIP comment written by BuildInfo.Comment. It
+// returns false for other comments. Unknown lines are ignored, so that
+// later versions can add fields.
+func ParseBuildInfo(comment string) (*BuildInfo, bool) {
+	scanner := bufio.NewScanner(strings.NewReader(comment))
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != buildInfoHeader {
+		return nil, false
+	}
+	b := &BuildInfo{}
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "tool":
+			b.Tool = value
+		case "job":
+			b.JobID = value
+		case "source-sha256":
+			b.SourceSHA256 = value
+		case "created":
+			b.Created, _ = time.Parse(time.RFC3339, value)
+		}
+	}
+	return b, true
+}
@@ -13,8 +13,11 @@ package metadata
 import (
 	"encoding/xml"
 	"fmt"
+	"regexp"
+	"strings"
 
 	"github.com/MANCHTOOLS/open-package/crypto"
+	"github.com/MANCHTOOLS/open-package/msi"
 )
 
 const (
@@ -26,31 +29,102 @@ const (
 	FileDigestAlgorithm = "SHA256"
 	// EncryptedFileName is the standard name for the encrypted inner package
 	EncryptedFileName = "IntunePackage.intunewin"
+	// DetectionXMLPath is the location of Detection.xml in the outer package
+	DetectionXMLPath = "IntuneWinPackage/Metadata/Detection.xml"
+	// ContentsDir is the directory of the encrypted content in the outer package
+	ContentsDir = "IntuneWinPackage/Contents/"
 )
 
+// ProfileIdentifiers lists the supported crypto profiles. ProfileVersion1
+// is AES-256-CBC encryption with PKCS7 padding and HMAC-SHA256
+// authentication, the only profile used by the official tool so far.
+var ProfileIdentifiers = []string{ProfileIdentifier}
+
+// toolVersionPattern matches version strings like "1.8.4.0"
+var toolVersionPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+){1,3}$`)
+
+// ValidateToolVersion checks that version is a dotted numeric version
+// string like the ones of the official tool (e.g. "1.8.6.0")
+func ValidateToolVersion(version string) error {
+	if !toolVersionPattern.MatchString(version) {
+		return fmt.Errorf("invalid tool version %q, expected a version like %s", version, ToolVersion)
+	}
+	return nil
+}
+
+// ValidateProfileIdentifier checks that profile is a supported crypto profile
+func ValidateProfileIdentifier(profile string) error {
+	for _, p := range ProfileIdentifiers {
+		if p == profile {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported profile identifier %q (supported: %s)", profile, strings.Join(ProfileIdentifiers, ", "))
+}
+
 // EncryptionInfo represents the encryption metadata in Detection.xml
 type EncryptionInfo struct {
-	XMLName             xml.Name `xml:"EncryptionInfo"`
-	EncryptionKey       string   `xml:"EncryptionKey"`
-	MacKey              string   `xml:"MacKey"`
-	InitializationVector string  `xml:"InitializationVector"`
-	Mac                 string   `xml:"Mac"`
-	ProfileIdentifier   string   `xml:"ProfileIdentifier"`
-	FileDigest          string   `xml:"FileDigest"`
-	FileDigestAlgorithm string   `xml:"FileDigestAlgorithm"`
+	XMLName              xml.Name `xml:"EncryptionInfo" json:"-"`
+	EncryptionKey        string   `xml:"EncryptionKey" json:"encryptionKey"`
+	MacKey               string   `xml:"MacKey" json:"macKey"`
+	InitializationVector string   `xml:"InitializationVector" json:"initializationVector"`
+	Mac                  string   `xml:"Mac" json:"mac"`
+	ProfileIdentifier    string   `xml:"ProfileIdentifier" json:"profileIdentifier"`
+	FileDigest           string   `xml:"FileDigest" json:"fileDigest"`
+	FileDigestAlgorithm  string   `xml:"FileDigestAlgorithm" json:"fileDigestAlgorithm"`
 }
 
 // ApplicationInfo represents the root element of Detection.xml
 type ApplicationInfo struct {
-	XMLName              xml.Name       `xml:"ApplicationInfo"`
-	XSI                  string         `xml:"xmlns:xsi,attr"`
-	XSD                  string         `xml:"xmlns:xsd,attr"`
-	ToolVersion          string         `xml:"ToolVersion,attr"`
-	Name                 string         `xml:"Name"`
-	UnencryptedContentSize int64        `xml:"UnencryptedContentSize"`
-	FileName             string         `xml:"FileName"`
-	SetupFile            string         `xml:"SetupFile"`
-	EncryptionInfo       EncryptionInfo `xml:"EncryptionInfo"`
+	XMLName                xml.Name       `xml:"ApplicationInfo"`
+	XSI                    string         `xml:"xmlns:xsi,attr"`
+	XSD                    string         `xml:"xmlns:xsd,attr"`
+	ToolVersion            string         `xml:"ToolVersion,attr"`
+	Name                   string         `xml:"Name"`
+	UnencryptedContentSize int64          `xml:"UnencryptedContentSize"`
+	FileName               string         `xml:"FileName"`
+	SetupFile              string         `xml:"SetupFile"`
+	EncryptionInfo         EncryptionInfo `xml:"EncryptionInfo"`
+	MsiInfo                *MsiInfo       `xml:"MsiInfo,omitempty"`
+}
+
+// MsiInfo represents the MSI metadata in Detection.xml. The official tool
+// adds it when the setup file is an MSI database.
+type MsiInfo struct {
+	MsiProductCode                string `xml:"MsiProductCode"`
+	MsiProductVersion             string `xml:"MsiProductVersion"`
+	MsiPackageCode                string `xml:"MsiPackageCode"`
+	MsiUpgradeCode                string `xml:"MsiUpgradeCode"`
+	MsiExecutionContext           string `xml:"MsiExecutionContext"`
+	MsiRequiresLogon              bool   `xml:"MsiRequiresLogon"`
+	MsiRequiresReboot             bool   `xml:"MsiRequiresReboot"`
+	MsiIsMachineInstall           bool   `xml:"MsiIsMachineInstall"`
+	MsiIsUserInstall              bool   `xml:"MsiIsUserInstall"`
+	MsiIncludesServices           bool   `xml:"MsiIncludesServices"`
+	MsiIncludesODBCDataSource     bool   `xml:"MsiIncludesODBCDataSource"`
+	MsiContainsSystemRegistryKeys bool   `xml:"MsiContainsSystemRegistryKeys"`
+	MsiContainsSystemFolders      bool   `xml:"MsiContainsSystemFolders"`
+	MsiPublisher                  string `xml:"MsiPublisher"`
+}
+
+// NewMsiInfo creates the Detection.xml MSI metadata from MSI product information
+func NewMsiInfo(info *msi.Info) *MsiInfo {
+	context := info.ExecutionContext()
+	return &MsiInfo{
+		MsiProductCode:                info.ProductCode,
+		MsiProductVersion:             info.ProductVersion,
+		MsiPackageCode:                info.PackageCode,
+		MsiUpgradeCode:                info.UpgradeCode,
+		MsiExecutionContext:           context,
+		MsiRequiresReboot:             info.RequiresReboot(),
+		MsiIsMachineInstall:           context != "User",
+		MsiIsUserInstall:              context != "System",
+		MsiIncludesServices:           info.HasServices,
+		MsiIncludesODBCDataSource:     info.HasODBCDataSources,
+		MsiContainsSystemRegistryKeys: info.HasSystemRegistryKeys,
+		MsiContainsSystemFolders:      info.HasSystemFolders,
+		MsiPublisher:                  info.Manufacturer,
+	}
 }
 
 // DetectionXMLOptions contains options for generating Detection.xml
@@ -61,27 +135,56 @@ type DetectionXMLOptions struct {
 	SetupFile string
 	// EncryptionInfo contains the cryptographic parameters
 	CryptoInfo crypto.EncryptionInfoBase64
+	// MsiInfo contains the MSI metadata (optional, MSI setup files only)
+	MsiInfo *MsiInfo
+	// StrictCompat serializes Detection.xml byte-compatible with the
+	// official tool instead of the default Go XML encoding
+	StrictCompat bool
+	// ToolVersion overrides the ToolVersion attribute (optional)
+	ToolVersion string
+	// ProfileIdentifier selects the crypto profile (optional)
+	ProfileIdentifier string
 }
 
 // GenerateDetectionXML creates the Detection.xml content
 func GenerateDetectionXML(opts DetectionXMLOptions) ([]byte, error) {
+	toolVersion := ToolVersion
+	if opts.ToolVersion != "" {
+		if err := ValidateToolVersion(opts.ToolVersion); err != nil {
+			return nil, err
+		}
+		toolVersion = opts.ToolVersion
+	}
+	profileIdentifier := ProfileIdentifier
+	if opts.ProfileIdentifier != "" {
+		if err := ValidateProfileIdentifier(opts.ProfileIdentifier); err != nil {
+			return nil, err
+		}
+		profileIdentifier = opts.ProfileIdentifier
+	}
+
 	appInfo := ApplicationInfo{
-		XSI:                  "http://www.w3.org/2001/XMLSchema-instance",
-		XSD:                  "http://www.w3.org/2001/XMLSchema",
-		ToolVersion:          ToolVersion,
-		Name:                 opts.Name,
+		XSI:                    "http://www.w3.org/2001/XMLSchema-instance",
+		XSD:                    "http://www.w3.org/2001/XMLSchema",
+		ToolVersion:            toolVersion,
+		Name:                   opts.Name,
 		UnencryptedContentSize: opts.CryptoInfo.UnencryptedSize,
-		FileName:             EncryptedFileName,
-		SetupFile:            opts.SetupFile,
+		FileName:               EncryptedFileName,
+		SetupFile:              opts.SetupFile,
 		EncryptionInfo: EncryptionInfo{
 			EncryptionKey:        opts.CryptoInfo.EncryptionKey,
 			MacKey:               opts.CryptoInfo.MacKey,
 			InitializationVector: opts.CryptoInfo.IV,
 			Mac:                  opts.CryptoInfo.MAC,
-			ProfileIdentifier:    ProfileIdentifier,
+			ProfileIdentifier:    profileIdentifier,
 			FileDigest:           opts.CryptoInfo.FileDigest,
 			FileDigestAlgorithm:  FileDigestAlgorithm,
 		},
+		MsiInfo: opts.MsiInfo,
+	}
+
+	if opts.StrictCompat {
+		return marshalStrict(&appInfo), nil
 	}
 
 	// Generate XML with proper formatting
@@ -96,3 +199,12 @@ func GenerateDetectionXML(opts DetectionXMLOptions) ([]byte, error) {
 
 	return result, nil
 }
+
+// ParseDetectionXML parses Detection.xml content
+func ParseDetectionXML(data []byte) (*ApplicationInfo, error) {
+	var appInfo ApplicationInfo
+	if err := xml.Unmarshal(data, &appInfo); err != nil {
+		return nil, fmt.Errorf("failed to parse Detection.xml: %w", err)
+	}
+	return &appInfo, nil
+}
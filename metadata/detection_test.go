@@ -2,8 +2,10 @@ package metadata
 
 import (
 	"encoding/xml"
+	"errors"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/MANCHTOOLS/open-package/crypto"
 )
@@ -87,3 +89,319 @@ func TestGenerateDetectionXML(t *testing.T) {
 		t.Error("xsd namespace not present")
 	}
 }
+
+func TestParseDetectionXML(t *testing.T) {
+	opts := DetectionXMLOptions{
+		Name:      "RoundTrip",
+		SetupFile: "setup.msi",
+		CryptoInfo: crypto.EncryptionInfoBase64{
+			EncryptionKey:   "a2V5",
+			UnencryptedSize: 42,
+		},
+	}
+
+	xmlData, err := GenerateDetectionXML(opts)
+	if err != nil {
+		t.Fatalf("GenerateDetectionXML failed: %v", err)
+	}
+
+	appInfo, err := ParseDetectionXML(xmlData)
+	if err != nil {
+		t.Fatalf("ParseDetectionXML failed: %v", err)
+	}
+	if appInfo.Name != "RoundTrip" || appInfo.SetupFile != "setup.msi" || appInfo.UnencryptedContentSize != 42 {
+		t.Errorf("Unexpected parse result: %+v", appInfo)
+	}
+	if appInfo.EncryptionInfo.EncryptionKey != "a2V5" {
+		t.Errorf("EncryptionKey mismatch: got %s", appInfo.EncryptionInfo.EncryptionKey)
+	}
+
+	if _, err := ParseDetectionXML([]byte("<ApplicationInfo><Name>")); err == nil {
+		t.Error("Expected error for malformed XML")
+	}
+}
+
+func TestGenerateDetectionXMLStrictCompat(t *testing.T) {
+	opts := DetectionXMLOptions{
+		Name:      "A&B",
+		SetupFile: "setup.msi",
+		CryptoInfo: crypto.EncryptionInfoBase64{
+			EncryptionKey:   "key",
+			MacKey:          "mackey",
+			IV:              "iv",
+			MAC:             "mac",
+			FileDigest:      "digest",
+			UnencryptedSize: 10,
+		},
+		MsiInfo: &MsiInfo{
+			MsiProductCode:      "{PRODUCT}",
+			MsiExecutionContext: "System",
+			MsiIsMachineInstall: true,
+		},
+		StrictCompat: true,
+	}
+
+	xmlData, err := GenerateDetectionXML(opts)
+	if err != nil {
+		t.Fatalf("GenerateDetectionXML failed: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		`<?xml version="1.0" encoding="utf-8"?>`,
+		`<ApplicationInfo xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ToolVersion="1.8.4.0">`,
+		`  <Name>A&amp;B</Name>`,
+		`  <UnencryptedContentSize>10</UnencryptedContentSize>`,
+		`  <FileName>IntunePackage.intunewin</FileName>`,
+		`  <SetupFile>setup.msi</SetupFile>`,
+		`  <EncryptionInfo>`,
+		`    <EncryptionKey>key</EncryptionKey>`,
+		`    <MacKey>mackey</MacKey>`,
+		`    <InitializationVector>iv</InitializationVector>`,
+		`    <Mac>mac</Mac>`,
+		`    <ProfileIdentifier>ProfileVersion1</ProfileIdentifier>`,
+		`    <FileDigest>digest</FileDigest>`,
+		`    <FileDigestAlgorithm>SHA256</FileDigestAlgorithm>`,
+		`  </EncryptionInfo>`,
+		`  <MsiInfo>`,
+		`    <MsiProductCode>{PRODUCT}</MsiProductCode>`,
+		`    <MsiProductVersion />`,
+		`    <MsiPackageCode />`,
+		`    <MsiUpgradeCode />`,
+		`    <MsiExecutionContext>System</MsiExecutionContext>`,
+		`    <MsiRequiresLogon>false</MsiRequiresLogon>`,
+		`    <MsiRequiresReboot>false</MsiRequiresReboot>`,
+		`    <MsiIsMachineInstall>true</MsiIsMachineInstall>`,
+		`    <MsiIsUserInstall>false</MsiIsUserInstall>`,
+		`    <MsiIncludesServices>false</MsiIncludesServices>`,
+		`    <MsiIncludesODBCDataSource>false</MsiIncludesODBCDataSource>`,
+		`    <MsiContainsSystemRegistryKeys>false</MsiContainsSystemRegistryKeys>`,
+		`    <MsiContainsSystemFolders>false</MsiContainsSystemFolders>`,
+		`    <MsiPublisher />`,
+		`  </MsiInfo>`,
+		`</ApplicationInfo>`,
+	}, "\r\n")
+
+	if string(xmlData) != expected {
+		t.Errorf("Strict output mismatch:\n%s\nexpected:\n%s", xmlData, expected)
+	}
+
+	// The strict output must parse to the same values
+	appInfo, err := ParseDetectionXML(xmlData)
+	if err != nil {
+		t.Fatalf("ParseDetectionXML failed: %v", err)
+	}
+	if appInfo.Name != "A&B" || appInfo.MsiInfo == nil || !appInfo.MsiInfo.MsiIsMachineInstall {
+		t.Errorf("Unexpected parse result: %+v", appInfo)
+	}
+}
+
+func TestParseDetectionXMLTolerant(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="utf-16"?>
+<ns:ApplicationInfo xmlns:ns="urn:other" toolversion="2.0">
+  <ns:Name>Variant</ns:Name>
+  <unencryptedcontentsize>99</unencryptedcontentsize>
+  <FileName>IntunePackage.intunewin</FileName>
+  <Vendor>someone</Vendor>
+  <EncryptionInfo>
+    <EncryptionKey>a2V5</EncryptionKey>
+    <MacKey>bWFj</MacKey>
+    <InitializationVector>aXY=</InitializationVector>
+    <Mac>bWFj</Mac>
+    <FileDigest>ZGln</FileDigest>
+  </EncryptionInfo>
+</ns:ApplicationInfo>`)
+
+	appInfo, warnings, err := ParseDetectionXMLTolerant(data)
+	if err != nil {
+		t.Fatalf("ParseDetectionXMLTolerant failed: %v", err)
+	}
+
+	if appInfo.Name != "Variant" {
+		t.Errorf("Name mismatch: expected Variant, got %s", appInfo.Name)
+	}
+	if appInfo.ToolVersion != "2.0" {
+		t.Errorf("ToolVersion mismatch: expected 2.0, got %s", appInfo.ToolVersion)
+	}
+	if appInfo.UnencryptedContentSize != 99 {
+		t.Errorf("UnencryptedContentSize mismatch: expected 99, got %d", appInfo.UnencryptedContentSize)
+	}
+	if appInfo.EncryptionInfo.MacKey != "bWFj" {
+		t.Errorf("MacKey mismatch: got %s", appInfo.EncryptionInfo.MacKey)
+	}
+	if appInfo.MsiInfo != nil {
+		t.Error("MsiInfo should be nil when missing")
+	}
+
+	joined := strings.Join(warnings, "\n")
+	for _, expected := range []string{"@toolversion", "unencryptedcontentsize", "unknown element Vendor"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("Expected warning containing %q, got:\n%s", expected, joined)
+		}
+	}
+	if len(warnings) != 3 {
+		t.Errorf("Expected 3 warnings, got %d:\n%s", len(warnings), joined)
+	}
+	if appInfo.XSI != "" || appInfo.XSD != "" {
+		t.Errorf("Expected no schema namespaces, got xsi=%q xsd=%q", appInfo.XSI, appInfo.XSD)
+	}
+
+	// The schema namespaces are kept for comparisons
+	xmlData, err := GenerateDetectionXML(DetectionXMLOptions{Name: "TestApp", SetupFile: "install.exe"})
+	if err != nil {
+		t.Fatalf("GenerateDetectionXML failed: %v", err)
+	}
+	appInfo, _, err = ParseDetectionXMLTolerant(xmlData)
+	if err != nil {
+		t.Fatalf("ParseDetectionXMLTolerant failed: %v", err)
+	}
+	if appInfo.XSI != "http://www.w3.org/2001/XMLSchema-instance" || appInfo.XSD != "http://www.w3.org/2001/XMLSchema" {
+		t.Errorf("Unexpected schema namespaces: xsi=%q xsd=%q", appInfo.XSI, appInfo.XSD)
+	}
+
+	// Missing required fields and invalid values are warnings
+	_, warnings, err = ParseDetectionXMLTolerant([]byte(`<ApplicationInfo><UnencryptedContentSize>x</UnencryptedContentSize><MsiInfo><MsiIsUserInstall>True</MsiIsUserInstall></MsiInfo></ApplicationInfo>`))
+	if err != nil {
+		t.Fatalf("ParseDetectionXMLTolerant failed: %v", err)
+	}
+	joined = strings.Join(warnings, "\n")
+	if !strings.Contains(joined, "invalid value") || !strings.Contains(joined, "EncryptionInfo/MacKey is missing") {
+		t.Errorf("Unexpected warnings:\n%s", joined)
+	}
+
+	// Malformed XML and unexpected roots are errors
+	if _, _, err := ParseDetectionXMLTolerant([]byte(`<ApplicationInfo>`)); err == nil {
+		t.Error("Expected error for malformed XML")
+	}
+	if _, _, err := ParseDetectionXMLTolerant([]byte(`<Other/>`)); err == nil {
+		t.Error("Expected error for unexpected root element")
+	}
+}
+
+func TestGenerateDetectionXMLOverrides(t *testing.T) {
+	opts := DetectionXMLOptions{
+		Name:              "TestApp",
+		SetupFile:         "install.exe",
+		ToolVersion:       "1.8.6.0",
+		ProfileIdentifier: "ProfileVersion1",
+	}
+
+	xmlData, err := GenerateDetectionXML(opts)
+	if err != nil {
+		t.Fatalf("GenerateDetectionXML failed: %v", err)
+	}
+	appInfo, err := ParseDetectionXML(xmlData)
+	if err != nil {
+		t.Fatalf("ParseDetectionXML failed: %v", err)
+	}
+	if appInfo.ToolVersion != "1.8.6.0" {
+		t.Errorf("ToolVersion mismatch: got %s", appInfo.ToolVersion)
+	}
+	if appInfo.EncryptionInfo.ProfileIdentifier != ProfileIdentifier {
+		t.Errorf("ProfileIdentifier mismatch: got %s", appInfo.EncryptionInfo.ProfileIdentifier)
+	}
+
+	invalid := []DetectionXMLOptions{
+		{ToolVersion: "latest"},
+		{ToolVersion: "1.8.4.0.1"},
+		{ToolVersion: "1"},
+		{ProfileIdentifier: "ProfileVersion2"},
+	}
+	for _, o := range invalid {
+		if _, err := GenerateDetectionXML(o); err == nil {
+			t.Errorf("Expected error for %+v", o)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	key := strings.Repeat("A", 43) + "="
+	valid := func() *ApplicationInfo {
+		return &ApplicationInfo{
+			ToolVersion:            ToolVersion,
+			Name:                   "TestApp",
+			UnencryptedContentSize: 10,
+			FileName:               EncryptedFileName,
+			SetupFile:              "install.exe",
+			EncryptionInfo: EncryptionInfo{
+				EncryptionKey:        key,
+				MacKey:               key,
+				InitializationVector: strings.Repeat("A", 22) + "==",
+				Mac:                  key,
+				ProfileIdentifier:    ProfileIdentifier,
+				FileDigest:           key,
+				FileDigestAlgorithm:  FileDigestAlgorithm,
+			},
+		}
+	}
+
+	if err := Validate(valid()); err != nil {
+		t.Fatalf("Validate failed for valid content: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(a *ApplicationInfo)
+		problem string
+	}{
+		{"missing setup", func(a *ApplicationInfo) { a.SetupFile = "" }, "SetupFile is required"},
+		{"negative size", func(a *ApplicationInfo) { a.UnencryptedContentSize = -1 }, "must not be negative"},
+		{"short key", func(a *ApplicationInfo) { a.EncryptionInfo.EncryptionKey = "AAAA" }, "EncryptionKey must be 32 bytes, got 3"},
+		{"bad base64", func(a *ApplicationInfo) { a.EncryptionInfo.Mac = "!!" }, "Mac is not valid base64"},
+		{"long IV", func(a *ApplicationInfo) { a.EncryptionInfo.InitializationVector = key }, "InitializationVector must be 16 bytes"},
+		{"unknown algorithm", func(a *ApplicationInfo) { a.EncryptionInfo.FileDigestAlgorithm = "MD5" }, "unsupported algorithm"},
+		{"digest size", func(a *ApplicationInfo) { a.EncryptionInfo.FileDigestAlgorithm = "SHA512" }, "FileDigest must be 64 bytes, got 32"},
+		{"unknown profile", func(a *ApplicationInfo) { a.EncryptionInfo.ProfileIdentifier = "ProfileVersion9" }, "unsupported profile identifier"},
+		{"bad context", func(a *ApplicationInfo) { a.MsiInfo = &MsiInfo{MsiExecutionContext: "Machine"} }, "unknown context"},
+	}
+	for _, tt := range tests {
+		appInfo := valid()
+		tt.modify(appInfo)
+		err := Validate(appInfo)
+		validationErr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("%s: expected ValidationError, got %v", tt.name, err)
+			continue
+		}
+		if len(validationErr.Problems) != 1 || !strings.Contains(validationErr.Problems[0], tt.problem) {
+			t.Errorf("%s: unexpected problems %v", tt.name, validationErr.Problems)
+		}
+	}
+}
+
+func TestNewFileDigest(t *testing.T) {
+	sizes := map[string]int{"": 32, "SHA256": 32, "sha-256": 32, "SHA384": 48, "SHA512": 64, "SHA1": 20}
+	for algorithm, size := range sizes {
+		h, err := NewFileDigest(algorithm)
+		if err != nil {
+			t.Errorf("NewFileDigest(%q) failed: %v", algorithm, err)
+			continue
+		}
+		if h.Size() != size {
+			t.Errorf("NewFileDigest(%q) size = %d, expected %d", algorithm, h.Size(), size)
+		}
+	}
+	if _, err := NewFileDigest("MD5"); !errors.Is(err, ErrUnsupportedDigest) {
+		t.Errorf("Expected ErrUnsupportedDigest for MD5, got %v", err)
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	info := &BuildInfo{
+		Tool:         "open-package 1.0.0",
+		JobID:        "0123456789abcdef",
+		SourceSHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		Created:      time.Date(2026, 10, 16, 8, 30, 0, 0, time.UTC),
+	}
+
+	parsed, ok := ParseBuildInfo(info.Comment())
+	if !ok {
+		t.Fatalf("ParseBuildInfo did not recognize %q", info.Comment())
+	}
+	if *parsed != *info {
+		t.Errorf("Build info mismatch: expected %+v, got %+v", info, parsed)
+	}
+
+	if _, ok := ParseBuildInfo("created by another tool"); ok {
+		t.Error("Expected other comments not to be recognized")
+	}
+}
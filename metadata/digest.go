@@ -0,0 +1,52 @@
+package metadata
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// ErrUnsupportedDigest is wrapped by the errors returned for file digest
+// algorithms that cannot be verified
+var ErrUnsupportedDigest = errors.New("unsupported file digest algorithm")
+
+// fileDigests are the hash functions of the supported file digest
+// algorithms. Packages are always created with SHA256; the others are
+// accepted when reading packages of other tools.
+var fileDigests = map[string]func() hash.Hash{
+	"SHA256": sha256.New,
+	"SHA384": sha512.New384,
+	"SHA512": sha512.New,
+	"SHA1":   sha1.New,
+}
+
+// FileDigestAlgorithms lists the supported file digest algorithms
+var FileDigestAlgorithms = []string{FileDigestAlgorithm, "SHA384", "SHA512", "SHA1"}
+
+// NewFileDigest returns a hash of a FileDigestAlgorithm value. Names are
+// case-insensitive and may contain a dash ("SHA-256"); an empty algorithm
+// is SHA256.
+func NewFileDigest(algorithm string) (hash.Hash, error) {
+	if algorithm == "" {
+		algorithm = FileDigestAlgorithm
+	}
+	newHash, ok := fileDigests[strings.ToUpper(strings.ReplaceAll(algorithm, "-", ""))]
+	if !ok {
+		return nil, fmt.Errorf("%w %q (supported: %s)", ErrUnsupportedDigest, algorithm, strings.Join(FileDigestAlgorithms, ", "))
+	}
+	return newHash(), nil
+}
+
+// ComputeFileDigest returns the digest of data with a FileDigestAlgorithm
+func ComputeFileDigest(algorithm string, data []byte) ([]byte, error) {
+	h, err := NewFileDigest(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(data)
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,85 @@
+package metadata
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// strictHeader is the XML declaration written by the official tool
+const strictHeader = `<?xml version="1.0" encoding="utf-8"?>`
+
+// strictEscaper escapes text the way .NET's XmlWriter does
+var strictEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// strictWriter writes XML elements in the layout of .NET's XmlSerializer:
+// CRLF line endings, two space indentation and self-closing empty elements
+type strictWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *strictWriter) line(depth int, s string) {
+	w.buf.WriteString("\r\n")
+	w.buf.WriteString(strings.Repeat("  ", depth))
+	w.buf.WriteString(s)
+}
+
+func (w *strictWriter) element(depth int, name, value string) {
+	if value == "" {
+		w.line(depth, "<"+name+" />")
+		return
+	}
+	w.line(depth, "<"+name+">"+strictEscaper.Replace(value)+"</"+name+">")
+}
+
+func (w *strictWriter) boolElement(depth int, name string, value bool) {
+	w.element(depth, name, strconv.FormatBool(value))
+}
+
+// marshalStrict serializes Detection.xml byte-compatible with the output of
+// the official tool (modulo keys): lower case encoding in the declaration,
+// xsd/xsi/ToolVersion attribute order, CRLF line endings, two space
+// indentation, self-closing empty elements and no trailing newline.
+func marshalStrict(appInfo *ApplicationInfo) []byte {
+	w := &strictWriter{}
+	w.buf.WriteString(strictHeader)
+	w.line(0, `<ApplicationInfo xmlns:xsd="`+appInfo.XSD+`" xmlns:xsi="`+appInfo.XSI+`" ToolVersion="`+strictEscaper.Replace(appInfo.ToolVersion)+`">`)
+
+	w.element(1, "Name", appInfo.Name)
+	w.element(1, "UnencryptedContentSize", strconv.FormatInt(appInfo.UnencryptedContentSize, 10))
+	w.element(1, "FileName", appInfo.FileName)
+	w.element(1, "SetupFile", appInfo.SetupFile)
+
+	enc := appInfo.EncryptionInfo
+	w.line(1, "<EncryptionInfo>")
+	w.element(2, "EncryptionKey", enc.EncryptionKey)
+	w.element(2, "MacKey", enc.MacKey)
+	w.element(2, "InitializationVector", enc.InitializationVector)
+	w.element(2, "Mac", enc.Mac)
+	w.element(2, "ProfileIdentifier", enc.ProfileIdentifier)
+	w.element(2, "FileDigest", enc.FileDigest)
+	w.element(2, "FileDigestAlgorithm", enc.FileDigestAlgorithm)
+	w.line(1, "</EncryptionInfo>")
+
+	if m := appInfo.MsiInfo; m != nil {
+		w.line(1, "<MsiInfo>")
+		w.element(2, "MsiProductCode", m.MsiProductCode)
+		w.element(2, "MsiProductVersion", m.MsiProductVersion)
+		w.element(2, "MsiPackageCode", m.MsiPackageCode)
+		w.element(2, "MsiUpgradeCode", m.MsiUpgradeCode)
+		w.element(2, "MsiExecutionContext", m.MsiExecutionContext)
+		w.boolElement(2, "MsiRequiresLogon", m.MsiRequiresLogon)
+		w.boolElement(2, "MsiRequiresReboot", m.MsiRequiresReboot)
+		w.boolElement(2, "MsiIsMachineInstall", m.MsiIsMachineInstall)
+		w.boolElement(2, "MsiIsUserInstall", m.MsiIsUserInstall)
+		w.boolElement(2, "MsiIncludesServices", m.MsiIncludesServices)
+		w.boolElement(2, "MsiIncludesODBCDataSource", m.MsiIncludesODBCDataSource)
+		w.boolElement(2, "MsiContainsSystemRegistryKeys", m.MsiContainsSystemRegistryKeys)
+		w.boolElement(2, "MsiContainsSystemFolders", m.MsiContainsSystemFolders)
+		w.element(2, "MsiPublisher", m.MsiPublisher)
+		w.line(1, "</MsiInfo>")
+	}
+
+	w.line(0, "</ApplicationInfo>")
+	return w.buf.Bytes()
+}
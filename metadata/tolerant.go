@@ -0,0 +1,230 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xmlNode is an element of a parsed XML document
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	text     string
+	children []*xmlNode
+}
+
+// fieldSetter assigns the text of an element to a field
+type fieldSetter func(appInfo *ApplicationInfo, value string) error
+
+// applicationFields are the known children of ApplicationInfo
+var applicationFields = map[string]fieldSetter{
+	"Name":      func(a *ApplicationInfo, v string) error { a.Name = v; return nil },
+	"FileName":  func(a *ApplicationInfo, v string) error { a.FileName = v; return nil },
+	"SetupFile": func(a *ApplicationInfo, v string) error { a.SetupFile = v; return nil },
+	"UnencryptedContentSize": func(a *ApplicationInfo, v string) error {
+		size, err := strconv.ParseInt(v, 10, 64)
+		a.UnencryptedContentSize = size
+		return err
+	},
+}
+
+// encryptionFields are the known children of EncryptionInfo
+var encryptionFields = map[string]fieldSetter{
+	"EncryptionKey":        func(a *ApplicationInfo, v string) error { a.EncryptionInfo.EncryptionKey = v; return nil },
+	"MacKey":               func(a *ApplicationInfo, v string) error { a.EncryptionInfo.MacKey = v; return nil },
+	"InitializationVector": func(a *ApplicationInfo, v string) error { a.EncryptionInfo.InitializationVector = v; return nil },
+	"Mac":                  func(a *ApplicationInfo, v string) error { a.EncryptionInfo.Mac = v; return nil },
+	"ProfileIdentifier":    func(a *ApplicationInfo, v string) error { a.EncryptionInfo.ProfileIdentifier = v; return nil },
+	"FileDigest":           func(a *ApplicationInfo, v string) error { a.EncryptionInfo.FileDigest = v; return nil },
+	"FileDigestAlgorithm":  func(a *ApplicationInfo, v string) error { a.EncryptionInfo.FileDigestAlgorithm = v; return nil },
+}
+
+// msiFields are the known children of MsiInfo
+var msiFields = map[string]fieldSetter{
+	"MsiProductCode":                func(a *ApplicationInfo, v string) error { a.MsiInfo.MsiProductCode = v; return nil },
+	"MsiProductVersion":             func(a *ApplicationInfo, v string) error { a.MsiInfo.MsiProductVersion = v; return nil },
+	"MsiPackageCode":                func(a *ApplicationInfo, v string) error { a.MsiInfo.MsiPackageCode = v; return nil },
+	"MsiUpgradeCode":                func(a *ApplicationInfo, v string) error { a.MsiInfo.MsiUpgradeCode = v; return nil },
+	"MsiExecutionContext":           func(a *ApplicationInfo, v string) error { a.MsiInfo.MsiExecutionContext = v; return nil },
+	"MsiPublisher":                  func(a *ApplicationInfo, v string) error { a.MsiInfo.MsiPublisher = v; return nil },
+	"MsiRequiresLogon":              boolSetter(func(a *ApplicationInfo) *bool { return &a.MsiInfo.MsiRequiresLogon }),
+	"MsiRequiresReboot":             boolSetter(func(a *ApplicationInfo) *bool { return &a.MsiInfo.MsiRequiresReboot }),
+	"MsiIsMachineInstall":           boolSetter(func(a *ApplicationInfo) *bool { return &a.MsiInfo.MsiIsMachineInstall }),
+	"MsiIsUserInstall":              boolSetter(func(a *ApplicationInfo) *bool { return &a.MsiInfo.MsiIsUserInstall }),
+	"MsiIncludesServices":           boolSetter(func(a *ApplicationInfo) *bool { return &a.MsiInfo.MsiIncludesServices }),
+	"MsiIncludesODBCDataSource":     boolSetter(func(a *ApplicationInfo) *bool { return &a.MsiInfo.MsiIncludesODBCDataSource }),
+	"MsiContainsSystemRegistryKeys": boolSetter(func(a *ApplicationInfo) *bool { return &a.MsiInfo.MsiContainsSystemRegistryKeys }),
+	"MsiContainsSystemFolders":      boolSetter(func(a *ApplicationInfo) *bool { return &a.MsiInfo.MsiContainsSystemFolders }),
+}
+
+// boolSetter creates a setter for a boolean field, accepting any case
+func boolSetter(field func(a *ApplicationInfo) *bool) fieldSetter {
+	return func(a *ApplicationInfo, v string) error {
+		b, err := strconv.ParseBool(strings.ToLower(v))
+		*field(a) = b
+		return err
+	}
+}
+
+// requiredFields must be present for a package to be decryptable
+var requiredFields = []string{
+	"FileName",
+	"UnencryptedContentSize",
+	"EncryptionInfo/EncryptionKey",
+	"EncryptionInfo/MacKey",
+	"EncryptionInfo/InitializationVector",
+	"EncryptionInfo/Mac",
+	"EncryptionInfo/FileDigest",
+}
+
+// ParseDetectionXMLTolerant parses Detection.xml variants produced by other
+// implementations. Namespace prefixes are ignored, element and attribute
+// names are matched case-insensitively and MsiInfo is optional. Unknown
+// elements, case differences, invalid values and missing required fields
+// are returned as warnings. Only malformed XML is an error.
+func ParseDetectionXMLTolerant(data []byte) (*ApplicationInfo, []string, error) {
+	root, err := parseXMLTree(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse Detection.xml: %w", err)
+	}
+
+	var warnings []string
+	if root.name != "ApplicationInfo" {
+		if !strings.EqualFold(root.name, "ApplicationInfo") {
+			return nil, nil, fmt.Errorf("unexpected root element <%s>, expected <ApplicationInfo>", root.name)
+		}
+		warnings = append(warnings, fmt.Sprintf("root element <%s> differs in case from <ApplicationInfo>", root.name))
+	}
+
+	appInfo := &ApplicationInfo{}
+	for _, attr := range root.attrs {
+		// The schema namespaces are compared by compat; other namespace
+		// declarations are skipped
+		if attr.Name.Space == "xmlns" {
+			switch attr.Name.Local {
+			case "xsi":
+				appInfo.XSI = attr.Value
+			case "xsd":
+				appInfo.XSD = attr.Value
+			}
+			continue
+		}
+		if attr.Name.Local == "xmlns" {
+			continue
+		}
+		if strings.EqualFold(attr.Name.Local, "ToolVersion") {
+			appInfo.ToolVersion = attr.Value
+			warnings = append(warnings, caseWarning(attr.Name.Local, "ToolVersion", "@")...)
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("unknown attribute %s on <ApplicationInfo> ignored", attr.Name.Local))
+	}
+
+	seen := make(map[string]bool)
+	for _, child := range root.children {
+		switch {
+		case strings.EqualFold(child.name, "EncryptionInfo"):
+			warnings = append(warnings, caseWarning(child.name, "EncryptionInfo", "")...)
+			warnings = append(warnings, applyFields(appInfo, child, encryptionFields, "EncryptionInfo/", seen)...)
+		case strings.EqualFold(child.name, "MsiInfo"):
+			warnings = append(warnings, caseWarning(child.name, "MsiInfo", "")...)
+			appInfo.MsiInfo = &MsiInfo{}
+			warnings = append(warnings, applyFields(appInfo, child, msiFields, "MsiInfo/", seen)...)
+		default:
+			warnings = append(warnings, applyField(appInfo, child, applicationFields, "", seen)...)
+		}
+	}
+
+	for _, field := range requiredFields {
+		if !seen[field] {
+			warnings = append(warnings, fmt.Sprintf("required element %s is missing", field))
+		}
+	}
+
+	return appInfo, warnings, nil
+}
+
+// applyFields assigns all children of an element
+func applyFields(appInfo *ApplicationInfo, parent *xmlNode, fields map[string]fieldSetter, prefix string, seen map[string]bool) []string {
+	var warnings []string
+	for _, child := range parent.children {
+		warnings = append(warnings, applyField(appInfo, child, fields, prefix, seen)...)
+	}
+	return warnings
+}
+
+// applyField assigns a single element to its field
+func applyField(appInfo *ApplicationInfo, node *xmlNode, fields map[string]fieldSetter, prefix string, seen map[string]bool) []string {
+	for name, set := range fields {
+		if !strings.EqualFold(name, node.name) {
+			continue
+		}
+		warnings := caseWarning(node.name, name, prefix)
+		if err := set(appInfo, strings.TrimSpace(node.text)); err != nil {
+			warnings = append(warnings, fmt.Sprintf("invalid value %q for %s%s ignored", node.text, prefix, name))
+		}
+		seen[prefix+name] = true
+		return warnings
+	}
+	return []string{fmt.Sprintf("unknown element %s%s ignored", prefix, node.name)}
+}
+
+// caseWarning reports an element name that only matches case-insensitively
+func caseWarning(actual, expected, prefix string) []string {
+	if actual == expected {
+		return nil
+	}
+	return []string{fmt.Sprintf("element %s%s differs in case from %s", prefix, actual, expected)}
+}
+
+// parseXMLTree parses an XML document into a tree of elements using local
+// names only, so that any namespace prefix is accepted
+func parseXMLTree(data []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	// Declarations such as encoding="utf-16" are read as-is
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	var root *xmlNode
+	var stack []*xmlNode
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, attrs: t.Attr}
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, fmt.Errorf("multiple root elements")
+				}
+				root = node
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("document has no root element")
+	}
+	return root, nil
+}
@@ -0,0 +1,120 @@
+package metadata
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/crypto"
+)
+
+// executionContexts are the valid MsiExecutionContext values
+var executionContexts = []string{"System", "User", "Any"}
+
+// ValidationError lists the problems found by Validate
+type ValidationError struct {
+	Problems []string
+}
+
+// Error joins the problems into a single message
+func (e *ValidationError) Error() string {
+	return "invalid Detection.xml: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks Detection.xml content the way the official schema does:
+// required fields must be present, keys and digests must be base64 values
+// of the expected length, sizes must not be negative and the profile and
+// digest algorithm must be known. It returns a *ValidationError listing
+// all problems, or nil.
+func Validate(appInfo *ApplicationInfo) error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	required := []struct {
+		name, value string
+	}{
+		{"Name", appInfo.Name},
+		{"FileName", appInfo.FileName},
+		{"SetupFile", appInfo.SetupFile},
+		{"EncryptionInfo/ProfileIdentifier", appInfo.EncryptionInfo.ProfileIdentifier},
+		{"EncryptionInfo/FileDigestAlgorithm", appInfo.EncryptionInfo.FileDigestAlgorithm},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			add("%s is required", r.name)
+		}
+	}
+
+	if appInfo.ToolVersion != "" {
+		if err := ValidateToolVersion(appInfo.ToolVersion); err != nil {
+			add("ToolVersion: %v", err)
+		}
+	}
+	if appInfo.UnencryptedContentSize < 0 {
+		add("UnencryptedContentSize must not be negative: %d", appInfo.UnencryptedContentSize)
+	}
+
+	enc := appInfo.EncryptionInfo
+	// The digest size depends on the algorithm; unsupported algorithms are
+	// reported below
+	digestSize := sha256.Size
+	if h, err := NewFileDigest(enc.FileDigestAlgorithm); err == nil {
+		digestSize = h.Size()
+	}
+	binaries := []struct {
+		name, value string
+		size        int
+	}{
+		{"EncryptionInfo/EncryptionKey", enc.EncryptionKey, crypto.AES256KeySize},
+		{"EncryptionInfo/MacKey", enc.MacKey, crypto.AES256KeySize},
+		{"EncryptionInfo/InitializationVector", enc.InitializationVector, crypto.IVSize},
+		{"EncryptionInfo/Mac", enc.Mac, crypto.HMACSize},
+		{"EncryptionInfo/FileDigest", enc.FileDigest, digestSize},
+	}
+	for _, b := range binaries {
+		if b.value == "" {
+			add("%s is required", b.name)
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(b.value)
+		if err != nil {
+			add("%s is not valid base64", b.name)
+			continue
+		}
+		if len(data) != b.size {
+			add("%s must be %d bytes, got %d", b.name, b.size, len(data))
+		}
+	}
+
+	if enc.ProfileIdentifier != "" {
+		if err := ValidateProfileIdentifier(enc.ProfileIdentifier); err != nil {
+			add("EncryptionInfo/ProfileIdentifier: %v", err)
+		}
+	}
+	if enc.FileDigestAlgorithm != "" {
+		if _, err := NewFileDigest(enc.FileDigestAlgorithm); err != nil {
+			add("EncryptionInfo/FileDigestAlgorithm: unsupported algorithm %q (supported: %s)", enc.FileDigestAlgorithm, strings.Join(FileDigestAlgorithms, ", "))
+		}
+	}
+
+	if appInfo.MsiInfo != nil && appInfo.MsiInfo.MsiExecutionContext != "" && !contains(executionContexts, appInfo.MsiInfo.MsiExecutionContext) {
+		add("MsiInfo/MsiExecutionContext: unknown context %q (expected %s)", appInfo.MsiInfo.MsiExecutionContext, strings.Join(executionContexts, ", "))
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
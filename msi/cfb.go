@@ -0,0 +1,249 @@
+package msi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// Compound File Binary format constants ([MS-CFB])
+const (
+	cfbSignature   = 0xE11AB1A1E011CFD0
+	cfbHeaderSize  = 512
+	cfbDirEntry    = 128
+	cfbEndOfChain  = 0xFFFFFFFE
+	cfbMaxRegSect  = 0xFFFFFFFA
+	cfbDIFATInHead = 109
+
+	cfbTypeStream = 2
+	cfbTypeRoot   = 5
+)
+
+// ErrNotMSI is returned when the file is not a compound file
+var ErrNotMSI = errors.New("not a Windows Installer database")
+
+// dirEntry is a directory entry of a compound file
+type dirEntry struct {
+	name  string
+	typ   byte
+	start uint32
+	size  uint64
+}
+
+// compoundFile is a minimal read-only Compound File Binary reader
+// sufficient to read the streams of an MSI database
+type compoundFile struct {
+	r              io.ReaderAt
+	sectorSize     int
+	miniSectorSize int
+	miniCutoff     uint64
+	fat            []uint32
+	miniFAT        []uint32
+	entries        []dirEntry
+	miniStream     []byte
+}
+
+// openCompoundFile parses the header, FAT, directory and mini stream
+func openCompoundFile(r io.ReaderAt) (*compoundFile, error) {
+	header := make([]byte, cfbHeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, ErrNotMSI
+	}
+	if binary.LittleEndian.Uint64(header[0:8]) != cfbSignature {
+		return nil, ErrNotMSI
+	}
+
+	sectorShift := binary.LittleEndian.Uint16(header[0x1E:])
+	miniShift := binary.LittleEndian.Uint16(header[0x20:])
+	if sectorShift != 9 && sectorShift != 12 {
+		return nil, fmt.Errorf("unsupported sector size 2^%d", sectorShift)
+	}
+	if miniShift != 6 {
+		return nil, fmt.Errorf("unsupported mini sector size 2^%d", miniShift)
+	}
+
+	c := &compoundFile{
+		r:              r,
+		sectorSize:     1 << sectorShift,
+		miniSectorSize: 1 << miniShift,
+		miniCutoff:     uint64(binary.LittleEndian.Uint32(header[0x38:])),
+	}
+
+	numFATSectors := binary.LittleEndian.Uint32(header[0x2C:])
+	firstDirSector := binary.LittleEndian.Uint32(header[0x30:])
+	firstMiniFATSector := binary.LittleEndian.Uint32(header[0x3C:])
+	firstDIFATSector := binary.LittleEndian.Uint32(header[0x44:])
+	numDIFATSectors := binary.LittleEndian.Uint32(header[0x48:])
+
+	// Collect the FAT sector locations from the header and DIFAT chain
+	fatSectors := make([]uint32, 0, numFATSectors)
+	for i := 0; i < cfbDIFATInHead && uint32(len(fatSectors)) < numFATSectors; i++ {
+		fatSectors = append(fatSectors, binary.LittleEndian.Uint32(header[0x4C+i*4:]))
+	}
+	difatSector := firstDIFATSector
+	for i := uint32(0); i < numDIFATSectors && difatSector <= cfbMaxRegSect; i++ {
+		sector, err := c.readSector(difatSector)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read DIFAT: %w", err)
+		}
+		perSector := c.sectorSize/4 - 1
+		for j := 0; j < perSector && uint32(len(fatSectors)) < numFATSectors; j++ {
+			fatSectors = append(fatSectors, binary.LittleEndian.Uint32(sector[j*4:]))
+		}
+		difatSector = binary.LittleEndian.Uint32(sector[perSector*4:])
+	}
+
+	for _, s := range fatSectors {
+		sector, err := c.readSector(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read FAT: %w", err)
+		}
+		c.fat = append(c.fat, decodeUint32s(sector)...)
+	}
+
+	dirData, err := c.readChain(firstDirSector, c.fat, c.sectorSize, c.readSector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	for off := 0; off+cfbDirEntry <= len(dirData); off += cfbDirEntry {
+		e := parseDirEntry(dirData[off : off+cfbDirEntry])
+		// Version 3 files only use the low 32 bits of the stream size
+		if c.sectorSize == 512 {
+			e.size &= 0xFFFFFFFF
+		}
+		c.entries = append(c.entries, e)
+	}
+	if len(c.entries) == 0 || c.entries[0].typ != cfbTypeRoot {
+		return nil, fmt.Errorf("missing root directory entry")
+	}
+
+	if firstMiniFATSector <= cfbMaxRegSect {
+		miniFATData, err := c.readChain(firstMiniFATSector, c.fat, c.sectorSize, c.readSector)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mini FAT: %w", err)
+		}
+		c.miniFAT = decodeUint32s(miniFATData)
+	}
+
+	// The mini stream is stored in the regular sectors of the root entry
+	root := c.entries[0]
+	if root.start <= cfbMaxRegSect {
+		miniStream, err := c.readChain(root.start, c.fat, c.sectorSize, c.readSector)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mini stream: %w", err)
+		}
+		if uint64(len(miniStream)) > root.size {
+			miniStream = miniStream[:root.size]
+		}
+		c.miniStream = miniStream
+	}
+
+	return c, nil
+}
+
+// readSector reads a regular sector by number
+func (c *compoundFile) readSector(n uint32) ([]byte, error) {
+	buf := make([]byte, c.sectorSize)
+	offset := (int64(n) + 1) * int64(c.sectorSize)
+	if _, err := c.r.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readMiniSector reads a sector of the mini stream by number
+func (c *compoundFile) readMiniSector(n uint32) ([]byte, error) {
+	start := int(n) * c.miniSectorSize
+	end := start + c.miniSectorSize
+	if end > len(c.miniStream) {
+		return nil, fmt.Errorf("mini sector %d out of range", n)
+	}
+	return c.miniStream[start:end], nil
+}
+
+// readChain concatenates the sectors of a chain starting at start
+func (c *compoundFile) readChain(start uint32, fat []uint32, size int, read func(uint32) ([]byte, error)) ([]byte, error) {
+	var data []byte
+	for sector, count := start, 0; sector != cfbEndOfChain; count++ {
+		if sector > cfbMaxRegSect || int(sector) >= len(fat) {
+			return nil, fmt.Errorf("invalid sector %#x in chain", sector)
+		}
+		if count > len(fat) {
+			return nil, fmt.Errorf("sector chain loop detected")
+		}
+		buf, err := read(sector)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, buf[:size]...)
+		sector = fat[sector]
+	}
+	return data, nil
+}
+
+// readStream returns the contents of a stream entry
+func (c *compoundFile) readStream(e dirEntry) ([]byte, error) {
+	if e.size == 0 {
+		return nil, nil
+	}
+
+	var data []byte
+	var err error
+	if e.size < c.miniCutoff {
+		data, err = c.readChain(e.start, c.miniFAT, c.miniSectorSize, c.readMiniSector)
+	} else {
+		data, err = c.readChain(e.start, c.fat, c.sectorSize, c.readSector)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) < e.size {
+		return nil, fmt.Errorf("stream %q is truncated", e.name)
+	}
+	return data[:e.size], nil
+}
+
+// stream returns the contents of the stream with the given raw name
+func (c *compoundFile) stream(name string) ([]byte, bool, error) {
+	for _, e := range c.entries {
+		if e.typ == cfbTypeStream && e.name == name {
+			data, err := c.readStream(e)
+			return data, true, err
+		}
+	}
+	return nil, false, nil
+}
+
+// parseDirEntry decodes a 128 byte directory entry
+func parseDirEntry(b []byte) dirEntry {
+	nameLen := int(binary.LittleEndian.Uint16(b[64:]))
+	if nameLen > 64 {
+		nameLen = 64
+	}
+	units := make([]uint16, 0, nameLen/2)
+	for i := 0; i+1 < nameLen; i += 2 {
+		u := binary.LittleEndian.Uint16(b[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+
+	return dirEntry{
+		name:  string(utf16.Decode(units)),
+		typ:   b[66],
+		start: binary.LittleEndian.Uint32(b[116:]),
+		size:  binary.LittleEndian.Uint64(b[120:]),
+	}
+}
+
+// decodeUint32s decodes a little-endian uint32 array
+func decodeUint32s(b []byte) []uint32 {
+	values := make([]uint32, len(b)/4)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return values
+}
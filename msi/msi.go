@@ -0,0 +1,339 @@
+// Package msi reads product information from Windows Installer (.msi) databases.
+//
+// An MSI database is a Compound File Binary (OLE structured storage) file
+// whose tables are stored as streams with encoded names. This package
+// implements just enough of both formats to read the Property table and
+// the summary information stream, which hold the product code, version and
+// other values needed to describe an MSI based package.
+//
+// Format references:
+// - [MS-CFB] Compound File Binary File Format
+// - https://github.com/wine-mirror/wine/blob/master/dlls/msi/table.c
+package msi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// tablePrefix marks streams that hold database tables
+const tablePrefix = 0x4840
+
+// Info contains the product information of an MSI database
+type Info struct {
+	// ProductCode is the GUID identifying the product
+	ProductCode string
+	// ProductVersion is the version of the product
+	ProductVersion string
+	// ProductName is the display name of the product
+	ProductName string
+	// Manufacturer is the publisher of the product
+	Manufacturer string
+	// UpgradeCode is the GUID shared by all versions of the product
+	UpgradeCode string
+	// PackageCode is the GUID identifying this particular MSI file
+	PackageCode string
+	// Template is the platform and language list (e.g. "x64;1033")
+	Template string
+	// Properties contains all rows of the Property table
+	Properties map[string]string
+	// HasServices reports whether the database installs services
+	HasServices bool
+	// HasODBCDataSources reports whether the database registers ODBC data sources
+	HasODBCDataSources bool
+	// HasSystemRegistryKeys reports whether registry values are written to
+	// machine wide roots (HKCR, HKLM or HKU)
+	HasSystemRegistryKeys bool
+	// HasSystemFolders reports whether files are installed to Windows system folders
+	HasSystemFolders bool
+	// Signed reports whether the database carries an Authenticode signature.
+	// The signature itself is not verified.
+	Signed bool
+}
+
+// ExecutionContext returns the install context of the package derived from
+// the ALLUSERS and MSIINSTALLPERUSER properties: "System", "User" or "Any"
+// for dual purpose packages.
+func (i *Info) ExecutionContext() string {
+	switch i.Properties["ALLUSERS"] {
+	case "1":
+		return "System"
+	case "2":
+		if i.Properties["MSIINSTALLPERUSER"] == "1" {
+			return "User"
+		}
+		return "Any"
+	}
+	return "User"
+}
+
+// RequiresReboot reports whether the package forces a reboot
+func (i *Info) RequiresReboot() bool {
+	return i.Properties["REBOOT"] == "Force" || i.Properties["REBOOT"] == "F"
+}
+
+// Open reads the product information of the MSI file at path
+func Open(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return info, nil
+}
+
+// Read reads the product information of an MSI database
+func Read(r io.ReaderAt) (*Info, error) {
+	cf, err := openCompoundFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	stringTable, refSize, err := readStringTable(cf)
+	if err != nil {
+		return nil, err
+	}
+
+	props, err := readPropertyTable(cf, stringTable, refSize)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		ProductCode:    props["ProductCode"],
+		ProductVersion: props["ProductVersion"],
+		ProductName:    props["ProductName"],
+		Manufacturer:   props["Manufacturer"],
+		UpgradeCode:    props["UpgradeCode"],
+		Properties:     props,
+	}
+
+	info.HasServices = hasRows(cf, "ServiceInstall")
+	info.HasODBCDataSources = hasRows(cf, "ODBCDataSource")
+	info.HasSystemRegistryKeys = hasSystemRegistryKeys(cf, refSize)
+	info.HasSystemFolders = hasSystemFolders(cf, stringTable, refSize)
+	_, info.Signed, _ = cf.stream("\x05DigitalSignature")
+
+	// The summary information is optional for our purposes
+	if summary, ok, err := cf.stream("\x05SummaryInformation"); err == nil && ok {
+		values := parseSummaryInformation(summary)
+		info.PackageCode = values[pidRevisionNumber]
+		info.Template = values[pidTemplate]
+	}
+
+	return info, nil
+}
+
+// readStringTable loads the shared string pool of the database. It returns
+// the strings indexed by string ID and the size of string references.
+func readStringTable(cf *compoundFile) ([]string, int, error) {
+	pool, ok, err := cf.stream(encodeStreamName("_StringPool", true))
+	if err != nil || !ok {
+		return nil, 0, fmt.Errorf("failed to read string pool: %v", orMissing(err))
+	}
+	data, ok, err := cf.stream(encodeStreamName("_StringData", true))
+	if err != nil || !ok {
+		return nil, 0, fmt.Errorf("failed to read string data: %v", orMissing(err))
+	}
+	if len(pool) < 4 {
+		return nil, 0, fmt.Errorf("string pool is too short")
+	}
+
+	// The high bit of the code page marks 3 byte string references
+	refSize := 2
+	if binary.LittleEndian.Uint32(pool)&0x80000000 != 0 {
+		refSize = 3
+	}
+
+	// String ID 0 is the null string
+	table := []string{""}
+	offset := 0
+	for i := 4; i+4 <= len(pool); {
+		length := int(binary.LittleEndian.Uint16(pool[i:]))
+		refs := binary.LittleEndian.Uint16(pool[i+2:])
+
+		switch {
+		case length == 0 && refs == 0:
+			// Unused string ID
+			table = append(table, "")
+			i += 4
+			continue
+		case length == 0:
+			// Strings over 64k store their length in the following entry
+			if i+8 > len(pool) {
+				return nil, 0, fmt.Errorf("string pool is truncated")
+			}
+			length = int(binary.LittleEndian.Uint16(pool[i+4:])) | int(binary.LittleEndian.Uint16(pool[i+6:]))<<16
+			i += 8
+		default:
+			i += 4
+		}
+
+		if offset+length > len(data) {
+			return nil, 0, fmt.Errorf("string data is truncated")
+		}
+		table = append(table, decodeString(data[offset:offset+length]))
+		offset += length
+	}
+
+	return table, refSize, nil
+}
+
+// readPropertyTable reads the Property table into a map. Table streams are
+// stored column by column, each cell being a string reference.
+func readPropertyTable(cf *compoundFile, stringTable []string, refSize int) (map[string]string, error) {
+	data, ok, err := cf.stream(encodeStreamName("Property", true))
+	if err != nil || !ok {
+		return nil, fmt.Errorf("failed to read Property table: %v", orMissing(err))
+	}
+
+	rowSize := 2 * refSize
+	rows := len(data) / rowSize
+	props := make(map[string]string, rows)
+	for row := 0; row < rows; row++ {
+		key := stringRef(data[row*refSize:], refSize)
+		value := stringRef(data[(rows+row)*refSize:], refSize)
+		if key >= len(stringTable) || value >= len(stringTable) {
+			return nil, fmt.Errorf("invalid string reference in Property table")
+		}
+		props[stringTable[key]] = stringTable[value]
+	}
+
+	return props, nil
+}
+
+// hasRows reports whether a table exists and contains rows
+func hasRows(cf *compoundFile, table string) bool {
+	data, ok, err := cf.stream(encodeStreamName(table, true))
+	return err == nil && ok && len(data) > 0
+}
+
+// hasSystemRegistryKeys checks the Root column of the Registry table for
+// machine wide roots. The Registry table has 5 string columns and the
+// 2 byte Root column, stored after the Registry key column.
+func hasSystemRegistryKeys(cf *compoundFile, refSize int) bool {
+	data, ok, err := cf.stream(encodeStreamName("Registry", true))
+	if err != nil || !ok {
+		return false
+	}
+
+	rows := len(data) / (5*refSize + 2)
+	for row := 0; row < rows; row++ {
+		// Integer columns are stored with the high bit flipped
+		root := int(binary.LittleEndian.Uint16(data[rows*refSize+row*2:])) - 0x8000
+		switch root {
+		case 0, 2, 3: // HKCR, HKLM, HKU
+			return true
+		}
+	}
+	return false
+}
+
+// systemFolders are the Directory table keys of Windows system folders
+var systemFolders = map[string]bool{
+	"SystemFolder":   true,
+	"System64Folder": true,
+	"System16Folder": true,
+	"WindowsFolder":  true,
+}
+
+// hasSystemFolders checks the key column of the Directory table for
+// Windows system folders
+func hasSystemFolders(cf *compoundFile, stringTable []string, refSize int) bool {
+	data, ok, err := cf.stream(encodeStreamName("Directory", true))
+	if err != nil || !ok {
+		return false
+	}
+
+	rows := len(data) / (3 * refSize)
+	for row := 0; row < rows; row++ {
+		ref := stringRef(data[row*refSize:], refSize)
+		if ref < len(stringTable) && systemFolders[stringTable[ref]] {
+			return true
+		}
+	}
+	return false
+}
+
+// stringRef decodes a 2 or 3 byte string reference
+func stringRef(b []byte, size int) int {
+	ref := int(binary.LittleEndian.Uint16(b))
+	if size == 3 {
+		ref |= int(b[2]) << 16
+	}
+	return ref
+}
+
+// decodeString converts string data to UTF-8. Databases using a single
+// byte code page are decoded as Latin-1, which covers the ASCII values
+// (GUIDs and versions) this package is interested in.
+func decodeString(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// orMissing describes a missing stream when err is nil
+func orMissing(err error) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("stream not found")
+}
+
+// mimeIndex maps a character to its 6 bit stream name code, or -1
+func mimeIndex(c rune) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 36
+	case c == '.':
+		return 62
+	case c == '_':
+		return 63
+	}
+	return -1
+}
+
+// encodeStreamName compresses a stream name the way Windows Installer does:
+// pairs of name characters are packed into a single UTF-16 code unit.
+func encodeStreamName(name string, table bool) string {
+	var out []rune
+	if table {
+		out = append(out, tablePrefix)
+	}
+
+	in := []rune(name)
+	for i := 0; i < len(in); i++ {
+		c := mimeIndex(in[i])
+		if c < 0 {
+			out = append(out, in[i])
+			continue
+		}
+		if i+1 < len(in) {
+			if next := mimeIndex(in[i+1]); next >= 0 {
+				out = append(out, rune(0x3800+c+next<<6))
+				i++
+				continue
+			}
+		}
+		out = append(out, rune(0x4800+c))
+	}
+	return string(out)
+}
@@ -0,0 +1,399 @@
+package msi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"unicode/utf16"
+)
+
+// buildCompoundFile creates a version 3 compound file holding the given
+// streams in the mini stream (all test streams are below the cutoff)
+func buildCompoundFile(t *testing.T, streams map[string][]byte) []byte {
+	t.Helper()
+	const sectorSize = 512
+	const free, endOfChain, fatSect = 0xFFFFFFFF, 0xFFFFFFFE, 0xFFFFFFFD
+
+	names := make([]string, 0, len(streams))
+	for name := range streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Lay out the streams in 64 byte mini sectors
+	var miniStream []byte
+	var miniFAT []uint32
+	starts := make(map[string]uint32)
+	for _, name := range names {
+		data := streams[name]
+		starts[name] = uint32(len(miniFAT))
+		count := (len(data) + 63) / 64
+		for i := 0; i < count; i++ {
+			if i == count-1 {
+				miniFAT = append(miniFAT, endOfChain)
+			} else {
+				miniFAT = append(miniFAT, uint32(len(miniFAT)+1))
+			}
+		}
+		padded := make([]byte, count*64)
+		copy(padded, data)
+		miniStream = append(miniStream, padded...)
+	}
+
+	// Directory: root entry followed by the streams as a right sibling chain
+	entry := func(name string, typ byte, right, child, start uint32, size uint64) []byte {
+		b := make([]byte, 128)
+		units := utf16.Encode([]rune(name))
+		for i, u := range units {
+			binary.LittleEndian.PutUint16(b[i*2:], u)
+		}
+		binary.LittleEndian.PutUint16(b[64:], uint16((len(units)+1)*2))
+		b[66] = typ
+		b[67] = 1
+		binary.LittleEndian.PutUint32(b[68:], free)
+		binary.LittleEndian.PutUint32(b[72:], right)
+		binary.LittleEndian.PutUint32(b[76:], child)
+		binary.LittleEndian.PutUint32(b[116:], start)
+		binary.LittleEndian.PutUint64(b[120:], size)
+		return b
+	}
+
+	dirSectors := (len(names) + 1 + 3) / 4
+	miniFATSectors := (len(miniFAT)*4 + sectorSize - 1) / sectorSize
+	miniStreamSectors := (len(miniStream) + sectorSize - 1) / sectorSize
+	firstMiniFAT := uint32(1 + dirSectors)
+	firstMiniStream := firstMiniFAT + uint32(miniFATSectors)
+
+	var dir []byte
+	dir = append(dir, entry("Root Entry", 5, free, 1, firstMiniStream, uint64(len(miniStream)))...)
+	for i, name := range names {
+		right := uint32(free)
+		if i+2 <= len(names) {
+			right = uint32(i + 2)
+		}
+		dir = append(dir, entry(name, 2, right, free, starts[name], uint64(len(streams[name])))...)
+	}
+
+	// FAT covering all sectors
+	fat := make([]uint32, sectorSize/4)
+	for i := range fat {
+		fat[i] = free
+	}
+	fat[0] = fatSect
+	chain := func(first uint32, count int) {
+		for i := 0; i < count; i++ {
+			if i == count-1 {
+				fat[first+uint32(i)] = endOfChain
+			} else {
+				fat[first+uint32(i)] = first + uint32(i) + 1
+			}
+		}
+	}
+	chain(1, dirSectors)
+	chain(firstMiniFAT, miniFATSectors)
+	chain(firstMiniStream, miniStreamSectors)
+
+	header := make([]byte, sectorSize)
+	binary.LittleEndian.PutUint64(header[0:], cfbSignature)
+	binary.LittleEndian.PutUint16(header[0x18:], 0x3E)
+	binary.LittleEndian.PutUint16(header[0x1A:], 3)
+	binary.LittleEndian.PutUint16(header[0x1C:], 0xFFFE)
+	binary.LittleEndian.PutUint16(header[0x1E:], 9)
+	binary.LittleEndian.PutUint16(header[0x20:], 6)
+	binary.LittleEndian.PutUint32(header[0x2C:], 1)
+	binary.LittleEndian.PutUint32(header[0x30:], 1)
+	binary.LittleEndian.PutUint32(header[0x38:], 4096)
+	binary.LittleEndian.PutUint32(header[0x3C:], firstMiniFAT)
+	binary.LittleEndian.PutUint32(header[0x40:], uint32(miniFATSectors))
+	binary.LittleEndian.PutUint32(header[0x44:], endOfChain)
+	for i := 0; i < 109; i++ {
+		binary.LittleEndian.PutUint32(header[0x4C+i*4:], free)
+	}
+	binary.LittleEndian.PutUint32(header[0x4C:], 0)
+
+	pad := func(b []byte, sectors int) []byte {
+		out := make([]byte, sectors*sectorSize)
+		copy(out, b)
+		return out
+	}
+	miniFATBytes := make([]byte, len(miniFAT)*4)
+	for i, v := range miniFAT {
+		binary.LittleEndian.PutUint32(miniFATBytes[i*4:], v)
+	}
+	fatBytes := make([]byte, len(fat)*4)
+	for i, v := range fat {
+		binary.LittleEndian.PutUint32(fatBytes[i*4:], v)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(header)
+	buf.Write(fatBytes)
+	buf.Write(pad(dir, dirSectors))
+	buf.Write(pad(miniFATBytes, miniFATSectors))
+	buf.Write(pad(miniStream, miniStreamSectors))
+	return buf.Bytes()
+}
+
+// buildDatabase creates an MSI database with the given properties. tables
+// may add further table streams using the shared string pool.
+func buildDatabase(t *testing.T, props map[string]string, summary map[uint32]string, tables func(addString func(string) uint16) map[string][]byte) []byte {
+	t.Helper()
+
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// String pool: code page header followed by (length, refcount) pairs
+	var pool, data bytes.Buffer
+	binary.Write(&pool, binary.LittleEndian, uint32(65001))
+	ids := make(map[string]uint16)
+	addString := func(s string) uint16 {
+		if id, ok := ids[s]; ok {
+			return id
+		}
+		binary.Write(&pool, binary.LittleEndian, uint16(len(s)))
+		binary.Write(&pool, binary.LittleEndian, uint16(1))
+		data.WriteString(s)
+		ids[s] = uint16(len(ids) + 1)
+		return ids[s]
+	}
+
+	var keyCol, valueCol bytes.Buffer
+	for _, k := range keys {
+		binary.Write(&keyCol, binary.LittleEndian, addString(k))
+		binary.Write(&valueCol, binary.LittleEndian, addString(props[k]))
+	}
+
+	// Extra tables must add their strings before the pool is stored
+	streams := make(map[string][]byte)
+	if tables != nil {
+		for name, table := range tables(addString) {
+			streams[encodeStreamName(name, true)] = table
+		}
+	}
+
+	streams[encodeStreamName("_StringPool", true)] = pool.Bytes()
+	streams[encodeStreamName("_StringData", true)] = data.Bytes()
+	streams[encodeStreamName("Property", true)] = append(keyCol.Bytes(), valueCol.Bytes()...)
+
+	if summary != nil {
+		streams["\x05SummaryInformation"] = buildSummaryInformation(summary)
+	}
+
+	return buildCompoundFile(t, streams)
+}
+
+// buildSummaryInformation creates a property set stream with string values
+func buildSummaryInformation(values map[uint32]string) []byte {
+	pids := make([]int, 0, len(values))
+	for pid := range values {
+		pids = append(pids, int(pid))
+	}
+	sort.Ints(pids)
+
+	var props bytes.Buffer
+	offsets := make([]uint32, len(pids))
+	headerSize := 8 + 8*len(pids)
+	for i, pid := range pids {
+		offsets[i] = uint32(headerSize + props.Len())
+		s := values[uint32(pid)] + "\x00"
+		binary.Write(&props, binary.LittleEndian, uint32(vtLPSTR))
+		binary.Write(&props, binary.LittleEndian, uint32(len(s)))
+		props.WriteString(s)
+		for props.Len()%4 != 0 {
+			props.WriteByte(0)
+		}
+	}
+
+	var section bytes.Buffer
+	binary.Write(&section, binary.LittleEndian, uint32(headerSize+props.Len()))
+	binary.Write(&section, binary.LittleEndian, uint32(len(pids)))
+	for i, pid := range pids {
+		binary.Write(&section, binary.LittleEndian, uint32(pid))
+		binary.Write(&section, binary.LittleEndian, offsets[i])
+	}
+	section.Write(props.Bytes())
+
+	out := make([]byte, 48)
+	binary.LittleEndian.PutUint16(out[0:], 0xFFFE)
+	binary.LittleEndian.PutUint32(out[24:], 1)
+	binary.LittleEndian.PutUint32(out[44:], 48)
+	return append(out, section.Bytes()...)
+}
+
+func TestRead(t *testing.T) {
+	props := map[string]string{
+		"ProductCode":    "{11111111-2222-3333-4444-555555555555}",
+		"ProductVersion": "1.2.3",
+		"ProductName":    "Test App",
+		"Manufacturer":   "Contoso",
+		"UpgradeCode":    "{AAAAAAAA-BBBB-CCCC-DDDD-EEEEEEEEEEEE}",
+		"ALLUSERS":       "1",
+	}
+	summary := map[uint32]string{
+		pidTemplate:       "x64;1033",
+		pidRevisionNumber: "{99999999-8888-7777-6666-555555555555}",
+	}
+
+	info, err := Read(bytes.NewReader(buildDatabase(t, props, summary, nil)))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	if info.ProductCode != props["ProductCode"] {
+		t.Errorf("ProductCode mismatch: expected %s, got %s", props["ProductCode"], info.ProductCode)
+	}
+	if info.ProductVersion != "1.2.3" {
+		t.Errorf("ProductVersion mismatch: expected 1.2.3, got %s", info.ProductVersion)
+	}
+	if info.ProductName != "Test App" {
+		t.Errorf("ProductName mismatch: expected Test App, got %s", info.ProductName)
+	}
+	if info.Manufacturer != "Contoso" {
+		t.Errorf("Manufacturer mismatch: expected Contoso, got %s", info.Manufacturer)
+	}
+	if info.UpgradeCode != props["UpgradeCode"] {
+		t.Errorf("UpgradeCode mismatch: got %s", info.UpgradeCode)
+	}
+	if info.Properties["ALLUSERS"] != "1" {
+		t.Errorf("ALLUSERS mismatch: got %q", info.Properties["ALLUSERS"])
+	}
+	if info.PackageCode != summary[pidRevisionNumber] {
+		t.Errorf("PackageCode mismatch: got %s", info.PackageCode)
+	}
+	if info.Template != "x64;1033" {
+		t.Errorf("Template mismatch: got %s", info.Template)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "msi-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "setup.msi")
+	data := buildDatabase(t, map[string]string{"ProductCode": "{00000000-0000-0000-0000-000000000001}"}, nil, nil)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write MSI: %v", err)
+	}
+
+	info, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if info.ProductCode != "{00000000-0000-0000-0000-000000000001}" {
+		t.Errorf("ProductCode mismatch: got %s", info.ProductCode)
+	}
+	if info.PackageCode != "" {
+		t.Errorf("PackageCode should be empty without summary information, got %s", info.PackageCode)
+	}
+}
+
+func TestReadTables(t *testing.T) {
+	props := map[string]string{"ALLUSERS": "1", "REBOOT": "Force"}
+	tables := func(addString func(string) uint16) map[string][]byte {
+		le16 := func(values ...uint16) []byte {
+			b := make([]byte, len(values)*2)
+			for i, v := range values {
+				binary.LittleEndian.PutUint16(b[i*2:], v)
+			}
+			return b
+		}
+
+		// Registry: one row with Root = 2 (HKLM), 5 string columns
+		var registry []byte
+		registry = append(registry, le16(addString("Reg1"))...)
+		registry = append(registry, le16(0x8000+2)...)
+		registry = append(registry, le16(addString(`Software\Test`), 0, 0, addString("Comp1"))...)
+
+		// Directory: TARGETDIR and SystemFolder
+		directory := le16(
+			addString("TARGETDIR"), addString("SystemFolder"),
+			0, addString("TARGETDIR"),
+			addString("SourceDir"), addString("."),
+		)
+
+		return map[string][]byte{
+			"Registry":       registry,
+			"Directory":      directory,
+			"ServiceInstall": le16(addString("Svc"), 0),
+		}
+	}
+
+	info, err := Read(bytes.NewReader(buildDatabase(t, props, nil, tables)))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	if !info.HasServices {
+		t.Error("Expected HasServices")
+	}
+	if info.HasODBCDataSources {
+		t.Error("Unexpected HasODBCDataSources")
+	}
+	if !info.HasSystemRegistryKeys {
+		t.Error("Expected HasSystemRegistryKeys")
+	}
+	if !info.HasSystemFolders {
+		t.Error("Expected HasSystemFolders")
+	}
+	if info.ExecutionContext() != "System" {
+		t.Errorf("Expected System context, got %s", info.ExecutionContext())
+	}
+	if !info.RequiresReboot() {
+		t.Error("Expected RequiresReboot")
+	}
+}
+
+func TestExecutionContext(t *testing.T) {
+	tests := []struct {
+		props    map[string]string
+		expected string
+	}{
+		{map[string]string{}, "User"},
+		{map[string]string{"ALLUSERS": "1"}, "System"},
+		{map[string]string{"ALLUSERS": "2"}, "Any"},
+		{map[string]string{"ALLUSERS": "2", "MSIINSTALLPERUSER": "1"}, "User"},
+	}
+	for _, tc := range tests {
+		info := &Info{Properties: tc.props}
+		if got := info.ExecutionContext(); got != tc.expected {
+			t.Errorf("ExecutionContext(%v): expected %s, got %s", tc.props, tc.expected, got)
+		}
+	}
+}
+
+func TestReadNotMSI(t *testing.T) {
+	_, err := Read(bytes.NewReader([]byte("MZ this is not a compound file")))
+	if err != ErrNotMSI {
+		t.Errorf("Expected ErrNotMSI, got %v", err)
+	}
+}
+
+func TestEncodeStreamName(t *testing.T) {
+	// "Property" packs into 4 code units after the table prefix
+	name := []rune(encodeStreamName("Property", true))
+	if len(name) != 5 {
+		t.Fatalf("Expected 5 code units, got %d", len(name))
+	}
+	if name[0] != tablePrefix {
+		t.Errorf("Expected table prefix, got %#x", name[0])
+	}
+	// 'P' = 25, 'r' = 53: 0x3800 + 25 + 53<<6
+	if name[1] != 0x3800+25+53<<6 {
+		t.Errorf("Unexpected first code unit %#x", name[1])
+	}
+
+	// Odd length names end with a single character code
+	name = []rune(encodeStreamName("abc", false))
+	if len(name) != 2 || name[1] != 0x4800+38 {
+		t.Errorf("Unexpected encoding of odd length name: %#v", name)
+	}
+}
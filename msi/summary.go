@@ -0,0 +1,53 @@
+package msi
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// Summary information property IDs ([MS-OLEPS])
+const (
+	pidTemplate       = 7
+	pidRevisionNumber = 9
+
+	vtLPSTR = 30
+)
+
+// parseSummaryInformation extracts the string properties of the first
+// property set in a summary information stream. Malformed data yields
+// the properties parsed so far.
+func parseSummaryInformation(b []byte) map[uint32]string {
+	values := make(map[uint32]string)
+	if len(b) < 48 {
+		return values
+	}
+
+	section := int(binary.LittleEndian.Uint32(b[44:]))
+	if section < 0 || section+8 > len(b) {
+		return values
+	}
+
+	count := int(binary.LittleEndian.Uint32(b[section+4:]))
+	for i := 0; i < count; i++ {
+		entry := section + 8 + i*8
+		if entry+8 > len(b) {
+			break
+		}
+		pid := binary.LittleEndian.Uint32(b[entry:])
+		offset := section + int(binary.LittleEndian.Uint32(b[entry+4:]))
+		if offset < 0 || offset+8 > len(b) {
+			continue
+		}
+		if binary.LittleEndian.Uint32(b[offset:]) != vtLPSTR {
+			continue
+		}
+		size := int(binary.LittleEndian.Uint32(b[offset+4:]))
+		start := offset + 8
+		if size < 0 || start+size > len(b) {
+			continue
+		}
+		values[pid] = strings.TrimRight(decodeString(b[start:start+size]), "\x00")
+	}
+
+	return values
+}
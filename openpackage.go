@@ -17,9 +17,33 @@
 //   - github.com/MANCHTOOLS/open-package/packager - Package creation workflow
 //   - github.com/MANCHTOOLS/open-package/crypto - AES-256-CBC encryption
 //   - github.com/MANCHTOOLS/open-package/metadata - Detection.xml generation
+//   - github.com/MANCHTOOLS/open-package/msi - MSI product information
+//   - github.com/MANCHTOOLS/open-package/config - JSON build config files
+//   - github.com/MANCHTOOLS/open-package/unpacker - Reading and decrypting packages
+//   - github.com/MANCHTOOLS/open-package/format - Versioned package layouts
+//   - github.com/MANCHTOOLS/open-package/compat - Comparison with the official tool
+//   - github.com/MANCHTOOLS/open-package/changes - File changes between builds
+//   - github.com/MANCHTOOLS/open-package/snippet - PowerShell upload scripts
+//   - github.com/MANCHTOOLS/open-package/lobapp - Intune app (win32LobApp) sidecars
+//   - github.com/MANCHTOOLS/open-package/detection - Intune detection rules
+//   - github.com/MANCHTOOLS/open-package/prune - Removing old package versions
+//   - github.com/MANCHTOOLS/open-package/registry - Local build history
+//   - github.com/MANCHTOOLS/open-package/split - Splitting sources over the size limit
+//   - github.com/MANCHTOOLS/open-package/inventory - Package contents by file type
+//   - github.com/MANCHTOOLS/open-package/escrow - Key escrow for archived packages
+//   - github.com/MANCHTOOLS/open-package/logging - Rotating log files
+//   - github.com/MANCHTOOLS/open-package/tempfiles - Cleanup of temporary files
+//   - github.com/MANCHTOOLS/open-package/bench - Throughput benchmarks
+//   - github.com/MANCHTOOLS/open-package/synthetic - Synthetic source trees
+//   - github.com/MANCHTOOLS/open-package/openpackagetest - Package fixtures for tests
+//   - github.com/MANCHTOOLS/open-package/psmodule - PowerShell module wrapping the CLI
+//   - github.com/MANCHTOOLS/open-package/messages - Translations of CLI messages
+//   - github.com/MANCHTOOLS/open-package/retry - Retries of transient errors
+//   - github.com/MANCHTOOLS/open-package/contentindex - Index of the files inside packages
 package openpackage
 
 import (
+	"github.com/MANCHTOOLS/open-package/escrow"
 	"github.com/MANCHTOOLS/open-package/packager"
 )
 
@@ -33,16 +57,46 @@ type Options struct {
 	OutputDir string
 	// Quiet suppresses progress output when true
 	Quiet bool
+	// Architecture is the target architecture (x86, x64, arm64), optional
+	Architecture string
+	// MSIXWrapper wraps an MSIX setup file with a bootstrap install script
+	MSIXWrapper bool
+	// StrictCompat writes Detection.xml byte-compatible with the official tool
+	StrictCompat bool
+	// ToolVersion overrides the ToolVersion recorded in Detection.xml, optional
+	ToolVersion string
+	// ProfileIdentifier selects the crypto profile (ProfileVersion1), optional
+	ProfileIdentifier string
+	// Name overrides the application name and output file name, optional
+	Name string
+	// EscrowKey escrows the package keys next to the package, optional
+	EscrowKey *escrow.Key
+	// Strict turns packaging warnings into errors
+	Strict bool
+	// Suppress lists warning codes whose warnings are dropped, optional
+	Suppress []string
+	// JobID correlates the build across pipeline stages, optional
+	JobID string
 }
 
 // CreatePackage creates an .intunewin package from the source directory.
 // It returns the path to the created package file.
 func CreatePackage(opts Options) (string, error) {
 	p := packager.New(packager.Options{
-		SourceDir: opts.SourceDir,
-		SetupFile: opts.SetupFile,
-		OutputDir: opts.OutputDir,
-		Quiet:     opts.Quiet,
+		SourceDir:         opts.SourceDir,
+		SetupFile:         opts.SetupFile,
+		OutputDir:         opts.OutputDir,
+		Quiet:             opts.Quiet,
+		Architecture:      opts.Architecture,
+		MSIXWrapper:       opts.MSIXWrapper,
+		StrictCompat:      opts.StrictCompat,
+		ToolVersion:       opts.ToolVersion,
+		ProfileIdentifier: opts.ProfileIdentifier,
+		Name:              opts.Name,
+		EscrowKey:         opts.EscrowKey,
+		Strict:            opts.Strict,
+		Suppress:          opts.Suppress,
+		JobID:             opts.JobID,
 	})
 	return p.CreatePackage()
 }
@@ -54,9 +108,19 @@ type Packager = packager.Packager
 // New creates a new Packager with the given options.
 func New(opts Options) *Packager {
 	return packager.New(packager.Options{
-		SourceDir: opts.SourceDir,
-		SetupFile: opts.SetupFile,
-		OutputDir: opts.OutputDir,
-		Quiet:     opts.Quiet,
+		SourceDir:         opts.SourceDir,
+		SetupFile:         opts.SetupFile,
+		OutputDir:         opts.OutputDir,
+		Quiet:             opts.Quiet,
+		Architecture:      opts.Architecture,
+		MSIXWrapper:       opts.MSIXWrapper,
+		StrictCompat:      opts.StrictCompat,
+		ToolVersion:       opts.ToolVersion,
+		ProfileIdentifier: opts.ProfileIdentifier,
+		Name:              opts.Name,
+		EscrowKey:         opts.EscrowKey,
+		Strict:            opts.Strict,
+		Suppress:          opts.Suppress,
+		JobID:             opts.JobID,
 	})
 }
@@ -0,0 +1,263 @@
+// Package openpackagetest provides helpers for tests of code that creates
+// or consumes .intunewin packages, in the spirit of net/http/httptest:
+// building tiny valid packages, decrypting them and asserting on their
+// Detection.xml fields and files.
+//
+//	path := openpackagetest.Build(t, openpackagetest.Fixture{
+//	    Files: map[string]string{"install.cmd": "@echo off"},
+//	})
+//	pkg := openpackagetest.Open(t, path)
+//	pkg.AssertDetection(t, map[string]string{"SetupFile": "install.cmd"})
+//	pkg.AssertGolden(t, "testdata/app.golden")
+//
+// Golden files hold Detection.xml, with the keys, MAC and digest that
+// change with every build masked, and the path, size and SHA256 of every
+// packaged file. Running the tests with OPENPACKAGETEST_UPDATE=1 writes
+// them instead of comparing.
+package openpackagetest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/MANCHTOOLS/open-package/packager"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+// DefaultSetupFile is the setup file of fixtures that name none
+const DefaultSetupFile = "install.cmd"
+
+// UpdateEnv is the environment variable that makes AssertGolden write
+// golden files
+const UpdateEnv = "OPENPACKAGETEST_UPDATE"
+
+// Fixture describes a package built by Build
+type Fixture struct {
+	// Name is the name of the source folder, which prefixes the entries of
+	// the inner ZIP and names the package (optional, defaults to "app")
+	Name string
+	// SetupFile is the setup file (optional, defaults to DefaultSetupFile)
+	SetupFile string
+	// Files maps paths relative to the source folder, with forward
+	// slashes, to their content. A setup file missing from Files is added
+	// as a short batch file.
+	Files map[string]string
+	// Options adjusts the packager options before the build, e.g. to set
+	// StrictCompat or ToolVersion (optional)
+	Options func(*packager.Options)
+}
+
+// Package is a decrypted package
+type Package struct {
+	*unpacker.Package
+	// Path is the path of the package
+	Path string
+	// Files maps the paths of the packaged files, relative to the source
+	// folder with forward slashes, to their content
+	Files map[string][]byte
+}
+
+// Build creates the package of f in a temporary folder of t and returns
+// its path. The folder is removed when the test ends.
+func Build(t testing.TB, f Fixture) string {
+	t.Helper()
+	if f.Name == "" {
+		f.Name = "app"
+	}
+	if f.SetupFile == "" {
+		f.SetupFile = DefaultSetupFile
+	}
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, f.Name)
+	files := map[string]string{f.SetupFile: "@echo off\r\nexit /b 0\r\n"}
+	for name, content := range f.Files {
+		files[name] = content
+	}
+	for name, content := range files {
+		path := filepath.Join(sourceDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create fixture folder: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write fixture file %s: %v", name, err)
+		}
+	}
+
+	opts := packager.Options{
+		SourceDir: sourceDir,
+		SetupFile: f.SetupFile,
+		OutputDir: dir,
+		Quiet:     true,
+	}
+	if f.Options != nil {
+		f.Options(&opts)
+	}
+	path, err := packager.New(opts).CreatePackage()
+	if err != nil {
+		t.Fatalf("Failed to build fixture package: %v", err)
+	}
+	return path
+}
+
+// Open opens, verifies and decrypts the package at path
+func Open(t testing.TB, path string) *Package {
+	t.Helper()
+	pkg, err := unpacker.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open package: %v", err)
+	}
+	innerZip, err := pkg.Decrypt()
+	if err != nil {
+		t.Fatalf("Failed to decrypt package: %v", err)
+	}
+	zr, err := unpacker.ReadInnerZip(innerZip)
+	if err != nil {
+		t.Fatalf("Failed to read inner ZIP: %v", err)
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", f.Name, err)
+		}
+		// The source folder name prefixes all entries
+		_, name, _ := strings.Cut(f.Name, "/")
+		files[name] = content
+	}
+	return &Package{Package: pkg, Path: path, Files: files}
+}
+
+// DetectionFields returns the text of the elements and the attributes of
+// Detection.xml by name, e.g. "Name", "SetupFile", "ToolVersion" or
+// "MsiProductCode"
+func (p *Package) DetectionFields() (map[string]string, error) {
+	fields := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(p.DetectionXML))
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return fields, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid Detection.xml: %w", err)
+		}
+		switch tok := token.(type) {
+		case xml.StartElement:
+			text.Reset()
+			for _, attr := range tok.Attr {
+				if attr.Name.Space == "" {
+					fields[attr.Name.Local] = attr.Value
+				}
+			}
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			if _, ok := fields[tok.Name.Local]; !ok {
+				fields[tok.Name.Local] = strings.TrimSpace(text.String())
+			}
+			text.Reset()
+		}
+	}
+}
+
+// AssertDetection checks fields of Detection.xml, named as in
+// DetectionFields
+func (p *Package) AssertDetection(t testing.TB, want map[string]string) {
+	t.Helper()
+	fields, err := p.DetectionFields()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		got, ok := fields[name]
+		switch {
+		case !ok:
+			t.Errorf("Detection.xml has no %s", name)
+		case got != want[name]:
+			t.Errorf("Detection.xml %s = %q, expected %q", name, got, want[name])
+		}
+	}
+}
+
+// AssertFile checks the content of a packaged file
+func (p *Package) AssertFile(t testing.TB, name, want string) {
+	t.Helper()
+	got, ok := p.Files[name]
+	switch {
+	case !ok:
+		t.Errorf("Package has no file %s", name)
+	case string(got) != want:
+		t.Errorf("File %s = %q, expected %q", name, got, want)
+	}
+}
+
+// volatileElements match the Detection.xml values that change with every
+// build
+var volatileElements = regexp.MustCompile(`<(EncryptionKey|MacKey|InitializationVector|Mac|FileDigest)>[^<]*</`)
+
+// Golden returns the golden file content of the package: Detection.xml
+// with the keys, MAC and digest masked, followed by the path, size and
+// SHA256 of every packaged file
+func (p *Package) Golden() string {
+	var sb strings.Builder
+	sb.WriteString(volatileElements.ReplaceAllString(strings.ReplaceAll(string(p.DetectionXML), "\r\n", "\n"), "<$1>*</"))
+	sb.WriteString("\n\n")
+	names := make([]string, 0, len(p.Files))
+	for name := range p.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sum := sha256.Sum256(p.Files[name])
+		fmt.Fprintf(&sb, "%s %d %s\n", name, len(p.Files[name]), hex.EncodeToString(sum[:]))
+	}
+	return sb.String()
+}
+
+// AssertGolden compares Golden with the golden file at path, or writes
+// the file when UpdateEnv is set
+func (p *Package) AssertGolden(t testing.TB, path string) {
+	t.Helper()
+	got := p.Golden()
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create golden file folder: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("Failed to write golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file (run with %s=1 to create it): %v", UpdateEnv, err)
+	}
+	if got != strings.ReplaceAll(string(want), "\r\n", "\n") {
+		t.Errorf("Package does not match %s (run with %s=1 to update it):\n%s", path, UpdateEnv, got)
+	}
+}
@@ -0,0 +1,65 @@
+package openpackagetest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/MANCHTOOLS/open-package/packager"
+)
+
+// recorder records the errors of assertions that are expected to fail
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestBuildAndOpen(t *testing.T) {
+	path := Build(t, Fixture{
+		Name: "myapp",
+		Files: map[string]string{
+			"scripts/detect.ps1": "exit 0",
+		},
+		Options: func(opts *packager.Options) {
+			opts.ToolVersion = "1.8.6.0"
+		},
+	})
+	pkg := Open(t, path)
+
+	pkg.AssertDetection(t, map[string]string{
+		"Name":                "myapp",
+		"SetupFile":           DefaultSetupFile,
+		"ToolVersion":         "1.8.6.0",
+		"FileName":            "IntunePackage.intunewin",
+		"FileDigestAlgorithm": "SHA256",
+	})
+	pkg.AssertFile(t, "scripts/detect.ps1", "exit 0")
+	if _, ok := pkg.Files[DefaultSetupFile]; !ok {
+		t.Errorf("Expected the setup file to be added, got %v", pkg.Files)
+	}
+	pkg.AssertGolden(t, "testdata/myapp.golden")
+
+	r := &recorder{TB: t}
+	pkg.AssertDetection(r, map[string]string{"Name": "other", "Missing": "x"})
+	pkg.AssertFile(r, "scripts/detect.ps1", "exit 1")
+	pkg.AssertFile(r, "missing.txt", "")
+	if len(r.errors) != 4 {
+		t.Errorf("Expected 4 failed assertions, got %q", r.errors)
+	}
+}
+
+func TestGoldenMasksKeys(t *testing.T) {
+	fixture := Fixture{Files: map[string]string{"data.txt": "data"}}
+	first := Open(t, Build(t, fixture)).Golden()
+	second := Open(t, Build(t, fixture)).Golden()
+	if first != second {
+		t.Errorf("Expected builds of the same fixture to have the same golden content:\n%s\n%s", first, second)
+	}
+	if !strings.Contains(first, "<EncryptionKey>*</EncryptionKey>") || !strings.Contains(first, "data.txt 4 ") {
+		t.Errorf("Unexpected golden content:\n%s", first)
+	}
+}
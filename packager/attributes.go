@@ -0,0 +1,107 @@
+package packager
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// Supported values for Options.Timestamps
+const (
+	// TimestampsPreserve keeps the modification times of the source files
+	TimestampsPreserve = "preserve"
+	// TimestampsBuild sets all entries to the time of the build
+	TimestampsBuild = "build"
+	// TimestampsFixed sets all entries to Options.Timestamp, so that
+	// builds of the same files have the same timestamps
+	TimestampsFixed = "fixed"
+)
+
+// TimestampModes lists all supported timestamp modes
+var TimestampModes = []string{TimestampsPreserve, TimestampsBuild, TimestampsFixed}
+
+// Supported values for Options.Attributes
+const (
+	// AttributesPreserve keeps the permissions and the read-only, hidden
+	// and system attributes of the source files
+	AttributesPreserve = "preserve"
+	// AttributesNormalize writes all files as 0644 and all directories as
+	// 0755, without read-only, hidden or system attributes
+	AttributesNormalize = "normalize"
+)
+
+// AttributeModes lists all supported attribute modes
+var AttributeModes = []string{AttributesPreserve, AttributesNormalize}
+
+// DefaultTimestamp is the time of all entries with TimestampsFixed when
+// Options.Timestamp is not set: the earliest time a ZIP entry can carry
+var DefaultTimestamp = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// MS-DOS attributes in the low byte of zip.FileHeader.ExternalAttrs
+const (
+	dosReadOnly = 0x01
+	dosHidden   = 0x02
+	dosSystem   = 0x04
+)
+
+// checkEntryModes checks Options.Timestamps and Options.Attributes
+func checkEntryModes(opts Options) error {
+	if opts.Timestamps != "" && !contains(TimestampModes, opts.Timestamps) {
+		return fmt.Errorf("unsupported timestamp mode %q (supported: %s)", opts.Timestamps, strings.Join(TimestampModes, ", "))
+	}
+	if opts.Attributes != "" && !contains(AttributeModes, opts.Attributes) {
+		return fmt.Errorf("unsupported attribute mode %q (supported: %s)", opts.Attributes, strings.Join(AttributeModes, ", "))
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// setAttributes applies Options.Timestamps and Options.Attributes to the
+// header of an entry. info is the source file or directory, or nil for
+// entries that are not in the source, which get the build time unless
+// timestamps are fixed.
+func (p *Packager) setAttributes(header *zip.FileHeader, info os.FileInfo) {
+	switch {
+	case p.opts.Timestamps == TimestampsFixed && !p.opts.Timestamp.IsZero():
+		setModified(header, p.opts.Timestamp)
+	case p.opts.Timestamps == TimestampsFixed:
+		setModified(header, DefaultTimestamp)
+	case p.opts.Timestamps == TimestampsBuild || info == nil:
+		setModified(header, p.buildTime)
+	default:
+		setModified(header, info.ModTime())
+	}
+
+	if p.opts.Attributes == AttributesNormalize {
+		if header.Mode().IsDir() {
+			header.SetMode(fs.ModeDir | 0755)
+		} else {
+			header.SetMode(0644)
+		}
+		return
+	}
+	if info != nil {
+		header.ExternalAttrs |= dosAttributes(info) & (dosHidden | dosSystem)
+	}
+}
+
+// setModified sets the modification time of an entry in UTC, as
+// zip.FileInfoHeader does. The MS-DOS time is set as well, as raw entries
+// written by the pipeline workers carry only that.
+func setModified(header *zip.FileHeader, t time.Time) {
+	t = t.UTC()
+	header.Modified = t
+	header.ModifiedDate = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	header.ModifiedTime = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+}
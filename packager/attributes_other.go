@@ -0,0 +1,11 @@
+//go:build !windows
+
+package packager
+
+import "os"
+
+// dosAttributes returns the MS-DOS attributes of a file. Other platforms
+// only have the read-only attribute, which is part of the permissions.
+func dosAttributes(info os.FileInfo) uint32 {
+	return 0
+}
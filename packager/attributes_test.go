@@ -0,0 +1,93 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCreateInnerZipTimestampsAndAttributes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-attributes-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "data"), 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	modTime := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	for name, mode := range map[string]os.FileMode{"setup.exe": 0755, "data/readonly.txt": 0444} {
+		path := filepath.Join(sourceDir, name)
+		if err := os.WriteFile(path, []byte(name), mode); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set times of %s: %v", name, err)
+		}
+	}
+	defer os.Chmod(filepath.Join(sourceDir, "data", "readonly.txt"), 0644)
+
+	entries := func(opts Options) map[string]*zip.File {
+		data, err := New(opts).createInnerZip()
+		if err != nil {
+			t.Fatalf("createInnerZip failed: %v", err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("Inner ZIP is not valid: %v", err)
+		}
+		files := make(map[string]*zip.File)
+		for _, f := range zr.File {
+			files[f.Name] = f
+		}
+		return files
+	}
+
+	for _, workers := range []int{1, 4} {
+		opts := Options{SourceDir: sourceDir, SetupFile: "setup.exe", Quiet: true, Workers: workers}
+
+		files := entries(opts)
+		if got := files["app/setup.exe"].Modified; !got.Equal(modTime) {
+			t.Errorf("workers %d: expected the source time to be preserved, got %v", workers, got)
+		}
+		if files["app/data/readonly.txt"].ExternalAttrs&dosReadOnly == 0 {
+			t.Errorf("workers %d: expected the read-only attribute to be preserved", workers)
+		}
+
+		opts.Timestamps = TimestampsFixed
+		opts.Attributes = AttributesNormalize
+		files = entries(opts)
+		for name, f := range files {
+			if !f.Modified.Equal(DefaultTimestamp) {
+				t.Errorf("workers %d: expected %s to have the default timestamp, got %v", workers, name, f.Modified)
+			}
+		}
+		if f := files["app/data/readonly.txt"]; f.ExternalAttrs&dosReadOnly != 0 || f.Mode().Perm() != 0644 {
+			t.Errorf("workers %d: expected normalized attributes, got %v", workers, f.Mode())
+		}
+		if f := files["app/data/"]; f.Mode().Perm() != 0755 || !f.Mode().IsDir() {
+			t.Errorf("workers %d: expected a normalized directory, got %v", workers, f.Mode())
+		}
+
+		opts.Timestamp = time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC)
+		if got := entries(opts)["app/setup.exe"].Modified; !got.Equal(opts.Timestamp) {
+			t.Errorf("workers %d: expected the fixed timestamp, got %v", workers, got)
+		}
+
+		opts.Timestamps = TimestampsBuild
+		before := time.Now().Add(-2 * time.Second)
+		if got := entries(opts)["app/setup.exe"].Modified; got.Before(before) {
+			t.Errorf("workers %d: expected the build time, got %v", workers, got)
+		}
+	}
+
+	p := New(Options{SourceDir: sourceDir, SetupFile: "setup.exe", Quiet: true, OutputDir: tempDir, Timestamps: "now"})
+	if _, err := p.CreatePackage(); err == nil {
+		t.Error("Expected error for an unsupported timestamp mode")
+	}
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package packager
+
+import (
+	"os"
+	"syscall"
+)
+
+// dosAttributes returns the MS-DOS attributes of a file
+func dosAttributes(info os.FileInfo) uint32 {
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return 0
+	}
+	var dos uint32
+	if attrs.FileAttributes&syscall.FILE_ATTRIBUTE_READONLY != 0 {
+		dos |= dosReadOnly
+	}
+	if attrs.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0 {
+		dos |= dosHidden
+	}
+	if attrs.FileAttributes&syscall.FILE_ATTRIBUTE_SYSTEM != 0 {
+		dos |= dosSystem
+	}
+	return dos
+}
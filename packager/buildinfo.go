@@ -0,0 +1,94 @@
+package packager
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+// DefaultBuildTool is the tool recorded in the build info without
+// Options.BuildTool
+const DefaultBuildTool = "open-package"
+
+// BuildInfo returns the build info stamped into the last package, or nil
+// without Options.BuildInfo
+func (p *Packager) BuildInfo() *metadata.BuildInfo {
+	return p.buildInfo
+}
+
+// newBuildInfo returns the build info of a package with the source digest
+func (p *Packager) newBuildInfo(sourceSHA256 string) *metadata.BuildInfo {
+	tool := p.opts.BuildTool
+	if tool == "" {
+		tool = DefaultBuildTool
+	}
+	return &metadata.BuildInfo{
+		Tool:         tool,
+		JobID:        p.opts.JobID,
+		SourceSHA256: sourceSHA256,
+		Created:      time.Now().UTC(),
+	}
+}
+
+// innerBuildInfo returns the build info stamped into an inner ZIP, or nil
+func innerBuildInfo(innerZip io.ReaderAt, size int64) *metadata.BuildInfo {
+	zr, err := zip.NewReader(innerZip, size)
+	if err != nil {
+		return nil
+	}
+	info, _ := metadata.ParseBuildInfo(zr.Comment)
+	return info
+}
+
+// sourceDigest collects the hashes of the files written to the inner ZIP,
+// for the build info and the duplicate content report
+type sourceDigest struct {
+	mu    sync.Mutex
+	files []digestFile
+}
+
+// digestFile is a file of a sourceDigest
+type digestFile struct {
+	path   string
+	size   int
+	sha256 string
+}
+
+// add hashes the content of an inner ZIP entry. It is safe for concurrent
+// use by the pipeline workers.
+func (d *sourceDigest) add(archivePath string, content []byte) {
+	sum := sha256.Sum256(content)
+	d.addSum(archivePath, int64(len(content)), sum[:])
+}
+
+// addSum records an inner ZIP entry hashed while it was streamed
+func (d *sourceDigest) addSum(archivePath string, size int64, sum []byte) {
+	// The source folder name that prefixes all entries is not part of the
+	// digest, as with changes.FromInnerZip
+	_, path, _ := strings.Cut(archivePath, "/")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.files = append(d.files, digestFile{path: path, size: int(size), sha256: hex.EncodeToString(sum)})
+}
+
+// sum returns the digest in the format of changes.Manifest.Digest, so that
+// it matches the source digest recorded in the build registry
+func (d *sourceDigest) sum() string {
+	sort.Slice(d.files, func(i, j int) bool {
+		return d.files[i].path < d.files[j].path
+	})
+	h := sha256.New()
+	for _, f := range d.files {
+		fmt.Fprintf(h, "%s\x00%d\x00%s\n", f.path, f.size, f.sha256)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
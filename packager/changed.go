@@ -0,0 +1,71 @@
+package packager
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ChangedFileError is returned when a source file keeps changing while it
+// is being packaged
+type ChangedFileError struct {
+	// Path is the archive path of the file
+	Path string
+	// Before and After are the file states around the last read
+	Before, After os.FileInfo
+	// Read is the number of bytes read
+	Read int64
+}
+
+// Error describes the change
+func (e *ChangedFileError) Error() string {
+	return fmt.Sprintf("%s changed while being packaged (size %d -> %d bytes, %d bytes read, modified %s -> %s)",
+		e.Path, e.Before.Size(), e.After.Size(), e.Read,
+		e.Before.ModTime().Format("2006-01-02 15:04:05.000"), e.After.ModTime().Format("2006-01-02 15:04:05.000"))
+}
+
+// sourceFile is an opened source file
+type sourceFile interface {
+	io.ReadSeeker
+	Stat() (os.FileInfo, error)
+}
+
+// readSourceFile streams a source file to the writer returned by create,
+// which is called with the file state before every read, and checks that
+// its size and modification time did not change during the read. Changed
+// files are read again up to Options.ChangedFileRetries times, so create
+// must discard what was written by an earlier read. It returns the file
+// state the content belongs to and the SHA256 digest of the content.
+func (p *Packager) readSourceFile(file sourceFile, archivePath string, create func(os.FileInfo) (io.Writer, error)) (os.FileInfo, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		before, err := file.Stat()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to stat %s: %w", archivePath, err)
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", archivePath, err)
+		}
+		w, err := create(before)
+		if err != nil {
+			return nil, nil, err
+		}
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(w, h), file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to write %s: %w", archivePath, err)
+		}
+		after, err := file.Stat()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to stat %s: %w", archivePath, err)
+		}
+
+		if before.Size() == after.Size() && before.ModTime().Equal(after.ModTime()) && n == after.Size() {
+			return after, h.Sum(nil), nil
+		}
+		if attempt >= p.opts.ChangedFileRetries {
+			return nil, nil, &ChangedFileError{Path: archivePath, Before: before, After: after, Read: n}
+		}
+		p.log("  %s changed while being read, reading again", archivePath)
+	}
+}
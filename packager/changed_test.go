@@ -0,0 +1,150 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MANCHTOOLS/open-package/tempfiles"
+)
+
+// growingFile is a source file that grows by one byte on each of its
+// first growths reads
+type growingFile struct {
+	Reader  *bytes.Reader
+	content []byte
+	growths int
+}
+
+func (f *growingFile) Seek(offset int64, whence int) (int64, error) {
+	return f.Reader.Seek(offset, whence)
+}
+
+func (f *growingFile) Read(b []byte) (int, error) {
+	n, err := f.Reader.Read(b)
+	if err != nil && f.growths > 0 {
+		f.growths--
+		f.content = append(f.content, 'x')
+		f.Reader = bytes.NewReader(f.content)
+	}
+	return n, err
+}
+
+func (f *growingFile) Stat() (os.FileInfo, error) {
+	return fakeFileInfo{size: int64(len(f.content))}, nil
+}
+
+type fakeFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (fi fakeFileInfo) Size() int64        { return fi.size }
+func (fi fakeFileInfo) ModTime() time.Time { return time.Unix(int64(fi.size), 0) }
+
+// recorder is the destination of readSourceFile, which counts the reads
+type recorder struct {
+	content bytes.Buffer
+	reads   int
+}
+
+func (r *recorder) create(os.FileInfo) (io.Writer, error) {
+	r.reads++
+	r.content.Reset()
+	return &r.content, nil
+}
+
+func TestReadSourceFileChanged(t *testing.T) {
+	// Stable files are read once
+	p := New(Options{Quiet: true})
+	var out recorder
+	info, sum, err := p.readSourceFile(&growingFile{Reader: bytes.NewReader([]byte("abc")), content: []byte("abc")}, "app/a.txt", out.create)
+	if err != nil || out.content.String() != "abc" || out.reads != 1 || info.Size() != 3 {
+		t.Fatalf("Unexpected result: %q, %d reads, %v", out.content.String(), out.reads, err)
+	}
+	if expected := sha256.Sum256([]byte("abc")); !bytes.Equal(sum, expected[:]) {
+		t.Errorf("Unexpected digest %x", sum)
+	}
+
+	// A file that changes during every read fails with a precise error
+	file := &growingFile{Reader: bytes.NewReader([]byte("abc")), content: []byte("abc"), growths: 5}
+	out = recorder{}
+	_, _, err = p.readSourceFile(file, "app/build.log", out.create)
+	var changed *ChangedFileError
+	if !errors.As(err, &changed) {
+		t.Fatalf("Expected ChangedFileError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "app/build.log changed while being packaged (size 3 -> 4 bytes") {
+		t.Errorf("Unexpected message: %v", err)
+	}
+
+	// With retries, the file is read again once it is stable
+	p = New(Options{Quiet: true, ChangedFileRetries: 2})
+	file = &growingFile{Reader: bytes.NewReader([]byte("abc")), content: []byte("abc"), growths: 1}
+	out = recorder{}
+	info, _, err = p.readSourceFile(file, "app/build.log", out.create)
+	if err != nil || out.content.String() != "abcx" || out.reads != 2 || info.Size() != 4 {
+		t.Errorf("Unexpected result after retry: %q, %d reads, %v", out.content.String(), out.reads, err)
+	}
+}
+
+func TestLargeSourceFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-large-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Incompressible content over spoolThreshold
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	content := make([]byte, spoolThreshold+1000)
+	rand.New(rand.NewSource(1)).Read(content)
+	for name, data := range map[string][]byte{"setup.exe": content, "small.txt": []byte("small")} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	// Streamed into the entry, compressed and spooled with retries, and
+	// spooled by the workers
+	for _, opts := range []Options{
+		{},
+		{ChangedFileRetries: 2},
+		{Workers: 4},
+	} {
+		temp := tempfiles.New(false, nil)
+		opts.SourceDir, opts.SetupFile, opts.Quiet, opts.Temp = sourceDir, "setup.exe", true, temp
+		p := New(opts)
+		innerZip, err := p.createInnerZip()
+		if err != nil {
+			t.Fatalf("createInnerZip failed with %+v: %v", opts, err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(innerZip), int64(len(innerZip)))
+		if err != nil {
+			t.Fatalf("Invalid ZIP: %v", err)
+		}
+		rc, err := zr.Open("app/setup.exe")
+		if err != nil {
+			t.Fatalf("Failed to open setup.exe: %v", err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(data, content) {
+			t.Errorf("Unexpected content with %+v: %d bytes, %v", opts, len(data), err)
+		}
+		if paths := temp.Paths(); len(paths) != 0 {
+			t.Errorf("Expected spool files to be removed, got %v", paths)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package packager
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DownloadScriptName is the setup file of a download wrapper package
+const DownloadScriptName = "install.ps1"
+
+// Download is a payload that is downloaded at install time instead of
+// being packaged, for content that exceeds the Intune limits
+type Download struct {
+	// URL is the HTTPS address of the payload
+	URL string
+	// SHA256 is the hex SHA256 digest the payload is verified against
+	SHA256 string
+	// FileName is the name the payload is saved as (optional, defaults to
+	// the last segment of the URL path)
+	FileName string
+	// Command is the install command, run with cmd.exe in the download
+	// folder. ZIP payloads are extracted into that folder first. Optional
+	// for MSI payloads, which default to a silent msiexec install.
+	Command string
+}
+
+// fileName returns the name the payload is saved as
+func (d Download) fileName() string {
+	if d.FileName != "" {
+		return d.FileName
+	}
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	return name
+}
+
+// command returns the install command of the payload
+func (d Download) command() string {
+	if d.Command == "" && strings.EqualFold(filepath.Ext(d.fileName()), ".msi") {
+		return fmt.Sprintf(`msiexec /i "%s" /qn /norestart`, d.fileName())
+	}
+	return d.Command
+}
+
+// Validate checks that the download can be generated
+func (d Download) Validate() error {
+	u, err := url.Parse(d.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("download URL %q must be an https URL", d.URL)
+	}
+	if sum, err := hex.DecodeString(d.SHA256); err != nil || len(sum) != 32 {
+		return fmt.Errorf("invalid SHA256 digest %q", d.SHA256)
+	}
+	name := d.fileName()
+	if name == "" || sanitizeName(name) != name {
+		return fmt.Errorf("invalid download file name %q", name)
+	}
+	if d.command() == "" {
+		return fmt.Errorf("an install command is required for %s", name)
+	}
+	return nil
+}
+
+// downloadScript returns a PowerShell script that downloads the payload
+// into a temporary folder, verifies its digest and runs the install command.
+// The script exits with the exit code of the command.
+func downloadScript(d Download) string {
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+
+	return strings.Join([]string{
+		"# Downloads " + d.fileName() + " at install time",
+		"$ErrorActionPreference = 'Stop'",
+		"$ProgressPreference = 'SilentlyContinue'",
+		"$url = " + quote(d.URL),
+		"$sha256 = " + quote(strings.ToUpper(d.SHA256)),
+		"$command = " + quote(d.command()),
+		"$dir = Join-Path $env:TEMP ('open-package-' + [guid]::NewGuid())",
+		"New-Item -ItemType Directory -Path $dir | Out-Null",
+		"try {",
+		"    $file = Join-Path $dir " + quote(d.fileName()),
+		"    [Net.ServicePointManager]::SecurityProtocol = [Net.SecurityProtocolType]::Tls12",
+		"    Invoke-WebRequest -Uri $url -OutFile $file -UseBasicParsing",
+		"    $actual = (Get-FileHash -Path $file -Algorithm SHA256).Hash",
+		"    if ($actual -ne $sha256) { throw \"SHA256 mismatch for ${url}: expected $sha256, got $actual\" }",
+		"    if ($file -like '*.zip') { Expand-Archive -Path $file -DestinationPath $dir }",
+		"    $process = Start-Process -FilePath 'cmd.exe' -ArgumentList ('/c ' + $command) -WorkingDirectory $dir -Wait -PassThru -NoNewWindow",
+		"    exit $process.ExitCode",
+		"} finally {",
+		"    Remove-Item -Path $dir -Recurse -Force -ErrorAction SilentlyContinue",
+		"}",
+		"",
+	}, "\r\n")
+}
+
+// CreateDownloadPackage creates a small package that contains only a
+// script downloading and installing d at install time. The package is
+// named after Options.Name (or the source folder name); the source folder
+// itself is not packaged. It returns the output path.
+func (p *Packager) CreateDownloadPackage(d Download) (string, error) {
+	if err := d.Validate(); err != nil {
+		return "", err
+	}
+	appName := p.appName()
+	if appName == "" || appName == "." {
+		return "", fmt.Errorf("a name is required for the download package")
+	}
+
+	tempDir, err := p.opts.Temp.Dir("open-package-download-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer p.opts.Temp.Release(tempDir)
+
+	stagingDir := filepath.Join(tempDir, appName)
+	if err := os.Mkdir(stagingDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(stagingDir, DownloadScriptName), []byte(downloadScript(d)), 0644); err != nil {
+		return "", fmt.Errorf("failed to write download script: %w", err)
+	}
+
+	opts := p.opts
+	opts.SourceDir = stagingDir
+	opts.Sources = nil
+	opts.Rewrites = nil
+	opts.Generated = nil
+	opts.Sandbox = nil
+	opts.SetupFile = DownloadScriptName
+	opts.MSIXWrapper = false
+	p.log("Creating download package for %s...", d.URL)
+	return New(opts).CreatePackage()
+}
@@ -0,0 +1,77 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDigest = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func TestDownloadValidate(t *testing.T) {
+	valid := Download{URL: "https://cdn.contoso.com/media/app.msi", SHA256: testDigest}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected MSI download to be valid: %v", err)
+	}
+	if cmd := valid.command(); cmd != `msiexec /i "app.msi" /qn /norestart` {
+		t.Errorf("Unexpected MSI command: %s", cmd)
+	}
+
+	tests := map[string]Download{
+		"http URL":          {URL: "http://cdn.contoso.com/app.msi", SHA256: testDigest},
+		"short digest":      {URL: "https://cdn.contoso.com/app.msi", SHA256: "e3b0c442"},
+		"no file name":      {URL: "https://cdn.contoso.com/", SHA256: testDigest, Command: "setup.exe /S"},
+		"invalid file name": {URL: "https://cdn.contoso.com/x", SHA256: testDigest, FileName: "a/b.exe", Command: "b.exe"},
+		"no command":        {URL: "https://cdn.contoso.com/setup.exe", SHA256: testDigest},
+	}
+	for name, d := range tests {
+		if err := d.Validate(); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func TestCreateDownloadPackage(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-download-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	d := Download{
+		URL:     "https://cdn.contoso.com/media/cad-suite.zip?sig=a'b",
+		SHA256:  testDigest,
+		Command: `setup.exe /quiet /log "%TEMP%\cad.log"`,
+	}
+	script := downloadScript(d)
+	for _, expected := range []string{
+		"$url = 'https://cdn.contoso.com/media/cad-suite.zip?sig=a''b'",
+		"$sha256 = '" + strings.ToUpper(testDigest) + "'",
+		"Join-Path $dir 'cad-suite.zip'",
+		`$command = 'setup.exe /quiet /log "%TEMP%\cad.log"'`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("Script does not contain %q:\n%s", expected, script)
+		}
+	}
+
+	if _, err := New(Options{OutputDir: tempDir, Quiet: true}).CreateDownloadPackage(d); err == nil {
+		t.Error("Expected error without a name")
+	}
+
+	outputPath, err := New(Options{OutputDir: tempDir, Quiet: true, Name: "CAD Suite"}).CreateDownloadPackage(d)
+	if err != nil {
+		t.Fatalf("CreateDownloadPackage failed: %v", err)
+	}
+	if filepath.Base(outputPath) != "CAD Suite.intunewin" {
+		t.Errorf("Unexpected output name: %s", filepath.Base(outputPath))
+	}
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		t.Fatalf("Package not created: %v", err)
+	}
+	if info.Size() > 16<<10 {
+		t.Errorf("Expected a small package, got %d bytes", info.Size())
+	}
+}
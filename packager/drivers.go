@@ -0,0 +1,265 @@
+package packager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// oidSignedData is the PKCS #7 content type of catalog files
+var oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+// Driver is a driver package found in the source folder. Paths are
+// relative to the source folder, with forward slashes.
+type Driver struct {
+	// INF is the setup information file of the driver. It is empty for
+	// driver binaries without an INF file in their folder.
+	INF string `json:"inf,omitempty"`
+	// Catalogs are the catalog files the INF names in its [Version] section
+	Catalogs []string `json:"catalogs,omitempty"`
+	// Signed reports whether all catalogs are present and carry a signature.
+	// Signatures are not verified.
+	Signed bool `json:"signed"`
+	// Binaries are the .sys files in the folder of the driver
+	Binaries []string `json:"binaries,omitempty"`
+	// Problems are the findings that keep the driver from installing
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Drivers returns the driver packages found by the last CreatePackage call
+func (p *Packager) Drivers() []Driver {
+	return p.drivers
+}
+
+// checkDrivers finds the driver packages of the source folder and warns
+// about their problems. Drivers in Win32 apps are only installed when the
+// install command stages them, e.g. with pnputil /add-driver.
+func (p *Packager) checkDrivers() error {
+	drivers, err := FindDrivers(p.opts.SourceDir)
+	if err != nil {
+		return p.warn(WarnDriverCheck, "cannot check driver packages: %v", err)
+	}
+	p.drivers = drivers
+	if len(drivers) == 0 {
+		return nil
+	}
+	p.log("  Driver packages: %d (install them with pnputil /add-driver <inf> /install)", len(drivers))
+	for _, d := range drivers {
+		name := d.INF
+		if name == "" {
+			name = strings.Join(d.Binaries, ", ")
+		}
+		for _, problem := range d.Problems {
+			if err := p.warn(WarnDriver, "driver %s: %s", name, problem); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FindDrivers finds the driver packages of a source folder: every INF file
+// with the catalogs it names, and .sys files in folders without INF file.
+// Junk and hidden files are skipped.
+func FindDrivers(sourceDir string) ([]Driver, error) {
+	type driverDir struct {
+		infs     []string
+		binaries []string
+		files    map[string]string
+	}
+	dirs := make(map[string]*driverDir)
+	err := walkDir(sourceDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sourceDir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if IsExcluded(d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		dir := dirs[path.Dir(rel)]
+		if dir == nil {
+			dir = &driverDir{files: make(map[string]string)}
+			dirs[path.Dir(rel)] = dir
+		}
+		// Catalog names in INF files are case-insensitive
+		dir.files[strings.ToLower(d.Name())] = rel
+		switch strings.ToLower(path.Ext(rel)) {
+		case ".inf":
+			dir.infs = append(dir.infs, rel)
+		case ".sys":
+			dir.binaries = append(dir.binaries, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var drivers []Driver
+	for _, dir := range dirs {
+		if len(dir.infs) == 0 {
+			if len(dir.binaries) > 0 {
+				drivers = append(drivers, Driver{
+					Binaries: dir.binaries,
+					Problems: []string{"driver binaries without INF file cannot be installed with pnputil"},
+				})
+			}
+			continue
+		}
+		for _, inf := range dir.infs {
+			driver := Driver{INF: inf, Binaries: dir.binaries, Signed: true}
+			catalogs, err := infCatalogs(filepath.Join(sourceDir, filepath.FromSlash(inf)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", inf, err)
+			}
+			if len(catalogs) == 0 {
+				driver.Signed = false
+				driver.Problems = append(driver.Problems, "the INF file names no catalog file, Windows does not install unsigned driver packages")
+			}
+			for _, catalog := range catalogs {
+				rel, ok := dir.files[strings.ToLower(catalog)]
+				if !ok {
+					driver.Signed = false
+					driver.Catalogs = append(driver.Catalogs, path.Join(path.Dir(inf), catalog))
+					driver.Problems = append(driver.Problems, fmt.Sprintf("catalog file %s is missing", catalog))
+					continue
+				}
+				driver.Catalogs = append(driver.Catalogs, rel)
+				signed, err := isSignedCatalog(filepath.Join(sourceDir, filepath.FromSlash(rel)))
+				if err != nil {
+					driver.Signed = false
+					driver.Problems = append(driver.Problems, fmt.Sprintf("catalog file %s is invalid: %v", catalog, err))
+					continue
+				}
+				if !signed {
+					driver.Signed = false
+					driver.Problems = append(driver.Problems, fmt.Sprintf("catalog file %s is not signed", catalog))
+				}
+			}
+			drivers = append(drivers, driver)
+		}
+	}
+	sort.Slice(drivers, func(i, j int) bool {
+		return driverKey(drivers[i]) < driverKey(drivers[j])
+	})
+	return drivers, nil
+}
+
+// driverKey is the path drivers are sorted by
+func driverKey(d Driver) string {
+	if d.INF != "" {
+		return d.INF
+	}
+	return d.Binaries[0]
+}
+
+// infCatalogs returns the catalog files named by the CatalogFile entries
+// (including the platform variants like CatalogFile.NTamd64) of the
+// [Version] section of an INF file. INF files are ANSI or UTF-16.
+func infCatalogs(infPath string) ([]string, error) {
+	data, err := os.ReadFile(infPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE {
+		units := make([]uint16, (len(data)-2)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(data[2+2*i:])
+		}
+		data = []byte(string(utf16.Decode(units)))
+	}
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+
+	var catalogs []string
+	seen := make(map[string]bool)
+	inVersion := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inVersion = strings.EqualFold(strings.Trim(line, "[] \t"), "Version")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !inVersion || !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key != "catalogfile" && !strings.HasPrefix(key, "catalogfile.") {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		if value != "" && !seen[strings.ToLower(value)] {
+			seen[strings.ToLower(value)] = true
+			catalogs = append(catalogs, value)
+		}
+	}
+	return catalogs, scanner.Err()
+}
+
+// isSignedCatalog reports whether a catalog file is a PKCS #7 signed data
+// structure with at least one signer. Signatures are not verified.
+func isSignedCatalog(catalogPath string) (bool, error) {
+	data, err := os.ReadFile(catalogPath)
+	if err != nil {
+		return false, err
+	}
+	var content struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(data, &content); err != nil {
+		return false, fmt.Errorf("not a PKCS #7 structure")
+	}
+	if !content.ContentType.Equal(oidSignedData) {
+		return false, fmt.Errorf("not a PKCS #7 signed data structure")
+	}
+	// The signed data is wrapped in an explicit [0] tag
+	var signedData asn1.RawValue
+	if content.Content.Class != asn1.ClassContextSpecific || content.Content.Tag != 0 {
+		return false, fmt.Errorf("invalid signed data")
+	}
+	if _, err := asn1.Unmarshal(content.Content.Bytes, &signedData); err != nil || signedData.Tag != asn1.TagSequence {
+		return false, fmt.Errorf("invalid signed data")
+	}
+
+	// The signer infos are the last field of the signed data sequence,
+	// after the optional certificates and CRLs
+	var field asn1.RawValue
+	fields := 0
+	for rest := signedData.Bytes; len(rest) > 0; fields++ {
+		if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+			return false, fmt.Errorf("invalid signed data: %w", err)
+		}
+	}
+	if fields < 4 {
+		return false, fmt.Errorf("invalid signed data")
+	}
+	return field.Class == asn1.ClassUniversal && field.Tag == asn1.TagSet && len(field.Bytes) > 0, nil
+}
@@ -0,0 +1,143 @@
+package packager
+
+import (
+	"encoding/asn1"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// testCatalog returns a PKCS #7 signed data structure with the given
+// number of signer infos
+func testCatalog(t *testing.T, signers int) []byte {
+	t.Helper()
+	marshal := func(v interface{}) []byte {
+		data, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatalf("Failed to marshal catalog: %v", err)
+		}
+		return data
+	}
+	var signerInfos []byte
+	for i := 0; i < signers; i++ {
+		signerInfos = append(signerInfos, marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: marshal(1)})...)
+	}
+	fields := marshal(1)
+	fields = append(fields, marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true})...)
+	fields = append(fields, marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: marshal(asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 1})})...)
+	fields = append(fields, marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: signerInfos})...)
+	signedData := marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: fields})
+	return marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+}
+
+// utf16INF encodes an INF file as UTF-16 with byte order mark
+func utf16INF(s string) []byte {
+	data := []byte{0xFF, 0xFE}
+	for _, u := range utf16.Encode([]rune(s)) {
+		data = binary.LittleEndian.AppendUint16(data, u)
+	}
+	return data
+}
+
+func TestFindDrivers(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-drivers-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	files := map[string][]byte{
+		"setup.exe":           []byte("setup"),
+		"signed/net.inf":      []byte("[Version]\r\nSignature=\"$WINDOWS NT$\"\r\nCatalogFile.NTamd64 = NET.CAT ; amd64 catalog\r\n\r\n[Strings]\r\nCatalogFile=other.cat\r\n"),
+		"signed/net.cat":      testCatalog(t, 1),
+		"signed/net.sys":      []byte("driver"),
+		"unsigned/usb.inf":    utf16INF("[Version]\r\nCatalogFile=usb.cat\r\n"),
+		"unsigned/usb.cat":    testCatalog(t, 0),
+		"missing/disk.inf":    []byte("[Version]\r\nCatalogFile=disk.cat\r\n"),
+		"nocatalog/audio.inf": []byte("[Version]\r\nClass=Media\r\n"),
+		"invalid/hid.inf":     []byte("[Version]\r\nCatalogFile=hid.cat\r\n"),
+		"invalid/hid.cat":     []byte("not a catalog"),
+		"orphan/filter.sys":   []byte("driver"),
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	drivers, err := FindDrivers(tempDir)
+	if err != nil {
+		t.Fatalf("FindDrivers failed: %v", err)
+	}
+	tests := []struct {
+		key      string
+		signed   bool
+		catalogs string
+		problem  string
+	}{
+		{"invalid/hid.inf", false, "invalid/hid.cat", "is invalid"},
+		{"missing/disk.inf", false, "missing/disk.cat", "disk.cat is missing"},
+		{"nocatalog/audio.inf", false, "", "names no catalog file"},
+		{"orphan/filter.sys", false, "", "without INF file"},
+		{"signed/net.inf", true, "signed/net.cat", ""},
+		{"unsigned/usb.inf", false, "unsigned/usb.cat", "usb.cat is not signed"},
+	}
+	if len(drivers) != len(tests) {
+		t.Fatalf("Expected %d drivers, got %d: %+v", len(tests), len(drivers), drivers)
+	}
+	for i, tt := range tests {
+		d := drivers[i]
+		if driverKey(d) != tt.key {
+			t.Errorf("Driver %d = %s, expected %s", i, driverKey(d), tt.key)
+			continue
+		}
+		if d.Signed != tt.signed {
+			t.Errorf("%s: signed = %v, expected %v", tt.key, d.Signed, tt.signed)
+		}
+		if got := strings.Join(d.Catalogs, ","); got != tt.catalogs {
+			t.Errorf("%s: catalogs = %q, expected %q", tt.key, got, tt.catalogs)
+		}
+		problems := strings.Join(d.Problems, "; ")
+		if tt.problem == "" && problems != "" || !strings.Contains(problems, tt.problem) {
+			t.Errorf("%s: problems = %q, expected %q", tt.key, problems, tt.problem)
+		}
+	}
+	if got := strings.Join(drivers[4].Binaries, ","); got != "signed/net.sys" {
+		t.Errorf("Binaries = %q, expected signed/net.sys", got)
+	}
+
+	// Problems are warnings, or errors in strict mode
+	outputDir := filepath.Join(tempDir, "..", filepath.Base(tempDir)+"-out")
+	defer os.RemoveAll(outputDir)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output dir: %v", err)
+	}
+	p := New(Options{SourceDir: tempDir, SetupFile: "setup.exe", OutputDir: outputDir, Quiet: true})
+	if _, err := p.CreatePackage(); err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	if len(p.Drivers()) != len(tests) {
+		t.Errorf("Expected %d drivers, got %d", len(tests), len(p.Drivers()))
+	}
+	warnings := strings.Join(p.Warnings(), "\n")
+	if !strings.Contains(warnings, "driver unsigned/usb.inf: catalog file usb.cat is not signed") {
+		t.Errorf("Expected warning for the unsigned catalog, got: %s", warnings)
+	}
+	strict := New(Options{SourceDir: tempDir, SetupFile: "setup.exe", OutputDir: outputDir, Quiet: true, Strict: true})
+	if _, err := strict.CreatePackage(); err == nil {
+		t.Error("Expected error for driver problems in strict mode")
+	}
+}
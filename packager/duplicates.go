@@ -0,0 +1,69 @@
+package packager
+
+import "sort"
+
+// Duplicate is content packaged under several paths, e.g. copies of the
+// same runtime in vendor media
+type Duplicate struct {
+	// Paths lists the copies relative to the source folder
+	Paths []string `json:"paths"`
+	// Size is the size of one copy in bytes
+	Size int64 `json:"size"`
+}
+
+// Wasted returns the size of all copies but one
+func (d Duplicate) Wasted() int64 {
+	return d.Size * int64(len(d.Paths)-1)
+}
+
+// Duplicates returns the content of the last CreatePackage call that is
+// packaged more than once, most wasted size first. Empty files are not
+// reported.
+func (p *Packager) Duplicates() []Duplicate {
+	return p.duplicates
+}
+
+// WastedSize returns the total size of the extra copies of duplicates
+func WastedSize(duplicates []Duplicate) int64 {
+	var wasted int64
+	for _, d := range duplicates {
+		wasted += d.Wasted()
+	}
+	return wasted
+}
+
+// duplicates groups the collected files by content
+func (d *sourceDigest) duplicates() []Duplicate {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	byContent := make(map[string]*Duplicate)
+	var order []string
+	for _, f := range d.files {
+		if f.size == 0 {
+			continue
+		}
+		dup, ok := byContent[f.sha256]
+		if !ok {
+			dup = &Duplicate{Size: int64(f.size)}
+			byContent[f.sha256] = dup
+			order = append(order, f.sha256)
+		}
+		dup.Paths = append(dup.Paths, f.path)
+	}
+
+	var duplicates []Duplicate
+	for _, sum := range order {
+		if dup := byContent[sum]; len(dup.Paths) > 1 {
+			sort.Strings(dup.Paths)
+			duplicates = append(duplicates, *dup)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].Wasted() != duplicates[j].Wasted() {
+			return duplicates[i].Wasted() > duplicates[j].Wasted()
+		}
+		return duplicates[i].Paths[0] < duplicates[j].Paths[0]
+	})
+	return duplicates
+}
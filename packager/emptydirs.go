@@ -0,0 +1,83 @@
+package packager
+
+import (
+	"archive/zip"
+	"strings"
+)
+
+// EmptyDirs returns the directories of the last CreatePackage call that
+// contain no files, relative to the source folder. They are included in
+// the inner ZIP unless Options.PruneEmptyDirs is set.
+func (p *Packager) EmptyDirs() []string {
+	return p.emptyDirs
+}
+
+// dirTracker finds the directories of the inner ZIP that contain no files.
+// With prune set, directory entries are only written once a file below
+// them is written, so that empty directories are left out.
+type dirTracker struct {
+	zw      *zip.Writer
+	baseDir string
+	prune   bool
+	pending []*trackedDir
+	empty   []string
+}
+
+type trackedDir struct {
+	header   *zip.FileHeader
+	written  bool
+	hasFiles bool
+}
+
+// addDir records a directory entry, writing it unless empty directories
+// are pruned
+func (d *dirTracker) addDir(header *zip.FileHeader) error {
+	dir := &trackedDir{header: header}
+	if !d.prune {
+		if _, err := d.zw.CreateHeader(header); err != nil {
+			return err
+		}
+		dir.written = true
+	}
+	d.pending = append(d.pending, dir)
+	return nil
+}
+
+// addFile marks the directories containing archivePath as non-empty and
+// writes their pending entries. Directories the walk has left without
+// finding files are empty.
+func (d *dirTracker) addFile(archivePath string) error {
+	remaining := d.pending[:0]
+	for _, dir := range d.pending {
+		if !strings.HasPrefix(archivePath, dir.header.Name) {
+			d.finish(dir)
+			continue
+		}
+		if !dir.written {
+			if _, err := d.zw.CreateHeader(dir.header); err != nil {
+				return err
+			}
+			dir.written = true
+		}
+		dir.hasFiles = true
+		remaining = append(remaining, dir)
+	}
+	d.pending = remaining
+	return nil
+}
+
+// close finishes all remaining directories
+func (d *dirTracker) close() {
+	for _, dir := range d.pending {
+		d.finish(dir)
+	}
+	d.pending = nil
+}
+
+// finish records a directory without files as empty
+func (d *dirTracker) finish(dir *trackedDir) {
+	if !dir.hasFiles {
+		name := strings.TrimSuffix(strings.TrimPrefix(dir.header.Name, d.baseDir+"/"), "/")
+		d.empty = append(d.empty, name)
+	}
+}
@@ -0,0 +1,163 @@
+package packager
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DefaultSampleSize is the amount of source data compressed by Estimate
+const DefaultSampleSize = 32 << 20
+
+// Approximate ZIP overhead used by Estimate
+const (
+	// entryOverhead is the size of the local and central directory
+	// headers, extended timestamps and data descriptor of an entry,
+	// excluding its name (which is stored twice)
+	entryOverhead = 30 + 9 + 16 + 46 + 9
+	// metadataOverhead covers Detection.xml and the outer ZIP headers
+	metadataOverhead = 1 << 10
+)
+
+// SizeEstimate is the predicted size of a package
+type SizeEstimate struct {
+	// Files and Dirs count the entries of the inner ZIP
+	Files, Dirs int
+	// SourceSize is the size of the packaged files, which is also their
+	// size once extracted on the device
+	SourceSize int64
+	// SampledSize is the amount of data compressed for the estimate. The
+	// estimate is exact (apart from headers) when it equals SourceSize.
+	SampledSize int64
+	// ContentSize is the size of the inner ZIP, recorded as
+	// UnencryptedContentSize in Detection.xml. The Intune Management
+	// Extension keeps the decrypted content of this size in its cache.
+	ContentSize int64
+	// PackageSize is the size of the .intunewin file
+	PackageSize int64
+	// DeviceSize is the disk space needed on the device while installing:
+	// the downloaded content, its decrypted copy and the extracted files
+	DeviceSize int64
+}
+
+// Estimate predicts the sizes of the package without building it, by
+// compressing a sample of up to sampleSize bytes spread proportionally
+// over all files (DefaultSampleSize if zero or less). Excluded files are
+// left out as with CreatePackage; directory links are not followed.
+func (p *Packager) Estimate(sampleSize int64) (*SizeEstimate, error) {
+	if sampleSize <= 0 {
+		sampleSize = DefaultSampleSize
+	}
+	files, est, nameSize, err := p.scanSource()
+	if err != nil {
+		return nil, err
+	}
+
+	// Compress the start of every file, in proportion to its size, so
+	// that the sample reflects the mix of file types
+	var sampled, compressed int64
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, compressionLevel)
+	for _, f := range files {
+		n := f.size
+		if est.SourceSize > sampleSize {
+			n = (f.size*sampleSize + est.SourceSize - 1) / est.SourceSize
+		}
+		if n == 0 {
+			continue
+		}
+
+		file, err := os.Open(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", f.path, err)
+		}
+		buf.Reset()
+		fw.Reset(&buf)
+		read, err := io.Copy(fw, io.LimitReader(file, n))
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.path, err)
+		}
+		if err := fw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress %s: %w", f.path, err)
+		}
+		sampled += read
+		compressed += int64(buf.Len())
+	}
+	est.SampledSize = sampled
+
+	compressedSize := est.SourceSize
+	if sampled > 0 {
+		compressedSize = int64(float64(est.SourceSize) * float64(compressed) / float64(sampled))
+	}
+	est.ContentSize = compressedSize + 2*nameSize + int64(est.Files+est.Dirs)*entryOverhead + 22
+
+	// HMAC, IV and PKCS7 padded ciphertext, stored in a deflated outer
+	// ZIP (5 bytes per stored block of incompressible data)
+	encryptedSize := 32 + 16 + (est.ContentSize/16+1)*16
+	est.PackageSize = encryptedSize + (encryptedSize/65535+1)*5 + metadataOverhead
+	est.DeviceSize = est.PackageSize + est.ContentSize + est.SourceSize
+	return est, nil
+}
+
+// sourceEntry is a file found by scanSource
+type sourceEntry struct {
+	path string
+	size int64
+}
+
+// scanSource lists the files of the source folder with their sizes, and
+// returns the entry counts and source size and the total length of the
+// entry names of the inner ZIP
+func (p *Packager) scanSource() ([]sourceEntry, *SizeEstimate, int64, error) {
+	var files []sourceEntry
+	est := &SizeEstimate{}
+	nameSize := int64(0)
+	baseDir := filepath.Base(p.opts.SourceDir)
+
+	err := walkDir(p.opts.SourceDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == p.opts.SourceDir {
+			return nil
+		}
+		if !p.opts.IncludeHidden && IsExcluded(d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isLink(d) && p.opts.Links == LinkSkip {
+			return nil
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(p.opts.SourceDir, path)
+		if err != nil {
+			return err
+		}
+		nameSize += int64(len(baseDir) + 1 + len(relPath))
+
+		if info.IsDir() {
+			est.Dirs++
+			nameSize++
+			return nil
+		}
+		est.Files++
+		est.SourceSize += info.Size()
+		files = append(files, sourceEntry{path: path, size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to scan %s: %w", p.opts.SourceDir, err)
+	}
+	return files, est, nameSize, nil
+}
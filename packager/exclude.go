@@ -0,0 +1,34 @@
+package packager
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// junkFiles are files created by Windows Explorer and macOS Finder
+var junkFiles = map[string]bool{
+	"thumbs.db":   true,
+	"desktop.ini": true,
+	".ds_store":   true,
+}
+
+// Excluded returns the source paths (relative to the source folder)
+// excluded from the last CreatePackage call as junk or hidden files
+func (p *Packager) Excluded() []string {
+	return p.excluded
+}
+
+// IsExcluded reports whether a source file is junk or hidden. Such files
+// are left out of packages unless Options.IncludeHidden is set.
+func IsExcluded(d fs.DirEntry) bool {
+	name := strings.ToLower(d.Name())
+	if junkFiles[name] {
+		return true
+	}
+	// Office lock and temporary files
+	if match, _ := filepath.Match("~$*.tmp", name); match {
+		return true
+	}
+	return isHiddenOrSystem(d)
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package packager
+
+import "io/fs"
+
+// isHiddenOrSystem reports whether a file has the hidden or system
+// attribute. Other platforms have no such attributes.
+func isHiddenOrSystem(d fs.DirEntry) bool {
+	return false
+}
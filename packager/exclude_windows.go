@@ -0,0 +1,23 @@
+//go:build windows
+
+package packager
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// isHiddenOrSystem reports whether a file has the hidden or system attribute
+func isHiddenOrSystem(d fs.DirEntry) bool {
+	// Directory entries carry their attributes on Windows, so Info does
+	// not stat the file
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return false
+	}
+	return attrs.FileAttributes&(syscall.FILE_ATTRIBUTE_HIDDEN|syscall.FILE_ATTRIBUTE_SYSTEM) != 0
+}
@@ -0,0 +1,130 @@
+package packager
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+)
+
+// GeneratedFile is a file rendered at build time and added to the inner
+// ZIP, e.g. an install script or a version file, without touching the
+// source folder
+type GeneratedFile struct {
+	// Path is the path of the file in the package, relative to the
+	// package root
+	Path string `json:"path"`
+	// Template is the content of the file, a Go template rendered with
+	// GeneratedData (optional)
+	Template string `json:"template,omitempty"`
+	// File is a template file read instead of Template (optional)
+	File string `json:"file,omitempty"`
+	// CRLF writes Windows line endings, as batch files require
+	CRLF bool `json:"crlf,omitempty"`
+}
+
+// GeneratedData provides the variables of generated file templates, e.g.
+// {{ .Name }} or {{ .Created.Format "2006-01-02" }}. The env function
+// reads environment variables: {{ env "BUILD_NUMBER" }}
+type GeneratedData struct {
+	// Name is the application name recorded in Detection.xml
+	Name string
+	// Architecture is the target architecture, if any
+	Architecture string
+	// SetupFile is the path of the setup file in the package
+	SetupFile string
+	// ProductVersion is the product version of the setup file, if any
+	ProductVersion string
+	// JobID is the correlation ID of the build
+	JobID string
+	// Tool is the tool name and version, as in the build info
+	Tool string
+	// SourceSHA256 is the digest of the packaged source files, in the
+	// format of the build registry. Generated files are not part of it.
+	SourceSHA256 string
+	// Created is the build time in UTC
+	Created time.Time
+}
+
+// generatedFuncs are the functions available in generated file templates
+var generatedFuncs = template.FuncMap{
+	"env": os.Getenv,
+}
+
+// Validate checks the path of the file and that at most one of Template
+// and File is set
+func (g GeneratedFile) Validate() error {
+	name, err := sourceTarget(g.Path)
+	if err != nil {
+		return fmt.Errorf("generated file: %w", err)
+	}
+	if name == "" {
+		return fmt.Errorf("generated file has no path")
+	}
+	if g.Template != "" && g.File != "" {
+		return fmt.Errorf("generated file %s has both a template and a template file", g.Path)
+	}
+	return nil
+}
+
+// parseGenerated parses the templates of Options.Generated, so that
+// invalid templates fail before the source is packaged
+func (p *Packager) parseGenerated() ([]*template.Template, error) {
+	templates := make([]*template.Template, 0, len(p.opts.Generated))
+	for _, g := range p.opts.Generated {
+		if err := g.Validate(); err != nil {
+			return nil, err
+		}
+		text := g.Template
+		if g.File != "" {
+			data, err := os.ReadFile(g.File)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read template of %s: %w", g.Path, err)
+			}
+			text = string(data)
+		}
+		tmpl, err := template.New(g.Path).Funcs(generatedFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template of %s: %w", g.Path, err)
+		}
+		templates = append(templates, tmpl)
+	}
+	return templates, nil
+}
+
+// renderGenerated renders the parsed templates of Options.Generated with
+// the digest of the source files
+func (p *Packager) renderGenerated(templates []*template.Template, sourceSHA256 string) ([]generatedFile, error) {
+	if len(templates) == 0 {
+		return nil, nil
+	}
+	info := p.newBuildInfo(sourceSHA256)
+	version, _ := SetupVersion(p.opts.SourceDir, p.opts.SetupFile)
+	data := GeneratedData{
+		Name:           p.appName(),
+		Architecture:   p.opts.Architecture,
+		SetupFile:      p.packagedSetupFile(),
+		ProductVersion: version,
+		JobID:          info.JobID,
+		Tool:           info.Tool,
+		SourceSHA256:   sourceSHA256,
+		Created:        info.Created,
+	}
+
+	files := make([]generatedFile, 0, len(templates))
+	for i, tmpl := range templates {
+		g := p.opts.Generated[i]
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", g.Path, err)
+		}
+		content := buf.Bytes()
+		if g.CRLF {
+			content = bytes.ReplaceAll(bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+		}
+		name, _ := sourceTarget(g.Path)
+		files = append(files, generatedFile{name: name, content: content})
+	}
+	return files, nil
+}
@@ -0,0 +1,84 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateInnerZipGenerated(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-generated-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "setup.exe"), []byte("setup"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+	templateFile := filepath.Join(tempDir, "version.tmpl")
+	if err := os.WriteFile(templateFile, []byte("{{ .Name }} {{ .JobID }} {{ .SourceSHA256 }}"), 0644); err != nil {
+		t.Fatalf("Failed to create template file: %v", err)
+	}
+
+	opts := Options{
+		SourceDir: sourceDir,
+		SetupFile: "setup.exe",
+		Quiet:     true,
+		JobID:     "job-1",
+		Generated: []GeneratedFile{
+			{Path: "install.cmd", Template: "@echo off\n{{ .SetupFile }} /S\n", CRLF: true},
+			{Path: "meta/version.txt", File: templateFile},
+		},
+	}
+	p := New(opts)
+	data, err := p.createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Inner ZIP is not valid: %v", err)
+	}
+	contents := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		contents[f.Name] = string(content)
+	}
+	if got := contents["app/install.cmd"]; got != "@echo off\r\nsetup.exe /S\r\n" {
+		t.Errorf("Unexpected install.cmd: %q", got)
+	}
+	if _, ok := contents["app/meta/"]; !ok {
+		t.Error("Expected a directory entry for the folder of a generated file")
+	}
+	fields := strings.Fields(contents["app/meta/version.txt"])
+	if len(fields) != 3 || fields[0] != "app" || fields[1] != "job-1" || len(fields[2]) != 64 {
+		t.Errorf("Unexpected version.txt: %q", contents["app/meta/version.txt"])
+	}
+
+	for name, g := range map[string]GeneratedFile{
+		"conflict":         {Path: "setup.exe", Template: "x"},
+		"invalid template": {Path: "x.txt", Template: "{{ .Name "},
+		"unknown variable": {Path: "x.txt", Template: "{{ .Version }}"},
+		"outside":          {Path: "../x.txt"},
+		"both":             {Path: "x.txt", Template: "x", File: templateFile},
+	} {
+		opts.Generated = []GeneratedFile{g}
+		if _, err := New(opts).createInnerZip(); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package packager
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Installer frameworks detected by InstallerType
+const (
+	InstallerInno = "Inno Setup"
+	InstallerNSIS = "NSIS"
+)
+
+// installerScanSize is the part of an executable searched for installer
+// markers. The setup data of both frameworks follows the loader stub.
+const installerScanSize = 32 << 20
+
+// installerMarkers are the signatures the frameworks embed in their setup
+// data: the Inno Setup loader table and setup header, and the NSIS first
+// header
+var installerMarkers = []struct {
+	installer string
+	marker    []byte
+}{
+	{InstallerInno, []byte("Inno Setup Setup Data")},
+	{InstallerInno, []byte("rDlPtS")},
+	{InstallerNSIS, []byte("NullsoftInst")},
+}
+
+// InstallerType detects the framework of an EXE setup file from the
+// markers in its setup data. It is empty for other setup files and
+// executables of unknown frameworks.
+func InstallerType(sourceDir, setupFile string) (string, error) {
+	if !strings.EqualFold(filepath.Ext(setupFile), ".exe") {
+		return "", nil
+	}
+	file, err := os.Open(filepath.Join(sourceDir, setupFile))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Chunks overlap by the longest marker, so that markers crossing a
+	// chunk boundary are found
+	const chunkSize, overlap = 1 << 20, 32
+	buf := make([]byte, overlap+chunkSize)
+	kept := 0
+	for read := 0; read < installerScanSize; {
+		n, err := io.ReadFull(file, buf[kept:])
+		read += n
+		data := buf[:kept+n]
+		for _, m := range installerMarkers {
+			if bytes.Contains(data, m.marker) {
+				return m.installer, nil
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		kept = copy(buf, data[len(data)-overlap:])
+	}
+	return "", nil
+}
+
+// CheckSilentSwitches checks the install command of an installer for the
+// switches that suppress its user interface. It returns a problem per
+// missing switch; commands of other installers are not checked.
+func CheckSilentSwitches(installer, command string) []string {
+	args := strings.Fields(command)
+	has := func(sw string, caseSensitive bool) bool {
+		for _, arg := range args {
+			if arg == sw || (!caseSensitive && strings.EqualFold(arg, sw)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var problems []string
+	switch installer {
+	case InstallerInno:
+		switch {
+		case has("/VERYSILENT", false):
+			if !has("/SUPPRESSMSGBOXES", false) {
+				problems = append(problems, "message boxes can still block the install, add /SUPPRESSMSGBOXES")
+			}
+		case has("/SILENT", false):
+			problems = append(problems, "/SILENT still shows a progress window, use /VERYSILENT")
+		default:
+			problems = append(problems, "the install command shows the setup wizard, add /VERYSILENT /SUPPRESSMSGBOXES /NORESTART")
+		}
+	case InstallerNSIS:
+		switch {
+		case has("/S", true):
+		case has("/S", false):
+			problems = append(problems, "NSIS switches are case-sensitive, use /S instead of /s")
+		default:
+			problems = append(problems, "the install command shows the setup wizard, add /S")
+		}
+	}
+	return problems
+}
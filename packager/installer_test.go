@@ -0,0 +1,80 @@
+package packager
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstallerType(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-installer-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Markers in the setup data after the loader stub, one across the
+	// boundary of the first chunk
+	stub := bytes.Repeat([]byte{0x90}, 1<<20-5)
+	files := map[string][]byte{
+		"inno.exe":  append(append([]byte{}, stub...), []byte("Inno Setup Setup Data (6.2.0)")...),
+		"nsis.exe":  append(append([]byte{}, stub...), []byte("\xef\xbe\xad\xdeNullsoftInst")...),
+		"other.exe": stub,
+		"inno.msi":  []byte("Inno Setup Setup Data"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), content, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	expected := map[string]string{
+		"inno.exe":  InstallerInno,
+		"nsis.exe":  InstallerNSIS,
+		"other.exe": "",
+		"inno.msi":  "",
+	}
+	for name, want := range expected {
+		got, err := InstallerType(tempDir, name)
+		if err != nil {
+			t.Errorf("InstallerType(%s) failed: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("InstallerType(%s) = %q, expected %q", name, got, want)
+		}
+	}
+	if _, err := InstallerType(tempDir, "missing.exe"); err == nil {
+		t.Error("Expected error for a missing setup file")
+	}
+}
+
+func TestCheckSilentSwitches(t *testing.T) {
+	tests := []struct {
+		installer string
+		command   string
+		problem   string
+	}{
+		{InstallerInno, `"setup.exe" /verysilent /suppressmsgboxes /norestart`, ""},
+		{InstallerInno, `setup.exe /VERYSILENT`, "/SUPPRESSMSGBOXES"},
+		{InstallerInno, `setup.exe /SILENT`, "progress window"},
+		{InstallerInno, `"setup.exe"`, "setup wizard"},
+		{InstallerNSIS, `setup.exe /S /D=C:\App`, ""},
+		{InstallerNSIS, `setup.exe /s`, "case-sensitive"},
+		{InstallerNSIS, `setup.exe /quiet`, "add /S"},
+		{"", `setup.exe`, ""},
+	}
+	for _, tt := range tests {
+		problems := CheckSilentSwitches(tt.installer, tt.command)
+		if tt.problem == "" {
+			if len(problems) != 0 {
+				t.Errorf("%s %q: unexpected problems %v", tt.installer, tt.command, problems)
+			}
+			continue
+		}
+		if len(problems) != 1 || !strings.Contains(problems[0], tt.problem) {
+			t.Errorf("%s %q: expected a problem about %q, got %v", tt.installer, tt.command, tt.problem, problems)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package packager
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Supported values for Options.Links
+const (
+	// LinkFollow packages the target of symbolic links and junctions under
+	// the path of the link (default)
+	LinkFollow = "follow"
+	// LinkSkip leaves symbolic links and junctions out of the package
+	LinkSkip = "skip"
+)
+
+// LinkModes lists all supported values for Options.Links
+var LinkModes = []string{LinkFollow, LinkSkip}
+
+// HardLinks returns the hard-linked files of the last CreatePackage call
+// that were left out with Options.SkipHardLinks because another link to the
+// same content was already packaged, as "duplicate => packaged" relative to
+// the source folder
+func (p *Packager) HardLinks() []string {
+	return p.hardLinks
+}
+
+// isLink reports whether a source entry is a symbolic link or a junction
+func isLink(d fs.DirEntry) bool {
+	return d.Type()&fs.ModeSymlink != 0 || isJunction(d)
+}
+
+// resolveLink returns the target of a link and its file info. Directories
+// already packaged (including the source folder itself) are reported with
+// a nil info, so that link cycles are not followed.
+func resolveLink(path string, visited map[string]bool) (string, os.FileInfo, error) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve link %s: %w", path, err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve link %s: %w", path, err)
+	}
+	if info.IsDir() {
+		if visited[target] {
+			return target, nil, nil
+		}
+		visited[target] = true
+	}
+	return target, info, nil
+}
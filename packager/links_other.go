@@ -0,0 +1,20 @@
+//go:build !unix && !windows
+
+package packager
+
+import (
+	"io/fs"
+	"os"
+)
+
+// isJunction reports whether a source entry is an NTFS junction. Other
+// platforms have no junctions.
+func isJunction(d fs.DirEntry) bool {
+	return false
+}
+
+// hardLinkID identifies the content of a file with more than one hard
+// link. Hard links are not detected on this platform.
+func hardLinkID(file *os.File) (string, bool) {
+	return "", false
+}
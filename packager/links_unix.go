@@ -0,0 +1,29 @@
+//go:build unix
+
+package packager
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// isJunction reports whether a source entry is an NTFS junction. Other
+// platforms have no junctions.
+func isJunction(d fs.DirEntry) bool {
+	return false
+}
+
+// hardLinkID identifies the content of a file with more than one hard link
+func hardLinkID(file *os.File) (string, bool) {
+	info, err := file.Stat()
+	if err != nil {
+		return "", false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d", st.Dev, st.Ino), true
+}
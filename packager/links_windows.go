@@ -0,0 +1,37 @@
+//go:build windows
+
+package packager
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// isJunction reports whether a source entry is an NTFS junction (mount
+// point). Junctions are reparse points that os.Lstat does not report as
+// symbolic links.
+func isJunction(d fs.DirEntry) bool {
+	if d.Type()&fs.ModeIrregular == 0 {
+		return false
+	}
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && attrs.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT != 0
+}
+
+// hardLinkID identifies the content of a file with more than one hard link
+func hardLinkID(file *os.File) (string, bool) {
+	var d syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(syscall.Handle(file.Fd()), &d); err != nil {
+		return "", false
+	}
+	if d.NumberOfLinks < 2 {
+		return "", false
+	}
+	return fmt.Sprintf("%x:%x:%x", d.VolumeSerialNumber, d.FileIndexHigh, d.FileIndexLow), true
+}
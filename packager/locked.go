@@ -0,0 +1,63 @@
+package packager
+
+import (
+	"os"
+	"time"
+
+	"github.com/MANCHTOOLS/open-package/retry"
+)
+
+// Supported values for Options.Unreadable
+const (
+	// UnreadableFail fails packaging on source files and folders that
+	// cannot be opened (default)
+	UnreadableFail = "fail"
+	// UnreadableSkip leaves source files and folders that cannot be opened
+	// out of the package with a warning
+	UnreadableSkip = "skip"
+)
+
+// UnreadableModes lists all supported values for Options.Unreadable
+var UnreadableModes = []string{UnreadableFail, UnreadableSkip}
+
+// DefaultOpenRetryDelay is the delay before the first retry of a locked file
+const DefaultOpenRetryDelay = retry.DefaultDelay
+
+// openFile and isTransientOpenError are variables so that tests can
+// simulate locked files on any platform
+var (
+	openFile             = os.Open
+	isTransientOpenError = retry.IsTransient
+)
+
+// Skipped returns the source files skipped by the last CreatePackage call
+// because they were locked or could not be opened. Skipped folders end
+// with a slash.
+func (p *Packager) Skipped() []string {
+	return p.skipped
+}
+
+// skipUnreadable leaves a source file or folder that cannot be opened out
+// of the package. The warning fails the build in strict mode.
+func (p *Packager) skipUnreadable(archivePath string, err error) error {
+	if err := p.warn(WarnUnreadable, "%s cannot be read and was skipped: %v", archivePath, err); err != nil {
+		return err
+	}
+	p.skipped = append(p.skipped, archivePath)
+	p.log("  Skipped unreadable file: %s", archivePath)
+	return nil
+}
+
+// openSourceFile opens a source file, retrying with exponential backoff
+// while it is locked by another process
+func (p *Packager) openSourceFile(path string) (*os.File, error) {
+	policy := retry.Policy{Retries: p.opts.OpenRetries, Delay: p.opts.OpenRetryDelay, Retryable: isTransientOpenError}
+	var file *os.File
+	err := policy.Do(func() (err error) {
+		file, err = openFile(path)
+		return err
+	}, func(err error, delay time.Duration) {
+		p.log("  %s is locked, retrying in %s", path, delay)
+	})
+	return file, err
+}
@@ -0,0 +1,183 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MANCHTOOLS/open-package/retry"
+)
+
+func TestLockedFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-locked-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.Mkdir(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	for _, name := range []string{"install.cmd", "busy.log"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	// busy.log is locked for the first lockedOpens attempts
+	errLocked := errors.New("sharing violation")
+	var attempts, lockedOpens int
+	openFile = func(path string) (*os.File, error) {
+		if filepath.Base(path) == "busy.log" {
+			attempts++
+			if attempts <= lockedOpens {
+				return nil, &os.PathError{Op: "open", Path: path, Err: errLocked}
+			}
+		}
+		return os.Open(path)
+	}
+	isTransientOpenError = func(err error) bool { return errors.Is(err, errLocked) }
+	defer func() {
+		openFile = os.Open
+		isTransientOpenError = retry.IsTransient
+	}()
+
+	opts := Options{
+		SourceDir:      sourceDir,
+		SetupFile:      "install.cmd",
+		Quiet:          true,
+		OpenRetries:    2,
+		OpenRetryDelay: time.Millisecond,
+	}
+
+	// The file is unlocked on the last retry
+	attempts, lockedOpens = 0, 2
+	p := New(opts)
+	innerZip, err := p.createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	if attempts != 3 || len(zipNames(t, innerZip)) != 2 {
+		t.Errorf("Expected 3 attempts and 2 entries, got %d and %v", attempts, zipNames(t, innerZip))
+	}
+
+	// The file stays locked
+	attempts, lockedOpens = 0, 10
+	if _, err := New(opts).createInnerZip(); !errors.Is(err, errLocked) {
+		t.Errorf("Expected lock error, got %v", err)
+	}
+
+	opts.SkipLocked = true
+	attempts = 0
+	p = New(opts)
+	innerZip, err = p.createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	if names := zipNames(t, innerZip); len(names) != 1 || names[0] != "app/install.cmd" {
+		t.Errorf("Unexpected entries: %v", names)
+	}
+	if len(p.Skipped()) != 1 || p.Skipped()[0] != "app/busy.log" {
+		t.Errorf("Unexpected skipped files: %v", p.Skipped())
+	}
+}
+
+func zipNames(t *testing.T, data []byte) []string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Invalid ZIP: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestUnreadableFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-unreadable-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "private"), 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	for _, name := range []string{"install.cmd", "secret.dat", "private/key.pem"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	openFile = func(path string) (*os.File, error) {
+		if filepath.Base(path) == "secret.dat" {
+			return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrPermission}
+		}
+		return os.Open(path)
+	}
+	defer func() { openFile = os.Open }()
+
+	opts := Options{SourceDir: sourceDir, SetupFile: "install.cmd", Quiet: true}
+	if _, err := New(opts).createInnerZip(); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Expected permission error, got %v", err)
+	}
+
+	opts.Unreadable = UnreadableSkip
+	p := New(opts)
+	innerZip, err := p.createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	if names := strings.Join(zipNames(t, innerZip), ","); names != "app/install.cmd,app/private/,app/private/key.pem" {
+		t.Errorf("Unexpected entries: %s", names)
+	}
+	if len(p.Skipped()) != 1 || p.Skipped()[0] != "app/secret.dat" {
+		t.Errorf("Unexpected skipped files: %v", p.Skipped())
+	}
+	if len(p.Warnings()) != 1 || !strings.Contains(p.Warnings()[0], "app/secret.dat cannot be read") {
+		t.Errorf("Unexpected warnings: %v", p.Warnings())
+	}
+
+	opts.Strict = true
+	if _, err := New(opts).createInnerZip(); !errors.Is(err, ErrStrict) {
+		t.Errorf("Expected ErrStrict, got %v", err)
+	}
+
+	opts.Strict, opts.Unreadable = false, "ignore"
+	opts.OutputDir = tempDir
+	if _, err := New(opts).CreatePackage(); err == nil || !strings.Contains(err.Error(), "unsupported unreadable mode") {
+		t.Errorf("Expected error for unsupported mode, got %v", err)
+	}
+
+	// Folders that cannot be listed are packaged empty. Permissions do not
+	// apply to root and are not modeled on Windows.
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		return
+	}
+	if err := os.Chmod(filepath.Join(sourceDir, "private"), 0); err != nil {
+		t.Fatalf("Failed to change permissions: %v", err)
+	}
+	defer os.Chmod(filepath.Join(sourceDir, "private"), 0755)
+	opts.Unreadable = UnreadableSkip
+	p = New(opts)
+	innerZip, err = p.createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	if names := strings.Join(zipNames(t, innerZip), ","); names != "app/install.cmd,app/private/" {
+		t.Errorf("Unexpected entries: %s", names)
+	}
+	if skipped := strings.Join(p.Skipped(), ","); skipped != "app/private/,app/secret.dat" {
+		t.Errorf("Unexpected skipped files: %s", skipped)
+	}
+}
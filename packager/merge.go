@@ -0,0 +1,89 @@
+package packager
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Source is an additional folder or file merged into the inner ZIP, so
+// that shared assets need not be copied into every source folder
+type Source struct {
+	// Path is the folder or file to add
+	Path string `json:"path"`
+	// Target is the folder of the package the files of Path are added to,
+	// relative to the package root (optional, defaults to the root). A
+	// folder is merged with the folder of the same name in the source
+	// folder; files must not exist in both.
+	Target string `json:"target,omitempty"`
+}
+
+// ParseSource parses a source given as path[=target]
+func ParseSource(s string) (Source, error) {
+	src := Source{Path: s}
+	if i := strings.LastIndex(s, "="); i >= 0 {
+		src.Path, src.Target = s[:i], s[i+1:]
+	}
+	if err := src.Validate(); err != nil {
+		return Source{}, err
+	}
+	return src, nil
+}
+
+// Validate checks that the source has a path and a target within the
+// package
+func (s Source) Validate() error {
+	if s.Path == "" {
+		return fmt.Errorf("source has no path")
+	}
+	_, err := sourceTarget(s.Target)
+	return err
+}
+
+// sourceTarget returns the target folder of a source with forward
+// slashes, or an error if it is not below the package root
+func sourceTarget(target string) (string, error) {
+	if target == "" {
+		return "", nil
+	}
+	cleaned := path.Clean(strings.ReplaceAll(target, `\`, "/"))
+	if cleaned == "." {
+		return "", nil
+	}
+	if !filepath.IsLocal(filepath.FromSlash(cleaned)) {
+		return "", fmt.Errorf("source target %q must be a folder within the package", target)
+	}
+	return cleaned, nil
+}
+
+// addTargetDirs adds the directory entries of a folder of the package and
+// its parents that the source folder does not have, e.g. the target folder
+// of a merged source
+func (p *Packager) addTargetDirs(addDir func(*zip.FileHeader) error, entries map[string]string, baseDir, target string) error {
+	if target == "" {
+		return nil
+	}
+	parts := strings.Split(target, "/")
+	for i := range parts {
+		archivePath := baseDir + "/" + strings.Join(parts[:i+1], "/")
+		if entries[strings.ToLower(archivePath)] == archivePath {
+			continue
+		}
+		if err := p.checkEntry(entries, archivePath); err != nil {
+			return err
+		}
+		header := &zip.FileHeader{
+			Name:   archivePath + "/",
+			Method: zip.Deflate,
+		}
+		header.SetMode(fs.ModeDir | 0755)
+		p.setAttributes(header, nil)
+		if err := addDir(header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
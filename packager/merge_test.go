@@ -0,0 +1,116 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCreateInnerZipSources(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-merge-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	files := map[string]string{
+		"app/install.exe":          "setup",
+		"app/scripts/install.ps1":  "install",
+		"shared/common.ps1":        "common",
+		"shared/lib/helper.psm1":   "helper",
+		"assets/license.txt":       "license",
+		"assets/tools/install.exe": "conflict",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	opts := Options{
+		SourceDir: filepath.Join(tempDir, "app"),
+		SetupFile: "install.exe",
+		Quiet:     true,
+		Sources: []Source{
+			{Path: filepath.Join(tempDir, "shared"), Target: "scripts"},
+			{Path: filepath.Join(tempDir, "assets", "license.txt")},
+			{Path: filepath.Join(tempDir, "assets", "license.txt"), Target: `docs\legal`},
+		},
+	}
+	data, err := New(opts).createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Inner ZIP is not valid: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	expected := []string{
+		"app/docs/",
+		"app/docs/legal/",
+		"app/docs/legal/license.txt",
+		"app/install.exe",
+		"app/license.txt",
+		"app/scripts/",
+		"app/scripts/common.ps1",
+		"app/scripts/install.ps1",
+		"app/scripts/lib/",
+		"app/scripts/lib/helper.psm1",
+	}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("Unexpected entries:\n%s\nexpected:\n%s", strings.Join(names, "\n"), strings.Join(expected, "\n"))
+	}
+
+	// Files must not be added twice
+	opts.Sources = []Source{{Path: filepath.Join(tempDir, "assets", "tools")}}
+	if _, err := New(opts).createInnerZip(); err == nil || !strings.Contains(err.Error(), "app/install.exe") {
+		t.Errorf("Expected error for a conflicting file, got %v", err)
+	}
+
+	opts.Sources = []Source{{Path: filepath.Join(tempDir, "shared"), Target: "../outside"}}
+	if _, err := New(opts).createInnerZip(); err == nil {
+		t.Error("Expected error for a target outside the package")
+	}
+	opts.Sources = []Source{{Path: filepath.Join(tempDir, "missing")}}
+	if _, err := New(opts).createInnerZip(); err == nil {
+		t.Error("Expected error for a missing source")
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Source
+		wantErr  bool
+	}{
+		{"../shared", Source{Path: "../shared"}, false},
+		{"../shared=scripts/shared", Source{Path: "../shared", Target: "scripts/shared"}, false},
+		{`C:\shared=tools`, Source{Path: `C:\shared`, Target: "tools"}, false},
+		{"=scripts", Source{}, true},
+		{"../shared=../up", Source{}, true},
+		{"../shared=/abs", Source{}, true},
+	}
+	for _, tt := range tests {
+		src, err := ParseSource(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSource(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if src != tt.expected {
+			t.Errorf("ParseSource(%q) = %+v, expected %+v", tt.input, src, tt.expected)
+		}
+	}
+}
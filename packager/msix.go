@@ -0,0 +1,57 @@
+package packager
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// MSIXBootstrapScriptName is the setup file of an MSIX wrapper package
+const MSIXBootstrapScriptName = "install.ps1"
+
+// msixExtensions are the file extensions of MSIX and APPX packages
+var msixExtensions = []string{".msix", ".msixbundle", ".appx", ".appxbundle"}
+
+// IsMSIX reports whether the setup file is an MSIX or APPX package. Such
+// packages are normally uploaded to Intune directly as line-of-business
+// apps rather than wrapped in an .intunewin package.
+func IsMSIX(setupFile string) bool {
+	ext := strings.ToLower(filepath.Ext(setupFile))
+	for _, e := range msixExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// msixBootstrapScript returns a PowerShell script that provisions the MSIX
+// package for all users. Other MSIX/APPX files in the package are passed
+// as dependencies (e.g. framework packages shipped next to the app).
+func msixBootstrapScript(setupFile string) string {
+	packagePath := strings.ReplaceAll(filepath.ToSlash(setupFile), "/", `\`)
+	packagePath = strings.ReplaceAll(packagePath, "'", "''")
+
+	return strings.Join([]string{
+		"# Bootstrap installer for " + setupFile,
+		"$ErrorActionPreference = 'Stop'",
+		"$package = Join-Path $PSScriptRoot '" + packagePath + "'",
+		"$dependencies = @(Get-ChildItem -Path $PSScriptRoot -Recurse -Include *.appx, *.msix |",
+		"    Where-Object { $_.FullName -ne $package } | ForEach-Object { $_.FullName })",
+		"$params = @{ Online = $true; PackagePath = $package; SkipLicense = $true }",
+		"if ($dependencies) { $params.DependencyPackagePath = $dependencies }",
+		"Add-AppxProvisionedPackage @params | Out-Null",
+		"",
+	}, "\r\n")
+}
+
+// msixWrapperFiles returns the generated files of an MSIX wrapper package
+func (p *Packager) msixWrapperFiles() ([]generatedFile, error) {
+	if !IsMSIX(p.opts.SetupFile) {
+		return nil, fmt.Errorf("setup file %s is not an MSIX package", p.opts.SetupFile)
+	}
+	return []generatedFile{{
+		name:    MSIXBootstrapScriptName,
+		content: []byte(msixBootstrapScript(p.opts.SetupFile)),
+	}}, nil
+}
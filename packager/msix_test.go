@@ -0,0 +1,103 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsMSIX(t *testing.T) {
+	tests := map[string]bool{
+		"app.msix":          true,
+		"App.MsixBundle":    true,
+		"legacy.appx":       true,
+		"bundle.appxbundle": true,
+		"setup.msi":         false,
+		"install.exe":       false,
+		"msix":              false,
+	}
+	for name, expected := range tests {
+		if IsMSIX(name) != expected {
+			t.Errorf("IsMSIX(%q): expected %v", name, expected)
+		}
+	}
+}
+
+func TestMSIXWrapper(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-msix-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "myapp")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "app.msix"), []byte("msix"), 0644); err != nil {
+		t.Fatalf("Failed to create MSIX: %v", err)
+	}
+
+	pkg := New(Options{
+		SourceDir:   sourceDir,
+		SetupFile:   "app.msix",
+		Quiet:       true,
+		MSIXWrapper: true,
+	})
+
+	if pkg.setupFile() != MSIXBootstrapScriptName {
+		t.Errorf("Expected setup file %s, got %s", MSIXBootstrapScriptName, pkg.setupFile())
+	}
+
+	zipData, err := pkg.createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
+	if err != nil {
+		t.Fatalf("Created data is not a valid ZIP: %v", err)
+	}
+
+	var script string
+	for _, f := range zr.File {
+		if f.Name == "myapp/"+MSIXBootstrapScriptName {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatalf("Failed to open script: %v", err)
+			}
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			script = string(data)
+		}
+	}
+	if script == "" {
+		t.Fatal("Bootstrap script not found in inner ZIP")
+	}
+	if !strings.Contains(script, "Add-AppxProvisionedPackage") || !strings.Contains(script, "'app.msix'") {
+		t.Errorf("Unexpected bootstrap script:\n%s", script)
+	}
+
+	// The uninstall companion package runs its script unwrapped
+	uninstall := New(Options{SourceDir: sourceDir, SetupFile: "app.msix", OutputDir: tempDir, Quiet: true, MSIXWrapper: true})
+	if _, err := uninstall.CreateUninstallPackage("powershell -Command Remove-AppxPackage MyApp"); err != nil {
+		t.Errorf("CreateUninstallPackage failed: %v", err)
+	}
+
+	// A source file with the same name as the script is rejected
+	if err := os.WriteFile(filepath.Join(sourceDir, MSIXBootstrapScriptName), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create conflicting file: %v", err)
+	}
+	if _, err := pkg.createInnerZip(); err == nil {
+		t.Error("Expected error for conflicting source file")
+	}
+
+	// Non-MSIX setup files cannot be wrapped
+	pkg = New(Options{SourceDir: sourceDir, SetupFile: "setup.exe", Quiet: true, MSIXWrapper: true})
+	if _, err := pkg.createInnerZip(); err == nil {
+		t.Error("Expected error for non-MSIX setup file")
+	}
+}
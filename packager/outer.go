@@ -0,0 +1,70 @@
+package packager
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/format"
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+// WriteOuter writes an outer .intunewin ZIP to w from its parts: the
+// Detection.xml content and the encrypted content ([HMAC][IV][Encrypted
+// Data]), which is streamed. The layout is format.Current, and the content
+// is stored under the FileName of Detection.xml. It is meant for repack
+// and re-signing flows that already have encrypted content; Detection.xml
+// is parsed but not validated against the content.
+func WriteOuter(w io.Writer, detectionXML []byte, encrypted io.Reader) error {
+	return writeOuter(w, "", detectionXML, encrypted)
+}
+
+// writeOuter writes an outer ZIP with an optional comment
+func writeOuter(w io.Writer, comment string, detectionXML []byte, encrypted io.Reader) error {
+	info, err := metadata.ParseDetectionXML(detectionXML)
+	if err != nil {
+		return fmt.Errorf("invalid Detection.xml: %w", err)
+	}
+	spec := format.Current
+	if strings.ContainsAny(info.FileName, `/\`) || info.FileName == "." || info.FileName == ".." {
+		return fmt.Errorf("invalid FileName %q in Detection.xml", info.FileName)
+	}
+
+	zw := zip.NewWriter(w)
+	if comment != "" {
+		if err := zw.SetComment(comment); err != nil {
+			return err
+		}
+	}
+
+	// Add Detection.xml to IntuneWinPackage/Metadata/ (in format.V1)
+	writer, err := createOuterEntry(zw, spec.MetadataPath)
+	if err != nil {
+		return fmt.Errorf("failed to add Detection.xml: %w", err)
+	}
+	if _, err := writer.Write(detectionXML); err != nil {
+		return fmt.Errorf("failed to add Detection.xml: %w", err)
+	}
+
+	// Add encrypted content to IntuneWinPackage/Contents/
+	writer, err = createOuterEntry(zw, spec.ContentPath(info.FileName))
+	if err != nil {
+		return fmt.Errorf("failed to add encrypted content: %w", err)
+	}
+	if _, err := io.Copy(writer, encrypted); err != nil {
+		return fmt.Errorf("failed to add encrypted content: %w", err)
+	}
+
+	return zw.Close()
+}
+
+// createOuterEntry adds an entry to the outer ZIP
+func createOuterEntry(zw *zip.Writer, name string) (io.Writer, error) {
+	header := &zip.FileHeader{
+		Name:   name,
+		Method: zip.Deflate,
+	}
+	header.SetMode(0644)
+	return zw.CreateHeader(header)
+}
@@ -0,0 +1,127 @@
+package packager
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MANCHTOOLS/open-package/metadata"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+func TestWriteOuter(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-outer-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.exe"), []byte("setup"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+	built, err := New(Options{SourceDir: sourceDir, SetupFile: "install.exe", OutputDir: tempDir, Quiet: true}).CreatePackage()
+	if err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	original, err := unpacker.Open(built)
+	if err != nil {
+		t.Fatalf("Failed to open package: %v", err)
+	}
+
+	// Repack the parts, with the content under another FileName
+	detectionXML := bytes.Replace(original.DetectionXML, []byte(metadata.EncryptedFileName), []byte("Repacked.intunewin"), 1)
+	var buf bytes.Buffer
+	if err := WriteOuter(&buf, detectionXML, bytes.NewReader(original.Encrypted)); err != nil {
+		t.Fatalf("WriteOuter failed: %v", err)
+	}
+	repacked, err := unpacker.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read repacked package: %v", err)
+	}
+	if problems := repacked.CheckStructure(); len(problems) != 0 {
+		t.Errorf("Unexpected structure problems: %v", problems)
+	}
+	if err := repacked.Verify(); err != nil {
+		t.Errorf("Repacked package does not verify: %v", err)
+	}
+	if repacked.Entries[1] != metadata.ContentsDir+"Repacked.intunewin" {
+		t.Errorf("Unexpected entries: %v", repacked.Entries)
+	}
+
+	invalid := [][]byte{
+		[]byte("not xml"),
+		bytes.Replace(original.DetectionXML, []byte(metadata.EncryptedFileName), []byte(`..\evil.intunewin`), 1),
+	}
+	for _, data := range invalid {
+		if err := WriteOuter(&bytes.Buffer{}, data, strings.NewReader("")); err == nil {
+			t.Errorf("Expected error for Detection.xml %.40q", data)
+		}
+	}
+}
+
+func TestCreatePackageWriteRetries(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-write-retry-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	outputDir := filepath.Join(tempDir, "out")
+	for _, dir := range []string{sourceDir, outputDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.cmd"), []byte("@echo off"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+
+	// The first failedWrites renames fail as on a share that dropped its
+	// connection
+	errDropped := &os.LinkError{Op: "rename", Err: os.ErrDeadlineExceeded}
+	var attempts, failedWrites int
+	renameFile = func(from, to string) error {
+		attempts++
+		if attempts <= failedWrites {
+			return errDropped
+		}
+		return os.Rename(from, to)
+	}
+	defer func() { renameFile = os.Rename }()
+
+	opts := Options{SourceDir: sourceDir, SetupFile: "install.cmd", OutputDir: outputDir, Quiet: true, WriteRetries: 2, WriteRetryDelay: time.Millisecond}
+	attempts, failedWrites = 0, 2
+	outputPath, err := New(opts).CreatePackage()
+	if err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+	if _, err := unpacker.Open(outputPath); err != nil {
+		t.Errorf("Failed to open the package: %v", err)
+	}
+
+	attempts, failedWrites = 0, 10
+	if _, err := New(opts).CreatePackage(); !errors.Is(err, os.ErrDeadlineExceeded) || attempts != 3 {
+		t.Errorf("Expected the write error after 3 attempts, got %v after %d", err, attempts)
+	}
+
+	// Failed attempts leave no temporary files behind
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatalf("Failed to read output dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the package in the output dir, got %v", entries)
+	}
+}
@@ -24,12 +24,19 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/MANCHTOOLS/open-package/crypto"
+	"github.com/MANCHTOOLS/open-package/escrow"
 	"github.com/MANCHTOOLS/open-package/metadata"
+	"github.com/MANCHTOOLS/open-package/msi"
+	"github.com/MANCHTOOLS/open-package/retry"
+	"github.com/MANCHTOOLS/open-package/tempfiles"
 )
 
 // Options contains the configuration for package creation
@@ -42,11 +49,193 @@ type Options struct {
 	OutputDir string
 	// Quiet suppresses progress output
 	Quiet bool
+	// Architecture is the target architecture of the package (optional).
+	// When set, it is appended to the output file name.
+	Architecture string
+	// MSIXWrapper wraps an MSIX setup file with a bootstrap PowerShell
+	// script, which becomes the setup file of the package
+	MSIXWrapper bool
+	// StrictCompat writes Detection.xml byte-compatible with the official tool
+	StrictCompat bool
+	// ToolVersion overrides the ToolVersion recorded in Detection.xml
+	// (optional, defaults to metadata.ToolVersion)
+	ToolVersion string
+	// ProfileIdentifier selects the crypto profile recorded in Detection.xml
+	// (optional, defaults to metadata.ProfileIdentifier)
+	ProfileIdentifier string
+	// Name overrides the application name recorded in Detection.xml and
+	// used for the output file name (optional, defaults to the source
+	// folder name). Characters invalid in file names are replaced.
+	Name string
+	// EscrowKey escrows the package keys next to the package (optional).
+	// See the escrow package for the files written.
+	EscrowKey *escrow.Key `json:"-"`
+	// Strict turns packaging warnings (path length, name collisions,
+	// unsigned setup files, size limits) into errors wrapping ErrStrict
+	Strict bool
+	// Suppress lists warning codes (e.g. WarnUnsigned) whose warnings are
+	// dropped, also in strict mode (optional)
+	Suppress []string
+	// Logger receives progress messages in addition to stdout (optional).
+	// Messages are logged even in quiet mode.
+	Logger *log.Logger `json:"-"`
+	// JobID correlates the build across pipeline stages (optional). It is
+	// recorded in the escrow sidecar.
+	JobID string
+	// OpenRetries is the number of times opening a source file is retried
+	// after a sharing or lock violation, e.g. while another tool has the
+	// file open (Windows only). Zero disables retries.
+	OpenRetries int
+	// OpenRetryDelay is the delay before the first retry, doubled for
+	// every further retry (default DefaultOpenRetryDelay)
+	OpenRetryDelay time.Duration
+	// WriteRetries is the number of times writing the package is retried
+	// after a transient error, e.g. of an output folder on a network share
+	// that drops its connection (see retry.IsTransient). Zero disables
+	// retries.
+	WriteRetries int
+	// WriteRetryDelay is the delay before the first retry, doubled for
+	// every further retry (default retry.DefaultDelay)
+	WriteRetryDelay time.Duration
+	// SkipLocked skips files that are still locked after all retries
+	// instead of failing. Skipped files are listed by Skipped.
+	SkipLocked bool
+	// Unreadable controls source files and folders that cannot be opened,
+	// e.g. for missing permissions or antivirus locks: UnreadableFail
+	// (default) fails packaging, UnreadableSkip leaves them out with a
+	// warning, so that Strict still fails. Skipped files are listed by
+	// Skipped.
+	Unreadable string
+	// IncludeHidden includes well-known junk files (Thumbs.db, desktop.ini,
+	// .DS_Store, ~$*.tmp) and files with the Windows hidden or system
+	// attribute, which are excluded by default
+	IncludeHidden bool
+	// PruneEmptyDirs leaves directories without files out of the inner ZIP.
+	// By default they are included, which some installers require.
+	PruneEmptyDirs bool
+	// ChangedFileRetries is the number of times a source file that changes
+	// while it is read (e.g. live build output) is read again before
+	// packaging fails. Zero fails on the first change. Without retries,
+	// files are streamed into their entry; with retries, they are
+	// compressed first, large files into a temporary file, so that a
+	// changed file can be read again.
+	ChangedFileRetries int
+	// Links controls symbolic links and NTFS junctions in the source
+	// folder: LinkFollow (default) packages their targets, LinkSkip leaves
+	// them out. Links to directories already packaged are skipped with a
+	// warning.
+	Links string
+	// SkipHardLinks packages only the first hard link to the same content
+	// and leaves the others out with a warning, so that Strict fails. They
+	// are listed by HardLinks. By default every link is packaged as a
+	// separate copy, as ZIP files cannot share content.
+	SkipHardLinks bool
+	// StripZoneIdentifier removes the Zone.Identifier stream, the Mark of
+	// the Web, from source files downloaded from the internet, as
+	// Unblock-File does (Windows only). Alternate data streams are never
+	// packaged; by default files carrying one are reported.
+	StripZoneIdentifier bool
+	// Workers is the number of source files read and compressed in
+	// parallel, which speeds up trees with many small files. Values below
+	// two package one file at a time.
+	Workers int
+	// MaxFileSize is the size in bytes above which a source file is
+	// reported, e.g. a stray VM image (optional, 0 disables the check)
+	MaxFileSize int64
+	// MaxSourceSize is the total size in bytes of the source files above
+	// which the source is reported (optional, 0 disables the check)
+	MaxSourceSize int64
+	// FailOnSizeLimit fails packaging with an error wrapping ErrSizeLimit
+	// when MaxFileSize or MaxSourceSize is exceeded, instead of warning
+	FailOnSizeLimit bool
+	// BuildInfo stamps the comments of the inner and outer ZIP with the
+	// tool, job ID and source digest of the build (see metadata.BuildInfo)
+	BuildInfo bool
+	// BuildTool is the tool name and version recorded in the build info
+	// (optional, defaults to DefaultBuildTool)
+	BuildTool string
+	// Sources are additional folders and files merged into the inner ZIP
+	// below target folders, e.g. shared scripts (optional)
+	Sources []Source
+	// Rewrites move folders and files of the source to other paths of the
+	// package; the first matching rule applies (optional)
+	Rewrites []Rewrite
+	// Generated are files rendered at build time and added to the inner
+	// ZIP (optional)
+	Generated []GeneratedFile
+	// Timestamps sets the modification times of the entries:
+	// TimestampsPreserve (default) keeps those of the source files,
+	// TimestampsBuild uses the build time and TimestampsFixed uses
+	// Timestamp, as some installers are sensitive to payload timestamps
+	Timestamps string
+	// Timestamp is the time of all entries with TimestampsFixed (optional,
+	// defaults to DefaultTimestamp)
+	Timestamp time.Time
+	// Attributes controls the permissions and Windows attributes of the
+	// entries: AttributesPreserve (default) keeps those of the source
+	// files, including read-only, hidden and system, AttributesNormalize
+	// writes uniform permissions without attributes
+	Attributes string
+	// Temp tracks the staging directories and partially written packages
+	// of the build (optional). Without it, they are removed as soon as
+	// they are no longer needed.
+	Temp *tempfiles.Manager `json:"-"`
+	// Sandbox creates the inner ZIP in a restricted process instead of
+	// this one (optional). Checks of the setup file and drivers still run
+	// in this process.
+	Sandbox Sandbox `json:"-"`
+	// Progress receives progress events of CreatePackage (optional): one at
+	// the start of every stage, throttled events for the files of the zip
+	// stage and a StageDone event with the package path. It is called on
+	// the goroutine of CreatePackage or of the zip writer, never
+	// concurrently. With Sandbox, the zip stage has no file events.
+	Progress func(Progress) `json:"-"`
+}
+
+// Supported values for Options.Architecture
+const (
+	ArchX86   = "x86"
+	ArchX64   = "x64"
+	ArchARM64 = "arm64"
+)
+
+// Architectures lists all supported architectures
+var Architectures = []string{ArchX86, ArchX64, ArchARM64}
+
+// IsValidArchitecture reports whether arch is a supported architecture
+func IsValidArchitecture(arch string) bool {
+	for _, a := range Architectures {
+		if a == arch {
+			return true
+		}
+	}
+	return false
 }
 
 // Packager handles the creation of .intunewin packages
 type Packager struct {
-	opts Options
+	opts       Options
+	warnings   []Warning
+	skipped    []string
+	excluded   []string
+	emptyDirs  []string
+	hardLinks  []string
+	timings    []StageTiming
+	digest     *sourceDigest
+	sourceSize int64
+	duplicates []Duplicate
+	drivers    []Driver
+	streams    []StreamFile
+	buildInfo  *metadata.BuildInfo
+	buildTime  time.Time
+	progress   *progress
+}
+
+// generatedFile is a file added to the inner ZIP that is not part of the
+// source directory
+type generatedFile struct {
+	name    string
+	content []byte
 }
 
 // New creates a new Packager with the given options
@@ -54,168 +243,594 @@ func New(opts Options) *Packager {
 	return &Packager{opts: opts}
 }
 
-// log prints a message if not in quiet mode
+// log prints a message if not in quiet mode and sends it to the logger
 func (p *Packager) log(format string, args ...interface{}) {
 	if !p.opts.Quiet {
 		fmt.Printf(format+"\n", args...)
 	}
+	if p.opts.Logger != nil {
+		p.opts.Logger.Printf(format, args...)
+	}
 }
 
 // CreatePackage creates the .intunewin package and returns the output path
 func (p *Packager) CreatePackage() (string, error) {
+	p.warnings = nil
+	p.skipped = nil
+	p.excluded = nil
+	p.emptyDirs = nil
+	p.hardLinks = nil
+	p.timings = nil
+	p.duplicates = nil
+	p.drivers = nil
+	p.streams = nil
+	p.buildInfo = nil
+	p.progress = nil
+	if p.opts.Architecture != "" && !IsValidArchitecture(p.opts.Architecture) {
+		return "", fmt.Errorf("unsupported architecture %q (supported: %s)", p.opts.Architecture, strings.Join(Architectures, ", "))
+	}
+	if p.opts.Links != "" && p.opts.Links != LinkFollow && p.opts.Links != LinkSkip {
+		return "", fmt.Errorf("unsupported link mode %q (supported: %s)", p.opts.Links, strings.Join(LinkModes, ", "))
+	}
+	if p.opts.Unreadable != "" && !contains(UnreadableModes, p.opts.Unreadable) {
+		return "", fmt.Errorf("unsupported unreadable mode %q (supported: %s)", p.opts.Unreadable, strings.Join(UnreadableModes, ", "))
+	}
+	if err := checkEntryModes(p.opts); err != nil {
+		return "", err
+	}
+	if err := checkSuppress(p.opts); err != nil {
+		return "", err
+	}
+	if p.opts.Name != "" && sanitizeName(p.opts.Name) == "" {
+		return "", fmt.Errorf("invalid application name %q", p.opts.Name)
+	}
+	if p.opts.ToolVersion != "" {
+		if err := metadata.ValidateToolVersion(p.opts.ToolVersion); err != nil {
+			return "", err
+		}
+	}
+	if p.opts.ProfileIdentifier != "" {
+		if err := metadata.ValidateProfileIdentifier(p.opts.ProfileIdentifier); err != nil {
+			return "", err
+		}
+	}
+
 	// Step 1: Create inner ZIP of source folder
+	start := time.Now()
+	p.startProgress()
 	p.log("Step 1/4: Creating inner ZIP archive...")
 	innerZip, err := p.createInnerZip()
 	if err != nil {
 		return "", fmt.Errorf("failed to create inner ZIP: %w", err)
 	}
 	p.log("  Created inner ZIP: %d bytes", len(innerZip))
+	if err := p.checkSetupSignature(); err != nil {
+		return "", err
+	}
+	if err := p.checkDrivers(); err != nil {
+		return "", err
+	}
+	msiInfo, err := p.msiInfo()
+	if err != nil {
+		return "", err
+	}
+
+	start = p.timeStage(StageZip, start)
 
 	// Step 2: Encrypt the inner ZIP
+	p.stageProgress(StageEncrypt, "")
 	p.log("Step 2/4: Encrypting content...")
 	encInfo, encryptedContent, err := crypto.Encrypt(innerZip)
 	if err != nil {
 		return "", fmt.Errorf("failed to encrypt content: %w", err)
 	}
 	p.log("  Encrypted size: %d bytes", len(encryptedContent))
+	if err := p.checkContentSize(int64(len(encryptedContent))); err != nil {
+		return "", err
+	}
+
+	start = p.timeStage(StageEncrypt, start)
 
 	// Step 3: Generate Detection.xml
+	p.stageProgress(StageMetadata, "")
 	p.log("Step 3/4: Generating Detection.xml...")
-	appName := filepath.Base(p.opts.SourceDir)
+	appName := p.appName()
+	cryptoInfo := encInfo.ToBase64()
 	detectionXML, err := metadata.GenerateDetectionXML(metadata.DetectionXMLOptions{
-		Name:       appName,
-		SetupFile:  p.opts.SetupFile,
-		CryptoInfo: encInfo.ToBase64(),
+		Name:              appName,
+		SetupFile:         p.packagedSetupFile(),
+		CryptoInfo:        cryptoInfo,
+		MsiInfo:           msiInfo,
+		StrictCompat:      p.opts.StrictCompat,
+		ToolVersion:       p.opts.ToolVersion,
+		ProfileIdentifier: p.opts.ProfileIdentifier,
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to generate Detection.xml: %w", err)
 	}
 
+	start = p.timeStage(StageMetadata, start)
+
 	// Step 4: Create outer ZIP (.intunewin)
+	p.stageProgress(StagePackage, "")
 	p.log("Step 4/4: Creating .intunewin package...")
-	outputPath := filepath.Join(p.opts.OutputDir, appName+".intunewin")
-	if err := p.createOuterPackage(outputPath, encryptedContent, detectionXML); err != nil {
+	outputName := appName
+	if p.opts.Architecture != "" {
+		outputName += "_" + p.opts.Architecture
+	}
+	outputPath := filepath.Join(p.opts.OutputDir, outputName+".intunewin")
+	if err := p.createOuterPackage(outputPath, bytes.NewReader(encryptedContent), int64(len(encryptedContent)), detectionXML); err != nil {
 		return "", fmt.Errorf("failed to create outer package: %w", err)
 	}
+	start = p.timeStage(StagePackage, start)
 
+	if p.opts.EscrowKey != nil {
+		p.stageProgress(StageEscrow, "")
+		if err := p.escrowKeys(outputPath, detectionXML, cryptoInfo, p.opts.ProfileIdentifier); err != nil {
+			return "", err
+		}
+		p.timeStage(StageEscrow, start)
+	}
+
+	p.stageProgress(StageDone, outputPath)
 	return outputPath, nil
 }
 
+// escrowKeys escrows the Detection.xml of a package with Options.EscrowKey
+func (p *Packager) escrowKeys(outputPath string, detectionXML []byte, cryptoInfo crypto.EncryptionInfoBase64, profileIdentifier string) error {
+	if profileIdentifier == "" {
+		profileIdentifier = metadata.ProfileIdentifier
+	}
+	keysPath, _, err := escrow.Write(p.opts.EscrowKey, outputPath, detectionXML, escrow.Details{
+		UnencryptedContentSize: cryptoInfo.UnencryptedSize,
+		FileDigest:             cryptoInfo.FileDigest,
+		FileDigestAlgorithm:    metadata.FileDigestAlgorithm,
+		ProfileIdentifier:      profileIdentifier,
+		JobID:                  p.opts.JobID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to escrow keys: %w", err)
+	}
+	p.log("  Escrowed keys: %s", keysPath)
+	return nil
+}
+
+// appName returns the application name, which is Options.Name or derived
+// from the source directory. An architecture subfolder (e.g. myapp/x64) is
+// skipped so that all architectures of an application share the same name.
+func (p *Packager) appName() string {
+	if p.opts.Name != "" {
+		return sanitizeName(p.opts.Name)
+	}
+	name := filepath.Base(p.opts.SourceDir)
+	if p.opts.Architecture != "" && strings.EqualFold(name, p.opts.Architecture) {
+		name = filepath.Base(filepath.Dir(p.opts.SourceDir))
+	}
+	return name
+}
+
+// reservedNames are device names that cannot be used as Windows file names
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizeName makes an application name usable as a file name on Windows
+// by replacing reserved and control characters with underscores and
+// removing leading and trailing spaces and dots
+func sanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if reservedNames[strings.ToUpper(name)] {
+		name += "_"
+	}
+	return name
+}
+
+// setupFile returns the setup file recorded in Detection.xml
+func (p *Packager) setupFile() string {
+	if p.opts.MSIXWrapper {
+		return MSIXBootstrapScriptName
+	}
+	return p.opts.SetupFile
+}
+
+// msiInfo reads the Detection.xml MSI metadata of an MSI setup file. It
+// returns nil for other setup files, and with a WarnMsiInfo warning for MSI
+// files it cannot read.
+func (p *Packager) msiInfo() (*metadata.MsiInfo, error) {
+	setupFile := p.setupFile()
+	if !strings.EqualFold(filepath.Ext(setupFile), ".msi") {
+		return nil, nil
+	}
+
+	info, err := msi.Open(filepath.Join(p.opts.SourceDir, setupFile))
+	if err != nil {
+		// Detection.xml is valid without MsiInfo, as for other installers
+		return nil, p.warn(WarnMsiInfo, "MSI information of %s not read, Detection.xml has no MsiInfo: %v", setupFile, err)
+	}
+	return metadata.NewMsiInfo(info), nil
+}
+
+// generatedFiles returns the files added to the inner ZIP in addition to
+// the source directory
+func (p *Packager) generatedFiles() ([]generatedFile, error) {
+	if p.opts.MSIXWrapper {
+		return p.msixWrapperFiles()
+	}
+	return nil, nil
+}
+
 // createInnerZip creates a ZIP archive of the source directory
 func (p *Packager) createInnerZip() ([]byte, error) {
+	if p.opts.Sandbox != nil {
+		return p.sandboxInnerZip()
+	}
 	var buf bytes.Buffer
-	zw := zip.NewWriter(&buf)
+	if err := p.writeInnerZip(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeInnerZip writes a ZIP archive of the source directory to w
+func (p *Packager) writeInnerZip(w io.Writer) error {
+	generated, err := p.generatedFiles()
+	if err != nil {
+		return err
+	}
+	templates, err := p.parseGenerated()
+	if err != nil {
+		return err
+	}
+	p.digest = &sourceDigest{}
+	p.sourceSize = 0
+	p.buildTime = time.Now()
+
+	zw := zip.NewWriter(w)
 
 	baseDir := filepath.Base(p.opts.SourceDir)
+	entries := make(map[string]string)
+	dirs := &dirTracker{zw: zw, baseDir: baseDir, prune: p.opts.PruneEmptyDirs}
 
-	err := filepath.Walk(p.opts.SourceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	visited := make(map[string]bool)
+	if root, err := filepath.EvalSymlinks(p.opts.SourceDir); err == nil {
+		visited[root] = true
+	}
+	hardLinks := make(map[string]string)
 
-		// Get relative path from source directory
-		relPath, err := filepath.Rel(p.opts.SourceDir, path)
-		if err != nil {
-			return err
-		}
+	out := p.newZipPipeline(zw, dirs)
+	emitDir := func(header *zip.FileHeader) error {
+		return out.emit(func() error { return dirs.addDir(header) })
+	}
+
+	// walk adds the files below root as relRoot. It is called again for
+	// the target of every followed directory link. Directory entries carry
+	// their type, so that regular files are not stat'ed before they are
+	// opened.
+	var walk func(root, relRoot string) error
+	var visit func(path, relPath string, d fs.DirEntry) error
+	walk = func(root, relRoot string) error {
+		return walkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// Folders below root that cannot be read stay empty
+				if d == nil || path == root || p.opts.Unreadable != UnreadableSkip {
+					return err
+				}
+				relPath, relErr := filepath.Rel(root, path)
+				if relErr != nil {
+					return err
+				}
+				if err := p.skipUnreadable(baseDir+"/"+filepath.ToSlash(filepath.Join(relRoot, relPath))+"/", err); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+			if err := out.err(); err != nil {
+				return err
+			}
+
+			// Get relative path from source directory
+			relPath, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+
+			// Skip the root directory itself
+			if relPath == "." {
+				return nil
+			}
+			return visit(path, filepath.Join(relRoot, relPath), d)
+		})
+	}
 
-		// Skip the root directory itself
-		if relPath == "." {
+	// visit adds a single file or directory as relPath
+	visit = func(path, relPath string, d fs.DirEntry) error {
+		if !p.opts.IncludeHidden && IsExcluded(d) {
+			p.excluded = append(p.excluded, filepath.ToSlash(relPath))
+			p.log("  Excluded: %s", filepath.ToSlash(relPath))
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		// Create the archive path (include base directory name)
-		archivePath := filepath.Join(baseDir, relPath)
-		// Normalize path separators for ZIP format (always use forward slashes)
-		archivePath = strings.ReplaceAll(archivePath, string(os.PathSeparator), "/")
+		// Package the target of links under the path of the link
+		var info os.FileInfo
+		var err error
+		linkTarget := ""
+		if isLink(d) {
+			if p.opts.Links == LinkSkip {
+				p.excluded = append(p.excluded, filepath.ToSlash(relPath))
+				p.log("  Excluded link: %s", filepath.ToSlash(relPath))
+				return nil
+			}
+			target, targetInfo, err := resolveLink(path, visited)
+			if err != nil {
+				return err
+			}
+			if targetInfo == nil {
+				return p.warn(WarnLinkSkipped, "%s links to %s, which is already packaged; link skipped", filepath.ToSlash(relPath), target)
+			}
+			path, info = target, targetInfo
+			if info.IsDir() {
+				linkTarget = target
+			}
+		} else if d.IsDir() {
+			if info, err = d.Info(); err != nil {
+				return err
+			}
+		}
 
-		// Create header
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return fmt.Errorf("failed to create header for %s: %w", relPath, err)
+		// Rewrite rules move entries to other paths of the package, whose
+		// parent folders may not exist in the source
+		packagePath := filepath.ToSlash(relPath)
+		if len(p.opts.Rewrites) > 0 {
+			packagePath = RewritePath(p.opts.Rewrites, packagePath)
+			if packagePath == "" {
+				if info == nil || !info.IsDir() {
+					return fmt.Errorf("rewrite moves file %s to the package root", filepath.ToSlash(relPath))
+				}
+				if linkTarget != "" {
+					return walk(linkTarget, relPath)
+				}
+				return nil
+			}
+			if i := strings.LastIndex(packagePath, "/"); i > 0 {
+				if err := p.addTargetDirs(emitDir, entries, baseDir, packagePath[:i]); err != nil {
+					return err
+				}
+			}
 		}
-		header.Name = archivePath
-		header.Method = zip.Deflate
 
-		if info.IsDir() {
+		// Create the archive path (include base directory name), with
+		// forward slashes as required by the ZIP format
+		archivePath := baseDir + "/" + packagePath
+
+		if info != nil && info.IsDir() {
+			// Merged sources add their files to folders of the same name
+			if entries[strings.ToLower(archivePath)] == archivePath {
+				if linkTarget != "" {
+					return walk(linkTarget, relPath)
+				}
+				return nil
+			}
+			if err := p.checkEntry(entries, archivePath); err != nil {
+				return err
+			}
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return fmt.Errorf("failed to create header for %s: %w", relPath, err)
+			}
 			// Ensure directory entries end with /
-			if !strings.HasSuffix(header.Name, "/") {
-				header.Name += "/"
+			header.Name = archivePath + "/"
+			header.Method = zip.Deflate
+			p.setAttributes(header, info)
+			if err := out.emit(func() error { return dirs.addDir(header) }); err != nil {
+				return err
 			}
-			_, err := zw.CreateHeader(header)
-			return err
+			if linkTarget != "" {
+				return walk(linkTarget, relPath)
+			}
+			return nil
 		}
 
-		// Create file entry
-		writer, err := zw.CreateHeader(header)
-		if err != nil {
-			return fmt.Errorf("failed to create entry for %s: %w", relPath, err)
+		if err := p.checkStreams(path, archivePath); err != nil {
+			return err
 		}
 
-		// Copy file content
-		file, err := os.Open(path)
+		// Open files before writing their header, so that locked files
+		// can be skipped
+		file, err := p.openSourceFile(path)
 		if err != nil {
+			if p.opts.SkipLocked && isTransientOpenError(err) {
+				p.skipped = append(p.skipped, archivePath)
+				p.log("  Skipped locked file: %s", archivePath)
+				return nil
+			}
+			if p.opts.Unreadable == UnreadableSkip {
+				return p.skipUnreadable(archivePath, err)
+			}
 			return fmt.Errorf("failed to open %s: %w", path, err)
 		}
-		defer file.Close()
 
-		if _, err := io.Copy(writer, file); err != nil {
-			return fmt.Errorf("failed to write %s: %w", relPath, err)
+		// ZIP files cannot share content between entries, so with
+		// SkipHardLinks only the first hard link to a file is packaged
+		if id, ok := hardLinkID(file); ok && p.opts.SkipHardLinks {
+			if first, seen := hardLinks[id]; seen {
+				file.Close()
+				p.hardLinks = append(p.hardLinks, filepath.ToSlash(relPath)+" => "+first)
+				return p.warn(WarnHardLinkSkipped, "hard link %s left out, it has the same content as %s", filepath.ToSlash(relPath), first)
+			}
+			hardLinks[id] = filepath.ToSlash(relPath)
 		}
 
-		return nil
-	})
+		if err := p.checkEntry(entries, archivePath); err != nil {
+			file.Close()
+			return err
+		}
+		if err := p.checkFileSize(file, archivePath); err != nil {
+			file.Close()
+			return err
+		}
 
-	if err != nil {
-		return nil, err
+		// The pipeline reads the content before creating the header, so
+		// that the header describes exactly the content written, and
+		// closes the file
+		return out.addFile(file, archivePath)
 	}
 
-	if err := zw.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close ZIP writer: %w", err)
+	// merge adds an additional source below its target folder: the files
+	// of a folder, or a single file
+	merge := func(src Source) error {
+		target, err := sourceTarget(src.Target)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(src.Path)
+		if err != nil {
+			return fmt.Errorf("failed to access source %s: %w", src.Path, err)
+		}
+		if err := p.addTargetDirs(emitDir, entries, baseDir, target); err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return visit(src.Path, filepath.Join(target, filepath.Base(src.Path)), fs.FileInfoToDirEntry(info))
+		}
+		if root, err := filepath.EvalSymlinks(src.Path); err == nil {
+			visited[root] = true
+		}
+		return walk(src.Path, filepath.FromSlash(target))
 	}
 
-	return buf.Bytes(), nil
-}
-
-// createOuterPackage creates the final .intunewin file with the standard structure
-func (p *Packager) createOuterPackage(outputPath string, encryptedContent, detectionXML []byte) error {
-	file, err := os.Create(outputPath)
+	err = walk(p.opts.SourceDir, "")
+	for _, src := range p.opts.Sources {
+		if err != nil {
+			break
+		}
+		err = merge(src)
+	}
+	if closeErr := out.close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return err
+	}
+	dirs.close()
+	p.emptyDirs = dirs.empty
+	if len(p.emptyDirs) > 0 {
+		action := "included"
+		if p.opts.PruneEmptyDirs {
+			action = "pruned"
+		}
+		p.log("  Empty directories (%s): %s", action, strings.Join(p.emptyDirs, ", "))
+	}
+	if err := p.reportStreams(); err != nil {
+		return err
 	}
-	defer file.Close()
 
-	zw := zip.NewWriter(file)
-	defer zw.Close()
+	// Generated files are rendered with the digest of the source files
+	rendered, err := p.renderGenerated(templates, p.digest.sum())
+	if err != nil {
+		return err
+	}
+	generated = append(generated, rendered...)
+	createDir := func(header *zip.FileHeader) error {
+		_, err := zw.CreateHeader(header)
+		return err
+	}
+	for _, g := range generated {
+		if _, err := os.Lstat(filepath.Join(p.opts.SourceDir, g.name)); err == nil || entries[strings.ToLower(baseDir+"/"+g.name)] != "" {
+			return fmt.Errorf("generated file %s conflicts with a source file", g.name)
+		}
+		if i := strings.LastIndex(g.name, "/"); i > 0 {
+			if err := p.addTargetDirs(createDir, entries, baseDir, g.name[:i]); err != nil {
+				return err
+			}
+		}
+		entries[strings.ToLower(baseDir+"/"+g.name)] = baseDir + "/" + g.name
+		header := &zip.FileHeader{
+			Name:   baseDir + "/" + g.name,
+			Method: zip.Deflate,
+		}
+		header.SetMode(0644)
+		p.setAttributes(header, nil)
+		writer, err := zw.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("failed to create entry for %s: %w", g.name, err)
+		}
+		if _, err := writer.Write(g.content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", g.name, err)
+		}
+		p.digest.add(header.Name, g.content)
+	}
 
-	// Add Detection.xml to IntuneWinPackage/Metadata/
-	metadataPath := "IntuneWinPackage/Metadata/Detection.xml"
-	if err := p.addToZip(zw, metadataPath, detectionXML); err != nil {
-		return fmt.Errorf("failed to add Detection.xml: %w", err)
+	p.duplicates = p.digest.duplicates()
+	for _, d := range p.duplicates {
+		p.log("  Duplicate content (%d bytes wasted): %s", d.Wasted(), strings.Join(d.Paths, ", "))
+	}
+	if p.opts.BuildInfo {
+		p.buildInfo = p.newBuildInfo(p.digest.sum())
+		if err := zw.SetComment(p.buildInfo.Comment()); err != nil {
+			return err
+		}
 	}
 
-	// Add encrypted content to IntuneWinPackage/Contents/
-	contentsPath := "IntuneWinPackage/Contents/" + metadata.EncryptedFileName
-	if err := p.addToZip(zw, contentsPath, encryptedContent); err != nil {
-		return fmt.Errorf("failed to add encrypted content: %w", err)
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to close ZIP writer: %w", err)
 	}
 
 	return nil
 }
 
-// addToZip adds a file to the ZIP archive
-func (p *Packager) addToZip(zw *zip.Writer, path string, content []byte) error {
-	header := &zip.FileHeader{
-		Name:   path,
-		Method: zip.Deflate,
-	}
-	header.SetMode(0644)
+// createOuterPackage creates the final .intunewin file with the standard
+// structure, retrying transient errors as set by Options.WriteRetries
+func (p *Packager) createOuterPackage(outputPath string, encrypted io.ReaderAt, encryptedSize int64, detectionXML []byte) error {
+	policy := retry.Policy{Retries: p.opts.WriteRetries, Delay: p.opts.WriteRetryDelay}
+	return policy.Do(func() error {
+		return p.writeOuterPackage(outputPath, io.NewSectionReader(encrypted, 0, encryptedSize), detectionXML)
+	}, func(err error, delay time.Duration) {
+		p.log("  Writing %s failed, retrying in %s: %v", outputPath, delay, err)
+	})
+}
 
-	writer, err := zw.CreateHeader(header)
+// writeOuterPackage writes the .intunewin file. The package is written
+// next to its output path and renamed into place, so that a failed or
+// interrupted build leaves no partial package behind.
+func (p *Packager) writeOuterPackage(outputPath string, encrypted io.Reader, detectionXML []byte) error {
+	file, err := p.opts.Temp.File(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".*.tmp")
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to create output file: %w", err)
 	}
+	defer p.opts.Temp.Release(file.Name())
+	defer file.Close()
 
-	_, err = writer.Write(content)
-	return err
+	var comment string
+	if p.buildInfo != nil {
+		comment = p.buildInfo.Comment()
+	}
+	if err := writeOuter(file, comment, detectionXML, encrypted); err != nil {
+		return err
+	}
+	if err := file.Chmod(0644); err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := renameFile(file.Name(), outputPath); err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	return nil
 }
+
+// renameFile is a variable so that tests can simulate failing writes
+var renameFile = os.Rename
@@ -4,11 +4,19 @@ import (
 	"archive/zip"
 	"bytes"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/MANCHTOOLS/open-package/metadata"
+	"github.com/MANCHTOOLS/open-package/tempfiles"
+	"github.com/MANCHTOOLS/open-package/unpacker"
 )
 
 func TestCreatePackage(t *testing.T) {
@@ -207,3 +215,741 @@ func TestCreateInnerZip(t *testing.T) {
 		}
 	}
 }
+
+func TestCreatePackageArchitecture(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-arch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "myapp", "x64")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.exe"), []byte("exe"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+
+	pkg := New(Options{
+		SourceDir:    sourceDir,
+		SetupFile:    "install.exe",
+		OutputDir:    tempDir,
+		Quiet:        true,
+		Architecture: ArchX64,
+	})
+
+	outputPath, err := pkg.CreatePackage()
+	if err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+
+	// The architecture subfolder is skipped for the name and the
+	// architecture is appended to the file name
+	if filepath.Base(outputPath) != "myapp_x64.intunewin" {
+		t.Errorf("Unexpected output name: %s", filepath.Base(outputPath))
+	}
+
+	pkg = New(Options{
+		SourceDir:    sourceDir,
+		SetupFile:    "install.exe",
+		OutputDir:    tempDir,
+		Quiet:        true,
+		Architecture: "ia64",
+	})
+	if _, err := pkg.CreatePackage(); err == nil {
+		t.Error("Expected error for unsupported architecture")
+	}
+}
+
+func TestCreatePackageName(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-name-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "build-output")
+	if err := os.Mkdir(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.exe"), []byte("exe"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+
+	pkg := New(Options{
+		SourceDir: sourceDir,
+		SetupFile: "install.exe",
+		OutputDir: tempDir,
+		Quiet:     true,
+		Name:      "Contoso: App/Tools?",
+	})
+	outputPath, err := pkg.CreatePackage()
+	if err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	if filepath.Base(outputPath) != "Contoso_ App_Tools_.intunewin" {
+		t.Errorf("Unexpected output name: %s", filepath.Base(outputPath))
+	}
+
+	tests := map[string]string{
+		"My App":    "My App",
+		" app. ":    "app",
+		"CON":       "CON_",
+		"a\tb":      "a_b",
+		"...":       "",
+		`x<y>"z"|*`: "x_y__z___",
+	}
+	for in, expected := range tests {
+		if got := sanitizeName(in); got != expected {
+			t.Errorf("sanitizeName(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+
+	pkg = New(Options{SourceDir: sourceDir, SetupFile: "install.exe", OutputDir: tempDir, Quiet: true, Name: ".."})
+	if _, err := pkg.CreatePackage(); err == nil {
+		t.Error("Expected error for invalid name")
+	}
+}
+
+func TestCreatePackageStrict(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-strict-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	longDir := filepath.Join(sourceDir, strings.Repeat("d", 120), strings.Repeat("e", 120))
+	if err := os.MkdirAll(longDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.cmd"), []byte("@echo off"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(longDir, "f.txt"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	opts := Options{SourceDir: sourceDir, SetupFile: "install.cmd", OutputDir: tempDir, Quiet: true}
+	pkg := New(opts)
+	if _, err := pkg.CreatePackage(); err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	if len(pkg.Warnings()) == 0 {
+		t.Fatal("Expected a path length warning")
+	}
+	for _, w := range pkg.Warnings() {
+		if !strings.Contains(w, "exceeds 260 characters") {
+			t.Errorf("Unexpected warning: %s", w)
+		}
+	}
+
+	for _, w := range pkg.WarningDetails() {
+		if w.Code != WarnLongPath || !strings.HasSuffix(w.String(), "("+WarnLongPath+")") {
+			t.Errorf("Unexpected warning code: %s", w)
+		}
+	}
+
+	opts.Strict = true
+	if _, err := New(opts).CreatePackage(); !errors.Is(err, ErrStrict) {
+		t.Errorf("Expected ErrStrict, got %v", err)
+	}
+
+	// Suppressed warnings are dropped, also in strict mode
+	opts.Suppress = []string{WarnLongPath}
+	pkg = New(opts)
+	if _, err := pkg.CreatePackage(); err != nil {
+		t.Fatalf("CreatePackage failed with a suppressed warning: %v", err)
+	}
+	if len(pkg.Warnings()) != 0 {
+		t.Errorf("Expected no warnings, got %v", pkg.Warnings())
+	}
+
+	opts.Suppress = []string{"W999"}
+	if _, err := New(opts).CreatePackage(); err == nil || !strings.Contains(err.Error(), "unknown warning code") {
+		t.Errorf("Expected an error for an unknown warning code, got %v", err)
+	}
+}
+
+func TestCreatePackageUnreadableMSI(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-msi-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "setup.msi"), []byte("not a compound file"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+
+	// The package is created without MsiInfo
+	p := New(Options{SourceDir: sourceDir, SetupFile: "setup.msi", OutputDir: tempDir, Quiet: true, Suppress: []string{WarnSignatureCheck}})
+	outputPath, err := p.CreatePackage()
+	if err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	if details := p.WarningDetails(); len(details) != 1 || details[0].Code != WarnMsiInfo {
+		t.Errorf("Expected a warning for the MSI, got %v", details)
+	}
+	pkg, err := unpacker.Open(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to open package: %v", err)
+	}
+	if pkg.Info.MsiInfo != nil {
+		t.Errorf("Expected no MsiInfo, got %+v", pkg.Info.MsiInfo)
+	}
+
+	p = New(Options{SourceDir: sourceDir, SetupFile: "setup.msi", OutputDir: tempDir, Quiet: true, Strict: true, Suppress: []string{WarnSignatureCheck}})
+	if _, err := p.CreatePackage(); !errors.Is(err, ErrStrict) {
+		t.Errorf("Expected a strict mode error, got %v", err)
+	}
+}
+
+func TestCreateInnerZipSizeLimits(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-limits-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	for name, size := range map[string]int{"a.txt": 100, "b.dmp": 5000, "c.txt": 100} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), make([]byte, size), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	opts := Options{SourceDir: sourceDir, Quiet: true, MaxFileSize: 1000, MaxSourceSize: 2000}
+	p := New(opts)
+	if _, err := p.createInnerZip(); err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	warnings := p.Warnings()
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "app/b.dmp is 5000 bytes") || !strings.Contains(warnings[1], "total size limit of 2000 bytes at app/b.dmp") {
+		t.Errorf("Unexpected warnings: %v", warnings)
+	}
+
+	opts.FailOnSizeLimit = true
+	if _, err := New(opts).createInnerZip(); !errors.Is(err, ErrSizeLimit) {
+		t.Errorf("Expected ErrSizeLimit, got %v", err)
+	}
+}
+
+func TestCheckEntryCollision(t *testing.T) {
+	p := New(Options{})
+	entries := make(map[string]string)
+	if err := p.checkEntry(entries, "app/Setup.exe"); err != nil {
+		t.Fatalf("checkEntry failed: %v", err)
+	}
+	if err := p.checkEntry(entries, "app/setup.EXE"); err != nil {
+		t.Fatalf("checkEntry failed: %v", err)
+	}
+	if len(p.Warnings()) != 1 || !strings.Contains(p.Warnings()[0], "collides with app/Setup.exe") {
+		t.Errorf("Unexpected warnings: %v", p.Warnings())
+	}
+
+	p = New(Options{Strict: true})
+	entries = map[string]string{"app/setup.exe": "app/Setup.exe"}
+	if err := p.checkEntry(entries, "app/SETUP.exe"); !errors.Is(err, ErrStrict) {
+		t.Errorf("Expected ErrStrict, got %v", err)
+	}
+}
+
+func TestCheckSetupSignature(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-signature-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	signed := "Write-Host hi\r\n# SIG # Begin signature block\r\n# MIIE\r\n# SIG # End signature block\r\n"
+	if err := os.WriteFile(filepath.Join(tempDir, "signed.ps1"), []byte(signed), 0644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "unsigned.ps1"), []byte("Write-Host hi"), 0644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	p := New(Options{SourceDir: tempDir, SetupFile: "signed.ps1", Strict: true})
+	if err := p.checkSetupSignature(); err != nil {
+		t.Errorf("Unexpected error for signed script: %v", err)
+	}
+	p = New(Options{SourceDir: tempDir, SetupFile: "unsigned.ps1", Strict: true})
+	if err := p.checkSetupSignature(); !errors.Is(err, ErrStrict) {
+		t.Errorf("Expected ErrStrict for unsigned script, got %v", err)
+	}
+}
+
+func TestCreateInnerZipExcludesJunk(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-junk-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	files := []string{"install.exe", "Thumbs.db", "docs/desktop.ini", "docs/.DS_Store", "docs/~$report.tmp", "docs/readme.txt"}
+	for _, name := range files {
+		path := filepath.Join(sourceDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	p := New(Options{SourceDir: sourceDir, SetupFile: "install.exe", Quiet: true})
+	innerZip, err := p.createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	expected := []string{"app/docs/", "app/docs/readme.txt", "app/install.exe"}
+	if names := zipNames(t, innerZip); strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("Unexpected entries: %v", names)
+	}
+	if len(p.Excluded()) != 4 {
+		t.Errorf("Expected 4 excluded files, got %v", p.Excluded())
+	}
+
+	p = New(Options{SourceDir: sourceDir, SetupFile: "install.exe", Quiet: true, IncludeHidden: true})
+	innerZip, err = p.createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	if names := zipNames(t, innerZip); len(names) != len(files)+1 {
+		t.Errorf("Expected all files with IncludeHidden, got %v", names)
+	}
+}
+
+func TestCreateInnerZipEmptyDirs(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-emptydirs-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	for _, dir := range []string{"cache", "data/logs", "lib/x64"} {
+		if err := os.MkdirAll(filepath.Join(sourceDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	for _, name := range []string{"install.exe", "lib/x64/core.dll"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	// Empty directories are included by default
+	p := New(Options{SourceDir: sourceDir, SetupFile: "install.exe", Quiet: true})
+	innerZip, err := p.createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	expected := "app/cache/,app/data/,app/data/logs/,app/install.exe,app/lib/,app/lib/x64/,app/lib/x64/core.dll"
+	if names := strings.Join(zipNames(t, innerZip), ","); names != expected {
+		t.Errorf("Unexpected entries: %s", names)
+	}
+	if empty := strings.Join(p.EmptyDirs(), ","); empty != "cache,data,data/logs" {
+		t.Errorf("Unexpected empty dirs: %s", empty)
+	}
+
+	p = New(Options{SourceDir: sourceDir, SetupFile: "install.exe", Quiet: true, PruneEmptyDirs: true})
+	innerZip, err = p.createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	expected = "app/install.exe,app/lib/,app/lib/x64/,app/lib/x64/core.dll"
+	if names := strings.Join(zipNames(t, innerZip), ","); names != expected {
+		t.Errorf("Unexpected entries with pruning: %s", names)
+	}
+	if len(p.EmptyDirs()) != 3 {
+		t.Errorf("Expected 3 empty dirs, got %v", p.EmptyDirs())
+	}
+}
+
+func TestCreateInnerZipDuplicates(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-duplicates-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	files := map[string]string{
+		"install.exe":         "setup",
+		"x86/vc_redist.exe":   "runtime runtime",
+		"x64/vc_redist.exe":   "runtime runtime",
+		"arm64/vc_redist.exe": "runtime runtime",
+		"a/license.txt":       "license",
+		"b/license.txt":       "license",
+		"a/empty.txt":         "",
+		"b/empty.txt":         "",
+	}
+	for name, content := range files {
+		path := filepath.Join(sourceDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	p := New(Options{SourceDir: sourceDir, SetupFile: "install.exe", Quiet: true, Workers: 4})
+	if _, err := p.createInnerZip(); err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	duplicates := p.Duplicates()
+	if len(duplicates) != 2 {
+		t.Fatalf("Expected 2 duplicates, got %+v", duplicates)
+	}
+	if strings.Join(duplicates[0].Paths, ",") != "arm64/vc_redist.exe,x64/vc_redist.exe,x86/vc_redist.exe" || duplicates[0].Wasted() != 30 {
+		t.Errorf("Unexpected first duplicate: %+v", duplicates[0])
+	}
+	if strings.Join(duplicates[1].Paths, ",") != "a/license.txt,b/license.txt" || duplicates[1].Wasted() != 7 {
+		t.Errorf("Unexpected second duplicate: %+v", duplicates[1])
+	}
+	if wasted := WastedSize(duplicates); wasted != 37 {
+		t.Errorf("Expected 37 bytes wasted, got %d", wasted)
+	}
+}
+
+func TestCreateInnerZipLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symbolic links requires privileges on Windows")
+	}
+
+	tempDir, err := os.MkdirTemp("", "intunewin-links-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	sharedDir := filepath.Join(tempDir, "shared")
+	for _, dir := range []string{sourceDir, sharedDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.exe"), []byte("setup"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sharedDir, "common.dll"), []byte("common"), 0644); err != nil {
+		t.Fatalf("Failed to create shared file: %v", err)
+	}
+	if err := os.Link(filepath.Join(sourceDir, "install.exe"), filepath.Join(sourceDir, "setup.exe")); err != nil {
+		t.Fatalf("Failed to create hard link: %v", err)
+	}
+	if err := os.Symlink(sharedDir, filepath.Join(sourceDir, "lib")); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	if err := os.Symlink(sourceDir, filepath.Join(sourceDir, "loop")); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	p := New(Options{SourceDir: sourceDir, SetupFile: "install.exe", Quiet: true})
+	innerZip, err := p.createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	expected := "app/install.exe,app/lib/,app/lib/common.dll,app/setup.exe"
+	if names := strings.Join(zipNames(t, innerZip), ","); names != expected {
+		t.Errorf("Unexpected entries: %s", names)
+	}
+	if len(p.HardLinks()) != 0 {
+		t.Errorf("Expected every hard link to be packaged, got %v", p.HardLinks())
+	}
+	if len(p.Warnings()) != 1 || !strings.Contains(p.Warnings()[0], "loop") {
+		t.Errorf("Expected a warning for the link cycle, got %v", p.Warnings())
+	}
+
+	p = New(Options{SourceDir: sourceDir, SetupFile: "install.exe", Quiet: true, Links: LinkSkip, SkipHardLinks: true})
+	innerZip, err = p.createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	if links := strings.Join(p.HardLinks(), ","); links != "setup.exe => install.exe" {
+		t.Errorf("Unexpected hard links: %s", links)
+	}
+	if details := p.WarningDetails(); len(details) != 1 || details[0].Code != WarnHardLinkSkipped {
+		t.Errorf("Expected a warning for the skipped hard link, got %v", details)
+	}
+	expected = "app/install.exe"
+	if names := strings.Join(zipNames(t, innerZip), ","); names != expected {
+		t.Errorf("Unexpected entries with skipped links: %s", names)
+	}
+	if excluded := strings.Join(p.Excluded(), ","); excluded != "lib,loop" {
+		t.Errorf("Unexpected excluded links: %s", excluded)
+	}
+
+	p = New(Options{SourceDir: sourceDir, SetupFile: "install.exe", Quiet: true, Links: LinkSkip, SkipHardLinks: true, Strict: true})
+	if _, err := p.createInnerZip(); !errors.Is(err, ErrStrict) {
+		t.Errorf("Expected a strict mode error for the skipped hard link, got %v", err)
+	}
+
+	p = New(Options{SourceDir: sourceDir, SetupFile: "install.exe", Quiet: true, Links: "copy"})
+	if _, err := p.CreatePackage(); err == nil {
+		t.Error("Expected an error for an unsupported link mode")
+	}
+}
+
+func TestCreateInnerZipWorkers(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-workers-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	for i := 0; i < 50; i++ {
+		name := filepath.Join(sourceDir, fmt.Sprintf("dir%d", i%5), fmt.Sprintf("file%02d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(name, bytes.Repeat([]byte(name), i), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(sourceDir, "empty"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+
+	contents := func(workers int) map[string]string {
+		p := New(Options{SourceDir: sourceDir, Quiet: true, Workers: workers, PruneEmptyDirs: true, BuildInfo: true})
+		innerZip, err := p.createInnerZip()
+		if err != nil {
+			t.Fatalf("createInnerZip with %d workers failed: %v", workers, err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(innerZip), int64(len(innerZip)))
+		if err != nil {
+			t.Fatalf("Invalid ZIP: %v", err)
+		}
+		files := make(map[string]string)
+		for i, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatalf("Failed to open %s: %v", f.Name, err)
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", f.Name, err)
+			}
+			files[fmt.Sprintf("%03d %s", i, f.Name)] = string(data)
+		}
+		files["source digest"] = p.BuildInfo().SourceSHA256
+		return files
+	}
+
+	sequential := contents(1)
+	parallel := contents(4)
+	if len(sequential) != 56 {
+		t.Errorf("Expected 55 entries and the source digest, got %d", len(sequential))
+	}
+	if len(parallel) != len(sequential) {
+		t.Fatalf("Expected %d entries with workers, got %d", len(sequential), len(parallel))
+	}
+	for name, data := range sequential {
+		if parallel[name] != data {
+			t.Errorf("Entry %s differs with workers", name)
+		}
+	}
+}
+
+func TestCreatePackageTimings(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-timings-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := os.WriteFile(filepath.Join(tempDir, "install.exe"), []byte("setup"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+
+	p := New(Options{SourceDir: tempDir, SetupFile: "install.exe", OutputDir: tempDir, Quiet: true})
+	if _, err := p.CreatePackage(); err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	var stages []string
+	for _, timing := range p.Timings() {
+		stages = append(stages, timing.Stage)
+	}
+	if got := strings.Join(stages, ","); got != "zip,encrypt,metadata,package" {
+		t.Errorf("Unexpected stages: %s", got)
+	}
+}
+
+func TestCreatePackageTemp(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-temp-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	outputDir := filepath.Join(tempDir, "output")
+	for _, dir := range []string{sourceDir, outputDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.exe"), []byte("setup"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+
+	temp := tempfiles.New(false, nil)
+	p := New(Options{SourceDir: sourceDir, SetupFile: "install.exe", OutputDir: outputDir, Quiet: true, Temp: temp})
+	if _, err := p.CreatePackage(); err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	if _, err := p.CreateUninstallPackage("uninstall.exe"); err != nil {
+		t.Fatalf("CreateUninstallPackage failed: %v", err)
+	}
+	if paths := temp.Paths(); len(paths) != 0 {
+		t.Errorf("Expected no temporary paths left, got %v", paths)
+	}
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatalf("Failed to read output dir: %v", err)
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".intunewin") {
+			t.Errorf("Unexpected file %s in output dir", entry.Name())
+		}
+	}
+
+	// Packages cannot be written after the build was cleaned up
+	temp.Cleanup()
+	if _, err := p.CreatePackage(); !errors.Is(err, tempfiles.ErrCleanedUp) {
+		t.Errorf("Expected ErrCleanedUp after cleanup, got %v", err)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-estimate-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "lib"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	words := strings.Fields("the installer copies files registry keys and shortcuts to the program folder of every user")
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		var content bytes.Buffer
+		for content.Len() < 20000*(i+1) {
+			content.WriteString(words[rng.Intn(len(words))])
+			content.WriteByte(' ')
+		}
+		if err := os.WriteFile(filepath.Join(sourceDir, "lib", fmt.Sprintf("file%d.txt", i)), content.Bytes(), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.exe"), []byte("setup"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+
+	p := New(Options{SourceDir: sourceDir, SetupFile: "install.exe", OutputDir: tempDir, Quiet: true})
+	outputPath, err := p.CreatePackage()
+	if err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	stat, err := os.Stat(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to stat package: %v", err)
+	}
+
+	within := func(name string, got, want int64, tolerance float64) {
+		t.Helper()
+		if diff := float64(got-want) / float64(want); diff > tolerance || diff < -tolerance {
+			t.Errorf("%s estimate %d is off from %d by %.1f%%", name, got, want, diff*100)
+		}
+	}
+
+	est, err := p.Estimate(0)
+	if err != nil {
+		t.Fatalf("Estimate failed: %v", err)
+	}
+	if est.Files != 21 || est.Dirs != 1 || est.SampledSize != est.SourceSize {
+		t.Errorf("Unexpected estimate: %+v", est)
+	}
+	within("package size", est.PackageSize, stat.Size(), 0.05)
+
+	// A small sample still gives a usable estimate
+	est, err = p.Estimate(256 << 10)
+	if err != nil {
+		t.Fatalf("Estimate failed: %v", err)
+	}
+	if est.SampledSize >= est.SourceSize {
+		t.Errorf("Expected a partial sample, got %d of %d bytes", est.SampledSize, est.SourceSize)
+	}
+	within("sampled package size", est.PackageSize, stat.Size(), 0.1)
+	if est.DeviceSize < est.SourceSize+est.ContentSize {
+		t.Errorf("Device size %d does not cover content and extracted files", est.DeviceSize)
+	}
+}
+
+func TestRotateKeys(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-rotate-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.exe"), []byte("setup"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+
+	original, err := New(Options{SourceDir: sourceDir, SetupFile: "install.exe", OutputDir: tempDir, Name: "My App", Quiet: true}).CreatePackage()
+	if err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	inner, err := unpacker.OpenInner(original, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to open original package: %v", err)
+	}
+	defer inner.Close()
+	before := inner.Package
+	content := inner.Content()
+
+	rotated := filepath.Join(tempDir, "rotated.intunewin")
+	if err := New(Options{Quiet: true}).RotateKeys(before.Info, content, content.Size(), rotated); err != nil {
+		t.Fatalf("RotateKeys failed: %v", err)
+	}
+
+	after, err := unpacker.Open(rotated)
+	if err != nil {
+		t.Fatalf("Failed to open rotated package: %v", err)
+	}
+	if err := after.Verify(); err != nil {
+		t.Fatalf("Rotated package does not verify: %v", err)
+	}
+	if after.Info.EncryptionInfo.EncryptionKey == before.Info.EncryptionInfo.EncryptionKey {
+		t.Error("Expected a new encryption key")
+	}
+	if after.Info.EncryptionInfo.FileDigest != before.Info.EncryptionInfo.FileDigest {
+		t.Error("Expected the content digest to be unchanged")
+	}
+	if after.Info.Name != "My App" || after.Info.SetupFile != "install.exe" {
+		t.Errorf("Unexpected Detection.xml fields: %+v", after.Info)
+	}
+}
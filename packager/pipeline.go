@@ -0,0 +1,292 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// compressionLevel matches the Deflate compressor of archive/zip, so that
+// parallel packaging produces the same compression
+const compressionLevel = 5
+
+// spoolThreshold is the size of source files above which their compressed
+// content is spooled to a temporary file instead of memory
+const spoolThreshold = 8 << 20
+
+// flateWriters reuses compressors between files, which matters for trees
+// with many small files
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		fw, _ := flate.NewWriter(nil, compressionLevel)
+		return fw
+	},
+}
+
+// zipPipeline writes the entries of the inner ZIP in walk order. With
+// Options.Workers above one, files are read and compressed in parallel and
+// written as raw entries by a single writer goroutine.
+type zipPipeline struct {
+	p    *Packager
+	zw   *zip.Writer
+	dirs *dirTracker
+
+	// workers limits the files read at the same time and ordered queues
+	// the writes. Both are nil when files are packaged one at a time.
+	workers chan struct{}
+	ordered chan func() error
+	done    chan struct{}
+
+	mu       sync.Mutex
+	firstErr error
+	// spools are the spool files not yet written, removed by close
+	spools map[*os.File]bool
+}
+
+// compressedFile is a file read and compressed by a worker. Its content is
+// in data, or in spool for large files.
+type compressedFile struct {
+	header *zip.FileHeader
+	data   []byte
+	spool  *os.File
+	err    error
+}
+
+func (p *Packager) newZipPipeline(zw *zip.Writer, dirs *dirTracker) *zipPipeline {
+	out := &zipPipeline{p: p, zw: zw, dirs: dirs, spools: make(map[*os.File]bool)}
+	if p.opts.Workers > 1 {
+		out.workers = make(chan struct{}, p.opts.Workers)
+		out.ordered = make(chan func() error, 4*p.opts.Workers)
+		out.done = make(chan struct{})
+		go out.run()
+	}
+	return out
+}
+
+// run performs the queued writes until the queue is closed. After the
+// first error the remaining writes are discarded.
+func (w *zipPipeline) run() {
+	defer close(w.done)
+	for write := range w.ordered {
+		if w.err() != nil {
+			continue
+		}
+		if err := write(); err != nil {
+			w.mu.Lock()
+			w.firstErr = err
+			w.mu.Unlock()
+		}
+	}
+}
+
+// err returns the first error of a queued write
+func (w *zipPipeline) err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.firstErr
+}
+
+// emit performs write after all writes emitted before it
+func (w *zipPipeline) emit(write func() error) error {
+	if w.ordered == nil {
+		return write()
+	}
+	w.ordered <- write
+	return w.err()
+}
+
+// addFile reads, compresses and writes a source file and closes it
+func (w *zipPipeline) addFile(file *os.File, archivePath string) error {
+	if w.ordered == nil && w.p.opts.ChangedFileRetries > 0 {
+		// A changed file cannot be taken back from the ZIP, so it is
+		// compressed into memory until it was read unchanged
+		defer file.Close()
+		return w.writeCompressed(w.compress(file, archivePath), archivePath)
+	}
+	if w.ordered == nil {
+		defer file.Close()
+		info, sum, err := w.p.readSourceFile(file, archivePath, func(info os.FileInfo) (io.Writer, error) {
+			header, err := w.p.fileHeader(info, archivePath)
+			if err != nil {
+				return nil, err
+			}
+			if err := w.dirs.addFile(archivePath); err != nil {
+				return nil, err
+			}
+			writer, err := w.zw.CreateHeader(header)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create entry for %s: %w", archivePath, err)
+			}
+			return writer, nil
+		})
+		if err != nil {
+			return err
+		}
+		w.p.digest.addSum(archivePath, info.Size(), sum)
+		w.p.fileProgress(archivePath, info.Size())
+		return nil
+	}
+
+	result := make(chan compressedFile, 1)
+	w.workers <- struct{}{}
+	go func() {
+		defer func() { <-w.workers }()
+		defer file.Close()
+		result <- w.compress(file, archivePath)
+	}()
+
+	return w.emit(func() error {
+		return w.writeCompressed(<-result, archivePath)
+	})
+}
+
+// writeCompressed writes a file compressed by compress as a raw entry
+func (w *zipPipeline) writeCompressed(r compressedFile, archivePath string) error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.spool != nil {
+		defer w.releaseSpool(r.spool)
+	}
+	if err := w.dirs.addFile(archivePath); err != nil {
+		return err
+	}
+	writer, err := w.zw.CreateRaw(r.header)
+	if err != nil {
+		return fmt.Errorf("failed to create entry for %s: %w", archivePath, err)
+	}
+	var content io.Reader = bytes.NewReader(r.data)
+	if r.spool != nil {
+		if _, err := r.spool.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to read spool file of %s: %w", archivePath, err)
+		}
+		content = r.spool
+	}
+	if _, err := io.Copy(writer, content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", archivePath, err)
+	}
+	w.p.fileProgress(archivePath, int64(r.header.UncompressedSize64))
+	return nil
+}
+
+// compress streams a source file through the deflate compressor. The
+// compressed content of files over spoolThreshold is spooled to a
+// temporary file, so that large files are never held in memory.
+func (w *zipPipeline) compress(file *os.File, archivePath string) compressedFile {
+	var buf bytes.Buffer
+	var spool *os.File
+	spooled := false
+	fw := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(fw)
+	crc := crc32.NewIEEE()
+	info, sum, err := w.p.readSourceFile(file, archivePath, func(info os.FileInfo) (io.Writer, error) {
+		buf.Reset()
+		crc.Reset()
+		spooled = info.Size() > spoolThreshold
+		if !spooled {
+			fw.Reset(&buf)
+			return io.MultiWriter(fw, crc), nil
+		}
+		if spool == nil {
+			var err error
+			if spool, err = w.newSpool(); err != nil {
+				return nil, fmt.Errorf("failed to create spool file for %s: %w", archivePath, err)
+			}
+		}
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to write spool file of %s: %w", archivePath, err)
+		}
+		if err := spool.Truncate(0); err != nil {
+			return nil, fmt.Errorf("failed to write spool file of %s: %w", archivePath, err)
+		}
+		fw.Reset(spool)
+		return io.MultiWriter(fw, crc), nil
+	})
+	if err == nil {
+		if err = fw.Close(); err != nil {
+			err = fmt.Errorf("failed to compress %s: %w", archivePath, err)
+		}
+	}
+	var header *zip.FileHeader
+	if err == nil {
+		header, err = w.p.fileHeader(info, archivePath)
+	}
+	if spool != nil && (err != nil || !spooled) {
+		w.releaseSpool(spool)
+		spool = nil
+	}
+	if err != nil {
+		return compressedFile{err: err}
+	}
+	w.p.digest.addSum(archivePath, info.Size(), sum)
+
+	header.CRC32 = crc.Sum32()
+	header.UncompressedSize64 = uint64(info.Size())
+	if spool == nil {
+		header.CompressedSize64 = uint64(buf.Len())
+		return compressedFile{header: header, data: buf.Bytes()}
+	}
+	size, err := spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		w.releaseSpool(spool)
+		return compressedFile{err: fmt.Errorf("failed to write spool file of %s: %w", archivePath, err)}
+	}
+	header.CompressedSize64 = uint64(size)
+	return compressedFile{header: header, spool: spool}
+}
+
+// newSpool creates a spool file, which is removed by releaseSpool or close
+func (w *zipPipeline) newSpool() (*os.File, error) {
+	spool, err := w.p.opts.Temp.File("", "open-package-spool-*")
+	if err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	w.spools[spool] = true
+	w.mu.Unlock()
+	return spool, nil
+}
+
+// releaseSpool closes and removes a spool file
+func (w *zipPipeline) releaseSpool(spool *os.File) {
+	w.mu.Lock()
+	delete(w.spools, spool)
+	w.mu.Unlock()
+	spool.Close()
+	w.p.opts.Temp.Release(spool.Name())
+}
+
+// close waits for the queued writes and returns the first error. Spool
+// files of writes discarded after an error are removed.
+func (w *zipPipeline) close() error {
+	if w.ordered != nil {
+		close(w.ordered)
+		<-w.done
+	}
+	w.mu.Lock()
+	spools := w.spools
+	w.spools = nil
+	w.mu.Unlock()
+	for spool := range spools {
+		spool.Close()
+		w.p.opts.Temp.Release(spool.Name())
+	}
+	return w.err()
+}
+
+// fileHeader creates the inner ZIP header of a source file
+func (p *Packager) fileHeader(info os.FileInfo, archivePath string) (*zip.FileHeader, error) {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create header for %s: %w", archivePath, err)
+	}
+	header.Name = archivePath
+	header.Method = zip.Deflate
+	p.setAttributes(header, info)
+	return header, nil
+}
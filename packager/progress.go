@@ -0,0 +1,94 @@
+package packager
+
+import (
+	"time"
+)
+
+// StageDone is the stage of the last progress event of a package
+const StageDone = "done"
+
+// progressInterval limits the events of the zip stage, which would
+// otherwise be sent for every file
+const progressInterval = 100 * time.Millisecond
+
+// Share of the overall percent reached at the start of each stage. The
+// zip stage, which reads and compresses the source, takes most of the
+// time.
+var stagePercent = map[string]int{
+	StageZip:      0,
+	StageEncrypt:  80,
+	StageMetadata: 90,
+	StagePackage:  92,
+	StageEscrow:   98,
+	StageDone:     100,
+}
+
+// Progress is a progress event of CreatePackage, sent to Options.Progress
+type Progress struct {
+	// Stage is the running stage: StageZip, StageEncrypt, StageMetadata,
+	// StagePackage, StageEscrow or, once the package is written, StageDone
+	Stage string `json:"stage"`
+	// Percent is the overall progress of the package, from 0 to 100
+	Percent int `json:"percent"`
+	// File is the last file packaged in the zip stage, with forward
+	// slashes and prefixed with the source folder name
+	File string `json:"file,omitempty"`
+	// Bytes and Total are the source bytes packaged so far and in total
+	// in the zip stage. Total is the size of SourceDir without merged
+	// sources or generated files, so Bytes may exceed it.
+	Bytes int64 `json:"bytes,omitempty"`
+	Total int64 `json:"total,omitempty"`
+	// Package is the path of the package, set in StageDone
+	Package string `json:"package,omitempty"`
+}
+
+// progress tracks the events of a CreatePackage call
+type progress struct {
+	total   int64
+	bytes   int64
+	percent int
+	last    time.Time
+}
+
+// startProgress sends the first event of the zip stage. The total size of
+// the source folder is scanned first, so that the stage has a percent.
+func (p *Packager) startProgress() {
+	if p.opts.Progress == nil {
+		return
+	}
+	p.progress = &progress{}
+	if _, est, _, err := p.scanSource(); err == nil {
+		p.progress.total = est.SourceSize
+	}
+	p.stageProgress(StageZip, "")
+}
+
+// stageProgress sends the event of the start of a stage, or of StageDone
+// with the package path
+func (p *Packager) stageProgress(stage, packagePath string) {
+	if p.progress == nil {
+		return
+	}
+	p.progress.percent = stagePercent[stage]
+	p.opts.Progress(Progress{Stage: stage, Percent: p.progress.percent, Total: p.progress.total, Bytes: p.progress.bytes, Package: packagePath})
+}
+
+// fileProgress sends an event for a packaged file of size bytes, at most
+// every progressInterval unless the percent changes. It is called in walk
+// order by a single goroutine.
+func (p *Packager) fileProgress(archivePath string, size int64) {
+	if p.progress == nil {
+		return
+	}
+	pr := p.progress
+	pr.bytes += size
+	percent := stagePercent[StageEncrypt] - 1
+	if pr.total > 0 && pr.bytes < pr.total {
+		percent = int(pr.bytes * int64(stagePercent[StageEncrypt]) / pr.total)
+	}
+	if percent == pr.percent && time.Since(pr.last) < progressInterval {
+		return
+	}
+	pr.percent, pr.last = percent, time.Now()
+	p.opts.Progress(Progress{Stage: StageZip, Percent: percent, File: archivePath, Bytes: pr.bytes, Total: pr.total})
+}
@@ -0,0 +1,78 @@
+package packager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreatePackageProgress(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-progress-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "data"), 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.cmd"), []byte("@echo off"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		name := filepath.Join(sourceDir, "data", fmt.Sprintf("file%02d.bin", i))
+		if err := os.WriteFile(name, []byte(strings.Repeat("x", 1000)), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	total := int64(20*1000 + len("@echo off"))
+
+	for _, workers := range []int{1, 4} {
+		var events []Progress
+		p := New(Options{
+			SourceDir: sourceDir,
+			SetupFile: "install.cmd",
+			OutputDir: tempDir,
+			Quiet:     true,
+			Workers:   workers,
+			Progress:  func(e Progress) { events = append(events, e) },
+		})
+		outputPath, err := p.CreatePackage()
+		if err != nil {
+			t.Fatalf("CreatePackage failed with %d workers: %v", workers, err)
+		}
+
+		var stages []string
+		percent, files := 0, 0
+		for _, e := range events {
+			if e.Percent < percent {
+				t.Errorf("Percent went back from %d to %d with %d workers: %+v", percent, e.Percent, workers, e)
+			}
+			percent = e.Percent
+			if e.Total != total {
+				t.Errorf("Expected total %d, got %+v", total, e)
+			}
+			if e.File != "" {
+				files++
+				if e.Stage != StageZip || !strings.HasPrefix(e.File, "app/") || e.Bytes == 0 {
+					t.Errorf("Unexpected file event %+v", e)
+				}
+				continue
+			}
+			stages = append(stages, e.Stage)
+		}
+		if got := strings.Join(stages, ","); got != "zip,encrypt,metadata,package,done" {
+			t.Errorf("Unexpected stages with %d workers: %s", workers, got)
+		}
+		if files == 0 {
+			t.Errorf("Expected file events with %d workers", workers)
+		}
+		last := events[len(events)-1]
+		if last.Percent != 100 || last.Package != outputPath || last.Bytes != total {
+			t.Errorf("Unexpected last event with %d workers: %+v", workers, last)
+		}
+	}
+}
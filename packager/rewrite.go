@@ -0,0 +1,82 @@
+package packager
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Rewrite moves a folder or file of the source to another path of the
+// package, e.g. to strip a vendor prefix without staging a copy. Paths are
+// relative to the package root, with forward slashes; From matches
+// regardless of case.
+type Rewrite struct {
+	// From is the folder or file to move. A trailing "/**" is allowed
+	// and matches the same folder.
+	From string `json:"from"`
+	// To is the new path (optional, defaults to the package root, which
+	// is only valid for folders)
+	To string `json:"to,omitempty"`
+}
+
+// ParseRewrite parses a rewrite rule given as from=to
+func ParseRewrite(s string) (Rewrite, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 0 {
+		return Rewrite{}, fmt.Errorf("rewrite %q must be given as from=to", s)
+	}
+	r := Rewrite{From: s[:i], To: s[i+1:]}
+	if err := r.Validate(); err != nil {
+		return Rewrite{}, err
+	}
+	return r, nil
+}
+
+// Validate checks that both paths are within the package
+func (r Rewrite) Validate() error {
+	from, err := sourceTarget(strings.TrimSuffix(r.From, "/**"))
+	if err != nil {
+		return fmt.Errorf("rewrite: %w", err)
+	}
+	if from == "" {
+		return fmt.Errorf("rewrite %q has no folder to move", r.From)
+	}
+	if _, err := sourceTarget(r.To); err != nil {
+		return fmt.Errorf("rewrite: %w", err)
+	}
+	return nil
+}
+
+// RewritePath applies the first matching rule to a path relative to the
+// package root, with forward slashes. It returns "" for a folder moved to
+// the root.
+func RewritePath(rules []Rewrite, name string) string {
+	for _, r := range rules {
+		from, _ := sourceTarget(strings.TrimSuffix(r.From, "/**"))
+		to, _ := sourceTarget(r.To)
+		if from == "" {
+			continue
+		}
+		switch {
+		case strings.EqualFold(name, from):
+			return to
+		case len(name) > len(from) && name[len(from)] == '/' && strings.EqualFold(name[:len(from)], from):
+			rest := name[len(from)+1:]
+			if to == "" {
+				return rest
+			}
+			return to + "/" + rest
+		}
+	}
+	return name
+}
+
+// packagedSetupFile returns the path of the setup file in the package,
+// after the rewrite rules
+func (p *Packager) packagedSetupFile() string {
+	setupFile := p.setupFile()
+	if len(p.opts.Rewrites) == 0 || p.opts.MSIXWrapper {
+		return setupFile
+	}
+	return filepath.FromSlash(RewritePath(p.opts.Rewrites, filepath.ToSlash(setupFile)))
+}
@@ -0,0 +1,106 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCreateInnerZipRewrites(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-rewrite-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	for _, name := range []string{"Vendor/Payload/setup.exe", "Vendor/Payload/data/app.dat", "Vendor/readme.txt", "docs/manual.pdf"} {
+		path := filepath.Join(sourceDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	opts := Options{
+		SourceDir: sourceDir,
+		SetupFile: filepath.FromSlash("Vendor/Payload/setup.exe"),
+		Quiet:     true,
+		Rewrites: []Rewrite{
+			{From: "vendor/payload/**"},
+			{From: "docs/manual.pdf", To: "help/en/manual.pdf"},
+		},
+	}
+	p := New(opts)
+	data, err := p.createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Inner ZIP is not valid: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	expected := []string{
+		"app/Vendor/",
+		"app/Vendor/readme.txt",
+		"app/data/",
+		"app/data/app.dat",
+		"app/docs/",
+		"app/help/",
+		"app/help/en/",
+		"app/help/en/manual.pdf",
+		"app/setup.exe",
+	}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("Unexpected entries:\n%s\nexpected:\n%s", strings.Join(names, "\n"), strings.Join(expected, "\n"))
+	}
+	if got := p.packagedSetupFile(); got != "setup.exe" {
+		t.Errorf("Expected the setup file to be recorded as setup.exe, got %s", got)
+	}
+
+	// Files cannot be moved to the package root itself
+	opts.Rewrites = []Rewrite{{From: "docs/manual.pdf"}}
+	if _, err := New(opts).createInnerZip(); err == nil {
+		t.Error("Expected error for a file moved to the package root")
+	}
+	// Rewrites must not create duplicate entries
+	opts.Rewrites = []Rewrite{{From: "docs", To: "Vendor"}, {From: "Vendor/Payload/data/app.dat", To: "Vendor/manual.pdf"}}
+	if _, err := New(opts).createInnerZip(); err == nil {
+		t.Error("Expected error for rewrites creating duplicate entries")
+	}
+}
+
+func TestParseRewrite(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Rewrite
+		wantErr  bool
+	}{
+		{"payload/**=", Rewrite{From: "payload/**"}, false},
+		{"vendor/app=bin", Rewrite{From: "vendor/app", To: "bin"}, false},
+		{"payload", Rewrite{}, true},
+		{"=bin", Rewrite{}, true},
+		{"payload=../bin", Rewrite{}, true},
+	}
+	for _, tt := range tests {
+		r, err := ParseRewrite(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRewrite(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if r != tt.expected {
+			t.Errorf("ParseRewrite(%q) = %+v, expected %+v", tt.input, r, tt.expected)
+		}
+	}
+}
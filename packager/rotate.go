@@ -0,0 +1,61 @@
+package packager
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/MANCHTOOLS/open-package/crypto"
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+// RotateKeys encrypts the decrypted content of an existing package, size
+// bytes of content, with new random keys and writes it to outputPath, e.g.
+// after the Detection.xml of the package was exposed. The content is
+// encrypted into a temporary file tracked by Options.Temp, so that neither
+// it nor its ciphertext are held in memory. The new Detection.xml keeps
+// all fields of info except the encryption information, and the build
+// info stamped into the content is stamped into the new package as well.
+// Options.StrictCompat, Options.EscrowKey and Options.JobID apply as with
+// CreatePackage; the other options are ignored.
+func (p *Packager) RotateKeys(info *metadata.ApplicationInfo, content io.ReaderAt, size int64, outputPath string) error {
+	p.log("Encrypting content with new keys...")
+	encrypted, err := p.opts.Temp.File("", "open-package-rotate-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer p.opts.Temp.Release(encrypted.Name())
+	defer encrypted.Close()
+	encInfo, err := crypto.EncryptStream(io.NewSectionReader(content, 0, size), encrypted)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt content: %w", err)
+	}
+	encryptedSize, err := encrypted.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt content: %w", err)
+	}
+	p.buildInfo = innerBuildInfo(content, size)
+	cryptoInfo := encInfo.ToBase64()
+	detectionXML, err := metadata.GenerateDetectionXML(metadata.DetectionXMLOptions{
+		Name:              info.Name,
+		SetupFile:         info.SetupFile,
+		CryptoInfo:        cryptoInfo,
+		MsiInfo:           info.MsiInfo,
+		StrictCompat:      p.opts.StrictCompat,
+		ToolVersion:       info.ToolVersion,
+		ProfileIdentifier: info.EncryptionInfo.ProfileIdentifier,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate Detection.xml: %w", err)
+	}
+
+	p.log("Creating %s...", outputPath)
+	if err := p.createOuterPackage(outputPath, encrypted, encryptedSize, detectionXML); err != nil {
+		return fmt.Errorf("failed to create outer package: %w", err)
+	}
+	if p.opts.EscrowKey != nil {
+		if err := p.escrowKeys(outputPath, detectionXML, cryptoInfo, info.EncryptionInfo.ProfileIdentifier); err != nil {
+			return err
+		}
+	}
+	return nil
+}
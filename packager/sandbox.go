@@ -0,0 +1,58 @@
+package packager
+
+import (
+	"fmt"
+	"io"
+)
+
+// Sandbox runs the walk and compression of the source folder, the stage
+// that reads untrusted vendor content, outside of the packaging process,
+// e.g. in a process with fewer privileges and no network access. ZipSource
+// has the contract of the ZipSource function, which the sandboxed process
+// is expected to run with the given options. Options round-trip through
+// JSON; the fields that only apply to this process are left out.
+type Sandbox interface {
+	ZipSource(sourceDir string, opts Options) (io.ReadCloser, *Manifest, error)
+}
+
+// sandboxInnerZip creates the inner ZIP with Options.Sandbox and takes
+// over the results of its walk
+func (p *Packager) sandboxInnerZip() ([]byte, error) {
+	// Options that only apply to this process are not passed on
+	opts := p.opts
+	opts.Sandbox = nil
+	opts.Logger = nil
+	opts.EscrowKey = nil
+	opts.Temp = nil
+	opts.Progress = nil
+	opts.Quiet = true
+
+	rc, manifest, err := p.opts.Sandbox.ZipSource(p.opts.SourceDir, opts)
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: %w", err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: %w", err)
+	}
+
+	p.digest = &sourceDigest{}
+	for _, f := range manifest.Files {
+		p.digest.files = append(p.digest.files, digestFile{path: f.Path, size: int(f.Size), sha256: f.SHA256})
+	}
+	for _, w := range manifest.Warnings {
+		if err := p.warn(w.Code, "%s", w.Message); err != nil {
+			return nil, err
+		}
+	}
+	p.skipped = manifest.Skipped
+	p.excluded = manifest.Excluded
+	p.emptyDirs = manifest.EmptyDirs
+	p.hardLinks = manifest.HardLinks
+	p.duplicates = manifest.Duplicates
+	p.streams = manifest.Streams
+	p.buildInfo = manifest.BuildInfo
+	p.log("  Created in sandbox: %d files", len(manifest.Files))
+	return data, nil
+}
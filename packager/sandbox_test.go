@@ -0,0 +1,107 @@
+package packager
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MANCHTOOLS/open-package/tempfiles"
+)
+
+// inProcessSandbox runs ZipSource in the test process and records the
+// options it receives, passed through JSON as to a sandboxed process
+type inProcessSandbox struct {
+	opts *Options
+}
+
+func (s inProcessSandbox) ZipSource(sourceDir string, opts Options) (io.ReadCloser, *Manifest, error) {
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(data, s.opts); err != nil {
+		return nil, nil, err
+	}
+	return ZipSource(sourceDir, *s.opts)
+}
+
+// failingSandbox fails to start
+type failingSandbox struct{}
+
+func (failingSandbox) ZipSource(sourceDir string, opts Options) (io.ReadCloser, *Manifest, error) {
+	return nil, nil, errors.New("no namespaces")
+}
+
+func TestCreatePackageSandbox(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-sandbox-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "empty"), 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	for _, name := range []string{"setup.exe", "Thumbs.db"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte("setup"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	var received Options
+	p := New(Options{
+		SourceDir: sourceDir,
+		SetupFile: "setup.exe",
+		OutputDir: tempDir,
+		Quiet:     true,
+		BuildInfo: true,
+		Sandbox:   inProcessSandbox{opts: &received},
+	})
+	if _, err := p.CreatePackage(); err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	if received.Sandbox != nil || received.Logger != nil || !received.Quiet || received.SetupFile != "setup.exe" || !received.BuildInfo {
+		t.Errorf("Expected the sandbox to receive options without the sandbox and logger, got %+v", received)
+	}
+	if len(p.Excluded()) != 1 || len(p.EmptyDirs()) != 1 {
+		t.Errorf("Expected the results of the sandboxed walk, got excluded %v and empty dirs %v", p.Excluded(), p.EmptyDirs())
+	}
+	if p.BuildInfo() == nil || len(p.BuildInfo().SourceSHA256) != 64 {
+		t.Errorf("Expected the build info of the sandboxed walk, got %+v", p.BuildInfo())
+	}
+
+	p = New(Options{SourceDir: sourceDir, SetupFile: "setup.exe", OutputDir: tempDir, Quiet: true, Sandbox: failingSandbox{}})
+	if _, err := p.CreatePackage(); err == nil {
+		t.Error("Expected error when the sandbox fails")
+	}
+}
+
+func TestOptionsJSON(t *testing.T) {
+	// Options of this process must not keep the others from being passed
+	// to a sandboxed process
+	opts := Options{
+		SourceDir: "app",
+		SetupFile: "setup.exe",
+		Logger:    log.New(io.Discard, "", 0),
+		Temp:      tempfiles.New(false, io.Discard),
+		Sandbox:   failingSandbox{},
+		Progress:  func(Progress) {},
+		Rewrites:  []Rewrite{{From: "bin", To: "app/bin"}},
+	}
+	data, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatalf("Failed to marshal options: %v", err)
+	}
+	var decoded Options
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal options: %v", err)
+	}
+	if decoded.SetupFile != "setup.exe" || len(decoded.Rewrites) != 1 || decoded.Logger != nil || decoded.Progress != nil {
+		t.Errorf("Unexpected options after round trip: %+v", decoded)
+	}
+}
@@ -0,0 +1,88 @@
+package packager
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+// Manifest describes the inner ZIP streamed by ZipSource
+type Manifest struct {
+	// Files are the packaged files, sorted by path. Paths are relative to
+	// the source folder, without the folder name that prefixes all entries.
+	Files []ManifestFile `json:"files"`
+	// SHA256 is the digest of the files, as recorded in the build info
+	// and the build registry
+	SHA256 string `json:"sha256"`
+	// Warnings, Skipped, Excluded, EmptyDirs, HardLinks, Duplicates and
+	// Streams are the results of the walk, as returned by the Packager methods of the
+	// same names
+	Warnings   []Warning    `json:"warnings,omitempty"`
+	Skipped    []string     `json:"skipped,omitempty"`
+	Excluded   []string     `json:"excluded,omitempty"`
+	EmptyDirs  []string     `json:"emptyDirs,omitempty"`
+	HardLinks  []string     `json:"hardLinks,omitempty"`
+	Duplicates []Duplicate  `json:"duplicates,omitempty"`
+	Streams    []StreamFile `json:"streams,omitempty"`
+	// BuildInfo is the build info stamped on the ZIP, with
+	// Options.BuildInfo
+	BuildInfo *metadata.BuildInfo `json:"buildInfo,omitempty"`
+}
+
+// ManifestFile is a file of a Manifest
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ZipSource streams the inner ZIP of sourceDir, with the same walk and
+// normalization as packages: exclusions, link handling, locked files,
+// entry checks and generated files. Options.SourceDir is replaced by
+// sourceDir; options that only apply to packages, like the name or the
+// architecture, are ignored.
+//
+// The ZIP is written while it is read. The manifest is filled in once the
+// reader has returned io.EOF; errors of the walk are returned by Read.
+// Closing the reader early stops the walk.
+func ZipSource(sourceDir string, opts Options) (io.ReadCloser, *Manifest, error) {
+	if opts.Links != "" && opts.Links != LinkFollow && opts.Links != LinkSkip {
+		return nil, nil, fmt.Errorf("unsupported link mode %q (supported: %s)", opts.Links, strings.Join(LinkModes, ", "))
+	}
+	if opts.Unreadable != "" && !contains(UnreadableModes, opts.Unreadable) {
+		return nil, nil, fmt.Errorf("unsupported unreadable mode %q (supported: %s)", opts.Unreadable, strings.Join(UnreadableModes, ", "))
+	}
+	if err := checkEntryModes(opts); err != nil {
+		return nil, nil, err
+	}
+	if err := checkSuppress(opts); err != nil {
+		return nil, nil, err
+	}
+	opts.SourceDir = sourceDir
+	p := New(opts)
+
+	manifest := &Manifest{}
+	pr, pw := io.Pipe()
+	go func() {
+		if err := p.writeInnerZip(pw); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		manifest.SHA256 = p.digest.sum()
+		for _, f := range p.digest.files {
+			manifest.Files = append(manifest.Files, ManifestFile{Path: f.path, Size: int64(f.size), SHA256: f.sha256})
+		}
+		manifest.Warnings = p.warnings
+		manifest.Skipped = p.skipped
+		manifest.Excluded = p.excluded
+		manifest.EmptyDirs = p.emptyDirs
+		manifest.HardLinks = p.hardLinks
+		manifest.Duplicates = p.duplicates
+		manifest.Streams = p.streams
+		manifest.BuildInfo = p.buildInfo
+		pw.Close()
+	}()
+	return pr, manifest, nil
+}
@@ -0,0 +1,99 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZipSource(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-source-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	files := map[string]string{
+		"install.exe":     "setup",
+		"data/config.xml": "<config/>",
+		"data/copy.xml":   "<config/>",
+		"Thumbs.db":       "junk",
+	}
+	for name, content := range files {
+		path := filepath.Join(sourceDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	r, manifest, err := ZipSource(sourceDir, Options{Quiet: true})
+	if err != nil {
+		t.Fatalf("ZipSource failed: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("Failed to read inner ZIP: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Invalid inner ZIP: %v", err)
+	}
+	entries := make(map[string]bool)
+	for _, f := range zr.File {
+		entries[f.Name] = true
+	}
+	for _, name := range []string{"app/install.exe", "app/data/config.xml", "app/data/copy.xml"} {
+		if !entries[name] {
+			t.Errorf("Missing entry %s in %v", name, entries)
+		}
+	}
+
+	if len(manifest.Files) != 3 || manifest.Files[0].Path != "data/config.xml" || manifest.Files[2].Size != 5 {
+		t.Errorf("Unexpected manifest files: %+v", manifest.Files)
+	}
+	if len(manifest.Excluded) != 1 || manifest.Excluded[0] != "Thumbs.db" {
+		t.Errorf("Unexpected excluded files: %v", manifest.Excluded)
+	}
+	if len(manifest.Duplicates) != 1 {
+		t.Errorf("Expected one duplicate, got %v", manifest.Duplicates)
+	}
+
+	// The digest matches that of packages of the same source
+	p := New(Options{SourceDir: sourceDir, Quiet: true})
+	if _, err := p.createInnerZip(); err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	if manifest.SHA256 != p.digest.sum() {
+		t.Errorf("Digest mismatch: %s, expected %s", manifest.SHA256, p.digest.sum())
+	}
+
+	// Errors of the walk are returned by Read
+	r, _, err = ZipSource(filepath.Join(tempDir, "missing"), Options{Quiet: true})
+	if err != nil {
+		t.Fatalf("ZipSource failed: %v", err)
+	}
+	if _, err := io.ReadAll(r); err == nil {
+		t.Error("Expected error for a missing source folder")
+	}
+
+	// Closing the reader early stops the walk
+	r, _, err = ZipSource(sourceDir, Options{Quiet: true})
+	if err != nil {
+		t.Fatalf("ZipSource failed: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+
+	if _, _, err := ZipSource(sourceDir, Options{Links: "copy"}); err == nil {
+		t.Error("Expected error for an unsupported link mode")
+	}
+}
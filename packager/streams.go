@@ -0,0 +1,107 @@
+package packager
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ZoneIdentifier is the alternate data stream in which Windows records the
+// zone a file was downloaded from, the Mark of the Web
+const ZoneIdentifier = "Zone.Identifier"
+
+// listStreams and removeStream are variables so that tests can simulate
+// alternate data streams on any platform
+var (
+	listStreams  = alternateStreams
+	removeStream = os.Remove
+)
+
+// StreamFile is a source file with NTFS alternate data streams. ZIP entries
+// only carry the unnamed data stream, so the other streams are not
+// packaged.
+type StreamFile struct {
+	// Path is the path of the file in the inner ZIP
+	Path string `json:"path"`
+	// Streams are the names of the alternate data streams, e.g.
+	// Zone.Identifier
+	Streams []string `json:"streams"`
+	// Stripped reports whether the Zone.Identifier stream was removed
+	// from the source file (Options.StripZoneIdentifier)
+	Stripped bool `json:"stripped,omitempty"`
+}
+
+// Streams returns the source files with alternate data streams found by
+// the last CreatePackage call (Windows only)
+func (p *Packager) Streams() []StreamFile {
+	return p.streams
+}
+
+// hasZoneIdentifier reports whether the file carries a Mark of the Web
+func (f StreamFile) hasZoneIdentifier() bool {
+	for _, s := range f.Streams {
+		if strings.EqualFold(s, ZoneIdentifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStreamName returns the name of a stream as reported by Windows,
+// e.g. ":Zone.Identifier:$DATA", or "" for the unnamed data stream
+func parseStreamName(s string) string {
+	s = strings.TrimPrefix(s, ":")
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+// checkStreams records the alternate data streams of a source file and
+// removes its Zone.Identifier stream with Options.StripZoneIdentifier
+func (p *Packager) checkStreams(path, archivePath string) error {
+	streams, err := listStreams(path)
+	if err != nil || len(streams) == 0 {
+		// File systems without streams, e.g. FAT volumes, fail the query
+		return nil
+	}
+	file := StreamFile{Path: archivePath, Streams: streams}
+	if p.opts.StripZoneIdentifier && file.hasZoneIdentifier() {
+		if err := removeStream(path + ":" + ZoneIdentifier); err != nil {
+			return fmt.Errorf("failed to remove the %s stream of %s: %w", ZoneIdentifier, path, err)
+		}
+		file.Stripped = true
+		p.log("  Removed Mark of the Web: %s", archivePath)
+	}
+	p.streams = append(p.streams, file)
+	return nil
+}
+
+// reportStreams warns about the alternate data streams left out of the
+// package. Files downloaded from the internet carry a Mark of the Web,
+// under which SmartScreen, PowerShell execution policies and Office block
+// or prompt for files here, while the files extracted on devices carry
+// none, so tests from the source folder do not match the device.
+func (p *Packager) reportStreams() error {
+	var marked []string
+	for _, f := range p.streams {
+		var other []string
+		for _, s := range f.Streams {
+			if !strings.EqualFold(s, ZoneIdentifier) {
+				other = append(other, s)
+			}
+		}
+		if len(other) > 0 {
+			if err := p.warn(WarnStreams, "%s has alternate data streams that are not packaged: %s", f.Path, strings.Join(other, ", ")); err != nil {
+				return err
+			}
+		}
+		if f.hasZoneIdentifier() && !f.Stripped {
+			marked = append(marked, f.Path)
+		}
+	}
+	if len(marked) == 0 {
+		return nil
+	}
+	return p.warn(WarnMarkOfTheWeb, "%d files carry a Mark of the Web (%s), e.g. %s; it is not packaged, so SmartScreen, execution policies and macro blocking treat them differently on devices than in this folder (strip it with -strip-zone-identifier)", len(marked), ZoneIdentifier, marked[0])
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package packager
+
+// alternateStreams returns no streams, as only NTFS has alternate data
+// streams
+func alternateStreams(path string) ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,87 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateInnerZipStreams(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-streams-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "app")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	for _, name := range []string{"setup.exe", "readme.txt", "plain.txt"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	// Simulate the streams of an NTFS volume
+	streams := map[string][]string{
+		"setup.exe":  {ZoneIdentifier},
+		"readme.txt": {ZoneIdentifier, "com.dropbox.attrs"},
+	}
+	var removed []string
+	defer func() { listStreams, removeStream = alternateStreams, os.Remove }()
+	listStreams = func(path string) ([]string, error) {
+		return streams[filepath.Base(path)], nil
+	}
+	removeStream = func(path string) error {
+		removed = append(removed, filepath.Base(path))
+		return nil
+	}
+
+	opts := Options{SourceDir: sourceDir, SetupFile: "setup.exe", Quiet: true}
+	p := New(opts)
+	if _, err := p.createInnerZip(); err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	if len(p.Streams()) != 2 {
+		t.Fatalf("Expected 2 files with streams, got %+v", p.Streams())
+	}
+	warnings := strings.Join(p.Warnings(), "\n")
+	if !strings.Contains(warnings, "2 files carry a Mark of the Web") || !strings.Contains(warnings, "app/readme.txt has alternate data streams that are not packaged: com.dropbox.attrs") {
+		t.Errorf("Unexpected warnings: %v", p.Warnings())
+	}
+	if len(removed) != 0 {
+		t.Errorf("Expected no streams to be removed by default, got %v", removed)
+	}
+
+	opts.StripZoneIdentifier = true
+	p = New(opts)
+	if _, err := p.createInnerZip(); err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	if len(removed) != 2 || removed[0] != "readme.txt:Zone.Identifier" {
+		t.Errorf("Expected the Zone.Identifier streams to be removed, got %v", removed)
+	}
+	if strings.Contains(strings.Join(p.Warnings(), "\n"), "Mark of the Web") {
+		t.Errorf("Expected no Mark of the Web warning after stripping, got %v", p.Warnings())
+	}
+
+	opts.Strict = true
+	opts.StripZoneIdentifier = false
+	if _, err := New(opts).createInnerZip(); err == nil {
+		t.Error("Expected error for a Mark of the Web in strict mode")
+	}
+}
+
+func TestParseStreamName(t *testing.T) {
+	tests := map[string]string{
+		"::$DATA":                "",
+		":Zone.Identifier:$DATA": "Zone.Identifier",
+	}
+	for input, expected := range tests {
+		if got := parseStreamName(input); got != expected {
+			t.Errorf("parseStreamName(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
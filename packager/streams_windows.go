@@ -0,0 +1,58 @@
+//go:build windows
+
+package packager
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32          = syscall.NewLazyDLL("kernel32.dll")
+	procFindFirstStreamW = modkernel32.NewProc("FindFirstStreamW")
+	procFindNextStreamW  = modkernel32.NewProc("FindNextStreamW")
+)
+
+// errorHandleEOF is returned when a file has no further streams
+const errorHandleEOF syscall.Errno = 38
+
+// win32FindStreamData is WIN32_FIND_STREAM_DATA
+type win32FindStreamData struct {
+	StreamSize int64
+	StreamName [syscall.MAX_PATH + 36]uint16
+}
+
+// alternateStreams returns the names of the alternate data streams of a
+// file, without the unnamed data stream
+func alternateStreams(path string) ([]string, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	var data win32FindStreamData
+	// FindStreamInfoStandard is the only information level
+	h, _, err := procFindFirstStreamW.Call(uintptr(unsafe.Pointer(name)), 0, uintptr(unsafe.Pointer(&data)), 0)
+	handle := syscall.Handle(h)
+	if handle == syscall.InvalidHandle {
+		if errors.Is(err, errorHandleEOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer syscall.FindClose(handle)
+
+	var streams []string
+	for {
+		if s := parseStreamName(syscall.UTF16ToString(data.StreamName[:])); s != "" {
+			streams = append(streams, s)
+		}
+		ok, _, err := procFindNextStreamW.Call(h, uintptr(unsafe.Pointer(&data)))
+		if ok == 0 {
+			if errors.Is(err, errorHandleEOF) {
+				return streams, nil
+			}
+			return streams, err
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package packager
+
+import "time"
+
+// Stages of CreatePackage reported by Timings
+const (
+	StageZip      = "zip"
+	StageEncrypt  = "encrypt"
+	StageMetadata = "metadata"
+	StagePackage  = "package"
+	StageEscrow   = "escrow"
+)
+
+// StageTiming is the duration of a CreatePackage stage
+type StageTiming struct {
+	Stage    string
+	Duration time.Duration
+}
+
+// Timings returns the duration of each stage of the last CreatePackage
+// call, in the order the stages ran
+func (p *Packager) Timings() []StageTiming {
+	return p.timings
+}
+
+// timeStage records the duration of a stage started at start and returns
+// the start of the next stage
+func (p *Packager) timeStage(stage string, start time.Time) time.Time {
+	now := time.Now()
+	p.timings = append(p.timings, StageTiming{Stage: stage, Duration: now.Sub(start)})
+	p.log("  %s took %s", stage, now.Sub(start).Round(time.Millisecond))
+	return now
+}
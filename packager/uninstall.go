@@ -0,0 +1,92 @@
+package packager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/msi"
+)
+
+// UninstallScriptName is the setup file of an uninstall companion package
+const UninstallScriptName = "uninstall.cmd"
+
+// UninstallCommand derives the command that removes the application
+// installed by the setup file. MSI setups are removed by product code.
+// The uninstallers of Inno Setup (unins000.exe) and NSIS (uninstall.exe)
+// installers are run from the default install folder of both frameworks,
+// %ProgramFiles%\<appName>; the uninstall command of applications
+// installed elsewhere and of other installers needs to be specified.
+func UninstallCommand(sourceDir, setupFile, appName string) (string, error) {
+	installer, err := InstallerType(sourceDir, setupFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read setup file: %w", err)
+	}
+	switch installer {
+	case InstallerInno:
+		return fmt.Sprintf(`"%%ProgramFiles%%\%s\unins000.exe" /VERYSILENT /SUPPRESSMSGBOXES /NORESTART`, appName), nil
+	case InstallerNSIS:
+		return fmt.Sprintf(`"%%ProgramFiles%%\%s\uninstall.exe" /S`, appName), nil
+	}
+
+	if !strings.EqualFold(filepath.Ext(setupFile), ".msi") {
+		return "", fmt.Errorf("cannot derive an uninstall command for %s, only MSI, Inno Setup and NSIS setups are supported", setupFile)
+	}
+
+	info, err := msi.Open(filepath.Join(sourceDir, setupFile))
+	if err != nil {
+		return "", fmt.Errorf("failed to read MSI: %w", err)
+	}
+	if info.ProductCode == "" {
+		return "", fmt.Errorf("%s has no ProductCode", setupFile)
+	}
+
+	return fmt.Sprintf("msiexec /x %s /qn /norestart", info.ProductCode), nil
+}
+
+// CreateUninstallPackage creates a companion package that contains only
+// an uninstall wrapper script running command. It is named after the
+// application with an "_uninstall" suffix and returns its output path.
+func (p *Packager) CreateUninstallPackage(command string) (string, error) {
+	if command == "" {
+		return "", fmt.Errorf("uninstall command is empty")
+	}
+
+	tempDir, err := p.opts.Temp.Dir("open-package-uninstall-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer p.opts.Temp.Release(tempDir)
+
+	appName := p.appName()
+	stagingDir := filepath.Join(tempDir, appName+"_uninstall")
+	if err := os.Mkdir(stagingDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	script := strings.Join([]string{
+		"@echo off",
+		"rem Uninstall wrapper for " + appName,
+		command,
+		"exit /b %ERRORLEVEL%",
+		"",
+	}, "\r\n")
+	if err := os.WriteFile(filepath.Join(stagingDir, UninstallScriptName), []byte(script), 0644); err != nil {
+		return "", fmt.Errorf("failed to write uninstall script: %w", err)
+	}
+
+	opts := p.opts
+	opts.SourceDir = stagingDir
+	opts.Sources = nil
+	opts.Rewrites = nil
+	opts.Generated = nil
+	opts.Sandbox = nil
+	opts.SetupFile = UninstallScriptName
+	opts.MSIXWrapper = false
+	// The name comes from the staging directory, so that the companion
+	// package does not overwrite the package of the application
+	opts.Name = ""
+	p.log("Creating uninstall companion package...")
+	return New(opts).CreatePackage()
+}
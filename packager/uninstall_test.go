@@ -0,0 +1,154 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MANCHTOOLS/open-package/metadata"
+	"github.com/MANCHTOOLS/open-package/unpacker"
+)
+
+func TestCreateUninstallPackage(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-uninstall-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "myapp")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+
+	pkg := New(Options{
+		SourceDir: sourceDir,
+		SetupFile: "install.exe",
+		OutputDir: tempDir,
+		Quiet:     true,
+	})
+
+	outputPath, err := pkg.CreateUninstallPackage(`"%ProgramFiles%\MyApp\uninstall.exe" /S`)
+	if err != nil {
+		t.Fatalf("CreateUninstallPackage failed: %v", err)
+	}
+	if filepath.Base(outputPath) != "myapp_uninstall.intunewin" {
+		t.Errorf("Unexpected output name: %s", filepath.Base(outputPath))
+	}
+
+	zr, err := zip.OpenReader(outputPath)
+	if err != nil {
+		t.Fatalf("Output is not a valid ZIP: %v", err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.Name != "IntuneWinPackage/Metadata/Detection.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open Detection.xml: %v", err)
+		}
+		var buf bytes.Buffer
+		buf.ReadFrom(rc)
+		rc.Close()
+
+		var appInfo metadata.ApplicationInfo
+		if err := xml.Unmarshal(buf.Bytes(), &appInfo); err != nil {
+			t.Fatalf("Failed to parse Detection.xml: %v", err)
+		}
+		if appInfo.SetupFile != UninstallScriptName {
+			t.Errorf("SetupFile mismatch: expected %s, got %s", UninstallScriptName, appInfo.SetupFile)
+		}
+		return
+	}
+	t.Error("Detection.xml not found in package")
+}
+
+func TestCreateUninstallPackageWithName(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-uninstall-name-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourceDir := filepath.Join(tempDir, "src")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.exe"), []byte("setup"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+
+	pkg := New(Options{
+		SourceDir: sourceDir,
+		SetupFile: "install.exe",
+		OutputDir: tempDir,
+		Name:      "Foo",
+		Quiet:     true,
+	})
+	mainPath, err := pkg.CreatePackage()
+	if err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	uninstallPath, err := pkg.CreateUninstallPackage("msiexec /x {00000000-0000-0000-0000-000000000000} /qn")
+	if err != nil {
+		t.Fatalf("CreateUninstallPackage failed: %v", err)
+	}
+	if filepath.Base(uninstallPath) != "Foo_uninstall.intunewin" {
+		t.Errorf("Unexpected output name: %s", filepath.Base(uninstallPath))
+	}
+
+	// The package of the application is kept
+	main, err := unpacker.Open(mainPath)
+	if err != nil {
+		t.Fatalf("Failed to open the package of the application: %v", err)
+	}
+	if main.Info.SetupFile != "install.exe" {
+		t.Errorf("Package of the application was overwritten: SetupFile %s", main.Info.SetupFile)
+	}
+}
+
+func TestUninstallCommand(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-uninstall-command-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	files := map[string][]byte{
+		"inno.exe":  []byte("MZ Inno Setup Setup Data (6.2.0)"),
+		"nsis.exe":  []byte("MZ \xef\xbe\xad\xdeNullsoftInst"),
+		"other.exe": []byte("MZ"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), content, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	expected := map[string]string{
+		"inno.exe": `"%ProgramFiles%\My App\unins000.exe" /VERYSILENT /SUPPRESSMSGBOXES /NORESTART`,
+		"nsis.exe": `"%ProgramFiles%\My App\uninstall.exe" /S`,
+	}
+	for name, want := range expected {
+		got, err := UninstallCommand(tempDir, name, "My App")
+		if err != nil {
+			t.Errorf("UninstallCommand(%s) failed: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("UninstallCommand(%s) = %q, expected %q", name, got, want)
+		}
+	}
+
+	if _, err := UninstallCommand(tempDir, "other.exe", "My App"); err == nil {
+		t.Error("Expected error for an installer of an unknown framework")
+	}
+	if _, err := UninstallCommand(tempDir, "missing.msi", "My App"); err == nil {
+		t.Error("Expected error for missing MSI")
+	}
+}
@@ -0,0 +1,149 @@
+package packager
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/msi"
+)
+
+const (
+	// resourceDirectory is the PE data directory of resources
+	resourceDirectory = 2
+	// rtVersion is the resource type of version information
+	rtVersion = 16
+)
+
+// fixedFileInfoSignature starts the VS_FIXEDFILEINFO of version resources
+var fixedFileInfoSignature = []byte{0xbd, 0x04, 0xef, 0xfe}
+
+// SetupVersion returns the product version of a setup file: the
+// ProductVersion of MSI files, or the product version resource of
+// executables (the file version if no product version is set). It is
+// empty for other setup files and executables without version resource.
+func SetupVersion(sourceDir, setupFile string) (string, error) {
+	path := filepath.Join(sourceDir, setupFile)
+	switch strings.ToLower(filepath.Ext(setupFile)) {
+	case ".msi":
+		info, err := msi.Open(path)
+		if err != nil {
+			return "", err
+		}
+		return info.ProductVersion, nil
+	case ".exe":
+		return peVersion(path)
+	}
+	return "", nil
+}
+
+// peVersion reads the version resource of a PE file
+func peVersion(path string) (string, error) {
+	f, err := pe.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var dir pe.DataDirectory
+	switch h := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if h.NumberOfRvaAndSizes > resourceDirectory {
+			dir = h.DataDirectory[resourceDirectory]
+		}
+	case *pe.OptionalHeader64:
+		if h.NumberOfRvaAndSizes > resourceDirectory {
+			dir = h.DataDirectory[resourceDirectory]
+		}
+	}
+	if dir.Size == 0 {
+		return "", nil
+	}
+
+	for _, s := range f.Sections {
+		size := max(s.VirtualSize, s.Size)
+		if dir.VirtualAddress < s.VirtualAddress || dir.VirtualAddress >= s.VirtualAddress+size {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return "", err
+		}
+		return versionResource(data, dir.VirtualAddress-s.VirtualAddress, s.VirtualAddress)
+	}
+	return "", nil
+}
+
+// versionResource finds the version resource in the resource tree at
+// offset root of a section loaded at sectionRVA and returns its version
+func versionResource(section []byte, root, sectionRVA uint32) (string, error) {
+	errInvalid := fmt.Errorf("invalid resource directory")
+	u32 := func(off uint32) (uint32, bool) {
+		if uint64(off)+4 > uint64(len(section)) {
+			return 0, false
+		}
+		return binary.LittleEndian.Uint32(section[off:]), true
+	}
+
+	// The tree has three levels: type, name and language. The first name
+	// and language of the version type are used.
+	offset := root
+	for level := 0; level < 3; level++ {
+		if uint64(offset)+16 > uint64(len(section)) {
+			return "", errInvalid
+		}
+		named := binary.LittleEndian.Uint16(section[offset+12:])
+		ids := binary.LittleEndian.Uint16(section[offset+14:])
+		next, found := uint32(0), false
+		for i := uint32(0); i < uint32(named)+uint32(ids); i++ {
+			entry := offset + 16 + i*8
+			id, ok1 := u32(entry)
+			target, ok2 := u32(entry + 4)
+			if !ok1 || !ok2 {
+				return "", errInvalid
+			}
+			if level == 0 && id != rtVersion {
+				continue
+			}
+			next, found = target, true
+			break
+		}
+		if !found {
+			return "", nil
+		}
+		if level < 2 {
+			if next&0x80000000 == 0 {
+				return "", errInvalid
+			}
+			next &^= 0x80000000
+		}
+		offset = root + next
+	}
+
+	// offset is the data entry of the version resource
+	rva, ok1 := u32(offset)
+	size, ok2 := u32(offset + 4)
+	if !ok1 || !ok2 || rva < sectionRVA || uint64(rva-sectionRVA)+uint64(size) > uint64(len(section)) {
+		return "", errInvalid
+	}
+	data := section[rva-sectionRVA : rva-sectionRVA+size]
+
+	i := bytes.Index(data, fixedFileInfoSignature)
+	if i < 0 || i+24 > len(data) {
+		return "", nil
+	}
+	fileMS := binary.LittleEndian.Uint32(data[i+8:])
+	fileLS := binary.LittleEndian.Uint32(data[i+12:])
+	productMS := binary.LittleEndian.Uint32(data[i+16:])
+	productLS := binary.LittleEndian.Uint32(data[i+20:])
+	if productMS == 0 && productLS == 0 {
+		productMS, productLS = fileMS, fileLS
+	}
+	if productMS == 0 && productLS == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("%d.%d.%d.%d", productMS>>16, productMS&0xffff, productLS>>16, productLS&0xffff), nil
+}
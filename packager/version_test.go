@@ -0,0 +1,79 @@
+package packager
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// resourceSection builds a resource section with a version resource
+func resourceSection(sectionRVA uint32, productMS, productLS uint32) []byte {
+	le := binary.LittleEndian
+	section := make([]byte, 0x100)
+	// Type, name and language directories with one ID entry each
+	for level, offset := range []uint32{0x00, 0x18, 0x30} {
+		le.PutUint16(section[offset+14:], 1)
+		id, target := uint32(1), offset+0x18|0x80000000
+		if level == 0 {
+			id = rtVersion
+		}
+		if level == 2 {
+			id, target = 0x409, 0x48
+		}
+		le.PutUint32(section[offset+16:], id)
+		le.PutUint32(section[offset+20:], target)
+	}
+	// Data entry pointing at the version resource
+	le.PutUint32(section[0x48:], sectionRVA+0x60)
+	le.PutUint32(section[0x4c:], 0x60)
+	// VS_FIXEDFILEINFO after the VS_VERSIONINFO header
+	copy(section[0x60+40:], fixedFileInfoSignature)
+	le.PutUint32(section[0x60+48:], 1<<16|2)
+	le.PutUint32(section[0x60+52:], 3<<16|4)
+	le.PutUint32(section[0x60+56:], productMS)
+	le.PutUint32(section[0x60+60:], productLS)
+	return section
+}
+
+func TestVersionResource(t *testing.T) {
+	version, err := versionResource(resourceSection(0x3000, 10<<16|1, 22<<16|3), 0, 0x3000)
+	if err != nil {
+		t.Fatalf("versionResource failed: %v", err)
+	}
+	if version != "10.1.22.3" {
+		t.Errorf("Expected product version 10.1.22.3, got %s", version)
+	}
+
+	// Without a product version the file version is used
+	version, err = versionResource(resourceSection(0x3000, 0, 0), 0, 0x3000)
+	if err != nil || version != "1.2.3.4" {
+		t.Errorf("Expected file version 1.2.3.4, got %s, %v", version, err)
+	}
+
+	if _, err := versionResource(make([]byte, 8), 0, 0x3000); err == nil {
+		t.Error("Expected error for a truncated resource directory")
+	}
+}
+
+func TestSetupVersion(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-version-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := os.WriteFile(filepath.Join(tempDir, "install.cmd"), []byte("@echo off"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+	if version, err := SetupVersion(tempDir, "install.cmd"); err != nil || version != "" {
+		t.Errorf("Expected no version for scripts, got %q, %v", version, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "setup.exe"), []byte("not a PE file"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+	if _, err := SetupVersion(tempDir, "setup.exe"); err == nil {
+		t.Error("Expected error for an invalid executable")
+	}
+}
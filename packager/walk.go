@@ -0,0 +1,72 @@
+package packager
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// walkDir is filepath.WalkDir with an explicit order: the entries of a
+// folder are visited sorted by the bytes of their names, whatever order
+// the file system returns them in and whatever the locale. Uppercase
+// names come before lowercase ones, and names are not normalized, so that
+// the entries of the inner ZIP are in the same order on every platform
+// and builds of the same source are reproducible.
+func walkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDirEntry(root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDirEntry visits path and, for folders, its sorted entries
+func walkDirEntry(path string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			return nil
+		}
+		return err
+	}
+
+	entries, err := readDirSorted(path)
+	if err != nil {
+		// As with filepath.WalkDir, the entries read before the error are
+		// still visited unless fn returns an error
+		if err = fn(path, d, err); err != nil {
+			if err == filepath.SkipDir {
+				return nil
+			}
+			return err
+		}
+	}
+	for _, entry := range entries {
+		if err := walkDirEntry(filepath.Join(path, entry.Name()), entry, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// readDirSorted reads the entries of a folder in the order of walkDir
+func readDirSorted(path string) ([]fs.DirEntry, error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := dir.ReadDir(-1)
+	dir.Close()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, err
+}
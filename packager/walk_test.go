@@ -0,0 +1,65 @@
+package packager
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWalkDirOrder(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-walk-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Files are created out of order, so that the order of the file
+	// system does not match
+	sourceDir := filepath.Join(tempDir, "app")
+	for _, name := range []string{"zeta.txt", "b/2.txt", "é.txt", "B.txt", "a.txt", "b/10.txt", "a b.txt", "install.cmd", "skip/x.txt"} {
+		path := filepath.Join(sourceDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	var visited []string
+	err = walkDir(sourceDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(sourceDir, path)
+		if d.Name() == "skip" {
+			return filepath.SkipDir
+		}
+		visited = append(visited, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walkDir failed: %v", err)
+	}
+	expected := ".,B.txt,a b.txt,a.txt,b,b/10.txt,b/2.txt,install.cmd,zeta.txt,é.txt"
+	if got := strings.Join(visited, ","); got != expected {
+		t.Errorf("Unexpected order:\n%s\nexpected:\n%s", got, expected)
+	}
+
+	innerZip, err := New(Options{SourceDir: sourceDir, SetupFile: "install.cmd", Quiet: true}).createInnerZip()
+	if err != nil {
+		t.Fatalf("createInnerZip failed: %v", err)
+	}
+	expected = "app/B.txt,app/a b.txt,app/a.txt,app/b/,app/b/10.txt,app/b/2.txt,app/install.cmd,app/skip/,app/skip/x.txt,app/zeta.txt,app/é.txt"
+	if names := strings.Join(zipNames(t, innerZip), ","); names != expected {
+		t.Errorf("Unexpected entry order:\n%s\nexpected:\n%s", names, expected)
+	}
+
+	if err := walkDir(filepath.Join(tempDir, "missing"), func(path string, d fs.DirEntry, err error) error {
+		return err
+	}); !os.IsNotExist(err) {
+		t.Errorf("Expected not exist error for a missing root, got %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package packager
+
+import (
+	"bytes"
+	"debug/pe"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/msi"
+)
+
+const (
+	// MaxPathLength is the Windows MAX_PATH limit that applies to content
+	// extracted by the Intune Management Extension
+	MaxPathLength = 260
+	// MaxContentSize is the largest Win32 app content accepted by Intune
+	MaxContentSize = 30 << 30
+
+	// imeCachePrefix is the folder the Intune Management Extension
+	// extracts packages to
+	imeCachePrefix = `C:\Windows\IMECache\00000000-0000-0000-0000-000000000000_1\`
+	// securityDirectory is the PE data directory of Authenticode signatures
+	securityDirectory = 4
+)
+
+// ErrStrict is wrapped by the errors returned for warnings in strict mode
+var ErrStrict = errors.New("strict mode")
+
+// ErrSizeLimit is wrapped by the errors returned for source files exceeding
+// Options.MaxFileSize or Options.MaxSourceSize with Options.FailOnSizeLimit
+var ErrSizeLimit = errors.New("size limit exceeded")
+
+// Warning codes. A code identifies a kind of warning across releases and
+// is never reused, so that pipelines can suppress or count warnings
+// without matching their messages.
+const (
+	WarnLongPath        = "W001"
+	WarnCaseCollision   = "W002"
+	WarnContentSize     = "W003"
+	WarnFileSize        = "W004"
+	WarnSourceSize      = "W005"
+	WarnLinkSkipped     = "W006"
+	WarnUnreadable      = "W007"
+	WarnStreams         = "W008"
+	WarnMarkOfTheWeb    = "W009"
+	WarnDriverCheck     = "W010"
+	WarnDriver          = "W011"
+	WarnSilentSwitches  = "W012"
+	WarnSignatureCheck  = "W013"
+	WarnUnsigned        = "W014"
+	WarnReusedVersion   = "W015"
+	WarnHardLinkSkipped = "W016"
+	WarnMsiInfo         = "W017"
+)
+
+// WarningCodes describes the warning codes. WarnSilentSwitches and
+// WarnReusedVersion are reported by the CLI, from CheckSilentSwitches and
+// the build registry.
+var WarningCodes = map[string]string{
+	WarnLongPath:        "path longer than MAX_PATH once extracted",
+	WarnCaseCollision:   "names colliding on case-insensitive file systems",
+	WarnContentSize:     "content over the Intune size limit",
+	WarnFileSize:        "source file over MaxFileSize",
+	WarnSourceSize:      "source over MaxSourceSize",
+	WarnLinkSkipped:     "link to a folder already packaged",
+	WarnUnreadable:      "unreadable source file skipped",
+	WarnStreams:         "alternate data streams not packaged",
+	WarnMarkOfTheWeb:    "files with a Mark of the Web",
+	WarnDriverCheck:     "driver packages not checked",
+	WarnDriver:          "driver package problem",
+	WarnSilentSwitches:  "installer without silent switches",
+	WarnSignatureCheck:  "setup signature not checked",
+	WarnUnsigned:        "unsigned setup file",
+	WarnReusedVersion:   "version already built with other files",
+	WarnHardLinkSkipped: "hard link to content already packaged, skipped",
+	WarnMsiInfo:         "MSI information not read",
+}
+
+// Warning is a warning of a build
+type Warning struct {
+	// Code is one of the Warn constants
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// String returns the message followed by the code
+func (w Warning) String() string {
+	return fmt.Sprintf("%s (%s)", w.Message, w.Code)
+}
+
+// checkSuppress checks that Options.Suppress lists known warning codes
+func checkSuppress(opts Options) error {
+	for _, code := range opts.Suppress {
+		if _, ok := WarningCodes[code]; !ok {
+			return fmt.Errorf("unknown warning code %q", code)
+		}
+	}
+	return nil
+}
+
+// Warnings returns the messages of the warnings of the last CreatePackage
+// call
+func (p *Packager) Warnings() []string {
+	var msgs []string
+	for _, w := range p.warnings {
+		msgs = append(msgs, w.Message)
+	}
+	return msgs
+}
+
+// WarningDetails returns the warnings of the last CreatePackage call with
+// their codes
+func (p *Packager) WarningDetails() []Warning {
+	return p.warnings
+}
+
+// warn records a warning, or returns it as an error in strict mode.
+// Warnings with a code of Options.Suppress are dropped.
+func (p *Packager) warn(code, format string, args ...interface{}) error {
+	if contains(p.opts.Suppress, code) {
+		return nil
+	}
+	w := Warning{Code: code, Message: fmt.Sprintf(format, args...)}
+	if p.opts.Strict {
+		return fmt.Errorf("%w: %s", ErrStrict, w)
+	}
+	p.warnings = append(p.warnings, w)
+	if p.opts.Logger != nil {
+		p.opts.Logger.Printf("Warning: %s", w)
+	}
+	return nil
+}
+
+// checkEntry checks an inner ZIP entry for paths exceeding MAX_PATH once
+// extracted, and for names only differing in case, which collide on Windows
+func (p *Packager) checkEntry(entries map[string]string, archivePath string) error {
+	if length := len(imeCachePrefix) + len(archivePath); length > MaxPathLength {
+		if err := p.warn(WarnLongPath, "%s exceeds %d characters when extracted (%d)", archivePath, MaxPathLength, length); err != nil {
+			return err
+		}
+	}
+
+	key := strings.ToLower(archivePath)
+	if existing, ok := entries[key]; ok {
+		if existing == archivePath {
+			return fmt.Errorf("%s is added more than once, e.g. by a merged source", archivePath)
+		}
+		return p.warn(WarnCaseCollision, "%s collides with %s on case-insensitive file systems", archivePath, existing)
+	}
+	entries[key] = archivePath
+	return nil
+}
+
+// checkContentSize checks the encrypted content against the Intune limit
+func (p *Packager) checkContentSize(size int64) error {
+	if size > MaxContentSize {
+		return p.warn(WarnContentSize, "content size %d bytes exceeds the Intune limit of %d bytes", size, int64(MaxContentSize))
+	}
+	return nil
+}
+
+// checkFileSize checks a source file against Options.MaxFileSize and the
+// source files so far against Options.MaxSourceSize. The total size is
+// reported once, for the file that exceeds it.
+func (p *Packager) checkFileSize(file *os.File, archivePath string) error {
+	if p.opts.MaxFileSize <= 0 && p.opts.MaxSourceSize <= 0 {
+		return nil
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", archivePath, err)
+	}
+
+	var problems []Warning
+	if p.opts.MaxFileSize > 0 && info.Size() > p.opts.MaxFileSize {
+		problems = append(problems, Warning{WarnFileSize, fmt.Sprintf("%s is %d bytes, over the file size limit of %d bytes", archivePath, info.Size(), p.opts.MaxFileSize)})
+	}
+	before := p.sourceSize
+	p.sourceSize += info.Size()
+	if p.opts.MaxSourceSize > 0 && before <= p.opts.MaxSourceSize && p.sourceSize > p.opts.MaxSourceSize {
+		problems = append(problems, Warning{WarnSourceSize, fmt.Sprintf("source exceeds the total size limit of %d bytes at %s", p.opts.MaxSourceSize, archivePath)})
+	}
+
+	for _, problem := range problems {
+		if p.opts.FailOnSizeLimit {
+			return fmt.Errorf("%w: %s", ErrSizeLimit, problem.Message)
+		}
+		if err := p.warn(problem.Code, "%s", problem.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSetupSignature checks that an executable, MSI or PowerShell setup
+// file carries a signature. Signatures are not verified.
+func (p *Packager) checkSetupSignature() error {
+	if p.opts.MSIXWrapper {
+		return nil
+	}
+
+	path := filepath.Join(p.opts.SourceDir, p.opts.SetupFile)
+	var signed bool
+	var err error
+	switch strings.ToLower(filepath.Ext(p.opts.SetupFile)) {
+	case ".exe":
+		signed, err = isSignedPE(path)
+	case ".msi":
+		var info *msi.Info
+		info, err = msi.Open(path)
+		if err == nil {
+			signed = info.Signed
+		}
+	case ".ps1":
+		signed, err = isSignedScript(path)
+	default:
+		return nil
+	}
+
+	if err != nil {
+		return p.warn(WarnSignatureCheck, "cannot check the signature of %s: %v", p.opts.SetupFile, err)
+	}
+	if !signed {
+		return p.warn(WarnUnsigned, "setup file %s is not signed", p.opts.SetupFile)
+	}
+	return nil
+}
+
+// isSignedPE reports whether a PE file has an Authenticode signature
+func isSignedPE(path string) (bool, error) {
+	f, err := pe.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	switch h := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return h.NumberOfRvaAndSizes > securityDirectory && h.DataDirectory[securityDirectory].Size > 0, nil
+	case *pe.OptionalHeader64:
+		return h.NumberOfRvaAndSizes > securityDirectory && h.DataDirectory[securityDirectory].Size > 0, nil
+	}
+	return false, nil
+}
+
+// isSignedScript reports whether a PowerShell script has a signature block
+func isSignedScript(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Contains(data, []byte("# SIG # Begin signature block")), nil
+}
@@ -0,0 +1,160 @@
+// Package prune removes old package versions from output directories.
+//
+// Packages are grouped by app: the path of a package relative to the
+// output directory with its version numbers left out, so that both
+// "output/My App 1.2.0.intunewin" and "output/1.2.0/My App.intunewin"
+// layouts are recognized. Within a group the most recently built packages
+// are kept. Removing a package also removes its sidecars (app, file
+// manifest, escrow and signature files named <package>.intunewin.*) and
+// its upload script.
+package prune
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MANCHTOOLS/open-package/snippet"
+)
+
+// PackageExt is the extension of the packages considered for pruning
+const PackageExt = ".intunewin"
+
+// versionPattern matches version numbers such as 1.2, v10.0.1 or 2024.05.01
+var versionPattern = regexp.MustCompile(`[vV]?\d+(\.\d+)+`)
+
+// Version is a built package with its sidecars
+type Version struct {
+	// Path is the path of the .intunewin file
+	Path    string
+	ModTime time.Time
+	// Sidecars are the files belonging to the package
+	Sidecars []string
+}
+
+// Files returns the package and its sidecars
+func (v Version) Files() []string {
+	return append([]string{v.Path}, v.Sidecars...)
+}
+
+// App is the group of versions of an app, newest first
+type App struct {
+	// Key identifies the app, its relative path with versions replaced by *
+	Key    string
+	Keep   []Version
+	Remove []Version
+}
+
+// Plan finds the packages below dir and selects all but the newest keep
+// versions of each app for removal
+func Plan(dir string, keep int) ([]App, error) {
+	if keep < 1 {
+		return nil, fmt.Errorf("at least one version must be kept, got %d", keep)
+	}
+
+	groups := make(map[string][]Version)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), PackageExt) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sidecars, err := findSidecars(path)
+		if err != nil {
+			return err
+		}
+		key := versionPattern.ReplaceAllString(filepath.ToSlash(rel), "*")
+		groups[key] = append(groups[key], Version{Path: path, ModTime: info.ModTime(), Sidecars: sidecars})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", dir, err)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	apps := make([]App, 0, len(keys))
+	for _, key := range keys {
+		versions := groups[key]
+		sort.Slice(versions, func(i, j int) bool {
+			if !versions[i].ModTime.Equal(versions[j].ModTime) {
+				return versions[i].ModTime.After(versions[j].ModTime)
+			}
+			return versions[i].Path > versions[j].Path
+		})
+		app := App{Key: key, Keep: versions}
+		if len(versions) > keep {
+			app.Keep, app.Remove = versions[:keep], versions[keep:]
+		}
+		apps = append(apps, app)
+	}
+	return apps, nil
+}
+
+// findSidecars returns the files next to a package that belong to it
+func findSidecars(packagePath string) ([]string, error) {
+	dir, base := filepath.Split(packagePath)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+	script := filepath.Base(snippet.Path(packagePath))
+	var sidecars []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || name == base {
+			continue
+		}
+		if strings.HasPrefix(name, base+".") || name == script {
+			sidecars = append(sidecars, filepath.Join(dir, name))
+		}
+	}
+	return sidecars, nil
+}
+
+// Remove deletes the versions selected for removal and the directories
+// left empty below dir. It returns the removed files.
+func Remove(dir string, apps []App) ([]string, error) {
+	var removed []string
+	for _, app := range apps {
+		for _, v := range app.Remove {
+			for _, path := range v.Files() {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return removed, fmt.Errorf("failed to remove %s: %w", path, err)
+				}
+				removed = append(removed, path)
+			}
+			removeEmptyParents(dir, filepath.Dir(v.Path))
+		}
+	}
+	return removed, nil
+}
+
+// removeEmptyParents removes path and its parents up to, but excluding,
+// root as long as they are empty
+func removeEmptyParents(root, path string) {
+	root = filepath.Clean(root)
+	for path = filepath.Clean(path); path != root && strings.HasPrefix(path, root); path = filepath.Dir(path) {
+		if os.Remove(path) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package prune
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlanAndRemove(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-prune-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Three versions in version folders, two with the version in the name
+	now := time.Now()
+	files := map[string]time.Duration{
+		"1.0.0/myapp.intunewin":            3 * time.Hour,
+		"1.0.0/myapp.intunewin.app.json":   3 * time.Hour,
+		"1.0.0/myapp.upload.ps1":           3 * time.Hour,
+		"1.1.0/myapp.intunewin":            2 * time.Hour,
+		"1.1.0/myapp.intunewin.files.json": 2 * time.Hour,
+		"1.2.0/myapp.intunewin":            time.Hour,
+		"tool v2.0.intunewin":              2 * time.Hour,
+		"tool v2.1.intunewin":              time.Hour,
+		"tool v2.1.intunewin.sig":          time.Hour,
+		"notes.txt":                        time.Hour,
+	}
+	for name, age := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatalf("Failed to set time: %v", err)
+		}
+	}
+
+	if _, err := Plan(tempDir, 0); err == nil {
+		t.Error("Expected error for keep 0")
+	}
+
+	apps, err := Plan(tempDir, 1)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(apps) != 2 || apps[0].Key != "*/myapp.intunewin" || apps[1].Key != "tool *.intunewin" {
+		t.Fatalf("Unexpected apps: %+v", apps)
+	}
+	if len(apps[0].Keep) != 1 || apps[0].Keep[0].Path != filepath.Join(tempDir, "1.2.0", "myapp.intunewin") || len(apps[0].Remove) != 2 {
+		t.Errorf("Unexpected versions: %+v", apps[0])
+	}
+	if len(apps[0].Remove[1].Sidecars) != 2 {
+		t.Errorf("Expected app sidecar and upload script, got %v", apps[0].Remove[1].Sidecars)
+	}
+
+	removed, err := Remove(tempDir, apps)
+	if err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if len(removed) != 6 {
+		t.Errorf("Expected 6 removed files, got %v", removed)
+	}
+	for _, name := range []string{"1.0.0", "1.1.0", "tool v2.0.intunewin"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", name)
+		}
+	}
+	for _, name := range []string{"1.2.0/myapp.intunewin", "tool v2.1.intunewin.sig", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Errorf("Expected %s to be kept: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+// Package psmodule generates the OpenPackage PowerShell module, a thin
+// wrapper around the CLI for Windows administrators.
+//
+// The module exports two cmdlets:
+//   - New-OpenPackage runs a manifest build of the CLI for every source it
+//     receives from parameters or the pipeline and returns the JSON results
+//     as objects, so that failed builds become PowerShell errors
+//   - Publish-OpenPackage runs the upload script written next to a package
+//     with -upload-script, taking the packages of New-OpenPackage from the
+//     pipeline
+//
+// The module holds no packaging logic: it is regenerated for every CLI
+// release, and the cmdlets only bind parameters and translate results.
+package psmodule
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/snippet"
+)
+
+// Name is the name of the module and of its files
+const Name = "OpenPackage"
+
+// DefaultVersion is the module version of Options without Version
+const DefaultVersion = "1.0.0"
+
+// CLIEnv is the environment variable that overrides the CLI path of the
+// module when it is imported
+const CLIEnv = "OPEN_PACKAGE_CLI"
+
+// guid identifies the module in the PowerShell Gallery and must not change
+// between releases
+const guid = "6f1c9a52-8f0e-4c1b-9d3a-2e7b5c4d8a10"
+
+// Options configures the generated module
+type Options struct {
+	// CLIPath is the open-package executable the cmdlets run (optional).
+	// Without it they run open-package from PATH, unless CLIEnv is set.
+	CLIPath string
+	// Version is the module version, e.g. the CLI version (optional,
+	// defaults to DefaultVersion). It has two to four numeric parts.
+	Version string
+}
+
+// Files returns the module files, the manifest (.psd1) and the script
+// module (.psm1), by file name
+func Files(opts Options) (map[string][]byte, error) {
+	version := opts.Version
+	if version == "" {
+		version = DefaultVersion
+	}
+	if !validVersion(version) {
+		return nil, fmt.Errorf("invalid module version %q (expected e.g. 1.2.3)", version)
+	}
+	replacer := strings.NewReplacer(
+		"{{VERSION}}", version,
+		"{{CLI}}", quote(opts.CLIPath),
+		"{{CLI_ENV}}", CLIEnv,
+		"{{UPLOAD_SUFFIX}}", quote(snippet.Suffix),
+	)
+	return map[string][]byte{
+		Name + ".psd1": []byte(crlf(replacer.Replace(manifest))),
+		Name + ".psm1": []byte(crlf(replacer.Replace(module))),
+	}, nil
+}
+
+// Write writes the module files to dir, which is created if needed, and
+// returns their paths. PowerShell finds the module when dir is named
+// after it and is in a folder of PSModulePath.
+func Write(dir string, opts Options) ([]string, error) {
+	files, err := Files(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create module folder: %w", err)
+	}
+	var paths []string
+	for _, name := range []string{Name + ".psd1", Name + ".psm1"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, files[name], 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// validVersion reports whether version parses as a .NET System.Version
+func validVersion(version string) bool {
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 || len(parts) > 4 {
+		return false
+	}
+	for _, part := range parts {
+		if part == "" || len(part) > 9 || strings.Trim(part, "0123456789") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// quote returns s as a single-quoted PowerShell string
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// crlf converts line endings to CRLF, which Windows PowerShell editors
+// expect
+func crlf(s string) string {
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+// manifest is the module manifest
+const manifest = `# Module manifest of OpenPackage, generated by open-package
+@{
+    RootModule        = 'OpenPackage.psm1'
+    ModuleVersion     = '{{VERSION}}'
+    GUID              = '` + guid + `'
+    Author            = 'open-package'
+    Description       = 'Creates .intunewin packages with the open-package CLI and uploads them with the generated upload scripts'
+    PowerShellVersion = '5.1'
+    FunctionsToExport = @('New-OpenPackage', 'Publish-OpenPackage')
+    CmdletsToExport   = @()
+    VariablesToExport = @()
+    AliasesToExport   = @()
+}
+`
+
+// module is the script module. New-OpenPackage writes a manifest with a
+// single row per source and reads the results file of the build, which is
+// the JSON contract of the CLI.
+const module = `# OpenPackage module, generated by open-package. Regenerate it with
+# "open-package ps-module" after updating the CLI instead of editing it.
+
+$script:Cli = {{CLI}}
+if ($env:{{CLI_ENV}}) {
+    $script:Cli = $env:{{CLI_ENV}}
+} elseif (-not $script:Cli) {
+    $script:Cli = 'open-package'
+}
+
+function New-OpenPackage {
+    <#
+    .SYNOPSIS
+    Creates an .intunewin package with the open-package CLI.
+
+    .DESCRIPTION
+    Packages every source folder received from the parameters or the
+    pipeline and returns the result of its build: Status, PackagePath,
+    JobId and the skipped, excluded and duplicate files. Failed builds are
+    reported as errors. Sources are bound by property name, so that rows of
+    Import-Csv with Source, Setup, Name and Output columns can be piped.
+
+    .PARAMETER Source
+    The source folder.
+
+    .PARAMETER Setup
+    The setup file, relative to the source folder.
+
+    .PARAMETER Name
+    The application name, which defaults to the source folder name.
+
+    .PARAMETER Output
+    The output folder of the package.
+
+    .PARAMETER UploadScript
+    Writes the upload script next to the package, for Publish-OpenPackage.
+
+    .PARAMETER Strict
+    Fails the build on packaging warnings.
+
+    .PARAMETER ArgumentList
+    Further options of "open-package pack", e.g. '-workers', '4'.
+
+    .EXAMPLE
+    New-OpenPackage -Source .\MyApp -Setup setup.msi -Output .\out
+
+    .EXAMPLE
+    Import-Csv apps.csv | New-OpenPackage -UploadScript | Publish-OpenPackage -TenantId contoso.onmicrosoft.com
+    #>
+    [CmdletBinding(SupportsShouldProcess = $true)]
+    param(
+        [Parameter(Mandatory = $true, Position = 0, ValueFromPipeline = $true, ValueFromPipelineByPropertyName = $true)]
+        [Alias('FullName')]
+        [string]$Source,
+
+        [Parameter(Mandatory = $true, Position = 1, ValueFromPipelineByPropertyName = $true)]
+        [string]$Setup,
+
+        [Parameter(ValueFromPipelineByPropertyName = $true)]
+        [string]$Name = '',
+
+        [Parameter(ValueFromPipelineByPropertyName = $true)]
+        [string]$Output = '.',
+
+        [switch]$UploadScript,
+
+        [switch]$Strict,
+
+        [string[]]$ArgumentList = @()
+    )
+
+    process {
+        # Empty CSV cells bind as empty strings
+        if (-not $Output) { $Output = '.' }
+        $sourcePath = $PSCmdlet.GetUnresolvedProviderPathFromPSPath($Source)
+        $outputPath = $PSCmdlet.GetUnresolvedProviderPathFromPSPath($Output)
+        if (-not $PSCmdlet.ShouldProcess($sourcePath, 'Create package')) {
+            return
+        }
+
+        $work = Join-Path ([IO.Path]::GetTempPath()) ('open-package-' + [guid]::NewGuid())
+        New-Item -ItemType Directory -Path $work | Out-Null
+        try {
+            $manifest = Join-Path $work 'manifest.csv'
+            $results = Join-Path $work 'results.json'
+            [pscustomobject]@{ source = $sourcePath; setup = $Setup; name = $Name; output = $outputPath } |
+                Export-Csv -LiteralPath $manifest -NoTypeInformation -Encoding UTF8
+
+            $arguments = @('pack', '-quiet', '-manifest', $manifest, '-results', $results)
+            if ($UploadScript) { $arguments += '-upload-script' }
+            if ($Strict) { $arguments += '-strict' }
+            $arguments += $ArgumentList
+
+            Write-Verbose "$script:Cli $($arguments -join ' ')"
+            $ErrorActionPreference = 'Continue'
+            & $script:Cli @arguments 2>&1 | ForEach-Object { Write-Verbose "$_" }
+            if (-not (Test-Path -LiteralPath $results)) {
+                Write-Error "open-package exited with code $LASTEXITCODE without results for $sourcePath"
+                return
+            }
+
+            # Windows PowerShell returns the array as a single object, which
+            # foreach enumerates once it is assigned
+            $parsed = Get-Content -LiteralPath $results -Raw -Encoding UTF8 | ConvertFrom-Json
+            foreach ($result in $parsed) {
+                $packagePath = $null
+                if ($result.PSObject.Properties['packages']) {
+                    $packagePath = @($result.packages)[0]
+                }
+                $result | Add-Member -NotePropertyName PackagePath -NotePropertyValue $packagePath
+                $result.PSObject.TypeNames.Insert(0, 'OpenPackage.BuildResult')
+                if ($result.status -ne 'ok') {
+                    Write-Error -Message "Packaging $sourcePath failed: $($result.error)" -TargetObject $result
+                    continue
+                }
+                $result
+            }
+        } finally {
+            Remove-Item -LiteralPath $work -Recurse -Force -ErrorAction SilentlyContinue
+        }
+    }
+}
+
+function Publish-OpenPackage {
+    <#
+    .SYNOPSIS
+    Uploads an .intunewin package to Intune.
+
+    .DESCRIPTION
+    Runs the upload script written next to the package by New-OpenPackage
+    -UploadScript (or "open-package -upload-script"), which uploads it with
+    the IntuneWin32App module. Packages are bound by PackagePath, so that
+    the results of New-OpenPackage can be piped.
+
+    .PARAMETER Path
+    The path of the .intunewin package.
+
+    .PARAMETER TenantId
+    The tenant to upload to, e.g. contoso.onmicrosoft.com.
+
+    .PARAMETER Parameters
+    Further parameters of the upload script, e.g. @{ Owner = 'IT' }.
+
+    .EXAMPLE
+    Publish-OpenPackage -Path .\out\MyApp.intunewin -TenantId contoso.onmicrosoft.com
+    #>
+    [CmdletBinding(SupportsShouldProcess = $true)]
+    param(
+        [Parameter(Mandatory = $true, Position = 0, ValueFromPipeline = $true, ValueFromPipelineByPropertyName = $true)]
+        [Alias('PackagePath', 'FullName')]
+        [string]$Path,
+
+        [Parameter(Mandatory = $true)]
+        [string]$TenantId,
+
+        [hashtable]$Parameters = @{}
+    )
+
+    process {
+        $packagePath = $PSCmdlet.GetUnresolvedProviderPathFromPSPath($Path)
+        $uploadScript = [IO.Path]::ChangeExtension($packagePath, {{UPLOAD_SUFFIX}})
+        if (-not (Test-Path -LiteralPath $uploadScript)) {
+            Write-Error "No upload script found at $uploadScript; create the package with -UploadScript"
+            return
+        }
+        if (-not $PSCmdlet.ShouldProcess($packagePath, "Upload to $TenantId")) {
+            return
+        }
+
+        $arguments = @{ TenantId = $TenantId; FilePath = $packagePath }
+        foreach ($key in $Parameters.Keys) {
+            $arguments[$key] = $Parameters[$key]
+        }
+        & $uploadScript @arguments
+    }
+}
+
+Export-ModuleMember -Function New-OpenPackage, Publish-OpenPackage
+`
@@ -0,0 +1,74 @@
+package psmodule
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFiles(t *testing.T) {
+	files, err := Files(Options{CLIPath: `C:\Tools\O'Brien\open-package.exe`, Version: "1.2.3"})
+	if err != nil {
+		t.Fatalf("Files failed: %v", err)
+	}
+	manifest := string(files["OpenPackage.psd1"])
+	module := string(files["OpenPackage.psm1"])
+	for _, want := range []string{"ModuleVersion     = '1.2.3'", "RootModule        = 'OpenPackage.psm1'", "'New-OpenPackage', 'Publish-OpenPackage'"} {
+		if !strings.Contains(manifest, want) {
+			t.Errorf("Manifest does not contain %q:\n%s", want, manifest)
+		}
+	}
+	for _, want := range []string{
+		`$script:Cli = 'C:\Tools\O''Brien\open-package.exe'`,
+		"$env:OPEN_PACKAGE_CLI",
+		"function New-OpenPackage",
+		"function Publish-OpenPackage",
+		"'-manifest', $manifest, '-results', $results",
+		"[IO.Path]::ChangeExtension($packagePath, '.upload.ps1')",
+	} {
+		if !strings.Contains(module, want) {
+			t.Errorf("Module does not contain %q", want)
+		}
+	}
+	if strings.Contains(module, "{{") || strings.Contains(manifest, "{{") {
+		t.Error("Unreplaced placeholder in module")
+	}
+	if strings.Count(module, "\n") != strings.Count(module, "\r\n") {
+		t.Error("Expected CRLF line endings")
+	}
+
+	for _, version := range []string{"1", "1.0.0-beta", "v1.0", "1..0", "1.2.3.4.5"} {
+		if _, err := Files(Options{Version: version}); err == nil {
+			t.Errorf("Expected error for version %q", version)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-psmodule-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dir := filepath.Join(tempDir, Name)
+	paths, err := Write(dir, Options{})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("Expected 2 files, got %v", paths)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "OpenPackage.psm1"))
+	if err != nil {
+		t.Fatalf("Failed to read module: %v", err)
+	}
+	if !strings.Contains(string(data), "$script:Cli = ''") {
+		t.Error("Expected an empty CLI path without Options.CLIPath")
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "OpenPackage.psd1"))
+	if err != nil || !strings.Contains(string(data), "'"+DefaultVersion+"'") {
+		t.Errorf("Expected the default version in the manifest, got %v", err)
+	}
+}
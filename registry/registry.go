@@ -0,0 +1,224 @@
+// Package registry records the packages built on a machine, so that teams
+// have the provenance of every build without running external systems.
+//
+// The registry is a JSON Lines file with one build per line. Builds are
+// appended as they are created, so the file can be shared by concurrent
+// builds, kept under version control or shipped to a log system as is.
+// Upload tooling records the Intune app of a build with Update, which
+// appends the new state of the build as an update line.
+package registry
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileName is the name of the default registry file
+const FileName = "registry.jsonl"
+
+// Upload states of a build
+const (
+	StatusBuilt    = "built"
+	StatusUploaded = "uploaded"
+)
+
+// Build is a package recorded in the registry
+type Build struct {
+	Time         time.Time `json:"time"`
+	JobID        string    `json:"jobId"`
+	Name         string    `json:"name"`
+	Version      string    `json:"version,omitempty"`
+	Architecture string    `json:"architecture,omitempty"`
+	// Package is the absolute path of the .intunewin file
+	Package       string `json:"package"`
+	PackageSHA256 string `json:"packageSha256"`
+	// SourceSHA256 is the digest of the packaged files (see
+	// changes.Manifest.Digest), equal for builds of unchanged sources
+	SourceSHA256 string `json:"sourceSha256"`
+	UploadStatus string `json:"uploadStatus"`
+	// AppID is the ID of the Intune app the package was uploaded to
+	AppID string `json:"appId,omitempty"`
+}
+
+// record is a line of the registry file: a build, or with Update the new
+// state of the earlier build of the same package
+type record struct {
+	Build
+	Update bool `json:"update,omitempty"`
+}
+
+// Registry is an open registry file
+type Registry struct {
+	path   string
+	builds []Build
+}
+
+// DefaultPath returns the registry in the user configuration directory
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "open-package", FileName), nil
+}
+
+// Open reads a registry file. A missing file is an empty registry.
+func Open(path string) (*Registry, error) {
+	r := &Registry{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("failed to parse registry %s line %d: %w", path, line, err)
+		}
+		if !rec.Update {
+			r.builds = append(r.builds, rec.Build)
+		} else if i := r.index(rec.Build); i >= 0 {
+			r.builds[i] = rec.Build
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read registry: %w", err)
+	}
+	return r, nil
+}
+
+// Path returns the path of the registry file
+func (r *Registry) Path() string {
+	return r.path
+}
+
+// Builds returns all builds, oldest first
+func (r *Registry) Builds() []Build {
+	return r.builds
+}
+
+// History returns the builds of an app (case-insensitive), oldest first.
+// An empty name returns all builds.
+func (r *Registry) History(name string) []Build {
+	if name == "" {
+		return r.builds
+	}
+	var builds []Build
+	for _, b := range r.builds {
+		if strings.EqualFold(b.Name, name) {
+			builds = append(builds, b)
+		}
+	}
+	return builds
+}
+
+// Find returns the latest build with a job ID, package path or package
+// digest (or a prefix of at least 8 characters of it)
+func (r *Registry) Find(id string) (Build, bool) {
+	abs, _ := filepath.Abs(id)
+	for i := len(r.builds) - 1; i >= 0; i-- {
+		b := r.builds[i]
+		if b.JobID == id || b.Package == abs ||
+			(len(id) >= 8 && strings.HasPrefix(b.PackageSHA256, strings.ToLower(id))) {
+			return b, true
+		}
+	}
+	return Build{}, false
+}
+
+// Conflict returns the latest build of the same version of an app with
+// other files, which means that modified content would be released under
+// a version already built. Builds without version never conflict.
+func (r *Registry) Conflict(name, version, architecture, sourceSHA256 string) (Build, bool) {
+	if version == "" {
+		return Build{}, false
+	}
+	for i := len(r.builds) - 1; i >= 0; i-- {
+		b := r.builds[i]
+		if strings.EqualFold(b.Name, name) && b.Version == version && b.Architecture == architecture && b.SourceSHA256 != sourceSHA256 {
+			return b, true
+		}
+	}
+	return Build{}, false
+}
+
+// Add appends a build to the registry file
+func (r *Registry) Add(b Build) error {
+	if b.UploadStatus == "" {
+		b.UploadStatus = StatusBuilt
+	}
+	if err := r.appendLine(record{Build: b}); err != nil {
+		return err
+	}
+	r.builds = append(r.builds, b)
+	return nil
+}
+
+// Update changes a build returned by Find, e.g. to record its upload, and
+// returns its new state. The new state is appended to the registry file,
+// so that builds added meanwhile by other processes are kept.
+func (r *Registry) Update(build Build, update func(*Build)) (Build, error) {
+	i := r.index(build)
+	if i < 0 {
+		return Build{}, fmt.Errorf("no build of %s in %s", build.Package, r.path)
+	}
+	b := r.builds[i]
+	update(&b)
+	if err := r.appendLine(record{Build: b, Update: true}); err != nil {
+		return Build{}, err
+	}
+	r.builds[i] = b
+	return b, nil
+}
+
+// index returns the index of the latest build of the same package file as
+// b, or -1. Packages of one job, e.g. an uninstall package, have their own
+// path and digest.
+func (r *Registry) index(b Build) int {
+	for i := len(r.builds) - 1; i >= 0; i-- {
+		if r.builds[i].Package == b.Package && r.builds[i].PackageSHA256 == b.PackageSHA256 {
+			return i
+		}
+	}
+	return -1
+}
+
+// appendLine writes a line to the registry file. Each line is a single write
+// to a file opened for appending, so that concurrent writers do not
+// interleave their lines.
+func (r *Registry) appendLine(rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("failed to create registry directory: %w", err)
+	}
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open registry: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write registry: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write registry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-registry-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "sub", FileName)
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open of a missing registry failed: %v", err)
+	}
+	if len(r.Builds()) != 0 {
+		t.Errorf("Expected an empty registry, got %d builds", len(r.Builds()))
+	}
+
+	builds := []Build{
+		{Time: time.Now().UTC(), JobID: "job1", Name: "My App", Version: "1.0", Package: "/out/1.0/My App.intunewin", PackageSHA256: "aaaaaaaaaaaa1111", SourceSHA256: "s1"},
+		{Time: time.Now().UTC(), JobID: "job2", Name: "Tool", Package: filepath.Join(tempDir, "Tool.intunewin"), PackageSHA256: "bbbbbbbbbbbb2222", SourceSHA256: "s2"},
+		{Time: time.Now().UTC(), JobID: "job3", Name: "My App", Version: "1.1", Package: "/out/1.1/My App.intunewin", PackageSHA256: "cccccccccccc3333", SourceSHA256: "s3"},
+	}
+	for _, b := range builds {
+		if err := r.Add(b); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	// Packages of one job, e.g. an uninstall package, are updated apart
+	uninstall := Build{Time: time.Now().UTC(), JobID: "job3", Name: "My App_uninstall", Version: "1.1", Package: "/out/1.1/My App_uninstall.intunewin", PackageSHA256: "dddddddddddd4444", SourceSHA256: "s4"}
+	if err := r.Add(uninstall); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	// Builds added by other processes meanwhile are kept
+	other, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := other.Add(Build{Time: time.Now().UTC(), JobID: "job4", Name: "Other", Package: "/out/Other.intunewin", PackageSHA256: "eeeeeeeeeeee5555"}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	updated, err := r.Update(builds[2], func(b *Build) {
+		b.UploadStatus = StatusUploaded
+		b.AppID = "11111111-2222-3333-4444-555555555555"
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if updated.Package != builds[2].Package || updated.UploadStatus != StatusUploaded {
+		t.Errorf("Unexpected updated build: %+v", updated)
+	}
+	if _, err := r.Update(Build{Package: "/out/missing.intunewin"}, func(b *Build) {}); err == nil {
+		t.Error("Expected error for an unknown build")
+	}
+
+	// The file holds everything recorded
+	r, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	history := r.History("my app")
+	if len(history) != 2 || history[0].Version != "1.0" || history[1].Version != "1.1" {
+		t.Fatalf("Unexpected history: %+v", history)
+	}
+	if history[0].UploadStatus != StatusBuilt || history[1].UploadStatus != StatusUploaded || history[1].AppID == "" {
+		t.Errorf("Unexpected upload status: %+v", history)
+	}
+	if len(r.History("")) != 5 {
+		t.Errorf("Expected all builds without a name, got %+v", r.History(""))
+	}
+	if b, _ := r.Find(uninstall.Package); b.UploadStatus != StatusBuilt {
+		t.Errorf("Expected the uninstall package not to be updated: %+v", b)
+	}
+	if _, ok := r.Find("job4"); !ok {
+		t.Error("Expected the build of the other process to be kept")
+	}
+
+	for _, id := range []string{"job2", "bbbbbbbb", filepath.Join(tempDir, "Tool.intunewin")} {
+		if b, ok := r.Find(id); !ok || b.JobID != "job2" {
+			t.Errorf("Find(%q) = %+v, %v", id, b, ok)
+		}
+	}
+	// Rebuilding a version is fine as long as the files are the same
+	if _, ok := r.Conflict("My App", "1.1", "", "s3"); ok {
+		t.Error("Expected no conflict for the same files")
+	}
+	if b, ok := r.Conflict("my app", "1.1", "", "s4"); !ok || b.JobID != "job3" {
+		t.Errorf("Expected conflict with job3, got %+v, %v", b, ok)
+	}
+	if _, ok := r.Conflict("Tool", "", "", "s4"); ok {
+		t.Error("Expected no conflict without version")
+	}
+
+	if _, ok := r.Find("bbbb"); ok {
+		t.Error("Expected short digest prefixes not to match")
+	}
+}
@@ -0,0 +1,78 @@
+// Package retry repeats operations that fail with transient errors, such
+// as source files locked by another process or output folders on network
+// shares that drop their connection for a moment.
+//
+// A Policy sets the number of retries, the exponential backoff between
+// them and which errors are retried. Builds use a policy per stage, e.g.
+// one for opening source files and one for writing packages.
+package retry
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultDelay is the delay before the first retry of a Policy without
+// Delay
+const DefaultDelay = 200 * time.Millisecond
+
+// Policy controls the retries of an operation
+type Policy struct {
+	// Retries is the number of retries after the first attempt. Zero
+	// disables retries.
+	Retries int
+	// Delay is the delay before the first retry, doubled for every further
+	// retry (default DefaultDelay)
+	Delay time.Duration
+	// MaxDelay caps the delay between retries (optional)
+	MaxDelay time.Duration
+	// Retryable reports whether an error is transient and the operation
+	// is retried (default IsTransient)
+	Retryable func(error) bool
+}
+
+// Do runs fn until it succeeds, fails with an error that is not
+// retryable or has used all retries, and returns its last error. onRetry
+// (optional) is called with the error and the delay before every retry,
+// e.g. to log it.
+func (p Policy) Do(fn func() error, onRetry func(err error, delay time.Duration)) error {
+	delay := p.Delay
+	if delay <= 0 {
+		delay = DefaultDelay
+	}
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Retries || !retryable(err) {
+			return err
+		}
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+		if onRetry != nil {
+			onRetry(err, delay)
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// IsTransient reports whether err is a transient error of the file system
+// or the network, which may succeed when retried: sharing and lock
+// violations and dropped network connections on Windows, busy resources,
+// timeouts and stale NFS handles on Unix, and errors that report a
+// timeout, such as those of the net package
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return true
+	}
+	return isTransientErrno(err)
+}
@@ -0,0 +1,85 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// timeoutError is an error that reports a timeout, as net errors do
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "i/o timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+func TestPolicyDo(t *testing.T) {
+	errTransient := errors.New("transient")
+	policy := Policy{
+		Retries:   3,
+		Delay:     time.Millisecond,
+		MaxDelay:  2 * time.Millisecond,
+		Retryable: func(err error) bool { return errors.Is(err, errTransient) },
+	}
+
+	// The operation succeeds on the third attempt
+	attempts := 0
+	var delays []time.Duration
+	err := policy.Do(func() error {
+		attempts++
+		if attempts < 3 {
+			return errTransient
+		}
+		return nil
+	}, func(err error, delay time.Duration) {
+		delays = append(delays, delay)
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("Expected success on the third attempt, got %v after %d attempts", err, attempts)
+	}
+	if fmt.Sprint(delays) != "[1ms 2ms]" {
+		t.Errorf("Unexpected delays %v", delays)
+	}
+
+	// All retries fail
+	attempts = 0
+	err = policy.Do(func() error {
+		attempts++
+		return fmt.Errorf("attempt %d: %w", attempts, errTransient)
+	}, nil)
+	if !errors.Is(err, errTransient) || attempts != 4 {
+		t.Errorf("Expected the last error after 4 attempts, got %v after %d attempts", err, attempts)
+	}
+
+	// Other errors are not retried
+	attempts = 0
+	err = policy.Do(func() error {
+		attempts++
+		return os.ErrPermission
+	}, nil)
+	if !errors.Is(err, os.ErrPermission) || attempts != 1 {
+		t.Errorf("Expected no retry, got %v after %d attempts", err, attempts)
+	}
+
+	// A zero policy runs the operation once
+	attempts = 0
+	Policy{}.Do(func() error {
+		attempts++
+		return timeoutError{}
+	}, nil)
+	if attempts != 1 {
+		t.Errorf("Expected a single attempt without retries, got %d", attempts)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	if !IsTransient(&os.PathError{Op: "write", Path: "x", Err: timeoutError{}}) {
+		t.Error("Expected timeouts to be transient")
+	}
+	for _, err := range []error{nil, os.ErrNotExist, os.ErrPermission, errors.New("disk full")} {
+		if IsTransient(err) {
+			t.Errorf("Expected %v not to be transient", err)
+		}
+	}
+}
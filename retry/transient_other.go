@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package retry
+
+// isTransientErrno reports whether err has a transient error code. Other
+// platforms have none.
+func isTransientErrno(err error) bool {
+	return false
+}
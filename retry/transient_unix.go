@@ -0,0 +1,29 @@
+//go:build unix
+
+package retry
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Error codes of busy resources and of network file systems that lost
+// their connection. Files locked by another process can still be read, as
+// locks are advisory.
+var transientErrnos = []syscall.Errno{
+	syscall.EAGAIN,
+	syscall.EBUSY,
+	syscall.EINTR,
+	syscall.ETIMEDOUT,
+	syscall.ESTALE,
+}
+
+// isTransientErrno reports whether err has a transient error code
+func isTransientErrno(err error) bool {
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
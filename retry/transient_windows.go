@@ -0,0 +1,30 @@
+//go:build windows
+
+package retry
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows error codes of files opened by another process and of network
+// shares that lost their connection
+var transientErrnos = []syscall.Errno{
+	32,   // ERROR_SHARING_VIOLATION
+	33,   // ERROR_LOCK_VIOLATION
+	59,   // ERROR_UNEXP_NET_ERR
+	64,   // ERROR_NETNAME_DELETED
+	121,  // ERROR_SEM_TIMEOUT
+	240,  // ERROR_VC_DISCONNECTED
+	1236, // ERROR_CONNECTION_ABORTED
+}
+
+// isTransientErrno reports whether err has a transient error code
+func isTransientErrno(err error) bool {
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+// Package snippet writes PowerShell scripts that upload a package to
+// Intune with the IntuneWin32App module
+// (https://github.com/MSEndpointMgr/IntuneWin32App), for teams that upload
+// with existing PowerShell tooling.
+//
+// The script is pre-filled from Detection.xml: the package path, display
+// name, install and uninstall commands and a detection rule (the product
+// code for MSI setups). Detection rules declared in the build config are
+// created with the matching cmdlets instead. All values are script
+// parameters, so that they can be reviewed and overridden when the script
+// is run. Localized display names and descriptions are selected with the
+// -Locale parameter.
+package snippet
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/detection"
+	"github.com/MANCHTOOLS/open-package/lobapp"
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+// Suffix replaces the .intunewin extension for the script file name
+const Suffix = ".upload.ps1"
+
+// Options describes the package to upload
+type Options struct {
+	// PackagePath is the path of the .intunewin file, preferably absolute
+	// so that the script can be run from any directory
+	PackagePath string
+	// Info is the Detection.xml of the package
+	Info *metadata.ApplicationInfo
+	// Metadata is the descriptive information from the build config
+	Metadata lobapp.Metadata
+	// InstallCommand overrides the command derived from the setup file
+	InstallCommand string
+	// UninstallCommand overrides the command derived from MSI setups.
+	// Without either, the script asks for it.
+	UninstallCommand string
+	// Architecture is the architecture of the package (optional), used
+	// for the requirement rule unless Metadata declares architectures
+	Architecture string
+}
+
+// Path returns the script path for a package
+func Path(packagePath string) string {
+	return strings.TrimSuffix(packagePath, filepath.Ext(packagePath)) + Suffix
+}
+
+// Generate returns the upload script
+func Generate(opts Options) []byte {
+	info := opts.Info
+	msi := info.MsiInfo
+	// Declared detection rules replace the product code rule
+	rules := opts.Metadata.Detection
+	if len(rules) > 0 {
+		msi = nil
+	}
+	app := lobapp.New(lobapp.Options{
+		PackagePath:      opts.PackagePath,
+		Info:             info,
+		Metadata:         opts.Metadata,
+		InstallCommand:   opts.InstallCommand,
+		UninstallCommand: opts.UninstallCommand,
+		Architecture:     opts.Architecture,
+	})
+	// The requirement rule of the module takes a single architecture
+	architecture := app.ApplicableArchitectures
+	if architecture == "" || strings.Contains(architecture, ",") {
+		architecture = "All"
+	}
+	minimumRelease := opts.Metadata.MinimumWindowsRelease
+	if minimumRelease == "" {
+		minimumRelease = "W10_1809"
+	}
+
+	lines := []string{
+		"# Uploads " + info.Name + " to Intune with the IntuneWin32App module",
+		"# (Install-Module IntuneWin32App). Generated by open-package; review the",
+		"# parameters, in particular the detection rule, before running it.",
+		"param(",
+		"    [Parameter(Mandatory = $true)]",
+		"    [string]$TenantId,",
+		"    [string]$FilePath = " + quote(opts.PackagePath) + ",",
+		"    [string]$DisplayName = " + quote(app.DisplayName) + ",",
+		"    [string]$Description = " + quote(app.Description) + ",",
+		"    [string]$Publisher = " + quote(app.Publisher) + ",",
+		"    [string]$InformationURL = " + quote(app.InformationURL) + ",",
+		"    [string]$Owner = " + quote(app.Owner) + ",",
+		"    [string]$Notes = " + quote(app.Notes) + ",",
+		"    [string]$InstallCommandLine = " + quote(app.InstallCommandLine) + ",",
+	}
+	if app.UninstallCommandLine == "" {
+		lines = append(lines,
+			"    [Parameter(Mandatory = $true)]",
+			"    [string]$UninstallCommandLine,")
+	} else {
+		lines = append(lines, "    [string]$UninstallCommandLine = "+quote(app.UninstallCommandLine)+",")
+	}
+	if msi != nil {
+		lines = append(lines,
+			"    [string]$ProductCode = "+quote(msi.MsiProductCode)+",",
+			"    [string]$ProductVersion = "+quote(msi.MsiProductVersion)+",")
+	} else if len(rules) == 0 {
+		lines = append(lines,
+			"    [string]$DetectionPath = "+quote(`C:\Program Files\`+info.Name)+",",
+			"    [string]$DetectionFile = "+quote(info.SetupFile)+",")
+	}
+	if len(opts.Metadata.Localized) > 0 {
+		lines = append(lines, "    [string]$Locale = '',")
+	}
+	lines = append(lines,
+		"    [string]$Architecture = "+quote(architecture)+",",
+		"    [string]$MinimumWindowsRelease = "+quote(minimumRelease),
+		")",
+		"",
+		"$ErrorActionPreference = 'Stop'",
+	)
+	if locales := opts.Metadata.Locales(); len(locales) > 0 {
+		lines = append(lines, "$Localized = @{")
+		for _, locale := range locales {
+			localized, _ := app.Localize(opts.Metadata, locale)
+			lines = append(lines, "    "+quote(locale)+" = @{ DisplayName = "+quote(localized.DisplayName)+"; Description = "+quote(localized.Description)+" }")
+		}
+		lines = append(lines,
+			"}",
+			"if ($Locale) {",
+			"    if (-not $Localized.ContainsKey($Locale)) { throw \"No localized metadata for $Locale\" }",
+			"    $DisplayName = $Localized[$Locale].DisplayName",
+			"    $Description = $Localized[$Locale].Description",
+			"}",
+		)
+	}
+	lines = append(lines,
+		"Import-Module IntuneWin32App",
+		"Connect-MSIntuneGraph -TenantID $TenantId | Out-Null",
+		"",
+	)
+	if len(rules) > 0 {
+		lines = append(lines, detectionRules(rules)...)
+	} else if msi != nil {
+		lines = append(lines,
+			"$DetectionRule = New-IntuneWin32AppDetectionRuleMSI -ProductCode $ProductCode `",
+			"    -ProductVersionOperator 'greaterThanOrEqual' -ProductVersion $ProductVersion")
+	} else {
+		lines = append(lines,
+			"# Replace with a file, registry or script rule that identifies the installed application",
+			"$DetectionRule = New-IntuneWin32AppDetectionRuleFile -Existence -Path $DetectionPath `",
+			"    -FileOrFolder $DetectionFile -DetectionType 'exists'")
+	}
+	lines = append(lines,
+		"$RequirementRule = New-IntuneWin32AppRequirementRule -Architecture $Architecture -MinimumSupportedWindowsRelease $MinimumWindowsRelease",
+		"",
+		"$params = @{",
+		"    FilePath             = $FilePath",
+		"    DisplayName          = $DisplayName",
+		"    Description          = $Description",
+		"    Publisher            = $Publisher",
+		"    InstallExperience    = "+quote(app.InstallExperience.RunAsAccount),
+		"    RestartBehavior      = 'suppress'",
+		"    DetectionRule        = $DetectionRule",
+		"    RequirementRule      = $RequirementRule",
+		"    InstallCommandLine   = $InstallCommandLine",
+		"    UninstallCommandLine = $UninstallCommandLine",
+		"}",
+		"if ($InformationURL) { $params.InformationURL = $InformationURL }",
+		"if ($Owner) { $params.Owner = $Owner }",
+		"if ($Notes) { $params.Notes = $Notes }",
+		"Add-IntuneWin32App @params",
+		"",
+	)
+	return []byte(strings.Join(lines, "\r\n"))
+}
+
+// detectionRules creates the detection rules declared in the build config
+// with the cmdlets of the module
+func detectionRules(rules []detection.Rule) []string {
+	var lines, calls []string
+	for i, rule := range rules {
+		var call string
+		switch rule.ODataType {
+		case detection.ProductCodeType:
+			call = "New-IntuneWin32AppDetectionRuleMSI -ProductCode " + quote(rule.ProductCode)
+			if rule.ProductVersionOperator != "" && rule.ProductVersionOperator != detection.OperatorNotConfigured {
+				call += " -ProductVersionOperator " + quote(rule.ProductVersionOperator) + " -ProductVersion " + quote(rule.ProductVersion)
+			}
+		case detection.FileSystemType:
+			call = "New-IntuneWin32AppDetectionRuleFile -Path " + quote(rule.Path) + " -FileOrFolder " + quote(rule.FileOrFolderName)
+			switch rule.OperationType {
+			case detection.OperationVersion:
+				call += " -Version -Operator " + quote(rule.Operator) + " -VersionValue " + quote(rule.ComparisonValue)
+			case detection.OperationSizeInMB:
+				call += " -Size -Operator " + quote(rule.Operator) + " -SizeInMBValue " + quote(rule.ComparisonValue)
+			case detection.OperationModifiedDate:
+				call += " -DateModified -Operator " + quote(rule.Operator) + " -DateTimeValue " + quote(rule.ComparisonValue)
+			case detection.OperationCreatedDate:
+				call += " -DateCreated -Operator " + quote(rule.Operator) + " -DateTimeValue " + quote(rule.ComparisonValue)
+			default:
+				call += " -Existence -DetectionType " + quote(rule.OperationType)
+			}
+		case detection.RegistryType:
+			call = "New-IntuneWin32AppDetectionRuleRegistry -KeyPath " + quote(rule.KeyPath)
+			if rule.ValueName != "" {
+				call += " -ValueName " + quote(rule.ValueName)
+			}
+			switch rule.OperationType {
+			case detection.OperationVersion:
+				call += " -VersionComparison -VersionComparisonOperator " + quote(rule.Operator) + " -VersionComparisonValue " + quote(rule.ComparisonValue)
+			case detection.OperationString:
+				call += " -StringComparison -StringComparisonOperator " + quote(rule.Operator) + " -StringComparisonValue " + quote(rule.ComparisonValue)
+			case detection.OperationInteger:
+				call += " -IntegerComparison -IntegerComparisonOperator " + quote(rule.Operator) + " -IntegerComparisonValue " + quote(rule.ComparisonValue)
+			default:
+				call += " -Existence -DetectionType " + quote(rule.OperationType)
+			}
+		case detection.ScriptType:
+			// The module reads detection scripts from a file
+			file := fmt.Sprintf("$DetectionScript%d", i+1)
+			lines = append(lines,
+				file+" = Join-Path ([IO.Path]::GetTempPath()) "+quote(fmt.Sprintf("detection%d.ps1", i+1)),
+				"[IO.File]::WriteAllBytes("+file+", [Convert]::FromBase64String("+quote(rule.ScriptContent)+"))")
+			call = "New-IntuneWin32AppDetectionRuleScript -ScriptFile " + file
+			if rule.EnforceSignatureCheck {
+				call += " -EnforceSignatureCheck $true"
+			}
+			if rule.RunAs32Bit {
+				call += " -RunAs32Bit $true"
+			}
+		}
+		if rule.Check32BitOn64System {
+			call += " -Check32BitOn64System $true"
+		}
+		calls = append(calls, "    ("+call+")")
+	}
+	lines = append(lines, "$DetectionRule = @(")
+	lines = append(lines, strings.Join(calls, ",\r\n"))
+	return append(lines, ")")
+}
+
+// quote returns a single-quoted PowerShell string
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
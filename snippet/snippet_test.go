@@ -0,0 +1,108 @@
+package snippet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MANCHTOOLS/open-package/detection"
+	"github.com/MANCHTOOLS/open-package/lobapp"
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+func TestGenerate(t *testing.T) {
+	// MSI setups are detected by product code
+	script := string(Generate(Options{
+		PackagePath: "/out/My App.intunewin",
+		Info: &metadata.ApplicationInfo{
+			Name:      "My App",
+			SetupFile: "setup.msi",
+			MsiInfo: &metadata.MsiInfo{
+				MsiProductCode:      "{11111111-2222-3333-4444-555555555555}",
+				MsiProductVersion:   "1.2.3",
+				MsiExecutionContext: "User",
+				MsiPublisher:        "O'Brien Software",
+			},
+		},
+		Architecture: "x64",
+	}))
+	for _, want := range []string{
+		`[string]$FilePath = '/out/My App.intunewin',`,
+		`[string]$Publisher = 'O''Brien Software',`,
+		`[string]$InstallCommandLine = 'msiexec /i "setup.msi" /qn /norestart',`,
+		`[string]$UninstallCommandLine = 'msiexec /x {11111111-2222-3333-4444-555555555555} /qn /norestart',`,
+		`[string]$Architecture = 'x64',`,
+		`[string]$MinimumWindowsRelease = 'W10_1809'`,
+		"New-IntuneWin32AppDetectionRuleMSI -ProductCode $ProductCode",
+		"InstallExperience    = 'user'",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Script does not contain %q:\n%s", want, script)
+		}
+	}
+	if !strings.HasSuffix(script, "\r\n") {
+		t.Error("Expected CRLF line endings")
+	}
+
+	// Other setups need the uninstall command and detection rule reviewed
+	script = string(Generate(Options{
+		PackagePath: "/out/tool.intunewin",
+		Info:        &metadata.ApplicationInfo{Name: "tool", SetupFile: `bin/setup.exe`},
+	}))
+	for _, want := range []string{
+		`[string]$InstallCommandLine = '"bin\setup.exe"',`,
+		"[Parameter(Mandatory = $true)]\r\n    [string]$UninstallCommandLine,",
+		"New-IntuneWin32AppDetectionRuleFile -Existence",
+		"InstallExperience    = 'system'",
+		`[string]$Architecture = 'All',`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Script does not contain %q:\n%s", want, script)
+		}
+	}
+
+	// Localized metadata is selected with -Locale
+	script = string(Generate(Options{
+		PackagePath: "/out/tool.intunewin",
+		Info:        &metadata.ApplicationInfo{Name: "tool", SetupFile: "setup.exe"},
+		Metadata: lobapp.Metadata{Localized: map[string]lobapp.Localization{
+			"de-DE": {DisplayName: "Werkzeug"},
+		}},
+	}))
+	for _, want := range []string{
+		"[string]$Locale = '',",
+		"'de-DE' = @{ DisplayName = 'Werkzeug'; Description = 'tool' }",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Script does not contain %q:\n%s", want, script)
+		}
+	}
+
+	// Declared detection rules replace the product code rule
+	script = string(Generate(Options{
+		PackagePath: "/out/tool.intunewin",
+		Info: &metadata.ApplicationInfo{Name: "tool", SetupFile: "setup.msi", MsiInfo: &metadata.MsiInfo{
+			MsiProductCode: "{11111111-2222-3333-4444-555555555555}",
+		}},
+		Metadata: lobapp.Metadata{Detection: []detection.Rule{
+			detection.File(`C:\Program Files\Tool\tool.exe`, detection.Version(detection.OperatorGreaterThanOrEqual, "2.0")),
+			detection.Registry("HKLM", `SOFTWARE\Tool`, ""),
+		}},
+	}))
+	for _, want := range []string{
+		"$DetectionRule = @(\r\n" +
+			"    (New-IntuneWin32AppDetectionRuleFile -Path 'C:\\Program Files\\Tool' -FileOrFolder 'tool.exe' -Version -Operator 'greaterThanOrEqual' -VersionValue '2.0'),\r\n" +
+			"    (New-IntuneWin32AppDetectionRuleRegistry -KeyPath 'HKEY_LOCAL_MACHINE\\SOFTWARE\\Tool' -Existence -DetectionType 'exists')\r\n" +
+			")",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Script does not contain %q:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "$ProductCode") {
+		t.Errorf("Unexpected product code rule:\n%s", script)
+	}
+
+	if got := Path("/out/tool.intunewin"); got != "/out/tool.upload.ps1" {
+		t.Errorf("Unexpected script path: %s", got)
+	}
+}
@@ -0,0 +1,180 @@
+// Package split suggests how to split a source folder that exceeds the
+// Intune content limit into several packages.
+//
+// The main package keeps the setup file. The remaining top-level files and
+// folders are distributed over data packages, which are deployed as
+// dependencies of the main app and place their content where the main setup
+// expects it. Folders larger than the limit are split into their children.
+// Sizes are uncompressed source sizes, so parts stay below the limit
+// however well their content compresses.
+package split
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/packager"
+)
+
+// Part is a candidate package of a split source
+type Part struct {
+	// Paths are the files and folders of the part, relative to the source
+	// folder with forward slashes
+	Paths []string `json:"paths"`
+	// Size is the total size of the part in bytes
+	Size int64 `json:"size"`
+	// Main is set for the part holding the setup file
+	Main bool `json:"main,omitempty"`
+}
+
+// Advice is a suggested split of a source folder
+type Advice struct {
+	// Limit is the largest part size in bytes
+	Limit int64 `json:"limit"`
+	// SourceSize is the total size of the source in bytes
+	SourceSize int64 `json:"sourceSize"`
+	// Parts are the suggested packages, the main part first. A source
+	// within the limit has a single part.
+	Parts []Part `json:"parts"`
+	// Oversized lists files larger than the limit, which no package can
+	// hold. They have to be downloaded at install time.
+	Oversized []string `json:"oversized,omitempty"`
+}
+
+// item is a file or folder placed into a part as a whole
+type item struct {
+	path string
+	size int64
+}
+
+// Advise suggests how to split sourceDir into packages of at most limit
+// bytes. Junk and hidden files are left out, as by default when packaging.
+func Advise(sourceDir, setupFile string, limit int64) (*Advice, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+	setupPath := path.Clean(filepath.ToSlash(setupFile))
+	if _, err := os.Stat(filepath.Join(sourceDir, setupFile)); err != nil {
+		return nil, fmt.Errorf("setup file: %w", err)
+	}
+
+	sizes, err := treeSizes(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	advice := &Advice{Limit: limit, SourceSize: sizes["."]}
+	var items []item
+	var collect func(dir string) error
+	collect = func(dir string) error {
+		entries, err := os.ReadDir(filepath.Join(sourceDir, filepath.FromSlash(dir)))
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			rel := path.Join(dir, e.Name())
+			size, ok := sizes[rel]
+			if !ok {
+				continue
+			}
+			switch {
+			case size <= limit:
+				items = append(items, item{path: rel, size: size})
+			case e.IsDir():
+				if err := collect(rel); err != nil {
+					return err
+				}
+			default:
+				advice.Oversized = append(advice.Oversized, rel)
+			}
+		}
+		return nil
+	}
+	if err := collect("."); err != nil {
+		return nil, fmt.Errorf("failed to read source: %w", err)
+	}
+
+	// The setup file and the folder around it within the limit go first,
+	// the others from large to small into the first part they fit
+	sort.SliceStable(items, func(i, j int) bool {
+		iSetup, jSetup := contains(items[i].path, setupPath), contains(items[j].path, setupPath)
+		if iSetup != jSetup {
+			return iSetup
+		}
+		return items[i].size > items[j].size
+	})
+	advice.Parts = []Part{{Main: true}}
+	for _, it := range items {
+		placed := false
+		for i := range advice.Parts {
+			if advice.Parts[i].Size+it.size <= limit {
+				advice.Parts[i].Paths = append(advice.Parts[i].Paths, it.path)
+				advice.Parts[i].Size += it.size
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			advice.Parts = append(advice.Parts, Part{Paths: []string{it.path}, Size: it.size})
+		}
+	}
+	for i := range advice.Parts {
+		sort.Strings(advice.Parts[i].Paths)
+	}
+	return advice, nil
+}
+
+// contains reports whether the setup file is p or below p
+func contains(p, setupPath string) bool {
+	return p == setupPath || strings.HasPrefix(setupPath, p+"/")
+}
+
+// treeSizes returns the size of every file and folder below dir by its
+// slash-separated relative path, the total size as ".". Links are not
+// followed.
+func treeSizes(dir string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && packager.IsExcluded(d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			sizes[rel] = 0
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		for parent := rel; ; parent = path.Dir(parent) {
+			sizes[parent] += info.Size()
+			if parent == "." {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source: %w", err)
+	}
+	return sizes, nil
+}
@@ -0,0 +1,68 @@
+package split
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAdvise(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-split-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	files := map[string]int{
+		"setup.exe":  10,
+		"data/a.bin": 600,
+		"data/b.bin": 600,
+		"big.iso":    1500,
+		"lib/x.dll":  300,
+		"Thumbs.db":  900,
+	}
+	for name, size := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	if _, err := Advise(tempDir, "missing.exe", 1000); err == nil {
+		t.Error("Expected error for a missing setup file")
+	}
+
+	advice, err := Advise(tempDir, "setup.exe", 1000)
+	if err != nil {
+		t.Fatalf("Advise failed: %v", err)
+	}
+	if advice.SourceSize != 3010 {
+		t.Errorf("Expected source size 3010 without junk, got %d", advice.SourceSize)
+	}
+	if len(advice.Oversized) != 1 || advice.Oversized[0] != "big.iso" {
+		t.Errorf("Expected big.iso to be oversized, got %v", advice.Oversized)
+	}
+	if len(advice.Parts) != 2 {
+		t.Fatalf("Expected 2 parts, got %+v", advice.Parts)
+	}
+	main := advice.Parts[0]
+	if !main.Main || strings.Join(main.Paths, ",") != "data/a.bin,lib,setup.exe" || main.Size != 910 {
+		t.Errorf("Unexpected main part: %+v", main)
+	}
+	if data := advice.Parts[1]; data.Main || strings.Join(data.Paths, ",") != "data/b.bin" || data.Size != 600 {
+		t.Errorf("Unexpected data part: %+v", data)
+	}
+
+	// A source within the limit is not split
+	advice, err = Advise(tempDir, "setup.exe", 10000)
+	if err != nil {
+		t.Fatalf("Advise failed: %v", err)
+	}
+	if len(advice.Parts) != 1 || len(advice.Parts[0].Paths) != 4 {
+		t.Errorf("Expected a single part, got %+v", advice.Parts)
+	}
+}
@@ -0,0 +1,242 @@
+// Package synthetic generates source trees with random content, so that
+// performance and correctness issues can be reproduced without sharing
+// proprietary installers.
+//
+// Trees are generated from a seed: the same options create the same files
+// on every machine.
+package synthetic
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Supported values for Options.Distribution
+const (
+	// DistributionLog draws sizes log-uniformly, so that most files are
+	// small and a few large, as in typical vendor media
+	DistributionLog = "log"
+	// DistributionUniform draws sizes uniformly
+	DistributionUniform = "uniform"
+	// DistributionFixed makes every file MinSize bytes
+	DistributionFixed = "fixed"
+)
+
+// Distributions lists all supported size distributions
+var Distributions = []string{DistributionLog, DistributionUniform, DistributionFixed}
+
+// Supported values for Options.Content
+const (
+	// ContentMixed writes text to half of the files and random data to the
+	// other half
+	ContentMixed = "mixed"
+	// ContentText writes compressible text
+	ContentText = "text"
+	// ContentRandom writes incompressible random data
+	ContentRandom = "random"
+	// ContentZero writes zero bytes, which compress best
+	ContentZero = "zero"
+)
+
+// Contents lists all supported content kinds
+var Contents = []string{ContentMixed, ContentText, ContentRandom, ContentZero}
+
+// Defaults of Options
+const (
+	DefaultFiles   = 100
+	DefaultMinSize = 1 << 10
+	DefaultMaxSize = 1 << 20
+	DefaultDepth   = 3
+)
+
+// Options configures a generated tree
+type Options struct {
+	// Files is the number of files (optional, defaults to DefaultFiles)
+	Files int
+	// MinSize and MaxSize bound the file sizes in bytes (optional,
+	// default to DefaultMinSize and DefaultMaxSize)
+	MinSize int64
+	MaxSize int64
+	// Distribution is the size distribution (optional, defaults to
+	// DistributionLog)
+	Distribution string
+	// Depth is the deepest folder level of files; zero puts all files in
+	// the root folder
+	Depth int
+	// FolderWidth is the number of subfolders per folder (optional,
+	// defaults to 4)
+	FolderWidth int
+	// Unicode gives folders and files non-ASCII names: accented,
+	// decomposed, Cyrillic, Greek, CJK and emoji characters
+	Unicode bool
+	// Content is the kind of file content (optional, defaults to
+	// ContentMixed)
+	Content string
+	// SetupFile is the name of a batch file written to the root folder as
+	// the setup file, so that the tree can be packaged (optional), e.g.
+	// install.cmd
+	SetupFile string
+	// Seed selects the generated tree
+	Seed int64
+}
+
+// Tree describes a generated tree
+type Tree struct {
+	// Files and Dirs are the numbers of files and folders, without the
+	// root folder and the setup file
+	Files int `json:"files"`
+	Dirs  int `json:"dirs"`
+	// Size is the total size of the files in bytes
+	Size int64 `json:"size"`
+}
+
+// unicodeNames are the name parts of Options.Unicode. The accents of
+// "resume" below are combining characters, so it only matches the
+// precomposed spelling after normalization.
+var unicodeNames = []string{
+	"Übersicht", "données", "re\u0301sume\u0301", "файлы", "παράδειγμα",
+	"日本語", "中文资料", "한국어", "📦 payload", "naïve café",
+}
+
+// fileExtensions are the extensions of generated files
+var fileExtensions = []string{".dll", ".dat", ".txt", ".xml", ".cab", ".ps1"}
+
+// text is repeated, with random variation, in text files
+const text = "The quick brown fox jumps over the lazy dog. "
+
+// Validate checks the distribution, content and size bounds
+func (o Options) Validate() error {
+	if o.Distribution != "" && !contains(Distributions, o.Distribution) {
+		return fmt.Errorf("unsupported size distribution %q (supported: %s)", o.Distribution, strings.Join(Distributions, ", "))
+	}
+	if o.Content != "" && !contains(Contents, o.Content) {
+		return fmt.Errorf("unsupported content %q (supported: %s)", o.Content, strings.Join(Contents, ", "))
+	}
+	if o.Depth < 0 {
+		return fmt.Errorf("invalid depth %d", o.Depth)
+	}
+	if o.MinSize < 0 || o.MaxSize < 0 || (o.MaxSize > 0 && o.MinSize > o.MaxSize) {
+		return fmt.Errorf("invalid size range %d to %d", o.MinSize, o.MaxSize)
+	}
+	if o.SetupFile != "" && (!filepath.IsLocal(o.SetupFile) || strings.ContainsAny(o.SetupFile, `/\`)) {
+		return fmt.Errorf("setup file %q must be a file name", o.SetupFile)
+	}
+	return nil
+}
+
+// Generate creates a tree below dir, which must not exist or be empty
+func Generate(dir string, opts Options) (*Tree, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Files <= 0 {
+		opts.Files = DefaultFiles
+	}
+	if opts.MinSize == 0 && opts.MaxSize == 0 {
+		opts.MinSize, opts.MaxSize = DefaultMinSize, DefaultMaxSize
+	}
+	if opts.MaxSize == 0 {
+		opts.MaxSize = max(opts.MinSize, DefaultMaxSize)
+	}
+	if opts.FolderWidth <= 0 {
+		opts.FolderWidth = 4
+	}
+
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("folder %s is not empty", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create folder: %w", err)
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	tree := &Tree{}
+	dirs := make(map[string]bool)
+	for i := 0; i < opts.Files; i++ {
+		// Folders are picked level by level, so that files share them
+		rel := ""
+		for level := rng.Intn(opts.Depth + 1); level > 0; level-- {
+			rel = filepath.Join(rel, name(rng.Intn(opts.FolderWidth), "dir", opts.Unicode))
+			if !dirs[rel] {
+				dirs[rel] = true
+				tree.Dirs++
+			}
+		}
+		ext := fileExtensions[rng.Intn(len(fileExtensions))]
+		path := filepath.Join(dir, rel, name(i, "file", opts.Unicode)+ext)
+		size := fileSize(rng, opts)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create folder: %w", err)
+		}
+		if err := os.WriteFile(path, content(rng, opts.Content, i, size), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write file: %w", err)
+		}
+		tree.Files++
+		tree.Size += size
+	}
+
+	if opts.SetupFile != "" {
+		setup := []byte("@echo off\r\nrem Synthetic setup file generated by open-package\r\n")
+		if err := os.WriteFile(filepath.Join(dir, opts.SetupFile), setup, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write setup file: %w", err)
+		}
+	}
+	return tree, nil
+}
+
+// name returns the name of the i-th folder or file
+func name(i int, prefix string, unicode bool) string {
+	if unicode {
+		return fmt.Sprintf("%s %d", unicodeNames[i%len(unicodeNames)], i)
+	}
+	return fmt.Sprintf("%s%05d", prefix, i)
+}
+
+// fileSize draws a file size from the distribution of opts
+func fileSize(rng *rand.Rand, opts Options) int64 {
+	lo, hi := opts.MinSize, opts.MaxSize
+	switch {
+	case opts.Distribution == DistributionFixed || lo == hi:
+		return lo
+	case opts.Distribution == DistributionUniform:
+		return lo + rng.Int63n(hi-lo+1)
+	}
+	// Sizes of zero bytes are drawn from one byte and rounded down
+	logLo, logHi := math.Log(float64(max(lo, 1))), math.Log(float64(hi))
+	size := int64(math.Exp(logLo + rng.Float64()*(logHi-logLo)))
+	return min(max(size, lo), hi)
+}
+
+// content returns the content of the i-th file
+func content(rng *rand.Rand, kind string, i int, size int64) []byte {
+	data := make([]byte, size)
+	if kind == "" || kind == ContentMixed {
+		kind = ContentText
+		if i%2 == 1 {
+			kind = ContentRandom
+		}
+	}
+	switch kind {
+	case ContentText:
+		for j := range data {
+			data[j] = text[(j+rng.Intn(4))%len(text)]
+		}
+	case ContentRandom:
+		rng.Read(data)
+	}
+	return data
+}
+
+// contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
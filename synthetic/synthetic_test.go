@@ -0,0 +1,109 @@
+package synthetic
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// listTree returns the files of dir with their sizes
+func listTree(t *testing.T, dir string) map[string]int64 {
+	t.Helper()
+	files := make(map[string]int64)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = info.Size()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk %s: %v", dir, err)
+	}
+	return files
+}
+
+func TestGenerate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "open-package-synthetic-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	opts := Options{Files: 50, MinSize: 10, MaxSize: 5000, Depth: 2, SetupFile: "setup.exe", Seed: 7}
+	tree, err := Generate(filepath.Join(tempDir, "a"), opts)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	files := listTree(t, filepath.Join(tempDir, "a"))
+	if tree.Files != 50 || len(files) != 51 {
+		t.Errorf("Expected 50 files and the setup file, got %d (%d on disk)", tree.Files, len(files))
+	}
+	var total int64
+	for name, size := range files {
+		if name == "setup.exe" {
+			continue
+		}
+		if size < 10 || size > 5000 {
+			t.Errorf("%s has %d bytes, outside of the size range", name, size)
+		}
+		if depth := strings.Count(name, "/"); depth > 2 {
+			t.Errorf("%s is deeper than 2 levels", name)
+		}
+		total += size
+	}
+	if total != tree.Size {
+		t.Errorf("Expected a total size of %d, got %d", tree.Size, total)
+	}
+
+	// The same seed creates the same tree
+	if _, err := Generate(filepath.Join(tempDir, "b"), opts); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	again := listTree(t, filepath.Join(tempDir, "b"))
+	for name, size := range files {
+		if again[name] != size {
+			t.Errorf("%s differs between runs with the same seed", name)
+		}
+	}
+
+	if _, err := Generate(filepath.Join(tempDir, "a"), opts); err == nil {
+		t.Error("Expected error for a folder that is not empty")
+	}
+
+	opts.Unicode = true
+	if _, err := Generate(filepath.Join(tempDir, "unicode"), opts); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	nonASCII := 0
+	for name := range listTree(t, filepath.Join(tempDir, "unicode")) {
+		if utf8.RuneCountInString(name) != len(name) {
+			nonASCII++
+		}
+	}
+	if nonASCII == 0 {
+		t.Error("Expected non-ASCII names")
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"distribution": {Distribution: "normal"},
+		"content":      {Content: "sparse"},
+		"size range":   {MinSize: 10, MaxSize: 5},
+		"depth":        {Depth: -1},
+		"setup path":   {SetupFile: "../setup.exe"},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
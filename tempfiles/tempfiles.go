@@ -0,0 +1,177 @@
+// Package tempfiles tracks the temporary files and directories of a build,
+// so that none are left behind when the build fails, panics or is
+// cancelled.
+//
+// Every temporary path is created through a Manager and released by its
+// creator once it is no longer needed. Cleanup removes the paths that are
+// still tracked, e.g. from a deferred recover or on a signal; Watch does
+// so when a context is done. For debugging, a Manager can keep the paths
+// and list them instead of removing them.
+package tempfiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrCleanedUp is returned when a temporary path is created after Cleanup
+var ErrCleanedUp = errors.New("temporary files were already cleaned up")
+
+// Manager tracks temporary paths. A nil *Manager is valid: paths are
+// created untracked and released by removing them.
+type Manager struct {
+	keep bool
+	out  io.Writer
+
+	mu      sync.Mutex
+	entries []entry
+	done    bool
+}
+
+// entry is a tracked path, with its file if it is still open
+type entry struct {
+	path string
+	file *os.File
+}
+
+// New returns a Manager. With keep, released and cleaned up paths are left
+// in place and listed on out (optional) instead of being removed.
+func New(keep bool, out io.Writer) *Manager {
+	return &Manager{keep: keep, out: out}
+}
+
+// Keep reports whether the Manager keeps its paths
+func (m *Manager) Keep() bool {
+	return m != nil && m.keep
+}
+
+// Dir creates and tracks a temporary directory, named as by os.MkdirTemp
+func (m *Manager) Dir(pattern string) (string, error) {
+	dir, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	if err := m.track(entry{path: dir}); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// File creates and tracks a temporary file in dir, as by os.CreateTemp.
+// The file is closed before it is removed.
+func (m *Manager) File(dir, pattern string) (*os.File, error) {
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.track(entry{path: file.Name(), file: file}); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+func (m *Manager) track(e entry) error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done {
+		return ErrCleanedUp
+	}
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+// Paths returns the tracked paths, in the order they were created
+func (m *Manager) Paths() []string {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	paths := make([]string, len(m.entries))
+	for i, e := range m.entries {
+		paths[i] = e.path
+	}
+	return paths
+}
+
+// Release stops tracking path and removes it, or lists it if the Manager
+// keeps its paths. Paths that no longer exist, e.g. files renamed into
+// place, are not listed.
+func (m *Manager) Release(path string) error {
+	e := entry{path: path}
+	if m != nil {
+		m.mu.Lock()
+		for i, tracked := range m.entries {
+			if tracked.path == path {
+				e = tracked
+				m.entries = append(m.entries[:i], m.entries[i+1:]...)
+				break
+			}
+		}
+		m.mu.Unlock()
+	}
+	return m.remove(e)
+}
+
+// Cleanup removes all tracked paths, newest first, or lists them if the
+// Manager keeps its paths. Paths cannot be created afterwards.
+func (m *Manager) Cleanup() error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	entries := m.entries
+	m.entries = nil
+	m.done = true
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := m.remove(entries[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Watch runs Cleanup once ctx is done. The returned channel is closed
+// when Cleanup has finished.
+func (m *Manager) Watch(ctx context.Context) <-chan struct{} {
+	cleaned := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		m.Cleanup()
+		close(cleaned)
+	}()
+	return cleaned
+}
+
+func (m *Manager) remove(e entry) error {
+	if e.file != nil {
+		e.file.Close()
+	}
+	if m.Keep() {
+		if info, err := os.Lstat(e.path); err == nil && m.out != nil {
+			kind := "file"
+			if info.IsDir() {
+				kind = "directory"
+			}
+			fmt.Fprintf(m.out, "Keeping temporary %s: %s\n", kind, e.path)
+		}
+		return nil
+	}
+	if err := os.RemoveAll(e.path); err != nil {
+		return fmt.Errorf("failed to remove temporary file: %w", err)
+	}
+	return nil
+}
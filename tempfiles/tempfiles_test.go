@@ -0,0 +1,114 @@
+package tempfiles
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManager(t *testing.T) {
+	m := New(false, nil)
+	dir, err := m.Dir("open-package-tempfiles-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file, err := m.File(dir, "test-*.tmp")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	if paths := m.Paths(); len(paths) != 2 || paths[0] != dir || paths[1] != file.Name() {
+		t.Fatalf("Unexpected tracked paths %v", paths)
+	}
+
+	if err := m.Release(file.Name()); err != nil {
+		t.Fatalf("Failed to release file: %v", err)
+	}
+	if _, err := os.Stat(file.Name()); !os.IsNotExist(err) {
+		t.Error("Expected the released file to be removed")
+	}
+	if paths := m.Paths(); len(paths) != 1 {
+		t.Errorf("Expected 1 tracked path after release, got %v", paths)
+	}
+
+	if _, err := m.File(dir, "open-*.tmp"); err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	if err := m.Cleanup(); err != nil {
+		t.Fatalf("Failed to clean up: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("Expected the temp dir to be removed")
+	}
+	if _, err := m.Dir("open-package-tempfiles-test-*"); !errors.Is(err, ErrCleanedUp) {
+		t.Errorf("Expected ErrCleanedUp after cleanup, got %v", err)
+	}
+}
+
+func TestManagerKeep(t *testing.T) {
+	var out bytes.Buffer
+	m := New(true, &out)
+	dir, err := m.Dir("open-package-tempfiles-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file, err := m.File(dir, "test-*.tmp")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	if err := os.Rename(file.Name(), filepath.Join(dir, "renamed")); err != nil {
+		t.Fatalf("Failed to rename file: %v", err)
+	}
+	m.Release(file.Name())
+	m.Cleanup()
+
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("Expected the temp dir to be kept: %v", err)
+	}
+	if !strings.Contains(out.String(), dir) {
+		t.Errorf("Expected the kept dir to be listed, got %q", out.String())
+	}
+	if strings.Contains(out.String(), file.Name()) {
+		t.Errorf("Expected the renamed file not to be listed, got %q", out.String())
+	}
+}
+
+func TestWatch(t *testing.T) {
+	m := New(false, nil)
+	dir, err := m.Dir("open-package-tempfiles-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cleaned := m.Watch(ctx)
+	cancel()
+	<-cleaned
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("Expected the temp dir to be removed on cancellation")
+	}
+}
+
+func TestNilManager(t *testing.T) {
+	var m *Manager
+	file, err := m.File("", "open-package-tempfiles-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	file.Close()
+	if err := m.Release(file.Name()); err != nil {
+		t.Fatalf("Failed to release file: %v", err)
+	}
+	if _, err := os.Stat(file.Name()); !os.IsNotExist(err) {
+		t.Error("Expected the released file to be removed")
+	}
+	if err := m.Cleanup(); err != nil {
+		t.Errorf("Unexpected cleanup error: %v", err)
+	}
+}
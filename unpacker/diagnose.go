@@ -0,0 +1,258 @@
+package unpacker
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/MANCHTOOLS/open-package/crypto"
+	"github.com/MANCHTOOLS/open-package/format"
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+// ZIP record signatures and sizes
+const (
+	localHeaderSignature     = 0x04034b50
+	centralHeaderSignature   = 0x02014b50
+	dataDescriptorSignature  = 0x08074b50
+	localHeaderSize          = 30
+	flagDataDescriptor       = 0x8
+	dataDescriptorSize       = 12
+	dataDescriptor64Size     = 20
+	signatureSize            = 4
+	endOfCentralDirSignature = 0x06054b50
+)
+
+// TruncationError describes a package that ends before its last section,
+// as left by an interrupted download or copy
+type TruncationError struct {
+	// Section is the part of the package that is cut off: an entry name,
+	// "central directory" or "encrypted content"
+	Section string
+	// Present is the number of bytes of the section that are present
+	Present int64
+	// Expected is the size of the section, or -1 if unknown
+	Expected int64
+	// Size is the size of the package file, or 0 if the outer ZIP is
+	// complete and only its encrypted content is short
+	Size int64
+}
+
+// Error describes what is missing
+func (e *TruncationError) Error() string {
+	msg := "package is truncated"
+	if e.Size > 0 {
+		msg += fmt.Sprintf(" after %d bytes", e.Size)
+	}
+	if e.Expected < 0 {
+		return fmt.Sprintf("%s: %s is incomplete (%d bytes present)", msg, e.Section, e.Present)
+	}
+	return fmt.Sprintf("%s: %s is incomplete (%d of %d bytes present, %d missing)",
+		msg, e.Section, e.Present, e.Expected, e.Expected-e.Present)
+}
+
+// checkEncryptedSize compares the size of the encrypted content with the
+// size Detection.xml implies
+func checkEncryptedSize(actual, unencryptedSize int64) error {
+	expected := ExpectedEncryptedSize(unencryptedSize)
+	if actual < expected {
+		return &TruncationError{Section: "encrypted content", Present: actual, Expected: expected}
+	}
+	if actual > expected {
+		return fmt.Errorf("encrypted content is %d bytes, expected %d for %d bytes of content", actual, expected, unencryptedSize)
+	}
+	return nil
+}
+
+// ExpectedEncryptedSize returns the size of the encrypted content of a
+// package with the given UnencryptedContentSize: the HMAC, the IV and the
+// content padded to the next AES block
+func ExpectedEncryptedSize(unencryptedSize int64) int64 {
+	return int64(crypto.HMACSize+crypto.IVSize) + (unencryptedSize/aes.BlockSize+1)*aes.BlockSize
+}
+
+// diagnose walks the local file headers of a package that cannot be read
+// as a ZIP and returns a *TruncationError if it ends early. Sizes of
+// entries written with data descriptors are found by decompressing them;
+// the encrypted content size is derived from Detection.xml when it is
+// present. It returns nil if no truncation is found.
+func diagnose(r io.ReaderAt, size int64) error {
+	var info *metadata.ApplicationInfo
+	offset := int64(0)
+	for {
+		var sig [signatureSize]byte
+		if _, err := r.ReadAt(sig[:], offset); err != nil {
+			if offset == 0 {
+				return nil
+			}
+			// The entries are complete, the central directory is missing
+			return &TruncationError{Section: "central directory", Present: 0, Expected: -1, Size: size}
+		}
+		switch binary.LittleEndian.Uint32(sig[:]) {
+		case localHeaderSignature:
+		case centralHeaderSignature, endOfCentralDirSignature:
+			return &TruncationError{Section: "central directory", Present: size - offset, Expected: -1, Size: size}
+		default:
+			return nil
+		}
+
+		var header [localHeaderSize]byte
+		if n, err := r.ReadAt(header[:], offset); err != nil {
+			return &TruncationError{Section: "local file header", Present: int64(n), Expected: localHeaderSize, Size: size}
+		}
+		flags := binary.LittleEndian.Uint16(header[6:])
+		method := binary.LittleEndian.Uint16(header[8:])
+		compressedSize := int64(binary.LittleEndian.Uint32(header[18:]))
+		nameLen := int64(binary.LittleEndian.Uint16(header[26:]))
+		extraLen := int64(binary.LittleEndian.Uint16(header[28:]))
+		name := make([]byte, nameLen)
+		if n, err := r.ReadAt(name, offset+localHeaderSize); err != nil {
+			return &TruncationError{Section: "local file header", Present: localHeaderSize + int64(n), Expected: localHeaderSize + nameLen + extraLen, Size: size}
+		}
+		entry := string(name)
+		dataStart := offset + localHeaderSize + nameLen + extraLen
+		if dataStart > size {
+			return &TruncationError{Section: entry + " header", Present: size - offset, Expected: dataStart - offset, Size: size}
+		}
+
+		// The uncompressed size of the encrypted content follows from
+		// Detection.xml, when it was read before
+		expected := int64(-1)
+		if info != nil && path.Base(entry) == info.FileName {
+			expected = ExpectedEncryptedSize(info.UnencryptedContentSize)
+		}
+
+		// Only Detection.xml is kept; the content of other entries, e.g. the
+		// encrypted package of a multi-GB download, is only counted
+		spec := format.Detect([]string{entry})
+		var content bytes.Buffer
+		dst := io.Discard
+		if spec != nil {
+			dst = &content
+		}
+		section := io.NewSectionReader(r, dataStart, size-dataStart)
+		var dataSize int64
+		switch {
+		case method == 8 && (flags&flagDataDescriptor != 0 || compressedSize == 0):
+			counter := &countingReader{r: section}
+			written, err := io.Copy(dst, flate.NewReader(counter))
+			if err != nil {
+				if errors.Is(err, io.ErrUnexpectedEOF) {
+					return &TruncationError{Section: entry, Present: written, Expected: expected, Size: size}
+				}
+				return nil
+			}
+			dataSize = counter.n
+		case flags&flagDataDescriptor != 0 && compressedSize == 0:
+			// Stored entries with data descriptor cannot be delimited
+			return nil
+		default:
+			dataSize = compressedSize
+			if dataStart+dataSize > size {
+				return &TruncationError{Section: entry, Present: size - dataStart, Expected: dataSize, Size: size}
+			}
+			if method == 8 && spec != nil {
+				io.Copy(&content, flate.NewReader(io.NewSectionReader(r, dataStart, dataSize)))
+			}
+		}
+		if spec != nil && content.Len() > 0 {
+			info, _, _ = metadata.ParseDetectionXMLTolerant(content.Bytes())
+			if info != nil && info.FileName == "" {
+				info.FileName = spec.ContentName
+			}
+		}
+
+		offset = dataStart + dataSize
+		if flags&flagDataDescriptor != 0 {
+			next, err := skipDataDescriptor(r, offset, size)
+			if err != nil {
+				return &TruncationError{Section: entry + " data descriptor", Present: size - offset, Expected: -1, Size: size}
+			}
+			offset = next
+		}
+	}
+}
+
+// skipDataDescriptor returns the offset after the data descriptor at
+// offset. The descriptor signature is optional, and ZIP64 descriptors have
+// 8-byte sizes; the variant is chosen so that the next record follows.
+func skipDataDescriptor(r io.ReaderAt, offset, size int64) (int64, error) {
+	var sig [signatureSize]byte
+	if _, err := r.ReadAt(sig[:], offset); err != nil {
+		return 0, err
+	}
+	if binary.LittleEndian.Uint32(sig[:]) == dataDescriptorSignature {
+		offset += signatureSize
+	}
+	for _, n := range []int64{dataDescriptorSize, dataDescriptor64Size} {
+		next := offset + n
+		if next == size {
+			return next, nil
+		}
+		if _, err := r.ReadAt(sig[:], next); err == nil {
+			switch binary.LittleEndian.Uint32(sig[:]) {
+			case localHeaderSignature, centralHeaderSignature, endOfCentralDirSignature:
+				return next, nil
+			}
+		}
+	}
+	if offset+dataDescriptorSize > size {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return offset + dataDescriptorSize, nil
+}
+
+// countingReader is a buffered reader that counts the bytes consumed, so
+// that the end of a deflate stream is known. It implements io.ByteReader,
+// which keeps the flate decompressor from reading ahead of what it
+// consumes.
+type countingReader struct {
+	r   io.Reader
+	buf []byte
+	pos int
+	n   int64
+}
+
+func (c *countingReader) fill() error {
+	if c.buf == nil {
+		c.buf = make([]byte, 0, 64<<10)
+	}
+	n, err := c.r.Read(c.buf[:cap(c.buf)])
+	c.buf, c.pos = c.buf[:n], 0
+	if n > 0 {
+		return nil
+	}
+	if err == nil {
+		err = io.ErrNoProgress
+	}
+	return err
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if c.pos == len(c.buf) {
+		if err := c.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.buf[c.pos:])
+	c.pos += n
+	c.n += int64(n)
+	return n, nil
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	if c.pos == len(c.buf) {
+		if err := c.fill(); err != nil {
+			return 0, err
+		}
+	}
+	b := c.buf[c.pos]
+	c.pos++
+	c.n++
+	return b, nil
+}
@@ -0,0 +1,132 @@
+package unpacker
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/aes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/MANCHTOOLS/open-package/crypto"
+	"github.com/MANCHTOOLS/open-package/format"
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+// ContentHeader describes the encrypted content of a package as far as it
+// can be read without keys: the [HMAC][IV] header and the sizes
+type ContentHeader struct {
+	// Entry is the name of the content entry in the outer ZIP
+	Entry string
+	// Size is the size of the encrypted content, header included
+	Size int64
+	// Mac and IV are the header of the encrypted content
+	Mac []byte
+	IV  []byte
+	// CiphertextSize is the size of the encrypted data after the header
+	CiphertextSize int64
+	// Aligned reports whether the ciphertext is a non-empty multiple of
+	// the AES block size, as PKCS#7 padding produces. Content that is not
+	// aligned was cut or extended and cannot be decrypted.
+	Aligned bool
+	// MinContentSize and MaxContentSize bound the size of the decrypted
+	// content of aligned ciphertext, as the padding takes 1 to 16 bytes
+	MinContentSize int64
+	MaxContentSize int64
+	// DetectionError is the error reading Detection.xml, or nil if it was
+	// read and compared with the header
+	DetectionError error
+	// Mismatches lists the differences between the header and
+	// Detection.xml
+	Mismatches []string
+}
+
+// ReadContentHeader reads the header of the encrypted content of the
+// package at path without keys and without decrypting it, for packages
+// whose Detection.xml is missing or damaged. The content entry is the one
+// named by Detection.xml if it can be read, else the default content path
+// or the only entry of the contents folder.
+func ReadContentHeader(path string) (*ContentHeader, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		if file, openErr := os.Open(path); openErr == nil {
+			defer file.Close()
+			if stat, statErr := file.Stat(); statErr == nil {
+				if truncated := diagnose(file, stat.Size()); truncated != nil {
+					return nil, truncated
+				}
+			}
+		}
+		return nil, fmt.Errorf("package is not a valid ZIP: %w", err)
+	}
+	defer zr.Close()
+
+	h := &ContentHeader{}
+	info, contents, detectionErr, err := locateContent(&zr.Reader)
+	if err != nil {
+		return nil, err
+	}
+	h.DetectionError = detectionErr
+	h.Entry = contents.Name
+	h.Size = int64(contents.UncompressedSize64)
+
+	rc, err := contents.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", contents.Name, err)
+	}
+	defer rc.Close()
+	header := make([]byte, crypto.HMACSize+crypto.IVSize)
+	if n, err := io.ReadFull(rc, header); err != nil {
+		return nil, fmt.Errorf("encrypted content too short: %d bytes", n)
+	}
+	h.Mac, h.IV = header[:crypto.HMACSize], header[crypto.HMACSize:]
+	h.CiphertextSize = h.Size - int64(len(header))
+	h.Aligned = h.CiphertextSize > 0 && h.CiphertextSize%aes.BlockSize == 0
+	if h.Aligned {
+		h.MinContentSize = h.CiphertextSize - aes.BlockSize
+		h.MaxContentSize = h.CiphertextSize - 1
+	}
+
+	if info != nil {
+		h.Mismatches = h.compare(info)
+	}
+	return h, nil
+}
+
+// locateContent returns the parsed Detection.xml of a package and the
+// content entry it names. If Detection.xml cannot be read, it returns the
+// error reading it instead, and the content entry at the default content
+// path or the only entry of the contents folder.
+func locateContent(zr *zip.Reader) (*metadata.ApplicationInfo, *zip.File, error, error) {
+	pkg, contents, detectionErr := readPackage(zr, DefaultLimits)
+	if detectionErr == nil {
+		return pkg.Info, contents, nil, nil
+	}
+	for _, spec := range format.Specs {
+		if f, _ := findEntry(zr.File, spec.ContentPath("")); f != nil {
+			return nil, f, detectionErr, nil
+		}
+		if f := singleContentEntry(zr.File, spec); f != nil {
+			return nil, f, detectionErr, nil
+		}
+	}
+	return nil, nil, detectionErr, fmt.Errorf("no encrypted content found in package")
+}
+
+// compare lists the differences between the header and Detection.xml
+func (h *ContentHeader) compare(info *metadata.ApplicationInfo) []string {
+	var mismatches []string
+	encInfo := info.EncryptionInfo
+	if mac, err := base64.StdEncoding.DecodeString(encInfo.Mac); err != nil || !bytes.Equal(mac, h.Mac) {
+		mismatches = append(mismatches, "Mac in Detection.xml does not match the header")
+	}
+	if iv, err := base64.StdEncoding.DecodeString(encInfo.InitializationVector); err != nil || !bytes.Equal(iv, h.IV) {
+		mismatches = append(mismatches, "InitializationVector in Detection.xml does not match the header")
+	}
+	if expected := ExpectedEncryptedSize(info.UnencryptedContentSize); expected != h.Size {
+		mismatches = append(mismatches, fmt.Sprintf("UnencryptedContentSize %d in Detection.xml implies %d bytes of encrypted content, found %d",
+			info.UnencryptedContentSize, expected, h.Size))
+	}
+	return mismatches
+}
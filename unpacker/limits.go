@@ -0,0 +1,245 @@
+package unpacker
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/tempfiles"
+)
+
+// Limits bound what the read paths accept from untrusted packages.
+// Packages of the official tool stay far below the defaults; the limits
+// keep crafted packages from exhausting memory or disk. Zero fields use
+// the fields of DefaultLimits.
+type Limits struct {
+	// MaxEntries is the largest number of entries of a ZIP
+	MaxEntries int
+	// MaxExpandedSize is the largest total uncompressed size in bytes of
+	// the entries of a ZIP
+	MaxExpandedSize int64
+	// MaxRatio is the largest ratio of uncompressed to compressed size, of
+	// an entry and of a ZIP as a whole. Ratios of less than RatioFloor
+	// uncompressed bytes are not checked, as small ZIPs are harmless
+	// whatever their ratio.
+	MaxRatio int64
+	// MaxDetectionXMLSize is the largest Detection.xml in bytes that is
+	// parsed
+	MaxDetectionXMLSize int64
+}
+
+// RatioFloor is the uncompressed size below which ratios are not checked
+const RatioFloor = 1 << 20
+
+// DefaultLimits are the limits of the package level functions and of
+// zero fields of Limits. MaxExpandedSize is above the 30 GB Intune accepts
+// for an app, and MaxRatio above the 1032:1 that deflate reaches for
+// zeros, so only entries that share compressed data or forge their sizes
+// exceed it. Services may lower them once at startup.
+var DefaultLimits = Limits{
+	MaxEntries:          100000,
+	MaxExpandedSize:     64 << 30,
+	MaxRatio:            2000,
+	MaxDetectionXMLSize: 1 << 20,
+}
+
+// Names of the limits in LimitError.Limit
+const (
+	LimitEntries          = "entries"
+	LimitExpandedSize     = "expanded size"
+	LimitRatio            = "ratio"
+	LimitDetectionXMLSize = "Detection.xml size"
+)
+
+// LimitError reports a package that exceeds one of its Limits
+type LimitError struct {
+	// Limit is the exceeded limit, one of the Limit constants
+	Limit string
+	// Entry is the entry that exceeds the limit, or empty for limits of
+	// a ZIP as a whole
+	Entry string
+	// Value is the number of entries, the size in bytes or the ratio that
+	// exceeds Max
+	Value int64
+	// Max is the limit
+	Max int64
+}
+
+// Error describes the exceeded limit
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case LimitEntries:
+		return fmt.Sprintf("%d entries exceed the limit of %d", e.Value, e.Max)
+	case LimitExpandedSize:
+		return fmt.Sprintf("entries expand beyond the limit of %d bytes", e.Max)
+	case LimitRatio:
+		if e.Entry == "" {
+			return fmt.Sprintf("entries expand %d:1, beyond the ratio limit of %d:1", e.Value, e.Max)
+		}
+		return fmt.Sprintf("entry %s expands %d:1, beyond the ratio limit of %d:1", e.Entry, e.Value, e.Max)
+	}
+	return fmt.Sprintf("%s has %d bytes, beyond the limit of %d", e.Entry, e.Value, e.Max)
+}
+
+// withDefaults returns l with zero fields set from DefaultLimits
+func (l Limits) withDefaults() Limits {
+	if l.MaxEntries <= 0 {
+		l.MaxEntries = DefaultLimits.MaxEntries
+	}
+	if l.MaxExpandedSize <= 0 {
+		l.MaxExpandedSize = DefaultLimits.MaxExpandedSize
+	}
+	if l.MaxRatio <= 0 {
+		l.MaxRatio = DefaultLimits.MaxRatio
+	}
+	if l.MaxDetectionXMLSize <= 0 {
+		l.MaxDetectionXMLSize = DefaultLimits.MaxDetectionXMLSize
+	}
+	return l
+}
+
+// Open is Open with the limits of l
+func (l Limits) Open(path string) (*Package, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open package: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat package: %w", err)
+	}
+
+	return l.Read(file, stat.Size())
+}
+
+// Read is Read with the limits of l
+func (l Limits) Read(r io.ReaderAt, size int64) (*Package, error) {
+	l = l.withDefaults()
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		if truncated := diagnose(r, size); truncated != nil {
+			return nil, truncated
+		}
+		return nil, fmt.Errorf("package is not a valid ZIP: %w", err)
+	}
+	if err := l.checkZip(zr, size); err != nil {
+		return nil, fmt.Errorf("package rejected: %w", err)
+	}
+	pkg, contents, err := readPackage(zr, l)
+	if err != nil {
+		return nil, err
+	}
+	if pkg.Encrypted, err = readEntry(contents); err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+// VerifyFile is VerifyFile with the limits of l
+func (l Limits) VerifyFile(path string, opts VerifyOptions) (*Package, error) {
+	return verifyFile(path, opts, l.withDefaults())
+}
+
+// Unpack is Unpack with the limits of l
+func (l Limits) Unpack(path, dir string) (*Package, []string, error) {
+	return l.UnpackWith(path, dir, nil)
+}
+
+// UnpackWith is UnpackWith with the limits of l
+func (l Limits) UnpackWith(path, dir string, temp *tempfiles.Manager) (*Package, []string, error) {
+	return unpack(path, dir, temp, l.withDefaults())
+}
+
+// Extract is Extract with the limits of l
+func (l Limits) Extract(innerZip []byte, dir string) ([]string, error) {
+	zr, err := l.ReadInnerZip(innerZip)
+	if err != nil {
+		return nil, err
+	}
+	return extractZip(zr, dir)
+}
+
+// ReadInnerZip opens a decrypted package content for reading. Like all
+// read paths of this package, it rejects ZIPs with more entries than
+// MaxEntries, with entries that expand beyond MaxExpandedSize or MaxRatio,
+// and with entry names that are absolute or contain "..", which fail with
+// zip.ErrInsecurePath.
+func (l Limits) ReadInnerZip(innerZip []byte) (*zip.Reader, error) {
+	zr, err := zip.NewReader(bytes.NewReader(innerZip), int64(len(innerZip)))
+	if err != nil {
+		return nil, fmt.Errorf("inner package is not a valid ZIP: %w", err)
+	}
+	if err := l.withDefaults().checkZip(zr, int64(len(innerZip))); err != nil {
+		return nil, fmt.Errorf("inner package: %w", err)
+	}
+	return zr, nil
+}
+
+// ReadInnerZip is Limits.ReadInnerZip with DefaultLimits
+func ReadInnerZip(innerZip []byte) (*zip.Reader, error) {
+	return Limits{}.ReadInnerZip(innerZip)
+}
+
+// checkZip checks the entries of a ZIP of size bytes against the limits.
+// Sizes are taken from the central directory; archive/zip fails reads of
+// entries that expand beyond them.
+func (l Limits) checkZip(zr *zip.Reader, size int64) error {
+	if len(zr.File) > l.MaxEntries {
+		return &LimitError{Limit: LimitEntries, Value: int64(len(zr.File)), Max: int64(l.MaxEntries)}
+	}
+	maxExpanded, maxRatio := uint64(l.MaxExpandedSize), uint64(l.MaxRatio)
+	var total uint64
+	for _, f := range zr.File {
+		if err := checkEntryName(f.Name); err != nil {
+			return err
+		}
+		if f.UncompressedSize64 > RatioFloor && f.UncompressedSize64/maxRatio > f.CompressedSize64 {
+			return &LimitError{Limit: LimitRatio, Entry: f.Name, Value: ratio(f.UncompressedSize64, f.CompressedSize64), Max: l.MaxRatio}
+		}
+		total += f.UncompressedSize64
+		if total > maxExpanded || total < f.UncompressedSize64 {
+			return &LimitError{Limit: LimitExpandedSize, Value: int64(min(total, 1<<63-1)), Max: l.MaxExpandedSize}
+		}
+	}
+	// Entries that share compressed data expand beyond the ratio as a whole
+	if total > RatioFloor && total/maxRatio > uint64(size) {
+		return &LimitError{Limit: LimitRatio, Value: ratio(total, uint64(size)), Max: l.MaxRatio}
+	}
+	return nil
+}
+
+// checkDetectionXML checks the size of the Detection.xml entry before it
+// is read
+func (l Limits) checkDetectionXML(f *zip.File) error {
+	if f.UncompressedSize64 > uint64(l.MaxDetectionXMLSize) {
+		return &LimitError{Limit: LimitDetectionXMLSize, Entry: f.Name, Value: int64(min(f.UncompressedSize64, 1<<63-1)), Max: l.MaxDetectionXMLSize}
+	}
+	return nil
+}
+
+// ratio returns uncompressed/compressed, or uncompressed for empty
+// compressed data
+func ratio(uncompressed, compressed uint64) int64 {
+	return int64(min(uncompressed/max(compressed, 1), 1<<63-1))
+}
+
+// checkEntryName rejects entry names that are absolute or contain ".."
+// with either separator, which would escape the extraction folder on
+// some platform
+func checkEntryName(name string) error {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(slashed, "/") || (len(slashed) >= 2 && slashed[1] == ':') {
+		return fmt.Errorf("entry %s has an absolute path: %w", name, zip.ErrInsecurePath)
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return fmt.Errorf("entry %s refers to a parent folder: %w", name, zip.ErrInsecurePath)
+		}
+	}
+	return nil
+}
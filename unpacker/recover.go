@@ -0,0 +1,293 @@
+package unpacker
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/crypto"
+	"github.com/MANCHTOOLS/open-package/format"
+	"github.com/MANCHTOOLS/open-package/metadata"
+	"github.com/MANCHTOOLS/open-package/tempfiles"
+)
+
+// Keys are the keys of a package kept apart from its Detection.xml. As
+// JSON, they use the fields of the fileEncryptionInfo of Graph content
+// versions: encryptionKey and macKey are required, fileDigest and
+// fileDigestAlgorithm are checked when present, and
+// unencryptedContentSize may be added from Detection.xml.
+type Keys struct {
+	metadata.EncryptionInfo
+	UnencryptedContentSize int64 `json:"unencryptedContentSize,omitempty"`
+}
+
+// LoadKeys reads a keys file: the JSON of Keys or a Detection.xml, e.g.
+// one recovered from escrow
+func LoadKeys(path string) (*Keys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys: %w", err)
+	}
+	keys, err := ParseKeys(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keys %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// ParseKeys parses the content of a keys file
+func ParseKeys(data []byte) (*Keys, error) {
+	keys := &Keys{}
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("<")) {
+		info, _, err := metadata.ParseDetectionXMLTolerant(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		keys.EncryptionInfo = info.EncryptionInfo
+		keys.UnencryptedContentSize = info.UnencryptedContentSize
+	} else if err := json.Unmarshal(trimmed, keys); err != nil {
+		return nil, err
+	}
+	if _, err := keys.decode(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// decode decodes the keys and the optional digest
+func (k *Keys) decode() (*packageKeys, error) {
+	if k.EncryptionKey == "" || k.MacKey == "" {
+		return nil, fmt.Errorf("encryptionKey and macKey are required")
+	}
+	encryptionKey, err := base64.StdEncoding.DecodeString(k.EncryptionKey)
+	if err != nil || len(encryptionKey) != crypto.AES256KeySize {
+		return nil, fmt.Errorf("encryptionKey is not a base64 encoded %d byte key", crypto.AES256KeySize)
+	}
+	macKey, err := base64.StdEncoding.DecodeString(k.MacKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid macKey: %w", err)
+	}
+	fileDigest, err := base64.StdEncoding.DecodeString(k.FileDigest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fileDigest: %w", err)
+	}
+	if _, err := metadata.NewFileDigest(k.FileDigestAlgorithm); err != nil {
+		return nil, err
+	}
+	return &packageKeys{encryptionKey: encryptionKey, macKey: macKey, fileDigest: fileDigest}, nil
+}
+
+// UnpackWithKeys is UnpackWith for packages whose Detection.xml is
+// missing or damaged: the content is decrypted with keys instead of the
+// keys of Detection.xml. The HMAC is always checked, the size and digest
+// when keys carry them.
+func UnpackWithKeys(path, dir string, keys *Keys, temp *tempfiles.Manager) ([]string, error) {
+	return Limits{}.UnpackWithKeys(path, dir, keys, temp)
+}
+
+// UnpackWithKeys is UnpackWithKeys with the limits of l
+func (l Limits) UnpackWithKeys(path, dir string, keys *Keys, temp *tempfiles.Manager) ([]string, error) {
+	l = l.withDefaults()
+	tmp, size, err := decryptWithKeys(path, keys, temp)
+	if err != nil {
+		return nil, err
+	}
+	defer temp.Release(tmp.Name())
+	defer tmp.Close()
+	return extractInner(tmp, size, dir, l)
+}
+
+// decryptWithKeys decrypts the content of the package at path with keys
+// into a temporary file, which the caller must close and release, and
+// checks it against the size and digest of keys
+func decryptWithKeys(path string, keys *Keys, temp *tempfiles.Manager) (*os.File, int64, error) {
+	decoded, err := keys.decode()
+	if err != nil {
+		return nil, 0, err
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("package is not a valid ZIP: %w", err)
+	}
+	defer zr.Close()
+	_, contents, _, err := locateContent(&zr.Reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	rc, err := contents.Open()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open %s: %w", contents.Name, err)
+	}
+	defer rc.Close()
+
+	tmp, size, digest, err := decryptToFile(bufio.NewReader(rc), decoded, keys.FileDigestAlgorithm, temp)
+	if err != nil {
+		return nil, 0, err
+	}
+	if keys.UnencryptedContentSize != 0 && size != keys.UnencryptedContentSize {
+		err = fmt.Errorf("size mismatch: keys declare %d bytes, decrypted %d bytes", keys.UnencryptedContentSize, size)
+	} else if len(decoded.fileDigest) > 0 && !bytes.Equal(digest, decoded.fileDigest) {
+		err = fmt.Errorf("file digest mismatch (%s)", digestName(keys.FileDigestAlgorithm))
+	}
+	if err != nil {
+		tmp.Close()
+		temp.Release(tmp.Name())
+		return nil, 0, err
+	}
+	return tmp, size, nil
+}
+
+// RepairOptions configures Repair
+type RepairOptions struct {
+	// Name and SetupFile are the values of the new Detection.xml. By
+	// default they are kept from the damaged Detection.xml, as far as it
+	// can be read; Name falls back to the folder of the content.
+	Name      string
+	SetupFile string
+	// StrictCompat writes Detection.xml byte-compatible with the official
+	// tool
+	StrictCompat bool
+	// Temp tracks the temporary file of the decrypted content
+	Temp *tempfiles.Manager
+}
+
+// Repair returns a new Detection.xml for the package at path, whose
+// Detection.xml is missing or damaged: the keys come from keys, Mac and
+// InitializationVector from the header of the encrypted content, and size
+// and SHA256 digest are computed by decrypting it. The package is written
+// from the new Detection.xml and OpenEncrypted with packager.WriteOuter.
+func Repair(path string, keys *Keys, opts RepairOptions) ([]byte, error) {
+	tmp, size, err := decryptWithKeys(path, keys, opts.Temp)
+	if err != nil {
+		return nil, err
+	}
+	defer opts.Temp.Release(tmp.Name())
+	defer tmp.Close()
+
+	h, err := ReadContentHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := metadata.NewFileDigest(metadata.FileDigestAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(digest, io.NewSectionReader(tmp, 0, size)); err != nil {
+		return nil, fmt.Errorf("failed to read decrypted content: %w", err)
+	}
+
+	// What is left of the damaged Detection.xml
+	salvaged := salvageDetectionXML(path)
+	name, setupFile, msiInfo := opts.Name, opts.SetupFile, salvaged.MsiInfo
+	if name == "" {
+		name = salvaged.Name
+	}
+	if name == "" {
+		name = topFolder(tmp, size)
+	}
+	if setupFile == "" {
+		setupFile = salvaged.SetupFile
+	}
+	if name == "" || setupFile == "" {
+		return nil, fmt.Errorf("the damaged Detection.xml does not name the app or its setup file, which must be given")
+	}
+
+	return metadata.GenerateDetectionXML(metadata.DetectionXMLOptions{
+		Name:      name,
+		SetupFile: setupFile,
+		CryptoInfo: crypto.EncryptionInfoBase64{
+			EncryptionKey:   keys.EncryptionKey,
+			MacKey:          keys.MacKey,
+			IV:              base64.StdEncoding.EncodeToString(h.IV),
+			MAC:             base64.StdEncoding.EncodeToString(h.Mac),
+			FileDigest:      base64.StdEncoding.EncodeToString(digest.Sum(nil)),
+			UnencryptedSize: size,
+		},
+		MsiInfo:           msiInfo,
+		StrictCompat:      opts.StrictCompat,
+		ProfileIdentifier: keys.ProfileIdentifier,
+	})
+}
+
+// salvageDetectionXML returns the fields of the Detection.xml of the
+// package at path that can still be read, or an empty ApplicationInfo
+func salvageDetectionXML(path string) *metadata.ApplicationInfo {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return &metadata.ApplicationInfo{}
+	}
+	defer zr.Close()
+	detection, _ := findEntry(zr.File, format.Current.MetadataPath)
+	if detection == nil {
+		return &metadata.ApplicationInfo{}
+	}
+	data, err := readEntry(detection)
+	if err != nil {
+		return &metadata.ApplicationInfo{}
+	}
+	info, _, err := metadata.ParseDetectionXMLTolerant(data)
+	if err != nil {
+		return &metadata.ApplicationInfo{}
+	}
+	return info
+}
+
+// topFolder returns the folder all entries of an inner ZIP are in, which
+// is the name of the source folder of packages of the official tool, or
+// "" if there is none
+func topFolder(r io.ReaderAt, size int64) string {
+	inner, err := zip.NewReader(r, size)
+	if err != nil {
+		return ""
+	}
+	folder := ""
+	for _, f := range inner.File {
+		first, _, nested := strings.Cut(format.Normalize(f.Name), "/")
+		if !nested || (folder != "" && first != folder) {
+			return ""
+		}
+		folder = first
+	}
+	return folder
+}
+
+// OpenEncrypted opens the encrypted content of the package at path, which
+// is found as ReadContentHeader finds it
+func OpenEncrypted(path string) (io.ReadCloser, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("package is not a valid ZIP: %w", err)
+	}
+	_, contents, _, err := locateContent(&zr.Reader)
+	if err != nil {
+		zr.Close()
+		return nil, err
+	}
+	rc, err := contents.Open()
+	if err != nil {
+		zr.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", contents.Name, err)
+	}
+	return &encryptedReader{ReadCloser: rc, zip: zr}, nil
+}
+
+// encryptedReader closes the package with its content entry
+type encryptedReader struct {
+	io.ReadCloser
+	zip *zip.ReadCloser
+}
+
+// Close closes the entry and the package
+func (r *encryptedReader) Close() error {
+	err := r.ReadCloser.Close()
+	if zipErr := r.zip.Close(); err == nil {
+		err = zipErr
+	}
+	return err
+}
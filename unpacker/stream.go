@@ -0,0 +1,229 @@
+package unpacker
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/MANCHTOOLS/open-package/crypto"
+	"github.com/MANCHTOOLS/open-package/metadata"
+	"github.com/MANCHTOOLS/open-package/tempfiles"
+)
+
+// Unpack verifies and extracts the package at path to dir without holding
+// its content in memory. The encrypted content is decrypted into a
+// temporary file while its HMAC and digest are computed; files are only
+// extracted once both match. A content size or header HMAC that does not
+// match Detection.xml fails before anything is decrypted. It returns the
+// package, without its encrypted content, and the extracted paths.
+func Unpack(path, dir string) (*Package, []string, error) {
+	return UnpackWith(path, dir, nil)
+}
+
+// UnpackWith is Unpack with the temporary file of the decrypted content
+// tracked by temp
+func UnpackWith(path, dir string, temp *tempfiles.Manager) (*Package, []string, error) {
+	return Limits{}.UnpackWith(path, dir, temp)
+}
+
+// unpack is UnpackWith with the limits of l
+func unpack(path, dir string, temp *tempfiles.Manager, l Limits) (*Package, []string, error) {
+	pkg, tmp, size, err := decryptPackage(path, temp, l)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer temp.Release(tmp.Name())
+	defer tmp.Close()
+
+	files, err := extractInner(tmp, size, dir, l)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pkg, files, nil
+}
+
+// decryptPackage decrypts the content of the package at path with the
+// keys of its Detection.xml into a temporary file, which the caller must
+// close and release, and checks HMAC, size and digest. It returns the
+// package without its encrypted content, the file and the content size.
+func decryptPackage(path string, temp *tempfiles.Manager, l Limits) (*Package, *os.File, int64, error) {
+	zr, pkg, contents, err := openContent(path, l)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer zr.Close()
+	keys, err := pkg.keys()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	encInfo := pkg.Info.EncryptionInfo
+
+	rc, err := contents.Open()
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to open %s: %w", contents.Name, err)
+	}
+	defer rc.Close()
+	r := bufio.NewReader(rc)
+	if encInfo.Mac != "" {
+		header, err := r.Peek(crypto.HMACSize)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to read %s: %w", contents.Name, err)
+		}
+		if base64.StdEncoding.EncodeToString(header) != encInfo.Mac {
+			return nil, nil, 0, fmt.Errorf("encrypted content does not match the Mac in Detection.xml")
+		}
+	}
+
+	tmp, size, digest, err := decryptToFile(r, keys, encInfo.FileDigestAlgorithm, temp)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if size != pkg.Info.UnencryptedContentSize {
+		err = fmt.Errorf("size mismatch: Detection.xml declares %d bytes, decrypted %d bytes",
+			pkg.Info.UnencryptedContentSize, size)
+	} else if !bytes.Equal(digest, keys.fileDigest) {
+		err = fmt.Errorf("file digest mismatch (%s)", digestName(encInfo.FileDigestAlgorithm))
+	}
+	if err != nil {
+		tmp.Close()
+		temp.Release(tmp.Name())
+		return nil, nil, 0, err
+	}
+	return pkg, tmp, size, nil
+}
+
+// Inner is the decrypted inner ZIP of a package, held in a temporary file
+// until it is closed
+type Inner struct {
+	*zip.Reader
+	// Package is the package without its encrypted content, or nil if it
+	// was decrypted with keys
+	Package *Package
+	file    *os.File
+	size    int64
+	temp    *tempfiles.Manager
+}
+
+// Content returns the decrypted inner ZIP, e.g. to encrypt it with new
+// keys
+func (i *Inner) Content() *io.SectionReader {
+	return io.NewSectionReader(i.file, 0, i.size)
+}
+
+// Close closes and removes the temporary file
+func (i *Inner) Close() error {
+	err := i.file.Close()
+	i.temp.Release(i.file.Name())
+	return err
+}
+
+// OpenInner verifies and decrypts the package at path like UnpackWith,
+// without extracting it, so that its files can be read from the inner
+// ZIP. With keys, Detection.xml is ignored as with UnpackWithKeys.
+func OpenInner(path string, keys *Keys, temp *tempfiles.Manager) (*Inner, error) {
+	return Limits{}.OpenInner(path, keys, temp)
+}
+
+// OpenInner is OpenInner with the limits of l
+func (l Limits) OpenInner(path string, keys *Keys, temp *tempfiles.Manager) (*Inner, error) {
+	l = l.withDefaults()
+	var pkg *Package
+	var tmp *os.File
+	var size int64
+	var err error
+	if keys != nil {
+		tmp, size, err = decryptWithKeys(path, keys, temp)
+	} else {
+		pkg, tmp, size, err = decryptPackage(path, temp, l)
+	}
+	if err != nil {
+		return nil, err
+	}
+	inner := &Inner{Package: pkg, file: tmp, size: size, temp: temp}
+	if inner.Reader, err = zip.NewReader(tmp, size); err != nil {
+		inner.Close()
+		return nil, fmt.Errorf("inner package is not a valid ZIP: %w", err)
+	}
+	if err := l.checkZip(inner.Reader, size); err != nil {
+		inner.Close()
+		return nil, fmt.Errorf("inner package: %w", err)
+	}
+	return inner, nil
+}
+
+// decryptToFile decrypts the encrypted content read from r into a
+// temporary file tracked by temp, computing the digest of the decrypted
+// content with algorithm. It returns the file, which the caller must close
+// and release, the size of the content and its digest.
+func decryptToFile(r io.Reader, keys *packageKeys, algorithm string, temp *tempfiles.Manager) (*os.File, int64, []byte, error) {
+	digest, err := metadata.NewFileDigest(algorithm)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	tmp, err := temp.File("", "open-package-unpack-*.zip")
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	size, err := crypto.DecryptStream(keys.encryptionKey, keys.macKey, r, io.MultiWriter(tmp, digest))
+	if err != nil {
+		tmp.Close()
+		temp.Release(tmp.Name())
+		return nil, 0, nil, err
+	}
+	return tmp, size, digest.Sum(nil), nil
+}
+
+// extractInner extracts the inner ZIP of size bytes in r to dir
+func extractInner(r io.ReaderAt, size int64, dir string, l Limits) ([]string, error) {
+	inner, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("inner package is not a valid ZIP: %w", err)
+	}
+	if err := l.checkZip(inner, size); err != nil {
+		return nil, fmt.Errorf("inner package: %w", err)
+	}
+	return extractZip(inner, dir)
+}
+
+// openContent opens the outer ZIP at path and reads Detection.xml. It
+// returns the ZIP, which the caller must close, the package without its
+// encrypted content and the entry of the content, whose size was checked
+// against Detection.xml.
+func openContent(path string, l Limits) (*zip.ReadCloser, *Package, *zip.File, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		if file, openErr := os.Open(path); openErr == nil {
+			defer file.Close()
+			if stat, statErr := file.Stat(); statErr == nil {
+				if truncated := diagnose(file, stat.Size()); truncated != nil {
+					return nil, nil, nil, truncated
+				}
+			}
+		}
+		return nil, nil, nil, fmt.Errorf("package is not a valid ZIP: %w", err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		zr.Close()
+		return nil, nil, nil, fmt.Errorf("failed to stat package: %w", err)
+	}
+	if err := l.checkZip(&zr.Reader, stat.Size()); err != nil {
+		zr.Close()
+		return nil, nil, nil, fmt.Errorf("package rejected: %w", err)
+	}
+
+	pkg, contents, err := readPackage(&zr.Reader, l)
+	if err != nil {
+		zr.Close()
+		return nil, nil, nil, err
+	}
+	if err := checkEncryptedSize(int64(contents.UncompressedSize64), pkg.Info.UnencryptedContentSize); err != nil {
+		zr.Close()
+		return nil, nil, nil, err
+	}
+	return zr, pkg, contents, nil
+}
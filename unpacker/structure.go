@@ -0,0 +1,130 @@
+package unpacker
+
+import (
+	"archive/zip"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/format"
+)
+
+// StructureProblem is a deviation of the outer ZIP from the layout of the
+// official tool, with a suggestion how to fix the package
+type StructureProblem struct {
+	Problem string `json:"problem"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+// String joins the problem and its fix
+func (p StructureProblem) String() string {
+	if p.Fix == "" {
+		return p.Problem
+	}
+	return p.Problem + " (" + p.Fix + ")"
+}
+
+// findEntry returns the entry with the given name. Packages of other
+// tools are accepted with backslashes or different casing in the name;
+// for those, exact is false.
+func findEntry(files []*zip.File, name string) (f *zip.File, exact bool) {
+	for _, f := range files {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	for _, f := range files {
+		if strings.EqualFold(format.Normalize(f.Name), name) {
+			return f, false
+		}
+	}
+	return nil, false
+}
+
+// singleContentEntry returns the only file below the contents directory,
+// for packages whose content does not match the FileName element
+func singleContentEntry(files []*zip.File, spec *format.Spec) *zip.File {
+	var found *zip.File
+	for _, f := range files {
+		name := strings.ToLower(format.Normalize(f.Name))
+		if !strings.HasPrefix(name, strings.ToLower(spec.ContentsDir)) || strings.HasSuffix(name, "/") {
+			continue
+		}
+		if found != nil {
+			return nil
+		}
+		found = f
+	}
+	return found
+}
+
+// CheckStructure checks the entries of the outer ZIP against its layout:
+// Detection.xml must be present exactly once at its path, the encrypted content must be at
+// the path named by the FileName element, entry names must use forward
+// slashes and the exact casing, and there must be no other entries.
+func (p *Package) CheckStructure() []StructureProblem {
+	var problems []StructureProblem
+	add := func(fix, msg string, args ...interface{}) {
+		problems = append(problems, StructureProblem{Problem: fmt.Sprintf(msg, args...), Fix: fix})
+	}
+
+	// Packages that were not read with a detected layout are checked
+	// against the current one
+	spec := p.Format
+	if spec == nil {
+		spec = format.Current
+	}
+	fileName := spec.ContentName
+	if p.Info != nil && p.Info.FileName != "" {
+		fileName = p.Info.FileName
+	}
+	if strings.ContainsAny(fileName, `/\`) {
+		add("set FileName to the file name only, e.g. "+spec.ContentName, "FileName %q contains a path", fileName)
+		fileName = path.Base(format.Normalize(fileName))
+	}
+	contentsPath := spec.ContentPath(fileName)
+
+	expected := map[string]string{
+		strings.ToLower(spec.MetadataPath): spec.MetadataPath,
+		strings.ToLower(contentsPath):      contentsPath,
+	}
+	for _, dir := range spec.Dirs {
+		expected[strings.ToLower(dir)] = dir
+	}
+	counts := make(map[string]int)
+	for _, entry := range p.Entries {
+		name := format.Normalize(entry)
+		want, known := expected[strings.ToLower(name)]
+		switch {
+		case !known && strings.HasPrefix(strings.ToLower(name), strings.ToLower(spec.ContentsDir)) && strings.EqualFold(path.Ext(name), path.Ext(fileName)):
+			add(fmt.Sprintf("rename it to %s or set FileName to %s", contentsPath, path.Base(name)), "content entry %s does not match the FileName element %q", entry, fileName)
+			counts[contentsPath]++
+			continue
+		case !known && strings.EqualFold(path.Base(name), "Detection.xml"):
+			add("move it to "+spec.MetadataPath, "Detection.xml is at %s", entry)
+			counts[spec.MetadataPath]++
+			continue
+		case !known:
+			add("remove it from the package", "unexpected entry %s", entry)
+			continue
+		}
+		counts[want]++
+		if entry != want {
+			if strings.Contains(entry, `\`) {
+				add("use forward slashes in entry names", "entry %s uses backslashes", entry)
+			} else {
+				add("rename it to "+want, "entry %s differs in case from %s", entry, want)
+			}
+		}
+	}
+
+	for _, name := range []string{spec.MetadataPath, contentsPath} {
+		switch n := counts[name]; {
+		case n == 0:
+			problems = append(problems, StructureProblem{Problem: name + " is missing"})
+		case n > 1:
+			add("keep a single entry", "%s is present %d times", name, n)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,268 @@
+// Package unpacker reads .intunewin packages.
+//
+// It is the counterpart of the packager package: it opens the outer ZIP,
+// parses Detection.xml and verifies and decrypts the encrypted inner
+// package using the keys stored in Detection.xml.
+package unpacker
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MANCHTOOLS/open-package/crypto"
+	"github.com/MANCHTOOLS/open-package/format"
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+// Package is an opened .intunewin package
+type Package struct {
+	// Entries lists the names of all entries in the outer ZIP
+	Entries []string
+	// DetectionXML is the raw Detection.xml content
+	DetectionXML []byte
+	// Info is the parsed Detection.xml
+	Info *metadata.ApplicationInfo
+	// Encrypted is the encrypted inner package ([HMAC][IV][Encrypted Data])
+	Encrypted []byte
+	// Format is the layout of the outer ZIP
+	Format *format.Spec
+	// Comment is the comment of the outer ZIP, which holds the build info
+	// of packages built with packager.Options.BuildInfo
+	Comment string
+	// Warnings lists deviations from the expected Detection.xml format
+	// that were tolerated while reading the package
+	Warnings []string
+}
+
+// Open reads the .intunewin package at path with DefaultLimits
+func Open(path string) (*Package, error) {
+	return Limits{}.Open(path)
+}
+
+// Read reads a .intunewin package from r with DefaultLimits
+func Read(r io.ReaderAt, size int64) (*Package, error) {
+	return Limits{}.Read(r, size)
+}
+
+// readPackage parses Detection.xml of an outer ZIP and returns the
+// package without its encrypted content, and the entry of the content
+func readPackage(zr *zip.Reader, l Limits) (*Package, *zip.File, error) {
+	var err error
+	pkg := &Package{Comment: zr.Comment}
+	for _, f := range zr.File {
+		pkg.Entries = append(pkg.Entries, f.Name)
+	}
+
+	pkg.Format = format.Detect(pkg.Entries)
+	if pkg.Format == nil {
+		return nil, nil, fmt.Errorf("%s not found in package", format.Current.MetadataPath)
+	}
+	spec := pkg.Format
+
+	detection, exact := findEntry(zr.File, spec.MetadataPath)
+	if err := l.checkDetectionXML(detection); err != nil {
+		return nil, nil, fmt.Errorf("package rejected: %w", err)
+	}
+	if pkg.DetectionXML, err = readEntry(detection); err != nil {
+		return nil, nil, err
+	}
+	if pkg.Info, pkg.Warnings, err = metadata.ParseDetectionXMLTolerant(pkg.DetectionXML); err != nil {
+		return nil, nil, err
+	}
+	if !exact {
+		pkg.Warnings = append(pkg.Warnings, fmt.Sprintf("%s found as %s", spec.MetadataPath, detection.Name))
+	}
+
+	if pkg.Info.FileName == "" {
+		pkg.Warnings = append(pkg.Warnings, fmt.Sprintf("FileName is empty, assuming %s", spec.ContentName))
+	}
+	contentsPath := spec.ContentPath(pkg.Info.FileName)
+	contents, exact := findEntry(zr.File, contentsPath)
+	if contents == nil {
+		contents = singleContentEntry(zr.File, spec)
+	}
+	if contents == nil {
+		return nil, nil, fmt.Errorf("%s not found in package", contentsPath)
+	}
+	if !exact {
+		pkg.Warnings = append(pkg.Warnings, fmt.Sprintf("%s found as %s", contentsPath, contents.Name))
+	}
+	return pkg, contents, nil
+}
+
+// Decrypt verifies the HMAC of the encrypted content, decrypts it and
+// checks the result against the digest and size in Detection.xml. It
+// returns the inner ZIP.
+func (p *Package) Decrypt() ([]byte, error) {
+	encInfo := p.Info.EncryptionInfo
+	keys, err := p.keys()
+	if err != nil {
+		return nil, err
+	}
+	fileDigest := keys.fileDigest
+
+	if err := checkEncryptedSize(int64(len(p.Encrypted)), p.Info.UnencryptedContentSize); err != nil {
+		return nil, err
+	}
+
+	plaintext, err := crypto.Decrypt(keys.encryptionKey, keys.macKey, p.Encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(plaintext)) != p.Info.UnencryptedContentSize {
+		return nil, fmt.Errorf("size mismatch: Detection.xml declares %d bytes, decrypted %d bytes",
+			p.Info.UnencryptedContentSize, len(plaintext))
+	}
+	digest, err := metadata.ComputeFileDigest(encInfo.FileDigestAlgorithm, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(digest, fileDigest) {
+		return nil, fmt.Errorf("file digest mismatch (%s)", digestName(encInfo.FileDigestAlgorithm))
+	}
+
+	return plaintext, nil
+}
+
+// packageKeys are the decoded keys and digest of Detection.xml
+type packageKeys struct {
+	encryptionKey []byte
+	macKey        []byte
+	fileDigest    []byte
+}
+
+// keys decodes the keys and digest of Detection.xml and checks that the
+// digest algorithm is supported, so that unsupported algorithms fail
+// before decrypting
+func (p *Package) keys() (*packageKeys, error) {
+	encInfo := p.Info.EncryptionInfo
+	encryptionKey, err := base64.StdEncoding.DecodeString(encInfo.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EncryptionKey: %w", err)
+	}
+	macKey, err := base64.StdEncoding.DecodeString(encInfo.MacKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MacKey: %w", err)
+	}
+	fileDigest, err := base64.StdEncoding.DecodeString(encInfo.FileDigest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FileDigest: %w", err)
+	}
+	if _, err := metadata.NewFileDigest(encInfo.FileDigestAlgorithm); err != nil {
+		return nil, err
+	}
+	return &packageKeys{encryptionKey: encryptionKey, macKey: macKey, fileDigest: fileDigest}, nil
+}
+
+// digestName returns the algorithm name for messages, SHA256 if empty
+func digestName(algorithm string) string {
+	if algorithm == "" {
+		return metadata.FileDigestAlgorithm
+	}
+	return algorithm
+}
+
+// Verify validates Detection.xml, checks that its Mac and
+// InitializationVector match the header of the encrypted content and
+// decrypts the content to check HMAC, size and digest
+func (p *Package) Verify() error {
+	if err := metadata.Validate(p.Info); err != nil {
+		return err
+	}
+
+	encInfo := p.Info.EncryptionInfo
+	if len(p.Encrypted) < crypto.HMACSize+crypto.IVSize {
+		return &TruncationError{Section: "encrypted content", Present: int64(len(p.Encrypted)), Expected: ExpectedEncryptedSize(p.Info.UnencryptedContentSize)}
+	}
+	if base64.StdEncoding.EncodeToString(p.Encrypted[:crypto.HMACSize]) != encInfo.Mac {
+		return fmt.Errorf("encrypted content does not match the Mac in Detection.xml")
+	}
+	if base64.StdEncoding.EncodeToString(p.Encrypted[crypto.HMACSize:crypto.HMACSize+crypto.IVSize]) != encInfo.InitializationVector {
+		return fmt.Errorf("encrypted content does not match the InitializationVector in Detection.xml")
+	}
+
+	_, err := p.Decrypt()
+	return err
+}
+
+// Extract writes the files of an inner ZIP to dir and returns the paths
+// of the extracted files. Entries that would be written outside of dir
+// are rejected, as are ZIPs that ReadInnerZip rejects with DefaultLimits.
+func Extract(innerZip []byte, dir string) ([]string, error) {
+	return Limits{}.Extract(innerZip, dir)
+}
+
+// extractZip writes the files of an inner ZIP to dir
+func extractZip(zr *zip.Reader, dir string) ([]string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var extracted []string
+	for _, f := range zr.File {
+		target := filepath.Join(absDir, filepath.FromSlash(f.Name))
+		if target != absDir && !strings.HasPrefix(target, absDir+string(os.PathSeparator)) {
+			return nil, fmt.Errorf("entry %s is outside of the target directory", f.Name)
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		if err := extractFile(f, target); err != nil {
+			return nil, err
+		}
+		extracted = append(extracted, target)
+	}
+
+	return extracted, nil
+}
+
+// extractFile writes a single ZIP entry to target
+func extractFile(f *zip.File, target string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", target, err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, rc); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", f.Name, err)
+	}
+	return out.Close()
+}
+
+// readEntry reads the content of a ZIP entry
+func readEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	return data, nil
+}
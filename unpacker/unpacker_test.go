@@ -0,0 +1,699 @@
+package unpacker
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/MANCHTOOLS/open-package/metadata"
+	"github.com/MANCHTOOLS/open-package/packager"
+)
+
+// createTestPackage builds a package from a small source tree
+func createTestPackage(t *testing.T, tempDir string) string {
+	t.Helper()
+
+	sourceDir := filepath.Join(tempDir, "testapp")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.exe"), []byte("fake exe content"), 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+
+	outputPath, err := packager.New(packager.Options{
+		SourceDir: sourceDir,
+		SetupFile: "install.exe",
+		OutputDir: tempDir,
+		Quiet:     true,
+	}).CreatePackage()
+	if err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	return outputPath
+}
+
+func TestOpenAndDecrypt(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-unpack-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	pkg, err := Open(createTestPackage(t, tempDir))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	if pkg.Info.Name != "testapp" {
+		t.Errorf("Name mismatch: expected testapp, got %s", pkg.Info.Name)
+	}
+	if len(pkg.Entries) != 2 {
+		t.Errorf("Expected 2 outer entries, got %v", pkg.Entries)
+	}
+
+	innerZip, err := pkg.Decrypt()
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(innerZip), int64(len(innerZip)))
+	if err != nil {
+		t.Fatalf("Decrypted content is not a valid ZIP: %v", err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "testapp/install.exe" {
+		t.Errorf("Unexpected inner ZIP entries")
+	}
+
+	// Corrupted content fails verification
+	pkg.Encrypted[len(pkg.Encrypted)-1] ^= 0xFF
+	if _, err := pkg.Decrypt(); err == nil {
+		t.Error("Expected error for corrupted content")
+	}
+}
+
+func TestReadMissingEntries(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create(metadata.DetectionXMLPath)
+	w.Write([]byte(`<ApplicationInfo><FileName>IntunePackage.intunewin</FileName></ApplicationInfo>`))
+	zw.Close()
+
+	if _, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err == nil {
+		t.Error("Expected error for missing encrypted content")
+	}
+
+	if _, err := Read(bytes.NewReader([]byte("not a zip")), 9); err == nil {
+		t.Error("Expected error for invalid ZIP")
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-extract-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	pkg, err := Open(createTestPackage(t, tempDir))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	innerZip, err := pkg.Decrypt()
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+
+	outDir := filepath.Join(tempDir, "extracted")
+	files, err := Extract(innerZip, outDir)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 extracted file, got %v", files)
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, "testapp", "install.exe"))
+	if err != nil || string(data) != "fake exe content" {
+		t.Errorf("Extracted content mismatch: %q, %v", data, err)
+	}
+
+	// Entries escaping the target directory are rejected
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("../evil.txt")
+	w.Write([]byte("evil"))
+	zw.Close()
+	if _, err := Extract(buf.Bytes(), outDir); err == nil {
+		t.Error("Expected error for path traversal entry")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "evil.txt")); err == nil {
+		t.Error("Path traversal entry was written")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-verify-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	pkg, err := Open(createTestPackage(t, tempDir))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := pkg.Verify(); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	// An IV that does not match the content header is detected
+	pkg.Info.EncryptionInfo.InitializationVector = "AAAAAAAAAAAAAAAAAAAAAA=="
+	if err := pkg.Verify(); err == nil {
+		t.Error("Expected error for mismatching IV")
+	}
+
+	pkg.Info.EncryptionInfo.FileDigestAlgorithm = "MD5"
+	var validationErr *metadata.ValidationError
+	if err := pkg.Verify(); !errors.As(err, &validationErr) {
+		t.Errorf("Expected ValidationError, got %v", err)
+	}
+}
+
+func TestDecryptDigestAlgorithms(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-digest-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	pkg, err := Open(createTestPackage(t, tempDir))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	innerZip, err := pkg.Decrypt()
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+
+	// Packages of other tools may declare other algorithms
+	enc := &pkg.Info.EncryptionInfo
+	enc.FileDigestAlgorithm = "SHA512"
+	if _, err := pkg.Decrypt(); err == nil {
+		t.Error("Expected digest mismatch for a SHA256 digest declared as SHA512")
+	}
+	digest := sha512.Sum512(innerZip)
+	enc.FileDigest = base64.StdEncoding.EncodeToString(digest[:])
+	if _, err := pkg.Decrypt(); err != nil {
+		t.Errorf("Decrypt failed for SHA512 digest: %v", err)
+	}
+	if err := pkg.Verify(); err != nil {
+		t.Errorf("Verify failed for SHA512 digest: %v", err)
+	}
+
+	enc.FileDigestAlgorithm = "MD5"
+	if _, err := pkg.Decrypt(); !errors.Is(err, metadata.ErrUnsupportedDigest) {
+		t.Errorf("Expected ErrUnsupportedDigest, got %v", err)
+	}
+}
+
+func TestUnpack(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-stream-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	packagePath := createTestPackage(t, tempDir)
+	outDir := filepath.Join(tempDir, "out")
+	pkg, files, err := Unpack(packagePath, outDir)
+	if err != nil {
+		t.Fatalf("Unpack failed: %v", err)
+	}
+	if pkg.Info.Name != "testapp" || pkg.Encrypted != nil {
+		t.Errorf("Unexpected package: %s, %d encrypted bytes", pkg.Info.Name, len(pkg.Encrypted))
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 extracted file, got %v", files)
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, "testapp", "install.exe"))
+	if err != nil || string(data) != "fake exe content" {
+		t.Errorf("Extracted content mismatch: %q, %v", data, err)
+	}
+
+	// Corrupted content is detected before anything is extracted
+	opened, err := Open(packagePath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	corrupted := append([]byte{}, opened.Encrypted...)
+	corrupted[len(corrupted)-20] ^= 0xFF
+	corruptPath := filepath.Join(tempDir, "corrupt.intunewin")
+	writePackage(t, corruptPath, opened.DetectionXML, opened.Info.FileName, corrupted)
+	badDir := filepath.Join(tempDir, "bad")
+	if _, _, err := Unpack(corruptPath, badDir); err == nil || !strings.Contains(err.Error(), "HMAC") {
+		t.Errorf("Expected HMAC error, got %v", err)
+	}
+	if _, err := os.Stat(badDir); !os.IsNotExist(err) {
+		t.Error("Files were extracted from corrupted content")
+	}
+
+	// Truncated content fails on its size before decrypting
+	writePackage(t, corruptPath, opened.DetectionXML, opened.Info.FileName, opened.Encrypted[:len(opened.Encrypted)-16])
+	var truncated *TruncationError
+	if _, _, err := Unpack(corruptPath, badDir); !errors.As(err, &truncated) || truncated.Expected-truncated.Present != 16 {
+		t.Errorf("Expected 16 bytes missing, got %v", err)
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-verify-file-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	packagePath := createTestPackage(t, tempDir)
+	for _, mode := range []VerifyMode{VerifyQuick, VerifyFull} {
+		var checkpoints []VerifyProgress
+		pkg, err := VerifyFile(packagePath, VerifyOptions{Mode: mode, Progress: func(p VerifyProgress) {
+			checkpoints = append(checkpoints, p)
+		}})
+		if err != nil {
+			t.Fatalf("VerifyFile failed in %s mode: %v", mode, err)
+		}
+		if pkg.Info.Name != "testapp" || pkg.Encrypted != nil {
+			t.Errorf("Unexpected package: %s, %d encrypted bytes", pkg.Info.Name, len(pkg.Encrypted))
+		}
+		if len(checkpoints) != 1 || checkpoints[0].Bytes != checkpoints[0].Total || checkpoints[0].Total == 0 {
+			t.Errorf("Expected a single final checkpoint in %s mode, got %+v", mode, checkpoints)
+		}
+	}
+
+	opened, err := Open(packagePath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	badPath := filepath.Join(tempDir, "bad.intunewin")
+
+	// Corrupted content fails both modes
+	corrupted := append([]byte{}, opened.Encrypted...)
+	corrupted[len(corrupted)-20] ^= 0xFF
+	writePackage(t, badPath, opened.DetectionXML, opened.Info.FileName, corrupted)
+	for _, mode := range []VerifyMode{VerifyQuick, VerifyFull} {
+		if _, err := VerifyFile(badPath, VerifyOptions{Mode: mode}); err == nil || !strings.Contains(err.Error(), "HMAC") {
+			t.Errorf("Expected HMAC error in %s mode, got %v", mode, err)
+		}
+	}
+
+	// A wrong digest is only found by decrypting
+	wrongDigest := strings.Replace(string(opened.DetectionXML), opened.Info.EncryptionInfo.FileDigest,
+		base64.StdEncoding.EncodeToString(make([]byte, 32)), 1)
+	writePackage(t, badPath, []byte(wrongDigest), opened.Info.FileName, opened.Encrypted)
+	if _, err := VerifyFile(badPath, VerifyOptions{Mode: VerifyQuick}); err != nil {
+		t.Errorf("VerifyFile failed in quick mode: %v", err)
+	}
+	if _, err := VerifyFile(badPath, VerifyOptions{}); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("Expected digest mismatch, got %v", err)
+	}
+
+	// Structure problems fail before the content is read
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range map[string][]byte{
+		metadata.DetectionXMLPath:                   opened.DetectionXML,
+		metadata.ContentsDir + opened.Info.FileName: opened.Encrypted,
+		"IntuneWinPackage/Metadata/readme.txt":      []byte("extra"),
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		w.Write(data)
+	}
+	zw.Close()
+	if err := os.WriteFile(badPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write package: %v", err)
+	}
+	var structureErr *StructureError
+	if _, err := VerifyFile(badPath, VerifyOptions{}); !errors.As(err, &structureErr) || len(structureErr.Problems) != 1 {
+		t.Errorf("Expected a StructureError, got %v", err)
+	}
+}
+
+func TestReadContentHeader(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-header-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	packagePath := createTestPackage(t, tempDir)
+	opened, err := Open(packagePath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	h, err := ReadContentHeader(packagePath)
+	if err != nil {
+		t.Fatalf("ReadContentHeader failed: %v", err)
+	}
+	if h.DetectionError != nil || len(h.Mismatches) != 0 {
+		t.Errorf("Unexpected problems: %v, %v", h.DetectionError, h.Mismatches)
+	}
+	size := opened.Info.UnencryptedContentSize
+	if !h.Aligned || h.Size != int64(len(opened.Encrypted)) || size < h.MinContentSize || size > h.MaxContentSize {
+		t.Errorf("Unexpected header for %d bytes of content: %+v", size, h)
+	}
+	if base64.StdEncoding.EncodeToString(h.Mac) != opened.Info.EncryptionInfo.Mac {
+		t.Error("Mac does not match Detection.xml")
+	}
+
+	// Without a readable Detection.xml the header is still read, and
+	// content that was cut is not aligned
+	badPath := filepath.Join(tempDir, "bad.intunewin")
+	writePackage(t, badPath, []byte("<ApplicationInfo"), opened.Info.FileName, opened.Encrypted[:len(opened.Encrypted)-5])
+	h, err = ReadContentHeader(badPath)
+	if err != nil {
+		t.Fatalf("ReadContentHeader failed: %v", err)
+	}
+	if h.DetectionError == nil || h.Aligned || !bytes.Equal(h.IV, opened.Encrypted[32:48]) {
+		t.Errorf("Unexpected header of a damaged package: %+v", h)
+	}
+
+	// The header is compared with Detection.xml
+	writePackage(t, badPath, opened.DetectionXML, opened.Info.FileName, opened.Encrypted[:len(opened.Encrypted)-16])
+	if h, err = ReadContentHeader(badPath); err != nil || len(h.Mismatches) != 1 {
+		t.Errorf("Expected a size mismatch, got %v, %v", h, err)
+	}
+}
+
+func TestRecoverWithKeys(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-recover-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	opened, err := Open(createTestPackage(t, tempDir))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	encInfo := opened.Info.EncryptionInfo
+	keysPath := filepath.Join(tempDir, "keys.json")
+	keysJSON := `{"encryptionKey":"` + encInfo.EncryptionKey + `","macKey":"` + encInfo.MacKey + `","fileDigest":"` + encInfo.FileDigest + `","fileDigestAlgorithm":"SHA256"}`
+	if err := os.WriteFile(keysPath, []byte(keysJSON), 0600); err != nil {
+		t.Fatalf("Failed to write keys: %v", err)
+	}
+	keys, err := LoadKeys(keysPath)
+	if err != nil {
+		t.Fatalf("LoadKeys failed: %v", err)
+	}
+
+	// A Detection.xml cut short keeps the package from being unpacked
+	damagedPath := filepath.Join(tempDir, "damaged.intunewin")
+	writePackage(t, damagedPath, opened.DetectionXML[:200], opened.Info.FileName, opened.Encrypted)
+	if _, _, err := Unpack(damagedPath, filepath.Join(tempDir, "bad")); err == nil {
+		t.Fatal("Expected damaged Detection.xml to fail")
+	}
+	files, err := UnpackWithKeys(damagedPath, filepath.Join(tempDir, "out"), keys, nil)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("UnpackWithKeys failed: %v, %v", files, err)
+	}
+
+	// Wrong keys fail on the HMAC
+	wrong := *keys
+	wrong.MacKey = base64.StdEncoding.EncodeToString(make([]byte, 32))
+	if _, err := UnpackWithKeys(damagedPath, filepath.Join(tempDir, "wrong"), &wrong, nil); err == nil || !strings.Contains(err.Error(), "HMAC") {
+		t.Errorf("Expected HMAC error for wrong keys, got %v", err)
+	}
+
+	// The regenerated Detection.xml makes a package that verifies
+	if _, err := Repair(damagedPath, keys, RepairOptions{}); err == nil {
+		t.Error("Expected error without a setup file")
+	}
+	detectionXML, err := Repair(damagedPath, keys, RepairOptions{SetupFile: "install.exe"})
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	repairedPath := filepath.Join(tempDir, "repaired.intunewin")
+	writePackage(t, repairedPath, detectionXML, metadata.EncryptedFileName, opened.Encrypted)
+	repaired, err := Open(repairedPath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := repaired.Verify(); err != nil {
+		t.Errorf("Repaired package does not verify: %v", err)
+	}
+	if repaired.Info.Name != "testapp" || repaired.Info.EncryptionInfo.FileDigest != encInfo.FileDigest {
+		t.Errorf("Unexpected repaired Detection.xml: %s, %s", repaired.Info.Name, repaired.Info.EncryptionInfo.FileDigest)
+	}
+
+	// A Detection.xml, e.g. recovered from escrow, is a keys file too
+	xmlPath := filepath.Join(tempDir, "Detection.xml")
+	if err := os.WriteFile(xmlPath, opened.DetectionXML, 0600); err != nil {
+		t.Fatalf("Failed to write Detection.xml: %v", err)
+	}
+	if fromXML, err := LoadKeys(xmlPath); err != nil || fromXML.UnencryptedContentSize != opened.Info.UnencryptedContentSize {
+		t.Errorf("LoadKeys failed for Detection.xml: %v", err)
+	}
+}
+
+// writePackage writes an outer ZIP with the given Detection.xml and
+// encrypted content
+func writePackage(t *testing.T, path string, detectionXML []byte, fileName string, encrypted []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range map[string][]byte{
+		metadata.DetectionXMLPath:       detectionXML,
+		metadata.ContentsDir + fileName: encrypted,
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close package: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write package: %v", err)
+	}
+}
+
+func TestTruncatedPackage(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-truncated-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Incompressible content, so that the encrypted content makes up most
+	// of the package
+	sourceDir := filepath.Join(tempDir, "testapp")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	content := make([]byte, 256<<10)
+	for i := range content {
+		content[i] = byte(i*7919 ^ i>>8)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "install.exe"), content, 0644); err != nil {
+		t.Fatalf("Failed to create setup file: %v", err)
+	}
+	packagePath, err := packager.New(packager.Options{
+		SourceDir: sourceDir,
+		SetupFile: "install.exe",
+		OutputDir: tempDir,
+		Quiet:     true,
+	}).CreatePackage()
+	if err != nil {
+		t.Fatalf("CreatePackage failed: %v", err)
+	}
+	data, err := os.ReadFile(packagePath)
+	if err != nil {
+		t.Fatalf("Failed to read package: %v", err)
+	}
+	pkg, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	expected := ExpectedEncryptedSize(pkg.Info.UnencryptedContentSize)
+
+	// Cut in the middle of the encrypted content
+	half := data[:len(data)/2]
+	_, err = Read(bytes.NewReader(half), int64(len(half)))
+	var truncated *TruncationError
+	if !errors.As(err, &truncated) {
+		t.Fatalf("Expected TruncationError, got %v", err)
+	}
+	if truncated.Section != metadata.ContentsDir+metadata.EncryptedFileName || truncated.Expected != expected ||
+		truncated.Present <= 0 || truncated.Present >= expected || truncated.Size != int64(len(half)) {
+		t.Errorf("Unexpected diagnosis: %+v (expected %d bytes)", truncated, expected)
+	}
+
+	// Cut in the central directory
+	short := data[:len(data)-30]
+	if _, err := Read(bytes.NewReader(short), int64(len(short))); !errors.As(err, &truncated) || truncated.Section != "central directory" {
+		t.Errorf("Expected truncated central directory, got %v", err)
+	}
+	// Not a ZIP at all
+	if _, err := Read(bytes.NewReader([]byte("not a zip")), 9); errors.As(err, &truncated) {
+		t.Errorf("Unexpected TruncationError for invalid data: %v", err)
+	}
+}
+
+func TestCheckStructure(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "intunewin-structure-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	built, err := Open(createTestPackage(t, tempDir))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if problems := built.CheckStructure(); len(problems) != 0 {
+		t.Errorf("Unexpected problems for a built package: %v", problems)
+	}
+
+	tests := []struct {
+		name    string
+		entries []string
+		problem string
+		fix     string
+	}{
+		{"backslashes", []string{`IntuneWinPackage\Metadata\Detection.xml`, "IntuneWinPackage/Contents/IntunePackage.intunewin"}, "uses backslashes", "forward slashes"},
+		{"casing", []string{"IntuneWinPackage/metadata/detection.xml", "IntuneWinPackage/Contents/IntunePackage.intunewin"}, "differs in case", "rename it to " + metadata.DetectionXMLPath},
+		{"extra entry", []string{metadata.DetectionXMLPath, "IntuneWinPackage/Contents/IntunePackage.intunewin", "readme.txt"}, "unexpected entry readme.txt", "remove it"},
+		{"misplaced", []string{"Metadata/Detection.xml", "IntuneWinPackage/Contents/IntunePackage.intunewin"}, "Detection.xml is at Metadata/Detection.xml", "move it"},
+		{"file name", []string{metadata.DetectionXMLPath, "IntuneWinPackage/Contents/setup.intunewin"}, "does not match the FileName element", "set FileName to setup.intunewin"},
+	}
+	for _, tt := range tests {
+		pkg := &Package{Info: built.Info, Entries: tt.entries}
+		problems := pkg.CheckStructure()
+		if len(problems) != 1 || !strings.Contains(problems[0].Problem, tt.problem) || !strings.Contains(problems[0].Fix, tt.fix) {
+			t.Errorf("%s: unexpected problems %v", tt.name, problems)
+		}
+	}
+
+	// Packages of other tools with backslashes, other casing or another
+	// content file name can still be read
+	for _, tt := range tests {
+		if tt.name == "misplaced" {
+			continue
+		}
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for _, name := range tt.entries {
+			data := built.Encrypted
+			if strings.HasSuffix(strings.ToLower(name), ".xml") {
+				data = built.DetectionXML
+			}
+			w, err := zw.Create(name)
+			if err != nil {
+				t.Fatalf("Failed to create %s: %v", name, err)
+			}
+			w.Write(data)
+		}
+		zw.Close()
+		pkg, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Errorf("%s: Read failed: %v", tt.name, err)
+			continue
+		}
+		if _, err := pkg.Decrypt(); err != nil {
+			t.Errorf("%s: Decrypt failed: %v", tt.name, err)
+		}
+	}
+
+	// Detection.xml twice
+	pkg := &Package{Info: built.Info, Entries: []string{metadata.DetectionXMLPath, metadata.DetectionXMLPath, metadata.ContentsDir + metadata.EncryptedFileName}}
+	if problems := pkg.CheckStructure(); len(problems) != 1 || !strings.Contains(problems[0].Problem, "present 2 times") {
+		t.Errorf("Unexpected problems for duplicate Detection.xml: %v", problems)
+	}
+}
+
+// zipOf returns a ZIP with the given entries, written with CreateRaw so
+// that their sizes can be forged
+func zipOf(t *testing.T, headers ...*zip.FileHeader) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, h := range headers {
+		w, err := zw.CreateRaw(h)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", h.Name, err)
+		}
+		w.Write(make([]byte, h.CompressedSize64))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close ZIP: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestLimits(t *testing.T) {
+	for _, name := range []string{"/etc/passwd", `C:\Windows\evil.dll`, `app\..\..\evil.txt`, "app/../../evil.txt", ".."} {
+		if _, err := ReadInnerZip(zipOf(t, &zip.FileHeader{Name: name})); !errors.Is(err, zip.ErrInsecurePath) {
+			t.Errorf("Expected ErrInsecurePath for entry name %s, got %v", name, err)
+		}
+	}
+	if _, err := ReadInnerZip(zipOf(t, &zip.FileHeader{Name: "app/..data/file.txt"})); err != nil {
+		t.Errorf("Unexpected error for a name starting with dots: %v", err)
+	}
+
+	// Zeros compress about 1000:1 and are accepted
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("app/zeros.bin")
+	w.Write(make([]byte, 8<<20))
+	zw.Close()
+	if _, err := ReadInnerZip(buf.Bytes()); err != nil {
+		t.Errorf("Unexpected error for compressed zeros: %v", err)
+	}
+
+	// A forged uncompressed size beyond the ratio is rejected
+	bomb := zipOf(t, &zip.FileHeader{Name: "app/bomb.bin", Method: zip.Deflate, CompressedSize64: 1 << 10, UncompressedSize64: 1 << 32})
+	var limitErr *LimitError
+	if _, err := ReadInnerZip(bomb); !errors.As(err, &limitErr) || limitErr.Limit != LimitRatio || limitErr.Entry != "app/bomb.bin" || limitErr.Value != 1<<22 {
+		t.Errorf("Expected ratio LimitError, got %v", err)
+	}
+	if _, err := Read(bytes.NewReader(bomb), int64(len(bomb))); err == nil || !strings.Contains(err.Error(), "ratio") {
+		t.Errorf("Expected ratio error for the outer ZIP, got %v", err)
+	}
+	// Small entries, as left by entries sharing compressed data, add up
+	// beyond the ratio
+	var headers []*zip.FileHeader
+	for i := 0; i < 200; i++ {
+		headers = append(headers, &zip.FileHeader{Name: "app/part" + strconv.Itoa(i), Method: zip.Deflate, CompressedSize64: 1, UncompressedSize64: 1 << 20})
+	}
+	if _, err := ReadInnerZip(zipOf(t, headers...)); !errors.As(err, &limitErr) || limitErr.Limit != LimitRatio || limitErr.Entry != "" {
+		t.Errorf("Expected ratio LimitError for the whole ZIP, got %v", err)
+	}
+
+	// Configured limits apply, with defaults for zero fields
+	few := zipOf(t, &zip.FileHeader{Name: "app/a"}, &zip.FileHeader{Name: "app/b"}, &zip.FileHeader{Name: "app/c"})
+	if _, err := (Limits{MaxEntries: 2}).ReadInnerZip(few); !errors.As(err, &limitErr) || limitErr.Limit != LimitEntries || limitErr.Value != 3 || limitErr.Max != 2 {
+		t.Errorf("Expected entries LimitError, got %v", err)
+	}
+	if _, err := (Limits{MaxExpandedSize: 1 << 20}).Extract(buf.Bytes(), t.TempDir()); !errors.As(err, &limitErr) || limitErr.Limit != LimitExpandedSize {
+		t.Errorf("Expected expanded size LimitError, got %v", err)
+	}
+	if _, err := (Limits{MaxRatio: 10}).ReadInnerZip(buf.Bytes()); !errors.As(err, &limitErr) || limitErr.Limit != LimitRatio {
+		t.Errorf("Expected ratio LimitError, got %v", err)
+	}
+	defaults := DefaultLimits
+	DefaultLimits.MaxEntries = 2
+	_, err := ReadInnerZip(few)
+	DefaultLimits = defaults
+	if !errors.As(err, &limitErr) || limitErr.Limit != LimitEntries {
+		t.Errorf("Expected DefaultLimits to apply, got %v", err)
+	}
+
+	// An oversized Detection.xml is not parsed
+	tempDir, err := os.MkdirTemp("", "intunewin-limits-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "large.intunewin")
+	writePackage(t, path, bytes.Repeat([]byte(" "), int(DefaultLimits.MaxDetectionXMLSize)+1), metadata.EncryptedFileName, []byte("content"))
+	if _, err := Open(path); !errors.As(err, &limitErr) || limitErr.Limit != LimitDetectionXMLSize {
+		t.Errorf("Expected Detection.xml LimitError, got %v", err)
+	}
+	if _, _, err := Unpack(path, filepath.Join(tempDir, "out")); !errors.As(err, &limitErr) || limitErr.Limit != LimitDetectionXMLSize {
+		t.Errorf("Expected Detection.xml LimitError, got %v", err)
+	}
+	if _, err := (Limits{MaxDetectionXMLSize: 2 << 20}).Open(path); errors.As(err, &limitErr) {
+		t.Errorf("Unexpected LimitError with a raised limit: %v", err)
+	}
+}
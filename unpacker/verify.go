@@ -0,0 +1,166 @@
+package unpacker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/MANCHTOOLS/open-package/crypto"
+	"github.com/MANCHTOOLS/open-package/metadata"
+)
+
+// VerifyMode selects how much of the content VerifyFile checks
+type VerifyMode int
+
+const (
+	// VerifyFull checks the HMAC and decrypts the content to check its
+	// size and digest, as Package.Verify does
+	VerifyFull VerifyMode = iota
+	// VerifyQuick only checks the HMAC of the encrypted content, which
+	// detects any change to it but not a Detection.xml with the wrong
+	// encryption key, size or digest
+	VerifyQuick
+)
+
+// String returns the name of the mode
+func (m VerifyMode) String() string {
+	if m == VerifyQuick {
+		return "quick"
+	}
+	return "full"
+}
+
+// verifyCheckpoint is the amount of encrypted content between two calls
+// of VerifyOptions.Progress
+const verifyCheckpoint = 16 << 20
+
+// VerifyProgress is a checkpoint of VerifyFile
+type VerifyProgress struct {
+	// Bytes and Total are the encrypted bytes checked so far and in total
+	Bytes int64
+	Total int64
+}
+
+// VerifyOptions configures VerifyFile
+type VerifyOptions struct {
+	// Mode selects the quick or the full check (default VerifyFull)
+	Mode VerifyMode
+	// Progress, if set, is called every 16 MiB of encrypted content and
+	// once it is read completely
+	Progress func(VerifyProgress)
+}
+
+// VerifyFile checks the package at path without holding its content in
+// memory: the structure of the outer ZIP, Detection.xml, the Mac and
+// InitializationVector against the header of the encrypted content and,
+// reading the content once, its HMAC and in VerifyFull mode its size and
+// digest. Structure problems are returned as a *StructureError before the
+// content is read. It returns the package without its encrypted content.
+func VerifyFile(path string, opts VerifyOptions) (*Package, error) {
+	return Limits{}.VerifyFile(path, opts)
+}
+
+// StructureError lists the problems of CheckStructure found by VerifyFile
+type StructureError struct {
+	Problems []StructureProblem
+}
+
+// Error summarizes the problems
+func (e *StructureError) Error() string {
+	if len(e.Problems) == 1 {
+		return "invalid package structure: " + e.Problems[0].String()
+	}
+	return fmt.Sprintf("invalid package structure: %d problems", len(e.Problems))
+}
+
+// verifyFile is VerifyFile with the limits of l
+func verifyFile(path string, opts VerifyOptions, l Limits) (*Package, error) {
+	zr, pkg, contents, err := openContent(path, l)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	if problems := pkg.CheckStructure(); len(problems) > 0 {
+		return nil, &StructureError{Problems: problems}
+	}
+	if err := metadata.Validate(pkg.Info); err != nil {
+		return nil, err
+	}
+	keys, err := pkg.keys()
+	if err != nil {
+		return nil, err
+	}
+	encInfo := pkg.Info.EncryptionInfo
+
+	rc, err := contents.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", contents.Name, err)
+	}
+	defer rc.Close()
+	r := bufio.NewReader(&progressReader{r: rc, total: int64(contents.UncompressedSize64), next: verifyCheckpoint, progress: opts.Progress})
+	header, err := r.Peek(crypto.HMACSize + crypto.IVSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", contents.Name, err)
+	}
+	if base64.StdEncoding.EncodeToString(header[:crypto.HMACSize]) != encInfo.Mac {
+		return nil, fmt.Errorf("encrypted content does not match the Mac in Detection.xml")
+	}
+	if base64.StdEncoding.EncodeToString(header[crypto.HMACSize:]) != encInfo.InitializationVector {
+		return nil, fmt.Errorf("encrypted content does not match the InitializationVector in Detection.xml")
+	}
+
+	if opts.Mode == VerifyQuick {
+		if _, err := crypto.VerifyStream(keys.macKey, r); err != nil {
+			return nil, err
+		}
+		return pkg, nil
+	}
+
+	digest, err := metadata.NewFileDigest(encInfo.FileDigestAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	size, err := crypto.DecryptStream(keys.encryptionKey, keys.macKey, r, digest)
+	if err != nil {
+		return nil, err
+	}
+	if size != pkg.Info.UnencryptedContentSize {
+		return nil, fmt.Errorf("size mismatch: Detection.xml declares %d bytes, decrypted %d bytes",
+			pkg.Info.UnencryptedContentSize, size)
+	}
+	if !bytes.Equal(digest.Sum(nil), keys.fileDigest) {
+		return nil, fmt.Errorf("file digest mismatch (%s)", digestName(encInfo.FileDigestAlgorithm))
+	}
+	return pkg, nil
+}
+
+// progressReader calls progress at every checkpoint of the bytes read
+// and at the end of r
+type progressReader struct {
+	r        io.Reader
+	total    int64
+	bytes    int64
+	next     int64
+	done     bool
+	progress func(VerifyProgress)
+}
+
+// Read reads from r and reports the checkpoints passed
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.bytes += int64(n)
+	if p.progress == nil || p.done {
+		return n, err
+	}
+	switch {
+	case err == io.EOF:
+		p.done = true
+		p.progress(VerifyProgress{Bytes: p.bytes, Total: p.total})
+	case p.bytes >= p.next:
+		p.progress(VerifyProgress{Bytes: p.bytes, Total: p.total})
+		p.next = p.bytes - p.bytes%verifyCheckpoint + verifyCheckpoint
+	}
+	return n, err
+}